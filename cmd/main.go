@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -19,7 +24,6 @@ import (
 	"github.com/dmawardi/Go-Template/internal/controller/core"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/email"
-	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/dmawardi/Go-Template/internal/modules"
 	"github.com/dmawardi/Go-Template/internal/queue"
@@ -37,8 +41,12 @@ import (
 // Init state
 var app config.AppConfig
 
-// Connect email service used in API setup to connect email services (forgot password, etc.)
-var connectEmailService = true
+// Time allowed for in-flight requests and jobs to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// QUEUE_DRIVER value used to keep jobs in memory instead of the database
+// (for lightweight deployments running a single instance, jobs are lost on restart)
+const queueDriverMemory = "memory"
 
 // API Details
 // @title           Go Template
@@ -61,8 +69,9 @@ var connectEmailService = true
 // @name Authorization
 
 func main() {
-	// Build context
-	ctx := context.Background()
+	// Build context (cancelled on SIGINT/SIGTERM to begin shutdown)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	// Set context in app config
 	app.Ctx = ctx
 	// Load env variables
@@ -96,6 +105,12 @@ func main() {
 	client := db.DbConnect(true)
 	// Set in state
 	app.DbClient = client
+	// Create a separate connection to the database for the job queue
+	// (not needed when jobs are kept in memory)
+	var queueClient *gorm.DB
+	if os.Getenv("QUEUE_DRIVER") != queueDriverMemory {
+		queueClient = db.DbConnect(false)
+	}
 
 	// Setup enforcer
 	e, err := auth.EnforcerSetup(client, true)
@@ -106,8 +121,27 @@ func main() {
 	app.Auth.Enforcer = e.Enforcer
 	app.Auth.Adapter = e.Adapter
 
-	// Setup new cache
-	app.Cache = &cache.CacheMap{}
+	// Setup new cache (in memory or Redis, selected using CACHE_DRIVER)
+	app.Cache, err = cache.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Set access and refresh token lifetimes (ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL)
+	err = auth.SetTokenLifetimesFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Load the keys signing access tokens (JWT_SIGNING_KEYS, or HMAC_SECRET if not set)
+	err = auth.LoadSigningKeysFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Load the secret signing unsubscribe links (EMAIL_UNSUBSCRIBE_SECRET)
+	err = email.LoadUnsubscribeSecretFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Set state in other packages
 	setAppState(&app, stateFuncs)
@@ -118,8 +152,8 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Create api
-	api := ApiSetup(client, connectEmailService)
+	// Create api (starts the job queue workers)
+	api, jobQueue := ApiSetup(client, queueClient)
 
 	fmt.Printf("Starting application: http://%s%s\n", serverUrl, portNumber)
 
@@ -129,31 +163,82 @@ func main() {
 		Handler: api.Routes(),
 	}
 
-	// Listen and serve using server settings above
-	err = srv.ListenAndServe()
+	// Listen and serve using server settings above (in background to allow shutdown)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	// Wait for a shutdown signal or for the server to fail
+	select {
+	case <-ctx.Done():
+		fmt.Println("Shutting down application...")
+	case err := <-serverErr:
+		log.Printf("Server error: %v\n", err)
+	}
+	// Cancel app context (stops the job queue workers)
+	stop()
+
+	shutdown(srv, jobQueue, client, queueClient)
+	// Stop the cache janitor or close the Redis connection
+	app.Cache.Close()
+}
+
+// Gracefully shuts down the server, job queue and database connections.
+// In-flight requests and jobs are given until the shutdown timeout to finish
+func shutdown(srv *http.Server, jobQueue queue.JobQueue, client, queueClient *gorm.DB) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting requests and wait for in-flight requests to finish
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Error shutting down server: %v\n", err)
+	}
+
+	// Wait for the workers to finish their current jobs
+	// (jobs still running after the timeout are released by the reaper once their lease expires)
+	err = jobQueue.Wait(shutdownCtx)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Job queue workers did not stop in time: %v\n", err)
+	}
+
+	// Close database connections
+	for _, dbClient := range []*gorm.DB{queueClient, client} {
+		if dbClient == nil {
+			continue
+		}
+		err = db.DbClose(dbClient)
+		if err != nil {
+			log.Printf("Error closing database connection: %v\n", err)
+		}
 	}
+	fmt.Println("Application stopped")
 }
 
 // Edit this to use the entire appconfig instead of just the client
 // Build API and store the services and repos in the config
-func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
-	var mail email.Email
-	// If connectEmail is true, use SMTP email
-	if connectEmail {
-		mail = email.NewSMTPEmail()
-	} else {
-		// Else, use email mock
-		mail = &helpers.EmailMock{}
+// Returns the API and the job queue (running on the queue client until app.Ctx is cancelled).
+// Jobs are kept in memory if no queue client is given
+func ApiSetup(client, queueClient *gorm.DB) (routes.Api, queue.JobQueue) {
+	// Email service (forgot password, etc.) using the driver set in EMAIL_DRIVER
+	mail, err := email.NewEmailFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Emails written by the file driver can be previewed in the admin panel
+	var outbox *email.Outbox
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("EMAIL_DRIVER")), email.DriverFile) {
+		outbox = email.NewOutbox(email.OutboxDirFromEnv())
 	}
 
-	// Create a separate connection to the database for the job queue
-	queueClient := db.DbConnect(false)
 	// Create job queue
-	jobQueue := queue.NewQueue(queueClient, mail)
-	// Establish async job processing
-	go jobQueue.Worker()
+	var jobQueue queue.JobQueue
+	if queueClient != nil {
+		jobQueue = queue.NewQueue(queueClient, mail)
+	} else {
+		jobQueue = queue.NewMemoryQueue(mail)
+	}
 
 	// Authorization
 	groupRepo := corerepositories.NewAuthPolicyRepository(client)
@@ -162,17 +247,76 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 
 	// user
 	userRepo := corerepositories.NewUserRepository(client)
-	userService := coreservices.NewUserService(userRepo, groupRepo, jobQueue)
+	refreshTokenRepo := corerepositories.NewRefreshTokenRepository(client)
+	twoFactorRepo := corerepositories.NewTwoFactorRepository(client)
+	userService := coreservices.NewUserService(userRepo, groupRepo, refreshTokenRepo, twoFactorRepo, jobQueue)
 	userController := core.NewUserController(userService)
+	// Register user jobs
+	for _, handler := range coreservices.NewUserJobHandlers(userService) {
+		queue.RegisterHandler(handler)
+	}
+	queue.RegisterSchedule(coreservices.PurgeVerificationCodesSchedule)
+	queue.RegisterSchedule(coreservices.PurgeRefreshTokensSchedule)
+	queue.RegisterSchedule(coreservices.PurgePasswordResetTokensSchedule)
+	// Purge finished jobs once their retention has passed
+	queue.RegisterSchedule(queue.PurgeJobsSchedule)
+	retentions, err := queue.ParseRetention(os.Getenv("JOB_RETENTION"))
+	if err != nil {
+		log.Printf("Error parsing JOB_RETENTION, using default retention: %v\n", err)
+	}
+	queue.SetRetention(retentions...)
 
 	// Action
 	actionRepo := corerepositories.NewActionRepository(client)
 	actionService := coreservices.NewActionService(actionRepo)
 	adminActionController := adminpanel.NewAdminActionController(actionService)
 
+	// Background jobs (admin panel only)
+	jobRepo := corerepositories.NewJobRepository(client)
+	// Jobs stored in the database are managed through the database queue (jobs kept in memory aren't listed)
+	jobManager, ok := jobQueue.(*queue.Queue)
+	if !ok {
+		jobManager = queue.NewQueue(client, mail)
+	}
+	jobService := coreservices.NewJobService(jobRepo, jobManager)
+	adminJobController := adminpanel.NewAdminJobController(jobService, actionService)
+
+	// Email log (records the delivery of emails sent by the job queue)
+	emailLogRepo := corerepositories.NewEmailLogRepository(client)
+	emailLogService := coreservices.NewEmailLogService(emailLogRepo, jobQueue)
+	jobQueue.SetEmailLogger(emailLogService)
+	emailLogRetention, err := time.ParseDuration(os.Getenv("EMAIL_LOG_RETENTION"))
+	if err != nil && os.Getenv("EMAIL_LOG_RETENTION") != "" {
+		log.Printf("Error parsing EMAIL_LOG_RETENTION, using default retention: %v\n", err)
+	}
+	for _, handler := range coreservices.NewEmailLogJobHandlers(emailLogService, emailLogRetention) {
+		queue.RegisterHandler(handler)
+	}
+	queue.RegisterSchedule(coreservices.PurgeEmailLogsSchedule)
+	adminEmailLogController := adminpanel.NewAdminEmailLogController(emailLogService, actionService)
+	// Email suppression list and preferences (checked before sending non-transactional emails)
+	emailSuppressionRepo := corerepositories.NewEmailSuppressionRepository(client)
+	emailPreferenceRepo := corerepositories.NewEmailPreferenceRepository(client)
+	emailSuppressionService := coreservices.NewEmailSuppressionService(emailSuppressionRepo, emailPreferenceRepo)
+	jobQueue.SetSuppressionList(emailSuppressionService)
+	emailController := core.NewEmailController(emailSuppressionService)
+	// API keys (integrations)
+	apiKeyRepo := corerepositories.NewApiKeyRepository(client)
+	apiKeyService := coreservices.NewApiKeyService(apiKeyRepo)
+	apiKeyController := core.NewApiKeyController(apiKeyService)
+
 	// Setup basic modules with new implementation (including admin controllers if available)
 	moduleMap := modules.SetupModules(modules.ModulesToSetup, client, actionService)
 
+	// Establish async job processing with the configured workers for each queue
+	// (started once all job handlers and schedules have been registered)
+	subscriptions, err := queue.ParseSubscriptions(os.Getenv("QUEUE_WORKERS"))
+	if err != nil {
+		log.Printf("Error parsing QUEUE_WORKERS, using default workers: %v\n", err)
+		subscriptions = nil
+	}
+	jobQueue.StartWorkers(app.Ctx, subscriptions...)
+
 	// Admin panel
 	//
 	// Create admin controller
@@ -182,6 +326,11 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 		adminpanel.NewAdminUserController(userService, actionService),
 		adminpanel.NewAdminAuthPolicyController(groupService),
 		adminActionController,
+		adminJobController,
+		adminpanel.NewAdminOutboxController(outbox),
+		adminEmailLogController,
+		adminpanel.NewAdminEmailSuppressionController(emailSuppressionService, actionService),
+		adminpanel.NewAdminApiKeyController(apiKeyService, actionService),
 		// ADD ADDITIONAL MODULES HERE
 		moduleMap,
 	)
@@ -190,7 +339,7 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 	adminpanel.GenerateAndSetAdminSidebar(adminController)
 
 	// Build API using controllers
-	api := routes.NewApi(adminController, userController, groupController,
+	api := routes.NewApi(adminController, userController, groupController, emailController, apiKeyController,
 		// Created modules contained in moduleMap
 		moduleMap,
 	)
@@ -209,8 +358,8 @@ func ApiSetup(client *gorm.DB, connectEmail bool) routes.Api {
 		Controller:      groupController,
 	}
 
-	// Return API (controllers)
-	return api
+	// Return API (controllers) and job queue
+	return api, jobQueue
 }
 
 // STATE MANAGEMENT
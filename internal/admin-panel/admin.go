@@ -24,6 +24,7 @@ func SetStateInAdminPanel(a *config.AppConfig) {
 	// Set header urls after setting state
 	header.HomeUrl = template.URL("http://" + app.BaseURL + "/admin/home")
 	header.ChangePasswordUrl = template.URL("http://" + app.BaseURL + "/admin/change-password")
+	header.TwoFactorUrl = template.URL("http://" + app.BaseURL + "/admin/two-factor")
 	header.LogOutUrl = template.URL("http://" + app.BaseURL + "/admin/logout")
 	header.ViewSiteUrl = template.URL("http://" + app.BaseURL + "/swagger/index.html")
 }
@@ -35,6 +36,11 @@ type AdminPanelController struct {
 	User AdminUserController
 	Auth AdminAuthPolicyController
 	Action AdminActionController
+	Job    AdminJobController
+	Outbox AdminOutboxController
+	EmailLog AdminEmailLogController
+	EmailSuppression models.BasicAdminController
+	ApiKey models.BasicAdminController
 	// Additional modules contained in module map
 	ModuleMap models.ModuleMap
 }
@@ -45,8 +51,13 @@ func NewAdminPanelController(
 							users AdminUserController, 
 							authPolicies AdminAuthPolicyController, 
 							action AdminActionController,
+							jobs AdminJobController,
+							outbox AdminOutboxController,
+							emailLogs AdminEmailLogController,
+							emailSuppressions models.BasicAdminController,
+							apiKeys models.BasicAdminController,
 							moduleMap models.ModuleMap) AdminPanelController {
-	return AdminPanelController{base, users, authPolicies, action, moduleMap}
+	return AdminPanelController{base, users, authPolicies, action, jobs, outbox, emailLogs, emailSuppressions, apiKeys, moduleMap}
 }
 
 
@@ -0,0 +1,249 @@
+package adminpanel
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	adminpanel "github.com/dmawardi/Go-Template/internal/helpers/adminPanel"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+// Format of the expiry date in the create form
+const apiKeyExpiryFormat = "2006-01-02"
+
+// API keys of every user can be viewed and deleted (which revokes them).
+// Keys created in the admin panel belong to the logged in user, and are only shown once
+func NewAdminApiKeyController(service coreservices.ApiKeyService, actionService webapi.ActionService) models.BasicAdminController {
+	adminHomeUrl := "/admin/api-keys"
+	return &adminApiKeyController{
+		service:       service,
+		actionService: actionService,
+		BasicAdminController: &basicAdminController[db.ApiKey, models.CreateApiKey, models.UpdateApiKey]{
+			Service:       service,
+			ActionService: actionService,
+			// Use values from above
+			AdminHomeUrl:         adminHomeUrl,
+			SchemaName:           "API Key",
+			PluralSchemaName:     "API Keys",
+			ConditionQueryParams: map[string]string{"name": "string", "prefix": "string"},
+			readOnly:             true,
+			tableHeaders: []TableHeader{
+				{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+				{Label: "Name", ColumnSortLabel: "name", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "UserID", ColumnSortLabel: "user_id", Pointer: false, DataType: "int", Sortable: true},
+				{Label: "Prefix", ColumnSortLabel: "prefix", Pointer: false, DataType: "string", Sortable: false},
+				{Label: "ExpiresAt", ColumnSortLabel: "expires_at", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "LastUsedAt", ColumnSortLabel: "last_used_at", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "CreatedAt", ColumnSortLabel: "created_at", Pointer: false, DataType: "string", Sortable: true},
+			},
+			generateEditForm: func() []FormField {
+				return []FormField{
+					{DbLabel: "Name", Label: "Name", Name: "name", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "UserID", Label: "Owner (User ID)", Name: "user_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Prefix", Label: "Key Starts With", Name: "prefix", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Scopes", Label: "Scopes", Name: "scopes", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "ExpiresAt", Label: "Expires At", Name: "expires_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "LastUsedAt", Label: "Last Used At", Name: "last_used_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+				}
+			},
+			rowActions: func(key db.ApiKey) []RowAction {
+				return []RowAction{
+					{Label: "Delete", Url: fmt.Sprintf("%s/delete/%d", adminHomeUrl, key.ID)},
+				}
+			},
+			newEmptySchema: func(params ...uint) *db.ApiKey {
+				// If there is a parameter
+				if len(params) > 0 {
+					return &db.ApiKey{ID: params[0]}
+				}
+				return &db.ApiKey{}
+			},
+			getIDFromSchema: func(schema *db.ApiKey) uint {
+				return schema.ID
+			},
+		},
+	}
+}
+
+type adminApiKeyController struct {
+	// List, view and delete pages (Create is replaced below)
+	models.BasicAdminController
+	service       coreservices.ApiKeyService
+	actionService webapi.ActionService
+}
+
+// Creates an API key for the logged in user (GET form / POST form). The key is shown once created
+func (c adminApiKeyController) Create(w http.ResponseWriter, r *http.Request) {
+	details := c.ObtainUrlDetails()
+	createForm := generateApiKeyCreateForm()
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		tokenData, err := auth.ValidateAndParseToken(r)
+		if err != nil {
+			http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+			return
+		}
+		userId, err := strconv.Atoi(tokenData.UserID)
+		if err != nil {
+			http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+			return
+		}
+		// Keys could otherwise be used to create keys with more scopes than their own
+		if tokenData.ApiKeyID != 0 {
+			http.Error(w, "API keys can't create API keys", http.StatusForbidden)
+			return
+		}
+		// Extract form submission
+		formFieldMap, err := adminpanel.ParseFormToMap(r)
+		if err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+
+		toValidate, fieldErrors := prepareSubmittedApiKeyForCreation(formFieldMap)
+		// Validate struct
+		pass, valErrors := request.GoValidateStruct(toValidate)
+		if pass && len(fieldErrors) == 0 {
+			toValidate.UserID = uint(userId)
+			created, err := c.service.Create(toValidate)
+			if err == nil {
+				// Record action (without the key)
+				err = c.actionService.RecordBulkAction(r, details.SchemaName, []int{int(created.ID)}, &models.RecordedAction{
+					ActionType: "create",
+					EntityType: details.SchemaName,
+					EntityID:   fmt.Sprint(created.ID),
+				}, fmt.Sprintf("Created API key %q (%s...)", created.Name, created.Prefix))
+				if err != nil {
+					fmt.Printf("Error recording action: %s", err)
+				}
+				c.renderCreatedApiKey(w, created)
+				return
+			}
+			// Scopes that aren't permissions of the user and past expiries are shown on their field
+			switch {
+			case errors.Is(err, coreservices.ErrInvalidApiKeyScope):
+				fieldErrors["scopes"] = err.Error()
+			case errors.Is(err, coreservices.ErrInvalidApiKeyExpiry):
+				fieldErrors["expires_at"] = err.Error()
+			default:
+				fmt.Println("Error creating API key: ", err)
+				http.Error(w, fmt.Sprintf("Error creating %s", details.SchemaName), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// If validation fails
+		// Populate form field errors
+		SetValidationErrorsInForm(createForm, *valErrors)
+		for i, field := range createForm {
+			if message, ok := fieldErrors[field.Name]; ok {
+				createForm[i].Errors = append(createForm[i].Errors, ErrorMessage(message))
+			}
+		}
+		// Populate previously entered values
+		err = populateFormValuesWithSubmittedFormMap(&createForm, formFieldMap)
+		if err != nil {
+			http.Error(w, "Error populating form", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Render page data
+	data := GenerateCreateRenderData(createForm, details.SchemaName, details.PluralSchemaName, details.AdminHomeUrl)
+	data.SectionDetail = template.HTML(fmt.Sprintf(`<p>The key will belong to you. Enter one scope per line: an action (%s) and a path, eg. <code>read /api/posts</code>. Paths can use wildcards as in permissions (eg. <code>/api/posts/*</code>), and every scope must be one of your permissions.</p>`,
+		strings.Join(auth.ApiKeyActions, ", ")))
+	// Show the submit button
+	data.PageType = PageType{EditPage: true}
+
+	// Execute the template with data and write to response
+	err := app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Shows a created API key. It can't be shown again, as only its hash is stored
+func (c adminApiKeyController) renderCreatedApiKey(w http.ResponseWriter, created *db.ApiKey) {
+	details := c.ObtainUrlDetails()
+	err := app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", PageRenderData{
+		PageTitle:     "Create " + details.SchemaName,
+		SectionTitle:  fmt.Sprintf("%s Created", details.SchemaName),
+		SectionDetail: template.HTML(`<p>Copy the key now, it won't be shown again. Send it as <code>Authorization: ApiKey &lt;key&gt;</code>.</p>`),
+		SchemaHome:    details.AdminHomeUrl,
+		PageType: PageType{
+			ViewPage: true,
+		},
+		FormData: FormData{
+			FormFields: []FormField{
+				{Label: "Name", Name: "name", Value: created.Name, Type: "text", Disabled: true},
+				{Label: "Key", Name: "key", Value: created.Key, Type: "code", Disabled: true},
+				{Label: "Scopes", Name: "scopes", Value: created.ObtainValue("Scopes"), Type: "code", Disabled: true},
+				{Label: "Expires At", Name: "expires_at", Value: created.ObtainValue("ExpiresAt"), Type: "text", Disabled: true},
+			},
+		},
+		HeaderSection: header,
+		SidebarList:   sidebar,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Form to create an API key
+func generateApiKeyCreateForm() []FormField {
+	return []FormField{
+		{DbLabel: "Name", Label: "Name", Name: "name", Placeholder: "eg. CI deployments", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "Scopes", Label: "Scopes", Name: "scopes", Placeholder: "read /api/posts", Value: "", Type: "textarea", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "ExpiresAt", Label: "Expires On (optional)", Name: "expires_at", Placeholder: "", Value: "", Type: "date", Required: false, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
+
+// Converts the submitted create form to a struct for validation/creation.
+// Returns the errors of fields that can't be parsed (by field name)
+func prepareSubmittedApiKeyForCreation(formFieldMap map[string]string) (*models.CreateApiKey, map[string]string) {
+	fieldErrors := map[string]string{}
+	toValidate := models.CreateApiKey{
+		Name:   formFieldMap["name"],
+		Scopes: parseApiKeyScopes(formFieldMap["scopes"]),
+	}
+	if expiry := strings.TrimSpace(formFieldMap["expires_at"]); expiry != "" {
+		expiresAt, err := time.Parse(apiKeyExpiryFormat, expiry)
+		if err != nil {
+			fieldErrors["expires_at"] = "Invalid date"
+		} else {
+			toValidate.ExpiresAt = &expiresAt
+		}
+	}
+	return &toValidate, fieldErrors
+}
+
+// Parses scopes entered one per line (eg. "read /api/posts")
+func parseApiKeyScopes(value string) []db.ApiKeyScope {
+	scopes := []db.ApiKeyScope{}
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		scope := db.ApiKeyScope{Action: fields[0]}
+		if len(fields) > 1 {
+			scope.Object = strings.Join(fields[1:], " ")
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
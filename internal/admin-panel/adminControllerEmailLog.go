@@ -0,0 +1,153 @@
+package adminpanel
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Email log entries are recorded by the job queue, so they can only be viewed, resent and deleted
+func NewAdminEmailLogController(service coreservices.EmailLogService, actionService webapi.ActionService) AdminEmailLogController {
+	adminHomeUrl := "/admin/email-logs"
+	return &adminEmailLogController{
+		service:       service,
+		actionService: actionService,
+		BasicAdminController: &basicAdminController[db.EmailLog, models.CreateEmailLog, models.UpdateEmailLog]{
+			Service:       service,
+			ActionService: actionService,
+			// Use values from above
+			AdminHomeUrl:         adminHomeUrl,
+			SchemaName:           "Email Log",
+			PluralSchemaName:     "Email Logs",
+			ConditionQueryParams: map[string]string{"recipients": "string", "subject": "string", "template": "string", "category": "string", "status": "string"},
+			readOnly:             true,
+			tableHeaders: []TableHeader{
+				{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+				{Label: "Recipients", ColumnSortLabel: "recipients", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "Subject", ColumnSortLabel: "subject", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "Template", ColumnSortLabel: "template", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "Status", ColumnSortLabel: "status", Pointer: false, DataType: "string", Sortable: true},
+				{Label: "Attempts", ColumnSortLabel: "attempts", Pointer: false, DataType: "int", Sortable: true},
+				{Label: "SentAt", ColumnSortLabel: "sent_at", Pointer: false, DataType: "string", Sortable: true},
+			},
+			generateEditForm: func() []FormField {
+				return []FormField{
+					{DbLabel: "Recipients", Label: "Recipients", Name: "recipients", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Subject", Label: "Subject", Name: "subject", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Template", Label: "Template", Name: "template", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Category", Label: "Category", Name: "category", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "JobID", Label: "Job ID", Name: "job_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Status", Label: "Status", Name: "status", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Attempts", Label: "Attempts", Name: "attempts", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "Response", Label: "Mail Server Response", Name: "response", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "SentAt", Label: "Sent At", Name: "sent_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+					{DbLabel: "UpdatedAt", Label: "Updated At", Name: "updated_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+				}
+			},
+			rowActions: func(emailLog db.EmailLog) []RowAction {
+				return []RowAction{
+					{Label: "Resend", Url: fmt.Sprintf("%s/resend/%d", adminHomeUrl, emailLog.ID)},
+					{Label: "Delete", Url: fmt.Sprintf("%s/delete/%d", adminHomeUrl, emailLog.ID)},
+				}
+			},
+			newEmptySchema: func(params ...uint) *db.EmailLog {
+				// If there is a parameter
+				if len(params) > 0 {
+					return &db.EmailLog{ID: params[0]}
+				}
+				return &db.EmailLog{}
+			},
+			getIDFromSchema: func(schema *db.EmailLog) uint {
+				return schema.ID
+			},
+		},
+	}
+}
+
+type adminEmailLogController struct {
+	// List, view and delete pages
+	models.BasicAdminController
+	service       coreservices.EmailLogService
+	actionService webapi.ActionService
+}
+
+type AdminEmailLogController interface {
+	models.BasicAdminController
+	// Queues the logged email to be sent again (GET confirmation / POST resend)
+	Resend(w http.ResponseWriter, r *http.Request)
+	ResendSuccess(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminEmailLogController) Resend(w http.ResponseWriter, r *http.Request) {
+	details := c.ObtainUrlDetails()
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", details.SchemaName), http.StatusNotFound)
+		return
+	}
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		err = c.service.Resend(idParameter)
+		if err != nil {
+			if errors.Is(err, coreservices.ErrEmailNotResendable) {
+				serveAdminError(w, fmt.Sprintf("Unable to resend %s %s: the message wasn't recorded (the bodies of account emails aren't stored)", details.SchemaName, stringParameter))
+				return
+			}
+			http.Error(w, "Error queuing email", http.StatusInternalServerError)
+			return
+		}
+
+		// Record action
+		err = c.recordResend(r, found)
+		if err != nil {
+			fmt.Printf("Error recording action: %s", err)
+		}
+
+		// Redirect to success page
+		http.Redirect(w, r, fmt.Sprintf("%s/resend/success", details.AdminHomeUrl), http.StatusSeeOther)
+		return
+	}
+
+	data := GenerateConfirmRenderData(details.SchemaName, details.AdminHomeUrl,
+		fmt.Sprintf("%s/resend/%s", details.AdminHomeUrl, stringParameter),
+		fmt.Sprintf("Are you sure you wish to resend \"%s\" to %s?", found.Subject, found.Recipients),
+		"Resend")
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Success handlers
+func (c adminEmailLogController) ResendSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, "Resend Email", "Email Queued To Be Resent!")
+}
+
+// Records the resend in the recorded actions
+func (c adminEmailLogController) recordResend(r *http.Request, found *db.EmailLog) error {
+	return c.actionService.RecordBulkAction(r, c.ObtainUrlDetails().SchemaName, []int{int(found.ID)}, &models.RecordedAction{
+		ActionType: "resend",
+		EntityType: c.ObtainUrlDetails().SchemaName,
+		EntityID:   fmt.Sprint(found.ID),
+	}, fmt.Sprintf("Resent email %q to %s", found.Subject, found.Recipients))
+}
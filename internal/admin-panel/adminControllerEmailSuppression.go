@@ -0,0 +1,70 @@
+package adminpanel
+
+import (
+	"github.com/dmawardi/Go-Template/internal/db"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+// Addresses on the suppression list don't receive non-transactional emails. Deleting an entry removes the address from the list
+func NewAdminEmailSuppressionController(service coreservices.EmailSuppressionService, actionService webapi.ActionService) models.BasicAdminController {
+	return &basicAdminController[db.EmailSuppression, models.CreateEmailSuppression, models.UpdateEmailSuppression]{
+		Service:       service,
+		ActionService: actionService,
+		// Use values from above
+		AdminHomeUrl:         "/admin/email-suppressions",
+		SchemaName:           "Email Suppression",
+		PluralSchemaName:     "Email Suppressions",
+		ConditionQueryParams: map[string]string{"email": "string", "reason": "string"},
+		tableHeaders: []TableHeader{
+			{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+			{Label: "Email", ColumnSortLabel: "email", Pointer: false, DataType: "string", Sortable: true},
+			{Label: "Reason", ColumnSortLabel: "reason", Pointer: false, DataType: "string", Sortable: true},
+			{Label: "Detail", ColumnSortLabel: "detail", Pointer: false, DataType: "string", Sortable: false},
+			{Label: "CreatedAt", ColumnSortLabel: "created_at", Pointer: false, DataType: "string", Sortable: true},
+		},
+		generateCreateForm: func() []FormField {
+			return []FormField{
+				{DbLabel: "Email", Label: "Email", Name: "email", Placeholder: "", Value: "", Type: "email", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+				{DbLabel: "Reason", Label: "Reason", Name: "reason", Placeholder: "", Value: "", Type: "select", Required: true, Disabled: false, Errors: []ErrorMessage{}, Selectors: SuppressionReasonSelection()},
+				{DbLabel: "Detail", Label: "Detail", Name: "detail", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
+			}
+		},
+		generateEditForm: func() []FormField {
+			return []FormField{
+				{DbLabel: "Email", Label: "Email", Name: "email", Placeholder: "", Value: "", Type: "email", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+				{DbLabel: "Reason", Label: "Reason", Name: "reason", Placeholder: "", Value: "", Type: "select", Required: true, Disabled: false, Errors: []ErrorMessage{}, Selectors: SuppressionReasonSelection()},
+				{DbLabel: "Detail", Label: "Detail", Name: "detail", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
+				{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+			}
+		},
+		prepareSubmittedFormForCreation: func(formFieldMap map[string]string) (*models.CreateEmailSuppression, error) {
+			// Convert submitted form field map to struct for validation/creation
+			toValidate := models.CreateEmailSuppression{
+				Email:  formFieldMap["email"],
+				Reason: formFieldMap["reason"],
+				Detail: formFieldMap["detail"],
+			}
+			return &toValidate, nil
+		},
+		prepareSubmittedFormForUpdate: func(formFieldMap map[string]string) (*models.UpdateEmailSuppression, error) {
+			// Convert submitted form field map to struct for validation/update
+			toValidate := models.UpdateEmailSuppression{
+				Reason: formFieldMap["reason"],
+				Detail: formFieldMap["detail"],
+			}
+			return &toValidate, nil
+		},
+		newEmptySchema: func(params ...uint) *db.EmailSuppression {
+			// If there is a parameter
+			if len(params) > 0 {
+				return &db.EmailSuppression{ID: params[0]}
+			}
+			return &db.EmailSuppression{}
+		},
+		getIDFromSchema: func(schema *db.EmailSuppression) uint {
+			return schema.ID
+		},
+	}
+}
@@ -0,0 +1,509 @@
+package adminpanel
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Table headers to show on find all page
+var jobTableHeaders = []TableHeader{
+	{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "JobType", ColumnSortLabel: "job_type", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Queue", ColumnSortLabel: "queue", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Priority", ColumnSortLabel: "priority", Pointer: false, DataType: "int", Sortable: true},
+	{Label: "Status", ColumnSortLabel: "status", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "Attempts", ColumnSortLabel: "attempts", Pointer: false, DataType: "string", Sortable: true},
+	{Label: "LastError", ColumnSortLabel: "last_error", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "NextRunAt", ColumnSortLabel: "next_run_at", Pointer: false, DataType: "string", Sortable: true},
+}
+
+// Statuses available in the status filter
+var jobStatuses = []string{db.JobStatusPending, db.JobStatusWaiting, db.JobStatusRunning, db.JobStatusFailed, db.JobStatusProcessed, db.JobStatusDead, db.JobStatusCancelled}
+
+func NewAdminJobController(service coreservices.JobService, actionService webapi.ActionService) AdminJobController {
+	return &adminJobController{
+		service:       service,
+		actionService: actionService,
+		// Use values from above
+		adminHomeUrl:     "/admin/jobs",
+		schemaName:       "Job",
+		pluralSchemaName: "Jobs",
+		tableHeaders:     jobTableHeaders,
+	}
+}
+
+type adminJobController struct {
+	service       coreservices.JobService
+	actionService webapi.ActionService
+	// For links
+	adminHomeUrl string
+	// For HTML text rendering
+	schemaName       string
+	pluralSchemaName string
+	// Custom table headers
+	tableHeaders []TableHeader
+}
+
+type AdminJobController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	View(w http.ResponseWriter, r *http.Request)
+	// Single job actions (GET confirmation / POST to apply)
+	Retry(w http.ResponseWriter, r *http.Request)
+	Cancel(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	// Bulk actions (from table)
+	BulkRetry(w http.ResponseWriter, r *http.Request)
+	BulkCancel(w http.ResponseWriter, r *http.Request)
+	BulkDelete(w http.ResponseWriter, r *http.Request)
+	// Success pages
+	RetrySuccess(w http.ResponseWriter, r *http.Request)
+	CancelSuccess(w http.ResponseWriter, r *http.Request)
+	DeleteSuccess(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminJobController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab query parameters
+	searchQuery := r.URL.Query().Get("search")
+	// Grab basic query params
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Generate query params to extract
+	queryParamsToExtract := core.JobConditionQueryParams()
+	// Extract query params
+	extractedConditionParams, err := request.ExtractSearchAndConditionParams(r, queryParamsToExtract)
+	if err != nil {
+		fmt.Println("Error extracting conditions: ", err)
+		http.Error(w, "Can't find conditions", http.StatusBadRequest)
+		return
+	}
+	// Extract filters
+	filter := models.JobFilter{
+		Status:  r.URL.Query().Get("status"),
+		JobType: r.URL.Query().Get("job_type"),
+		Queue:   r.URL.Query().Get("queue"),
+	}
+
+	// Grab all items
+	found, err := c.service.FindAll(baseQueryParams.Limit, baseQueryParams.Offset, baseQueryParams.Order, extractedConditionParams, filter)
+	if err != nil {
+		http.Error(w, "Error finding data", http.StatusInternalServerError)
+		return
+	}
+	// Convert data to AdminPanelSchema
+	schemaSlice := *found.Data
+	var adminSchemaSlice []models.AdminPanelSchema
+	for _, item := range schemaSlice {
+		// Append to schemaSlice
+		adminSchemaSlice = append(adminSchemaSlice, item)
+	}
+
+	// Build the table data
+	tableData := BuildTableData(adminSchemaSlice, found.Meta, c.adminHomeUrl, c.tableHeaders, false)
+	// Add the actions available for each job based on its status
+	for i, job := range schemaSlice {
+		tableData.TableRows[i].Edit.ExtraActions = c.rowActions(job)
+	}
+	tableData.BulkActions = []FormFieldSelector{
+		{Value: "retry", Label: "Retry selected jobs"},
+		{Value: "cancel", Label: "Cancel selected jobs"},
+		{Value: "delete", Label: "Delete selected jobs"},
+	}
+
+	// Generate Find All page render data
+	data := GenerateFindAllRenderData(tableData, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, searchQuery)
+	data.SectionTitle = fmt.Sprintf("Select a %s to view", c.schemaName)
+	data.TableFilters = c.generateFilters(filter)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminJobController) View(w http.ResponseWriter, r *http.Request) {
+	// Init new view form
+	viewForm := c.generateViewForm()
+
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Search for by ID and store in found
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// Populate form fields with job values
+	currentData := map[string]string{}
+	for _, field := range viewForm {
+		currentData[field.DbLabel] = found.ObtainValue(field.DbLabel)
+	}
+	// Show the decoded payload
+	currentData["Payload"] = formatJobPayload(found.Payload)
+	err = populateValuessWithDBData(&viewForm, currentData)
+	if err != nil {
+		http.Error(w, "Error generating form", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData(viewForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, false)
+	data.PageTitle = fmt.Sprintf("%s: %s", c.schemaName, stringParameter)
+	data.SectionTitle = fmt.Sprintf("%s %s (%s)", c.schemaName, stringParameter, found.JobType)
+	// Show links to the actions available for the job
+	data.SectionDetail = c.actionLinks(*found)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminJobController) Retry(w http.ResponseWriter, r *http.Request) {
+	c.updateJob(w, r, "retry", "Retry", c.service.Retry)
+}
+
+func (c adminJobController) Cancel(w http.ResponseWriter, r *http.Request) {
+	c.updateJob(w, r, "cancel", "Cancel", c.service.Cancel)
+}
+
+func (c adminJobController) Delete(w http.ResponseWriter, r *http.Request) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		// Find job for change log
+		found, err := c.service.FindById(idParameter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+			return
+		}
+		// Delete job (running jobs can't be deleted)
+		err = c.service.Delete(idParameter)
+		if err != nil {
+			if errors.Is(err, coreservices.ErrJobNotDeletable) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Error deleting %s", c.schemaName), http.StatusInternalServerError)
+			return
+		}
+
+		// Record action
+		err = c.actionService.RecordAction(r, c.schemaName, uint(idParameter), &models.RecordedAction{
+			ActionType: "delete",
+			EntityType: c.schemaName,
+			EntityID:   stringParameter,
+		}, helpers.ChangeLogInput{OldObj: found, NewObj: &db.Job{}})
+		if err != nil {
+			fmt.Printf("Error recording action: %s", err)
+		}
+
+		// Redirect to success page
+		http.Redirect(w, r, fmt.Sprintf("%s/delete/success", c.adminHomeUrl), http.StatusSeeOther)
+		return
+	}
+
+	data := GenerateDeleteRenderData(c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminJobController) BulkRetry(w http.ResponseWriter, r *http.Request) {
+	c.bulkUpdateJobs(w, r, "bulk-retry", c.service.BulkRetry)
+}
+
+func (c adminJobController) BulkCancel(w http.ResponseWriter, r *http.Request) {
+	c.bulkUpdateJobs(w, r, "bulk-cancel", c.service.BulkCancel)
+}
+
+func (c adminJobController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Grab body of request
+	// Init
+	var listOfIds BulkDeleteRequest
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+
+	// Prepare response
+	bulkResponse := models.BulkDeleteResponse{
+		// Set deleted records to length of selected items
+		DeletedRecords: len(listOfIds.SelectedItems),
+		Errors:         []error{},
+	}
+
+	// Convert string slice to int slice
+	intIdList, err := data.ConvertStringSliceToIntSlice(listOfIds.SelectedItems)
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Bulk Delete
+	err = c.service.BulkDelete(intIdList)
+	// If error detected send error response
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Record Bulk delete
+	err = c.actionService.RecordBulkDelete(r, c.schemaName, c.pluralSchemaName, intIdList, &models.RecordedAction{
+		ActionType: "bulk-delete",
+		EntityType: c.schemaName,
+		EntityID:   fmt.Sprint(intIdList),
+	})
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+	// else if successful
+	bulkResponse.Success = true
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Success handlers
+func (c adminJobController) RetrySuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Retry %s", c.schemaName), fmt.Sprintf("%s Queued For Retry!", c.schemaName))
+}
+func (c adminJobController) CancelSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Cancel %s", c.schemaName), fmt.Sprintf("%s Cancelled Successfully!", c.schemaName))
+}
+func (c adminJobController) DeleteSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, fmt.Sprintf("Delete %s", c.schemaName), fmt.Sprintf("%s Deleted Successfully!", c.schemaName))
+}
+
+// Helpers
+//
+// Shows a confirmation page (GET) or applies a status change to a single job (POST)
+// eg. action: "retry", label: "Retry"
+func (c adminJobController) updateJob(w http.ResponseWriter, r *http.Request, action, label string, apply func(int) (*db.Job, error)) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+	// Find current job (used for change log)
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		updated, err := apply(idParameter)
+		if err != nil {
+			// Show reason if the job's status doesn't allow the change
+			if errors.Is(err, coreservices.ErrJobNotRetryable) || errors.Is(err, coreservices.ErrJobNotCancellable) {
+				serveAdminError(w, fmt.Sprintf("Unable to %s %s %s: %s", action, c.schemaName, stringParameter, found.Status))
+				return
+			}
+			http.Error(w, fmt.Sprintf("Error updating %s", c.schemaName), http.StatusInternalServerError)
+			return
+		}
+
+		// Record action
+		err = c.actionService.RecordAction(r, c.schemaName, uint(idParameter), &models.RecordedAction{
+			ActionType: "update",
+			EntityType: c.schemaName,
+			EntityID:   stringParameter,
+		}, helpers.ChangeLogInput{OldObj: found, NewObj: updated})
+		if err != nil {
+			fmt.Printf("Error recording action: %s", err)
+		}
+
+		// Redirect to success page
+		http.Redirect(w, r, fmt.Sprintf("%s/%s/success", c.adminHomeUrl, action), http.StatusSeeOther)
+		return
+	}
+
+	data := GenerateConfirmRenderData(c.schemaName, c.adminHomeUrl,
+		fmt.Sprintf("%s/%s/%s", c.adminHomeUrl, action, stringParameter),
+		fmt.Sprintf("Are you sure you wish to %s %s: %s (%s)?", action, c.schemaName, stringParameter, found.JobType),
+		label)
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Applies a status change to the selected jobs and responds with the number of jobs updated
+func (c adminJobController) bulkUpdateJobs(w http.ResponseWriter, r *http.Request, action string, apply func([]int) (int64, error)) {
+	// Grab body of request
+	var listOfIds BulkDeleteRequest
+	// Prepare response
+	bulkResponse := models.BulkUpdateResponse{
+		Errors: []error{},
+	}
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+
+	// Convert string slice to int slice
+	intIdList, err := data.ConvertStringSliceToIntSlice(listOfIds.SelectedItems)
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Apply the change (jobs with a status that doesn't allow it are skipped)
+	updated, err := apply(intIdList)
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Record bulk action
+	err = c.actionService.RecordBulkAction(r, c.schemaName, intIdList, &models.RecordedAction{
+		ActionType: action,
+		EntityType: c.schemaName,
+		EntityID:   fmt.Sprint(intIdList),
+	}, fmt.Sprintf("Applied %s to %d of %d %s: %v", action, updated, len(intIdList), c.pluralSchemaName, intIdList))
+	if err != nil {
+		fmt.Printf("Error recording action: %s", err)
+	}
+
+	bulkResponse.Success = true
+	bulkResponse.UpdatedRecords = updated
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Builds the links to the actions available for a job based on its status
+func (c adminJobController) rowActions(job db.Job) []RowAction {
+	var actions []RowAction
+	if coreservices.JobCanBeRetried(job) {
+		actions = append(actions, RowAction{Label: "Retry", Url: fmt.Sprintf("%s/retry/%d", c.adminHomeUrl, job.ID)})
+	}
+	if coreservices.JobCanBeCancelled(job) {
+		actions = append(actions, RowAction{Label: "Cancel", Url: fmt.Sprintf("%s/cancel/%d", c.adminHomeUrl, job.ID)})
+	}
+	// Running jobs can't be deleted from the table as a worker holds them
+	if job.Status != db.JobStatusRunning {
+		actions = append(actions, RowAction{Label: "Delete", Url: fmt.Sprintf("%s/delete/%d", c.adminHomeUrl, job.ID)})
+	}
+	return actions
+}
+
+// Renders the row actions as links for the view page
+func (c adminJobController) actionLinks(job db.Job) template.HTML {
+	return rowActionLinks(c.rowActions(job))
+}
+
+// Builds the status and job type filters for the find all page
+func (c adminJobController) generateFilters(filter models.JobFilter) []FormField {
+	// Status selector
+	statusSelector := []FormFieldSelector{{Value: "", Label: "All"}}
+	for _, status := range jobStatuses {
+		statusSelector = append(statusSelector, FormFieldSelector{Value: status, Label: status})
+	}
+	setDefaultSelected(statusSelector, filter.Status)
+
+	// Job type selector (built from the job types stored)
+	typeSelector := []FormFieldSelector{{Value: "", Label: "All"}}
+	jobTypes, err := c.service.FindJobTypes()
+	if err != nil {
+		fmt.Printf("Error finding job types: %v\n", err)
+	}
+	for _, jobType := range jobTypes {
+		typeSelector = append(typeSelector, FormFieldSelector{Value: jobType, Label: jobType})
+	}
+	setDefaultSelected(typeSelector, filter.JobType)
+
+	return []FormField{
+		{Label: "Status", Name: "status", Type: "select", Selectors: statusSelector},
+		{Label: "Type", Name: "job_type", Type: "select", Selectors: typeSelector},
+	}
+}
+
+// Formats a JSON payload with indentation for display. Returns the raw payload if it isn't valid JSON
+func formatJobPayload(payload string) string {
+	var formatted bytes.Buffer
+	if err := json.Indent(&formatted, []byte(payload), "", "  "); err != nil {
+		return payload
+	}
+	return formatted.String()
+}
+
+// Form generation
+// Used to build View form
+func (c adminJobController) generateViewForm() []FormField {
+	return []FormField{
+		{DbLabel: "JobType", Label: "Job Type", Name: "job_type", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Status", Label: "Status", Name: "status", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Queue", Label: "Queue", Name: "queue", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Priority", Label: "Priority", Name: "priority", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Attempts", Label: "Attempts", Name: "attempts", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Payload", Label: "Payload", Name: "payload", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LastError", Label: "Last Error", Name: "last_error", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "RunAt", Label: "Run At", Name: "run_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "NextRunAt", Label: "Next Run At", Name: "next_run_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "ProcessedAt", Label: "Processed At", Name: "processed_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UniqueKey", Label: "Unique Key", Name: "unique_key", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "BatchID", Label: "Batch ID", Name: "batch_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "ParentID", Label: "Waits On Job", Name: "parent_id", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LockedBy", Label: "Locked By", Name: "locked_by", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "LockedUntil", Label: "Locked Until", Name: "locked_until", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+
+		{DbLabel: "CreatedAt", Label: "Created At", Name: "created_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "UpdatedAt", Label: "Updated At", Name: "updated_at", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+	}
+}
@@ -0,0 +1,257 @@
+package adminpanel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// Table headers to show on find all page
+var outboxTableHeaders = []TableHeader{
+	{Label: "ID", ColumnSortLabel: "id", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "Date", ColumnSortLabel: "date", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "To", ColumnSortLabel: "to", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "Subject", ColumnSortLabel: "subject", Pointer: false, DataType: "string", Sortable: false},
+	{Label: "Attachments", ColumnSortLabel: "attachments", Pointer: false, DataType: "string", Sortable: false},
+}
+
+// Builds the controller for the outbox of emails captured by the file email driver.
+// Pass a nil outbox if emails aren't being captured (the pages explain how to enable it)
+func NewAdminOutboxController(outbox *email.Outbox) AdminOutboxController {
+	return &adminOutboxController{
+		outbox: outbox,
+		// Use values from above
+		adminHomeUrl:     "/admin/outbox",
+		schemaName:       "Email",
+		pluralSchemaName: "Outbox",
+		tableHeaders:     outboxTableHeaders,
+	}
+}
+
+type adminOutboxController struct {
+	outbox *email.Outbox
+	// For links
+	adminHomeUrl string
+	// For HTML text rendering
+	schemaName       string
+	pluralSchemaName string
+	// Custom table headers
+	tableHeaders []TableHeader
+}
+
+type AdminOutboxController interface {
+	FindAll(w http.ResponseWriter, r *http.Request)
+	View(w http.ResponseWriter, r *http.Request)
+	// Serves the HTML body of a message (shown in a sandboxed frame on the view page)
+	HTML(w http.ResponseWriter, r *http.Request)
+	BulkDelete(w http.ResponseWriter, r *http.Request)
+}
+
+func (c adminOutboxController) FindAll(w http.ResponseWriter, r *http.Request) {
+	// Grab query parameters
+	searchQuery := r.URL.Query().Get("search")
+	// Grab basic query params
+	baseQueryParams, err := request.ExtractBasicFindAllQueryParams(r)
+	if err != nil {
+		http.Error(w, "Error extracting query params", http.StatusBadRequest)
+		return
+	}
+
+	// Grab captured messages matching the search
+	messages := []email.OutboxMessage{}
+	if c.outbox != nil {
+		found, err := c.outbox.List()
+		if err != nil {
+			http.Error(w, "Error finding data", http.StatusInternalServerError)
+			return
+		}
+		for _, message := range found {
+			if matchesOutboxSearch(message, searchQuery) {
+				messages = append(messages, message)
+			}
+		}
+	}
+
+	// Convert the current page to AdminPanelSchema
+	var adminSchemaSlice []models.AdminPanelSchema
+	for i := baseQueryParams.Offset; i < len(messages) && i < baseQueryParams.Offset+baseQueryParams.Limit; i++ {
+		adminSchemaSlice = append(adminSchemaSlice, messages[i])
+	}
+	metaData := data.BuildPageMetaData(int64(len(messages)), baseQueryParams.Limit, baseQueryParams.Offset)
+
+	// Build the table data
+	tableData := BuildTableData(adminSchemaSlice, metaData, c.adminHomeUrl, c.tableHeaders, false)
+	tableData.BulkActions = []FormFieldSelector{{Value: "delete", Label: "Delete selected emails"}}
+
+	// Generate Find All page render data
+	data := GenerateFindAllRenderData(tableData, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, searchQuery)
+	data.SectionTitle = fmt.Sprintf("Select an %s to preview", c.schemaName)
+	data.SectionDetail = c.outboxNotice()
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminOutboxController) View(w http.ResponseWriter, r *http.Request) {
+	// Init new view form
+	viewForm := c.generateViewForm()
+
+	// Grab URL parameter
+	stringParameter := chi.URLParam(r, "id")
+	found, ok := c.findMessage(w, stringParameter)
+	if !ok {
+		return
+	}
+
+	// Populate form fields with message values
+	currentData := map[string]string{}
+	for _, field := range viewForm {
+		currentData[field.DbLabel] = found.ObtainValue(field.DbLabel)
+	}
+	err := populateValuessWithDBData(&viewForm, currentData)
+	if err != nil {
+		http.Error(w, "Error generating form", http.StatusInternalServerError)
+		return
+	}
+
+	data := GenerateEditRenderData(viewForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, false)
+	data.PageTitle = fmt.Sprintf("%s: %s", c.schemaName, found.Subject)
+	data.SectionTitle = found.Subject
+	// Preview the HTML body
+	if found.HTMLBody != "" {
+		data.SectionDetail = template.HTML(fmt.Sprintf(
+			`<iframe class="email-preview" sandbox="allow-popups allow-popups-to-escape-sandbox" src="%s" title="Email preview" style="width: 100%%; min-height: 500px; border: 1px solid #ccc; background: #fff;"></iframe>`,
+			template.HTMLEscapeString(fmt.Sprintf("%s/%s/html", c.adminHomeUrl, found.ID)),
+		))
+	}
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+func (c adminOutboxController) HTML(w http.ResponseWriter, r *http.Request) {
+	found, ok := c.findMessage(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	// Sandbox the email so its content can't run scripts in the admin panel.
+	// Links open in a new tab so verification links can be clicked
+	w.Header().Set("Content-Security-Policy", "sandbox allow-popups allow-popups-to-escape-sandbox; script-src 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	body := found.HTMLBody
+	if !strings.Contains(strings.ToLower(body), "<base") {
+		body = `<base target="_blank">` + body
+	}
+	w.Write([]byte(body))
+}
+
+func (c adminOutboxController) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	// Init
+	var listOfIds BulkDeleteRequest
+
+	// Decode request body as JSON and store
+	err := json.NewDecoder(r.Body).Decode(&listOfIds)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+
+	// Prepare response
+	bulkResponse := models.BulkDeleteResponse{
+		// Set deleted records to length of selected items
+		DeletedRecords: len(listOfIds.SelectedItems),
+		Errors:         []error{},
+	}
+	if c.outbox == nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, errors.New("emails aren't being captured"))
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Bulk Delete
+	err = c.outbox.Delete(listOfIds.SelectedItems...)
+	// If error detected send error response
+	if err != nil {
+		bulkResponse.Errors = append(bulkResponse.Errors, err)
+		bulkResponse.Success = false
+		request.WriteAsJSON(w, bulkResponse)
+		return
+	}
+
+	// Set success
+	bulkResponse.Success = true
+	request.WriteAsJSON(w, bulkResponse)
+}
+
+// Helpers
+//
+// Finds a message in the outbox, writing an error response if it can't be found
+func (c adminOutboxController) findMessage(w http.ResponseWriter, id string) (*email.OutboxMessage, bool) {
+	if c.outbox == nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return nil, false
+	}
+	found, err := c.outbox.Find(id)
+	if err != nil {
+		if errors.Is(err, email.ErrMessageNotFound) {
+			http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		} else {
+			http.Error(w, fmt.Sprintf("Error reading %s", c.schemaName), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return found, true
+}
+
+// Explains where captured emails come from
+func (c adminOutboxController) outboxNotice() template.HTML {
+	if c.outbox == nil {
+		return template.HTML(fmt.Sprintf(`<p>Emails are only captured when EMAIL_DRIVER is set to "%s".</p>`, email.DriverFile))
+	}
+	return template.HTML(fmt.Sprintf(`<p>Emails written to <code>%s</code> by the file email driver.</p>`, template.HTMLEscapeString(c.outbox.Dir)))
+}
+
+// Checks if a message's subject or recipients contain the search query
+func matchesOutboxSearch(message email.OutboxMessage, searchQuery string) bool {
+	if searchQuery == "" {
+		return true
+	}
+	searchQuery = strings.ToLower(searchQuery)
+	for _, value := range []string{message.Subject, message.Recipients, message.To} {
+		if strings.Contains(strings.ToLower(value), searchQuery) {
+			return true
+		}
+	}
+	return false
+}
+
+// Builds the (read only) form used to view a message
+func (c adminOutboxController) generateViewForm() []FormField {
+	return []FormField{
+		{DbLabel: "Date", Label: "Date", Name: "date", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "From", Label: "From", Name: "from", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "To", Label: "To", Name: "to", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Cc", Label: "Cc", Name: "cc", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Recipients", Label: "All Recipients (including Bcc)", Name: "recipients", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "ReplyTo", Label: "Reply To", Name: "reply_to", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "Attachments", Label: "Attachments", Name: "attachments", Placeholder: "", Value: "", Type: "text", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "TextBody", Label: "Text Body", Name: "text_body", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+		{DbLabel: "HTMLBody", Label: "HTML Source", Name: "html_body", Placeholder: "", Value: "", Type: "code", Required: false, Disabled: true, Errors: []ErrorMessage{}},
+	}
+}
@@ -63,6 +63,9 @@ type AdminUserController interface {
 	CreateSuccess(w http.ResponseWriter, r *http.Request)
 	EditSuccess(w http.ResponseWriter, r *http.Request)
 	DeleteSuccess(w http.ResponseWriter, r *http.Request)
+	// Reset two-factor authentication (GET confirmation / POST reset)
+	ResetTwoFactor(w http.ResponseWriter, r *http.Request)
+	ResetTwoFactorSuccess(w http.ResponseWriter, r *http.Request)
 	// For sidebar
 	ObtainUrlDetails() models.URLDetails
 }
@@ -137,6 +140,7 @@ func (c adminUserController) Create(w http.ResponseWriter, r *http.Request) {
 			Name:     formFieldMap["name"],
 			Username: formFieldMap["username"],
 			Email:    formFieldMap["email"],
+			Language: formFieldMap["language"],
 			Password: formFieldMap["password"],
 			Role:     formFieldMap["role"],
 			Verified: verified,
@@ -227,6 +231,7 @@ func (c adminUserController) Edit(w http.ResponseWriter, r *http.Request) {
 			Name:     formFieldMap["name"],
 			Username: formFieldMap["username"],
 			Email:    formFieldMap["email"],
+			Language: formFieldMap["language"],
 			Password: formFieldMap["password"],
 			Role:     formFieldMap["role"],
 			Verified: verified,
@@ -286,6 +291,15 @@ func (c adminUserController) Edit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := GenerateEditRenderData(editForm, c.schemaName, c.pluralSchemaName, c.adminHomeUrl, stringParameter, true)
+	// Users with two-factor authentication can have it reset (eg. after losing their authenticator)
+	twoFactor, err := c.service.TwoFactorStatus(idParameter)
+	if err != nil {
+		fmt.Printf("Error finding two-factor status: %v\n", err)
+	} else if twoFactor.Enabled {
+		data.SectionDetail = rowActionLinks([]RowAction{
+			{Label: "Reset 2FA", Url: fmt.Sprintf("%s/reset-two-factor/%s", c.adminHomeUrl, stringParameter)},
+		})
+	}
 
 	// Execute the template with data and write to response
 	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
@@ -386,6 +400,57 @@ func (c adminUserController) BulkDelete(w http.ResponseWriter, r *http.Request)
 	request.WriteAsJSON(w, bulkResponse)
 }
 
+// Removes the two-factor authentication of a user, so they can enrol a new authenticator. Their sessions end
+func (c adminUserController) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	stringParameter := chi.URLParam(r, "id")
+	// Convert to int
+	idParameter, err := strconv.Atoi(stringParameter)
+	if err != nil {
+		serveAdminError(w, "Unable to interpret ID")
+		return
+	}
+	found, err := c.service.FindById(idParameter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s not found", c.schemaName), http.StatusNotFound)
+		return
+	}
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		err = c.service.ResetTwoFactor(idParameter)
+		if err != nil {
+			http.Error(w, "Error resetting two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		// Record action
+		err = c.actionService.RecordBulkAction(r, c.schemaName, []int{idParameter}, &models.RecordedAction{
+			ActionType: "reset-two-factor",
+			EntityType: c.schemaName,
+			EntityID:   stringParameter,
+		}, fmt.Sprintf("Reset two-factor authentication of %s", found.Email))
+		if err != nil {
+			fmt.Printf("Error recording action: %s", err)
+		}
+
+		// Redirect to success page
+		http.Redirect(w, r, fmt.Sprintf("%s/reset-two-factor/success", c.adminHomeUrl), http.StatusSeeOther)
+		return
+	}
+
+	data := GenerateConfirmRenderData(c.schemaName, c.adminHomeUrl,
+		fmt.Sprintf("%s/reset-two-factor/%s", c.adminHomeUrl, stringParameter),
+		fmt.Sprintf("Are you sure you wish to reset the two-factor authentication of %s? They will be logged out and can enrol a new authenticator.", found.Email),
+		"Reset 2FA")
+
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
 // Success handlers
 func (c adminUserController) CreateSuccess(w http.ResponseWriter, r *http.Request) {
 	// Serve admin success page
@@ -399,6 +464,10 @@ func (c adminUserController) DeleteSuccess(w http.ResponseWriter, r *http.Reques
 	// Serve admin success page
 	serveAdminSuccess(w, fmt.Sprintf("Delete %s", c.schemaName), fmt.Sprintf("%s Deleted Successfully!", c.schemaName))
 }
+func (c adminUserController) ResetTwoFactorSuccess(w http.ResponseWriter, r *http.Request) {
+	// Serve admin success page
+	serveAdminSuccess(w, "Reset Two-Factor Authentication", "Two-Factor Authentication Reset!")
+}
 
 // Form generation
 // Used to build Create form
@@ -407,6 +476,7 @@ func (c adminUserController) generateCreateForm() []FormField {
 		{DbLabel: "Name", Label: "Name", Name: "name", Placeholder: "Enter name", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Username", Label: "Username", Name: "username", Placeholder: "Enter username", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Email", Label: "Email", Name: "email", Placeholder: "Enter email", Value: "", Type: "email", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "Language", Label: "Language", Name: "language", Placeholder: "Enter language for emails (eg. en, es)", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Password", Label: "Password", Name: "password", Placeholder: "Enter password", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Role", Label: "Role", Name: "role", Placeholder: "Enter role", Value: "user", Type: "select", Required: false, Disabled: false, Errors: []ErrorMessage{}, Selectors: RoleSelection()},
 		{DbLabel: "Verified", Label: "Verified", Name: "verified", Placeholder: "", Value: "true", Type: "checkbox", Required: false, Disabled: false, Errors: []ErrorMessage{}},
@@ -419,6 +489,7 @@ func (c adminUserController) generateEditForm() []FormField {
 		{DbLabel: "Name", Label: "Name", Name: "name", Placeholder: "Enter name", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Username", Label: "Username", Name: "username", Placeholder: "Enter username", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Email", Label: "Email", Name: "email", Placeholder: "Enter email", Value: "", Type: "email", Required: false, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "Language", Label: "Language", Name: "language", Placeholder: "Enter language for emails (eg. en, es)", Value: "", Type: "text", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Password", Label: "Password", Name: "password", Placeholder: "Enter password", Value: "", Type: "password", Required: false, Disabled: false, Errors: []ErrorMessage{}},
 		{DbLabel: "Role", Label: "Role", Name: "role", Placeholder: "Enter role", Value: "user", Type: "select", Required: false, Disabled: false, Errors: []ErrorMessage{}, Selectors: RoleSelection()},
 		{DbLabel: "Verified", Label: "Verified", Name: "verified", Placeholder: "", Value: "false", Type: "checkbox", Required: false, Disabled: false, Errors: []ErrorMessage{}},
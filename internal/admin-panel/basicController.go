@@ -45,6 +45,10 @@ type basicAdminController[dbSchema, create, update any] struct {
 	tableHeaders []TableHeader
 	// Conditional query params
 	ConditionQueryParams map[string]string
+	// Records are created by the app (eg. logs) and can only be viewed and deleted
+	readOnly bool
+	// Optional links to additional actions for a record (eg. Resend), shown in the table and on the view page
+	rowActions func(schema dbSchema) []RowAction
 
 	// Input functions for forms
 	// Form creators
@@ -109,7 +113,13 @@ func (c basicAdminController[dbSchema, create, update]) FindAll(w http.ResponseW
 	}
 
 	// Build the table data
-	tableData := BuildTableData(adminSchemaSlice, found.Meta, c.AdminHomeUrl, c.tableHeaders, true)
+	tableData := BuildTableData(adminSchemaSlice, found.Meta, c.AdminHomeUrl, c.tableHeaders, !c.readOnly)
+	// Add the additional actions available for each record
+	if c.rowActions != nil {
+		for i, schema := range schemaSlice {
+			tableData.TableRows[i].Edit.ExtraActions = c.rowActions(schema)
+		}
+	}
 
 	// Generate Find All render data using input data
 	data := GenerateFindAllRenderData(tableData, c.SchemaName, c.PluralSchemaName, c.AdminHomeUrl, searchQuery)
@@ -122,6 +132,11 @@ func (c basicAdminController[dbSchema, create, update]) FindAll(w http.ResponseW
 	}
 }
 func (c basicAdminController[dbSchema, create, update]) Create(w http.ResponseWriter, r *http.Request) {
+	// Read only records are created by the app
+	if c.readOnly {
+		serveAdminError(w, fmt.Sprintf("%s can't be created from the admin panel", c.PluralSchemaName))
+		return
+	}
 	// Init new Create form
 	createForm := c.generateCreateForm()
 
@@ -218,6 +233,11 @@ func (c basicAdminController[dbSchema, create, update]) Edit(w http.ResponseWrit
 
 	// If form is being submitted (method = POST)
 	if r.Method == "POST" {
+		// Read only records can't be updated
+		if c.readOnly {
+			serveAdminError(w, fmt.Sprintf("%s can't be updated from the admin panel", c.PluralSchemaName))
+			return
+		}
 		// Extract form submission
 		formFieldMap, err := adminpanel.ParseFormToMap(r)
 		if err != nil {
@@ -273,6 +293,12 @@ func (c basicAdminController[dbSchema, create, update]) Edit(w http.ResponseWrit
 
 	// Populate form field placeholders with data from database
 	currentData := getValuesUsingFieldMap(*found)
+	// Read only records are shown using their formatted values
+	if adminSchema, ok := any(*found).(models.AdminPanelSchema); ok && c.readOnly {
+		for _, field := range editForm {
+			currentData[field.DbLabel] = adminSchema.ObtainValue(field.DbLabel)
+		}
+	}
 	// Populate form field placeholders with data from database
 	err = populateValuessWithDBData(&editForm, currentData)
 	if err != nil {
@@ -280,7 +306,11 @@ func (c basicAdminController[dbSchema, create, update]) Edit(w http.ResponseWrit
 		return
 	}
 
-	data := GenerateEditRenderData(editForm, c.SchemaName, c.PluralSchemaName, c.AdminHomeUrl, stringParameter, true)
+	data := GenerateEditRenderData(editForm, c.SchemaName, c.PluralSchemaName, c.AdminHomeUrl, stringParameter, !c.readOnly)
+	// Show links to the additional actions available for the record
+	if c.rowActions != nil {
+		data.SectionDetail = rowActionLinks(c.rowActions(*found))
+	}
 
 	// Execute the template with data and write to response
 	err = app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", data)
@@ -1,12 +1,13 @@
 package adminpanel
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/dmawardi/Go-Template/internal/auth"
 	adminpanel "github.com/dmawardi/Go-Template/internal/helpers/adminPanel"
@@ -21,12 +22,18 @@ type AdminCoreController interface {
 	Home(w http.ResponseWriter, r *http.Request)
 	// Admin login handler
 	Login(w http.ResponseWriter, r *http.Request)
+	// Second login step handler (two-factor authentication)
+	LoginTwoFactor(w http.ResponseWriter, r *http.Request)
 	// Admin logout handler
 	Logout(w http.ResponseWriter, r *http.Request)
 	// Change Password handler
 	ChangePassword(w http.ResponseWriter, r *http.Request)
 	// Change Password Success handler
 	ChangePasswordSuccess(w http.ResponseWriter, r *http.Request)
+	// Reset Password handler (link from password reset emails)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+	// Two-factor authentication enrolment handler
+	TwoFactor(w http.ResponseWriter, r *http.Request)
 	// Admin redirect handler
 	AdminRedirectBasedOnLoginStatus(w http.ResponseWriter, r *http.Request)
 }
@@ -60,8 +67,6 @@ func (c adminCoreController) Home(w http.ResponseWriter, r *http.Request) {
 
 // Admin login page
 func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
-	// Init token string
-	tokenString := ""
 	loginErrorMsg := ""
 
 	// Generate form
@@ -87,13 +92,10 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 		// If validation passes
 		if pass {
 			// Login user
-			tokenString, err = c.service.LoginUser(&login)
+			tokens, err := c.service.LoginUser(&login)
 			if err == nil {
-				// Set token in cookie
-				auth.CreateAndSetHeaderCookie(w, tokenString)
-
-				// Redirect or render a success message
-				http.Redirect(w, r, "/admin/home", http.StatusSeeOther)
+				// Set tokens in cookies and redirect (or continue with the second login step)
+				c.completeLogin(w, r, tokens, "/admin/home")
 				return
 			}
 			// Else if login fails
@@ -140,14 +142,18 @@ func (c adminCoreController) Login(w http.ResponseWriter, r *http.Request) {
 
 // Admin logout page
 func (c adminCoreController) Logout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "jwt_token", // Use the name of your auth cookie
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Unix(0, 0),
-		HttpOnly: true,
-		Secure:   true, // Set to false if not using HTTPS
-	})
+	// End the session server side (using the refresh token, or the session of the access token)
+	if cookie, err := r.Cookie(auth.RefreshTokenCookie); err == nil && cookie.Value != "" {
+		if err := c.service.Logout(cookie.Value); err != nil {
+			fmt.Printf("Error ending session on logout: %v\n", err)
+		}
+	} else if tokenData, err := auth.ValidateAndParseToken(r); err == nil && tokenData.SessionID != "" {
+		if err := c.service.RevokeSession(tokenData.SessionID); err != nil {
+			fmt.Printf("Error ending session on logout: %v\n", err)
+		}
+	}
+	// Clear the token cookies
+	auth.ClearAuthCookies(w)
 
 	// Redirect to the login page, or return a success message
 	http.Redirect(w, r, "/admin", http.StatusFound)
@@ -202,15 +208,21 @@ func (c adminCoreController) ChangePassword(w http.ResponseWriter, r *http.Reque
 			// If pasword match error is nil, and new password matches confirm new password
 			if changePassword.NewPassword == changePassword.ConfirmNewPassword && passMatch {
 
-				// Update the user's password
+				// Update the user's password (ends every session of the user)
 				_, err = c.service.Update(userID, &models.UpdateUser{Password: changePassword.ConfirmNewPassword})
 				if err != nil {
 					fmt.Println(err.Error())
 					return
 				}
-
-				// Redirect or render a success message
-				http.Redirect(w, r, "/admin/change-password-success", http.StatusSeeOther)
+				// Start a new session for the current user
+				tokens, err := c.service.LoginUser(&models.Login{Email: tokenData.Email, Password: changePassword.ConfirmNewPassword})
+				if err != nil {
+					fmt.Printf("Error starting new session after password change: %v\n", err)
+					http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+					return
+				}
+				// Redirect to the success message (users with two-factor authentication enter a code first)
+				c.completeLogin(w, r, tokens, "/admin/change-password-success")
 				return
 			} else {
 				notification = "Old password does not match or new passwords do not match"
@@ -260,16 +272,292 @@ func (c adminCoreController) ChangePasswordSuccess(w http.ResponseWriter, r *htt
 	serveAdminSuccess(w, "Change Password Success - Admin", "Change Password Success")
 }
 
+// Reset Password (public page opened from the link in password reset emails)
+func (c adminCoreController) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	notification := ""
+	token := r.URL.Query().Get("token")
+	// Generate form
+	passwordForm := c.generateResetPasswordForm()
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		// Extract form data
+		form, err := adminpanel.ParseFormToMap(r)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		reset := models.CompletePasswordReset{Token: token, NewPassword: form["new_password"]}
+		pass, valErrors := request.GoValidateStruct(reset)
+
+		if form["new_password"] != form["confirm_new_password"] {
+			notification = "New passwords do not match"
+		} else if pass {
+			// Set the new password. Every session of the user ends
+			err = c.service.ResetPassword(reset.Token, reset.NewPassword)
+			if err == nil {
+				// Log in using the new password
+				http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+				return
+			}
+			fmt.Printf("Error resetting password: %v\n", err)
+			notification = "This password reset link is invalid or has expired"
+		} else {
+			// Populate form field errors
+			SetValidationErrorsInForm(passwordForm, *valErrors)
+			if len(valErrors.Validation_errors["token"]) > 0 {
+				notification = "This password reset link is invalid or has expired"
+			}
+		}
+	}
+	// Execute the template with data and write to response
+	err := app.AdminTemplates.ExecuteTemplate(w, "login.go.tmpl", PageRenderData{
+		PageTitle: "Reset Password",
+		// The section title is used on this page, to display errors
+		SectionTitle: notification,
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction:  "/admin/reset-password?token=" + url.QueryEscape(token),
+				FormMethod:  "POST",
+				SubmitLabel: "Reset Password",
+			},
+			FormFields: passwordForm,
+		},
+		HeaderSection: header,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
 // Redirect
+// Expired access tokens are renewed using the refresh token cookie, returning to the page
+// that was requested (next query parameter) if any
 func (c adminCoreController) AdminRedirectBasedOnLoginStatus(w http.ResponseWriter, r *http.Request) {
+	// Only redirect to admin pages
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/admin/") {
+		next = "/admin/home"
+	}
+
 	_, err := auth.ValidateAndParseToken(r)
-	if err != nil {
+	if err == nil {
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+	// Else, try to renew the tokens using the refresh token
+	if cookie, cookieErr := r.Cookie(auth.RefreshTokenCookie); cookieErr == nil && cookie.Value != "" {
+		err := c.renewSession(w, cookie.Value)
+		if err == nil {
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		fmt.Printf("Error refreshing admin session: %v\n", err)
+		auth.ClearAuthCookies(w)
+	}
+	http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+}
+
+// Second login step of users with two-factor authentication. The challenge from the password step is kept in a cookie
+func (c adminCoreController) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	loginErrorMsg := ""
+	cookie, err := r.Cookie(auth.TwoFactorChallengeCookie)
+	if err != nil || cookie.Value == "" {
+		// The challenge expired (or the password wasn't checked yet)
 		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
 		return
-	} else {
-		http.Redirect(w, r, "/admin/home", http.StatusSeeOther)
+	}
+	// Generate form
+	codeForm := c.generateTwoFactorLoginForm()
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		// Extract form data
+		form, err := adminpanel.ParseFormToMap(r)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		login := models.TwoFactorLogin{ChallengeToken: cookie.Value, Code: form["code"]}
+		pass, valErrors := request.GoValidateStruct(login)
+
+		if pass {
+			tokens, err := c.service.VerifyTwoFactorLogin(login.ChallengeToken, login.Code)
+			if err == nil {
+				auth.ClearTwoFactorChallengeCookie(w)
+				c.completeLogin(w, r, tokens, "/admin/home")
+				return
+			}
+			fmt.Printf("Error completing two-factor login: %v\n", err)
+			switch {
+			case errors.Is(err, coreservices.ErrInvalidTwoFactorChallenge):
+				// Start again from the password step
+				auth.ClearTwoFactorChallengeCookie(w)
+				http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+				return
+			case errors.Is(err, coreservices.ErrTwoFactorLocked):
+				auth.ClearTwoFactorChallengeCookie(w)
+				loginErrorMsg = "Too many invalid codes, try again later"
+			default:
+				loginErrorMsg = "Invalid code"
+			}
+		} else {
+			// Populate form field errors
+			SetValidationErrorsInForm(codeForm, *valErrors)
+		}
+	}
+	// Execute the template with data and write to response
+	err = app.AdminTemplates.ExecuteTemplate(w, "login.go.tmpl", PageRenderData{
+		PageTitle: "Two-Factor Authentication",
+		// The section title is used on this page, to display login errors
+		SectionTitle: loginErrorMsg,
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction:  "/admin/login/two-factor",
+				FormMethod:  "POST",
+				SubmitLabel: "Verify",
+			},
+			FormFields: codeForm,
+		},
+		HeaderSection: header,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Two-factor authentication page. Shows the QR code to enrol an authenticator app and confirms the
+// enrolment with a code. The recovery codes are shown once two-factor authentication is enabled
+func (c adminCoreController) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	notification := ""
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	userID, err := strconv.Atoi(tokenData.UserID)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	// Generate form
+	codeForm := c.generateTwoFactorEnrolmentForm()
+
+	// If form is being submitted (method = POST)
+	if r.Method == "POST" {
+		// Extract form data
+		form, err := adminpanel.ParseFormToMap(r)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		confirmation := models.TwoFactorCode{Code: form["code"]}
+		pass, valErrors := request.GoValidateStruct(confirmation)
+
+		if pass {
+			recoveryCodes, err := c.service.ConfirmTwoFactorEnrolment(userID, confirmation.Code)
+			if err == nil {
+				// Renew the session, as pages may have been blocked until two-factor authentication was set up
+				if cookie, cookieErr := r.Cookie(auth.RefreshTokenCookie); cookieErr == nil && cookie.Value != "" {
+					if err := c.renewSession(w, cookie.Value); err != nil {
+						fmt.Printf("Error renewing session after two-factor enrolment: %v\n", err)
+					}
+				}
+				c.renderTwoFactorPage(w, "Two-Factor Authentication Enabled",
+					"<p>Save these recovery codes somewhere safe. Each code can be used once to log in without your authenticator app, and they won't be shown again.</p>",
+					[]FormField{{DbLabel: "recovery_codes", Label: "Recovery Codes", Name: "recovery_codes", Value: strings.Join(recoveryCodes.RecoveryCodes, "\n"), Type: "code", Disabled: true, Errors: []ErrorMessage{}}},
+					false)
+				return
+			}
+			fmt.Printf("Error confirming two-factor enrolment: %v\n", err)
+			notification = "Invalid code, please try again"
+		} else {
+			// Populate form field errors
+			SetValidationErrorsInForm(codeForm, *valErrors)
+		}
+	}
+
+	status, err := c.service.TwoFactorStatus(userID)
+	if err != nil {
+		http.Error(w, "Can't find two-factor status", http.StatusInternalServerError)
+		return
+	}
+	// Already enabled: show the status only
+	if status.Enabled {
+		c.renderTwoFactorPage(w, "Two-Factor Authentication",
+			fmt.Sprintf("<p>Two-factor authentication is enabled. %d recovery code(s) left. To enrol another authenticator, ask an admin to reset your two-factor authentication.</p>", status.RecoveryCodesRemaining),
+			[]FormField{}, false)
 		return
 	}
+
+	enrolment, err := c.service.BeginTwoFactorEnrolment(userID)
+	if err != nil {
+		fmt.Printf("Error starting two-factor enrolment: %v\n", err)
+		http.Error(w, "Failed two-factor enrolment", http.StatusInternalServerError)
+		return
+	}
+	detail := ""
+	if status.Required {
+		detail += "<p>Your role requires two-factor authentication. Set it up to continue.</p>"
+	}
+	if notification != "" {
+		detail += fmt.Sprintf(`<p class="error-message">%s</p>`, template.HTMLEscapeString(notification))
+	}
+	detail += fmt.Sprintf(`<p>Scan the QR code with your authenticator app (or enter the secret <code>%s</code>), then enter the code it shows.</p><img src="%s" alt="QR code" width="256" height="256" />`,
+		template.HTMLEscapeString(enrolment.Secret), template.HTMLEscapeString(enrolment.QRCode))
+	c.renderTwoFactorPage(w, "Set Up Two-Factor Authentication", detail, codeForm, true)
+}
+
+// Renders the two-factor authentication page. The form is only submittable while enrolling
+func (c adminCoreController) renderTwoFactorPage(w http.ResponseWriter, title string, detail string, fields []FormField, enrolling bool) {
+	err := app.AdminTemplates.ExecuteTemplate(w, "layout.go.tmpl", PageRenderData{
+		SectionTitle:  title,
+		PageTitle:     "Two-Factor Authentication",
+		SectionDetail: template.HTML(detail),
+		PageType: PageType{
+			EditPage: enrolling,
+			ViewPage: !enrolling,
+		},
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction: "/admin/two-factor",
+				FormMethod: "POST",
+			},
+			FormFields: fields,
+		},
+		HeaderSection: header,
+		SidebarList:   sidebar,
+	})
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+}
+
+// Sets the token cookies and redirects to the next page. Users with two-factor authentication
+// continue with the second login step instead
+func (c adminCoreController) completeLogin(w http.ResponseWriter, r *http.Request, tokens *models.LoginResponse, next string) {
+	if tokens.TwoFactorRequired {
+		auth.SetTwoFactorChallengeCookie(w, tokens.ChallengeToken, coreservices.TwoFactorChallengeTTL)
+		http.Redirect(w, r, "/admin/login/two-factor", http.StatusSeeOther)
+		return
+	}
+	auth.CreateAndSetHeaderCookie(w, tokens.Token)
+	auth.SetRefreshTokenCookie(w, tokens.RefreshToken)
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// Exchanges the refresh token for a new token pair and sets them in the cookies
+func (c adminCoreController) renewSession(w http.ResponseWriter, refreshToken string) error {
+	tokens, err := c.service.RefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	auth.CreateAndSetHeaderCookie(w, tokens.Token)
+	auth.SetRefreshTokenCookie(w, tokens.RefreshToken)
+	return nil
 }
 
 // Form generators
@@ -279,6 +567,22 @@ func (c adminCoreController) generateLoginForm() []FormField {
 		{DbLabel: "password", Label: "Password", Name: "password", Placeholder: "", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
 	}
 }
+func (c adminCoreController) generateTwoFactorLoginForm() []FormField {
+	return []FormField{
+		{DbLabel: "code", Label: "Authentication Code (or Recovery Code)", Name: "code", Placeholder: "", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
+func (c adminCoreController) generateTwoFactorEnrolmentForm() []FormField {
+	return []FormField{
+		{DbLabel: "code", Label: "Authentication Code", Name: "code", Placeholder: "", Value: "", Type: "text", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
+func (c adminCoreController) generateResetPasswordForm() []FormField {
+	return []FormField{
+		{DbLabel: "new_password", Label: "New Password", Name: "new_password", Placeholder: "", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+		{DbLabel: "confirm_new_password", Label: "Confirm New Password", Name: "confirm_new_password", Placeholder: "", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
+	}
+}
 func (c adminCoreController) generateChangePasswordForm() []FormField {
 	return []FormField{
 		{DbLabel: "Password", Label: "Current Password", Name: "currentPassword", Placeholder: "", Value: "", Type: "password", Required: true, Disabled: false, Errors: []ErrorMessage{}},
@@ -47,6 +47,14 @@ func ActionSelection() []FormFieldSelector {
 		{Value: "delete", Label: "Delete", Selected: false},
 	}
 }
+func SuppressionReasonSelection() []FormFieldSelector {
+	return []FormFieldSelector{
+		{Value: db.SuppressionReasonManual, Label: "Manual", Selected: true},
+		{Value: db.SuppressionReasonHardBounce, Label: "Hard bounce", Selected: false},
+		{Value: db.SuppressionReasonComplaint, Label: "Complaint", Selected: false},
+		{Value: db.SuppressionReasonUnsubscribed, Label: "Unsubscribed", Selected: false},
+	}
+}
 func UserSelection() []FormFieldSelector {
 	var users []db.User
 	// Query all users
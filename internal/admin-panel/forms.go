@@ -57,6 +57,8 @@ type ErrorMessage string
 type FormDetails struct {
 	FormAction string
 	FormMethod string
+	// Text of the submit button on standalone pages (eg. login). Defaults to "Login"
+	SubmitLabel string
 }
 
 // Map used to group form selectors for a schema (eg. FormSelector["field_name"])
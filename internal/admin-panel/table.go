@@ -1,7 +1,9 @@
 package adminpanel
 
 import (
+	"bytes"
 	"fmt"
+	"html/template"
 	"strings"
 
 	"github.com/dmawardi/Go-Template/internal/helpers/data"
@@ -16,6 +18,8 @@ type TableData struct {
 	TableHeaders   []TableHeader
 	TableRows      []TableRow
 	MetaData       models.ExtendedSchemaMetaData
+	// Actions offered for selected rows (defaults to delete if empty)
+	BulkActions []FormFieldSelector
 }
 
 // Used for table header information. Also holds information for sorting and pointer + data type
@@ -52,6 +56,25 @@ type EditInfo struct {
 	EditAllowed bool
 	EditUrl   string // eg. admin/users/1
 	DeleteUrl string // eg. admin/users/delete/1
+	// Additional links shown in the Actions column (eg. Retry)
+	ExtraActions []RowAction
+}
+
+// Link to an action that can be performed on a single row
+type RowAction struct {
+	Label string // eg. Retry
+	Url   string // eg. admin/jobs/retry/1
+}
+
+// Renders row actions as buttons (used on view pages)
+func rowActionLinks(actions []RowAction) template.HTML {
+	var links bytes.Buffer
+	links.WriteString(`<div class="button-container">`)
+	for _, action := range actions {
+		links.WriteString(fmt.Sprintf(`<a href="%s" class="button-primary">%s</a> `, template.HTMLEscapeString(action.Url), template.HTMLEscapeString(action.Label)))
+	}
+	links.WriteString(`</div>`)
+	return template.HTML(links.String())
 }
 
 // Used for bulk delete form on find all pages
@@ -30,6 +30,10 @@ type PageRenderData struct {
 	// Search
 	SearchTerm             string
 	RecordsPerPageSelector []int
+	// Select filters shown next to search (eg. status)
+	TableFilters []FormField
+	// Label of the submit button on confirmation pages (eg. "Retry")
+	ConfirmLabel string
 	// Special section data for policies
 	PolicySection PolicySection
 	HeaderSection HeaderSection
@@ -40,6 +44,7 @@ type HeaderSection struct {
 	HomeUrl           template.URL
 	ViewSiteUrl       template.URL
 	ChangePasswordUrl template.URL
+	TwoFactorUrl      template.URL
 	LogOutUrl         template.URL
 }
 
@@ -59,6 +64,7 @@ type PageType struct {
 	CreatePage  bool
 	DeletePage  bool
 	SuccessPage bool
+	ConfirmPage bool
 	// Used for policy section
 	PolicyMode string // eg. "policy" or "inheritance"
 }
@@ -168,7 +174,7 @@ func GenerateAndSetAdminSidebar(adminCont AdminPanelController) {
 		fieldValue := valueOfCont.Field(i).Interface()
 
 		// If not base controller, add to sidebar list
-		if fieldName != "Base" && fieldName != "Auth" && fieldName != "ModuleMap" && fieldName != "Action" {
+		if fieldName != "Base" && fieldName != "Auth" && fieldName != "ModuleMap" && fieldName != "Action" && fieldName != "Job" && fieldName != "Outbox" && fieldName != "EmailLog" {
 			currentController := ObtainUrlDetailsForBasicAdminController(fieldValue)
 			// Create sidebar item
 			item := sidebarItem{
@@ -323,6 +329,30 @@ func GenerateDeleteRenderData(SchemaName, PluralSchemaName, AdminHomeUrl, idPara
 	}
 }
 
+// Generate the render data for a confirmation page (eg. Retry job)
+func GenerateConfirmRenderData(SchemaName, AdminHomeUrl, formAction, sectionTitle, confirmLabel string) PageRenderData {
+	return PageRenderData{
+		// Input data
+		FormData: FormData{
+			FormDetails: FormDetails{
+				FormAction: formAction,
+				FormMethod: "post",
+			},
+			FormFields: []FormField{},
+		},
+		PageTitle:    fmt.Sprintf("%s %s", confirmLabel, SchemaName),
+		SectionTitle: sectionTitle,
+		ConfirmLabel: confirmLabel,
+		SchemaHome:   AdminHomeUrl,
+		// Admin panel standard variables
+		HeaderSection: header,
+		SidebarList:   sidebar,
+		PageType: PageType{
+			ConfirmPage: true,
+		},
+	}
+}
+
 // Sidebar helpers
 // Uses the ObtainUrlDetails method to get the sidebar details of any Basic Admin Controller type
 func ObtainUrlDetailsForBasicAdminController(input interface{}) models.URLDetails {
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/util"
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+// API keys
+// Integrations authenticate using long-lived API keys (sent as "Authorization: ApiKey <key>") instead of
+// logging in. A request made with a key is allowed if both its owner (through their Casbin policies) and
+// the key (through its scopes) are allowed to perform it, so keys never grant more than the owner has
+
+// Authorization scheme of API keys
+const ApiKeyScheme = "ApiKey"
+
+// Actions the scopes of an API key can grant
+var ApiKeyActions = []string{"read", "create", "update", "delete"}
+
+// How often the last used time of a key is updated, so every request doesn't write to the database
+const apiKeyLastUsedInterval = time.Minute
+
+// Checks whether the scopes of an API key allow an action on an object. Objects are matched as in Casbin policies
+func ApiKeyScopesAllow(scopes []db.ApiKeyScope, object, action string) bool {
+	for _, scope := range scopes {
+		if scope.Action == action && util.KeyMatch(object, scope.Object) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates an API key and returns the details of its owner. Expired keys and keys of deleted users are rejected
+func validateApiKey(key string) (*AuthToken, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return &AuthToken{}, errors.New("API key not detected")
+	}
+	found := db.ApiKey{}
+	result := app.DbClient.Where("key_hash = ?", HashToken(key)).First(&found)
+	if result.Error != nil {
+		return &AuthToken{}, errors.New("invalid API key")
+	}
+	now := time.Now()
+	if found.ExpiresAt != nil && !found.ExpiresAt.After(now) {
+		return &AuthToken{}, errors.New("API key expired")
+	}
+	owner := db.User{}
+	result = app.DbClient.First(&owner, found.UserID)
+	if result.Error != nil {
+		return &AuthToken{}, errors.New("invalid API key")
+	}
+
+	// Record when the key was last used
+	if found.LastUsedAt == nil || found.LastUsedAt.Before(now.Add(-apiKeyLastUsedInterval)) {
+		result = app.DbClient.Model(&db.ApiKey{}).Where("id = ?", found.ID).UpdateColumn("last_used_at", now)
+		if result.Error != nil {
+			fmt.Println("Error recording API key use: ", result.Error)
+		}
+	}
+
+	role := ""
+	roles, err := app.Auth.Enforcer.GetRolesForUser(fmt.Sprint(owner.ID))
+	if err == nil && len(roles) > 0 {
+		role = strings.TrimPrefix(roles[0], "role:")
+	}
+	return &AuthToken{
+		UserID:       fmt.Sprint(owner.ID),
+		Email:        owner.Email,
+		Role:         role,
+		ApiKeyID:     found.ID,
+		ApiKeyScopes: found.Scopes,
+	}, nil
+}
@@ -0,0 +1,37 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+func TestApiKeyScopesAllow(t *testing.T) {
+	scopes := []db.ApiKeyScope{
+		{Object: "/api/me", Action: "read"},
+		{Object: "/api/posts/*", Action: "update"},
+	}
+
+	var tests = []struct {
+		name     string
+		object   string
+		action   string
+		expected bool
+	}{
+		{"Exact scope", "/api/me", "read", true},
+		{"Wildcard scope", "/api/posts/drafts", "update", true},
+		{"Fail: Other action on object", "/api/me", "update", false},
+		{"Fail: Other object", "/api/users", "read", false},
+		{"Fail: Wildcard doesn't match base path", "/api/posts", "update", false},
+	}
+	for _, v := range tests {
+		if allowed := auth.ApiKeyScopesAllow(scopes, v.object, v.action); allowed != v.expected {
+			t.Errorf("%s: expected %v, got %v", v.name, v.expected, allowed)
+		}
+	}
+
+	if auth.ApiKeyScopesAllow(nil, "/api/me", "read") {
+		t.Errorf("Expected key without scopes to be denied")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/casbin/casbin/v2"
 	gormadapter "github.com/casbin/gorm-adapter/v3"
 	"github.com/dmawardi/Go-Template/internal/config"
+	"github.com/dmawardi/Go-Template/internal/db"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -21,6 +22,7 @@ import (
 
 var app *config.AppConfig
 
+// Used to sign access tokens when no signing keys are set (see LoadSigningKeysFromEnv)
 var JWTKey = []byte(os.Getenv("HMAC_SECRET"))
 
 // Function called in main.go to connect app state to current file
@@ -34,6 +36,13 @@ type AuthToken struct {
 	UserID string `json:"userID"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// Session (refresh token family) the token was issued for. Rejected once the session is revoked
+	SessionID string `json:"sid,omitempty"`
+	// Set when the user must set up two-factor authentication before accessing anything else
+	TwoFactorSetupRequired bool `json:"2fa_setup,omitempty"`
+	// Set when the request is authenticated using an API key (never part of a JWT)
+	ApiKeyID     uint             `json:"-"`
+	ApiKeyScopes []db.ApiKeyScope `json:"-"`
 	jwt.RegisteredClaims
 }
 
@@ -72,26 +81,28 @@ func EnforcerSetup(db *gorm.DB, setupDefaultPolicy bool) (*config.AuthEnforcer,
 	return &config.AuthEnforcer{Enforcer: enforcer, Adapter: adapter}, nil
 }
 
-// Generates a JSON web token based on user's details
-func GenerateJWT(userID int, email, roleName string) (string, error) {
+// Generates a short-lived access token (JSON web token) for a user's session (see AccessTokenTTL).
+// Tokens of users who must set up two-factor authentication only give access to the enrolment pages
+func GenerateAccessToken(userID int, email, roleName, sessionID string, twoFactorSetupRequired bool) (string, error) {
 	// Build expiration time
-	expirationTime := time.Now().Add(12 * time.Hour)
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	// Build claims to be stored in token
 	claims := &AuthToken{
 		Email: email,
 		// Convert ID to string
-		UserID: fmt.Sprint(userID),
-		Role:   roleName,
+		UserID:    fmt.Sprint(userID),
+		Role:      roleName,
+		SessionID: sessionID,
+		// Only the enrolment pages are accessible until two-factor authentication is set up
+		TwoFactorSetupRequired: twoFactorSetupRequired,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
 	}
 
-	// Create new token using built claims and signing method
-	authToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	// Decrypt token using key to generate string
-	tokenString, err := authToken.SignedString(JWTKey)
+	// Sign token using the newest signing key (see keys.go)
+	tokenString, err := signToken(claims)
 	// If error
 	if err != nil {
 		return "", err
@@ -105,7 +116,11 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 	// Grab request header
 	header := r.Header
 	// Extract token string from Authorization header by removing prefix "Bearer "
-	_, tokenString, _ := strings.Cut(header.Get("Authorization"), " ")
+	scheme, tokenString, _ := strings.Cut(header.Get("Authorization"), " ")
+	// Integrations send API keys instead ("ApiKey <key>")
+	if strings.EqualFold(scheme, ApiKeyScheme) {
+		return validateApiKey(tokenString)
+	}
 
 	// If token string is empty
 	if tokenString == "" {
@@ -129,9 +144,8 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&AuthToken{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWTKey), nil
-		},
+		// Find the key that signed the token
+		verificationKey,
 	)
 	if err != nil {
 		err = errors.New("couldn't parse token")
@@ -154,6 +168,17 @@ func ValidateAndParseToken(r *http.Request) (tokenData *AuthToken, err error) {
 		err = errors.New("token expired")
 		return &AuthToken{}, err
 	}
+
+	// Revocation check (logged out sessions and reused refresh tokens)
+	if claims.SessionID != "" {
+		revoked, err := isSessionRevoked(claims.SessionID)
+		if err != nil {
+			return &AuthToken{}, fmt.Errorf("couldn't check session: %w", err)
+		}
+		if revoked {
+			return &AuthToken{}, errors.New("session revoked")
+		}
+	}
 	// else return claims
 	return claims, nil
 }
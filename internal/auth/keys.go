@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signing keys
+// Access tokens are signed using RS256 (RSA keys) or EdDSA (Ed25519 keys) loaded from PEM files set in
+// JWT_SIGNING_KEYS (comma separated, newest first). The newest key signs new tokens and the older keys are
+// only used to verify tokens, so a key can be rotated without logging everyone out. Each key is identified
+// by its JWK thumbprint (RFC 7638), sent as the "kid" header of the tokens it signs.
+// The public keys are published at /.well-known/jwks.json so other services can verify our tokens.
+// If no keys are set, tokens are signed using HS256 and the HMAC_SECRET (not published)
+
+// SigningKey is a key used to sign or verify access tokens
+type SigningKey struct {
+	// Key ID (JWK thumbprint of the public key)
+	ID     string
+	Method jwt.SigningMethod
+	// Private key (nil for keys that are only used to verify tokens)
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// Signing keys, newest (used to sign) first. Empty if HMAC_SECRET is used instead
+var signingKeys []*SigningKey
+
+// Loads the signing keys from the PEM files set in JWT_SIGNING_KEYS (newest first). Falls back to
+// signing with HMAC_SECRET if not set. Called once the environment variables are loaded
+func LoadSigningKeysFromEnv() error {
+	// Read again, as the secret may be loaded from .env after package initialization
+	JWTKey = []byte(os.Getenv("HMAC_SECRET"))
+
+	var keys []*SigningKey
+	for _, path := range strings.Split(os.Getenv("JWT_SIGNING_KEYS"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed reading signing key: %w", err)
+		}
+		key, err := ParseSigningKey(data)
+		if err != nil {
+			return fmt.Errorf("failed loading signing key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 && len(JWTKey) == 0 {
+		return errors.New("JWT_SIGNING_KEYS or HMAC_SECRET must be set to sign access tokens")
+	}
+	return SetSigningKeys(keys...)
+}
+
+// Sets the keys used to sign and verify access tokens. The first key signs new tokens and must include
+// its private key. Signing falls back to HMAC_SECRET if no keys are given
+func SetSigningKeys(keys ...*SigningKey) error {
+	if len(keys) > 0 && keys[0].Private == nil {
+		return errors.New("the newest signing key must be a private key")
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if seen[key.ID] {
+			return fmt.Errorf("duplicate signing key %s", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	signingKeys = keys
+	return nil
+}
+
+// Parses a PEM encoded RSA or Ed25519 key. Private keys can sign and verify tokens, public keys only verify them
+// Supported blocks: PRIVATE KEY (PKCS #8), RSA PRIVATE KEY (PKCS #1), PUBLIC KEY (PKIX) and RSA PUBLIC KEY (PKCS #1)
+func ParseSigningKey(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{}
+	switch parsed := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, parsed, &parsed.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, parsed
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, parsed, parsed.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, parsed
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (expected RSA or Ed25519)", parsed)
+	}
+	if rsaKey, ok := key.Public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("RSA keys must be at least 2048 bits, got %d", rsaKey.N.BitLen())
+	}
+
+	// Identify the key by its thumbprint
+	jwk := key.JWK()
+	key.ID = jwk.thumbprint()
+	return key, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA modulus and exponent
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 curve and public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a set of public keys (as published at /.well-known/jwks.json)
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Returns the public key in the JWK format
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch public := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// Returns the public keys used to verify access tokens (empty when signing with HMAC_SECRET)
+func PublicKeys() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range signingKeys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
+
+// Returns the JWK thumbprint (RFC 7638): the hash of the required members in lexicographic order
+func (jwk JWK) thumbprint() string {
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Signs the claims using the newest signing key (or HMAC_SECRET if no keys are set)
+func signToken(claims jwt.Claims) (string, error) {
+	if len(signingKeys) == 0 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JWTKey)
+	}
+	key := signingKeys[0]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Returns the key that verifies a token. The key is found using the "kid" header and must match
+// the algorithm of the token, so tokens can't choose how they're verified
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if len(signingKeys) == 0 {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return JWTKey, nil
+	}
+	keyID, _ := token.Header["kid"].(string)
+	for _, key := range signingKeys {
+		if key.ID == keyID {
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), keyID)
+			}
+			return key.Public, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", keyID)
+}
@@ -0,0 +1,209 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Builds PEM encoded RSA and Ed25519 keys in the supported formats
+func buildPEMKeys(t *testing.T) map[string][]byte {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPKCS8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKCS8, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKIX, err := x509.MarshalPKIXPublicKey(edPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(blockType string, data []byte) []byte {
+		return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data})
+	}
+	return map[string][]byte{
+		"rsa-pkcs8":      encode("PRIVATE KEY", rsaPKCS8),
+		"rsa-pkcs1":      encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+		"rsa-public":     encode("PUBLIC KEY", rsaPublic),
+		"rsa-small":      encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(smallRSAKey)),
+		"ed25519":        encode("PRIVATE KEY", edPKCS8),
+		"ed25519-public": encode("PUBLIC KEY", edPKIX),
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	keys := buildPEMKeys(t)
+
+	var tests = []struct {
+		name          string
+		data          []byte
+		expectedAlg   string
+		expectPrivate bool
+		expectError   bool
+	}{
+		{"RSA PKCS #8", keys["rsa-pkcs8"], "RS256", true, false},
+		{"RSA PKCS #1", keys["rsa-pkcs1"], "RS256", true, false},
+		{"RSA public key", keys["rsa-public"], "RS256", false, false},
+		{"Ed25519", keys["ed25519"], "EdDSA", true, false},
+		{"Ed25519 public key", keys["ed25519-public"], "EdDSA", false, false},
+		{"RSA key under 2048 bits", keys["rsa-small"], "", false, true},
+		{"Not PEM", []byte("secret"), "", false, true},
+	}
+	for _, v := range tests {
+		key, err := auth.ParseSigningKey(v.data)
+		if (err != nil) != v.expectError {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.expectError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if key.Method.Alg() != v.expectedAlg || (key.Private != nil) != v.expectPrivate || key.ID == "" {
+			t.Errorf("%s: unexpected key %+v", v.name, key)
+		}
+	}
+
+	// The key ID is derived from the public key, so a private key and its public key share it
+	private, _ := auth.ParseSigningKey(keys["rsa-pkcs1"])
+	public, _ := auth.ParseSigningKey(keys["rsa-public"])
+	if private.ID != public.ID {
+		t.Errorf("Expected private and public keys to share an ID, got %s and %s", private.ID, public.ID)
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	keys := buildPEMKeys(t)
+	oldKey, _ := auth.ParseSigningKey(keys["ed25519"])
+	newKey, _ := auth.ParseSigningKey(keys["rsa-pkcs8"])
+	// Restore signing with HMAC_SECRET
+	t.Cleanup(func() { auth.SetSigningKeys() })
+
+	// Token signed before the rotation
+	if err := auth.SetSigningKeys(oldKey); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := auth.GenerateAccessToken(1, "rotation@example.com", "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// During the grace period, the new key signs and the old key still verifies
+	if err := auth.SetSigningKeys(newKey, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := auth.GenerateAccessToken(1, "rotation@example.com", "user", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(newToken, &auth.AuthToken{})
+	if err != nil || parsed.Header["kid"] != newKey.ID || parsed.Method.Alg() != "RS256" {
+		t.Errorf("Expected token signed by the new key, got %v (%v)", parsed.Header, err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := validate(token); err != nil {
+			t.Errorf("Expected %s token to be valid during the grace period, got %v", name, err)
+		}
+	}
+	if jwks := auth.PublicKeys(); len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != newKey.ID {
+		t.Errorf("Expected both public keys to be published, got %+v", jwks)
+	}
+
+	// Once the old key is removed, its tokens are rejected
+	if err := auth.SetSigningKeys(newKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validate(oldToken); err == nil {
+		t.Errorf("Expected token of removed key to be rejected")
+	}
+
+	// Tokens can't pick another algorithm for a key (eg. HMAC using the public key as the secret)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.AuthToken{UserID: "1", Role: "admin"})
+	forged.Header["kid"] = newKey.ID
+	publicKey, _ := x509.MarshalPKIXPublicKey(newKey.Public)
+	forgedToken, _ := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+	if _, err := validate(forgedToken); err == nil {
+		t.Errorf("Expected token using another algorithm to be rejected")
+	}
+
+	// The newest key must be able to sign
+	public, _ := auth.ParseSigningKey(keys["rsa-public"])
+	if err := auth.SetSigningKeys(public); err == nil {
+		t.Errorf("Expected error setting a public key as the newest key")
+	}
+}
+
+func TestLoadSigningKeysFromEnv(t *testing.T) {
+	keys := buildPEMKeys(t)
+	dir := t.TempDir()
+	for _, name := range []string{"ed25519", "rsa-pkcs1"} {
+		if err := os.WriteFile(filepath.Join(dir, name+".pem"), keys[name], 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Restore signing with the original HMAC_SECRET
+	hmacSecret := auth.JWTKey
+	t.Cleanup(func() {
+		auth.JWTKey = hmacSecret
+		auth.SetSigningKeys()
+	})
+
+	var tests = []struct {
+		keys         string
+		hmacSecret   string
+		expectedKeys int
+		expectError  bool
+	}{
+		{filepath.Join(dir, "ed25519.pem") + ", " + filepath.Join(dir, "rsa-pkcs1.pem"), "", 2, false},
+		{"", "secret", 0, false},
+		// Nothing to sign with
+		{"", "", 0, true},
+		{filepath.Join(dir, "missing.pem"), "secret", 0, true},
+	}
+	for _, v := range tests {
+		t.Setenv("JWT_SIGNING_KEYS", v.keys)
+		t.Setenv("HMAC_SECRET", v.hmacSecret)
+		err := auth.LoadSigningKeysFromEnv()
+		if (err != nil) != v.expectError {
+			t.Errorf("%q: expected error %v, got %v", v.keys, v.expectError, err)
+			continue
+		}
+		if err == nil && len(auth.PublicKeys().Keys) != v.expectedKeys {
+			t.Errorf("%q: expected %d keys, got %+v", v.keys, v.expectedKeys, auth.PublicKeys())
+		}
+	}
+}
+
+// Validates an access token as sent in the Authorization header
+func validate(accessToken string) (*auth.AuthToken, error) {
+	request := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	return auth.ValidateAndParseToken(request)
+}
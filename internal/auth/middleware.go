@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/dmawardi/Go-Template/internal/db"
@@ -25,6 +26,10 @@ func AuthenticateJWT(next http.Handler) http.Handler {
 		if err != nil {
 			// Determine Redirect URL based on object
 			redirectURL := determineInvalidTokenRedirectURL(object)
+			// Return to the requested page once the session is renewed (admin panel pages only)
+			if redirectURL != "" && httpMethod == http.MethodGet {
+				redirectURL += "?next=" + url.QueryEscape(r.URL.RequestURI())
+			}
 			// If redirect URL is  empty
 			if redirectURL == "" {
 				http.Error(w, "Error parsing authentication token", http.StatusForbidden)
@@ -35,8 +40,23 @@ func AuthenticateJWT(next http.Handler) http.Handler {
 			return
 		}
 
+		// Users who must set up two-factor authentication can only access the enrolment pages until they do
+		if tokenData.TwoFactorSetupRequired && !isTwoFactorEnrolmentPath(object) {
+			// Admin panel pages are redirected to the enrolment page
+			if determineInvalidTokenRedirectURL(object) != "" {
+				http.Redirect(w, r, "/admin/two-factor", http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Two-factor authentication must be set up", http.StatusForbidden)
+			return
+		}
+
 		// Enforce RBAC policy and determine if user is authorized to perform action
 		allowed := Authorize(tokenData.UserID, object, action)
+		// API keys are also restricted to their scopes
+		if allowed && tokenData.ApiKeyID != 0 {
+			allowed = ApiKeyScopesAllow(tokenData.ApiKeyScopes, object, action)
+		}
 
 		// If not allowed
 		if !allowed {
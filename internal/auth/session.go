@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+)
+
+// Sessions
+// A login starts a session: a short-lived access token (JWT) paired with a refresh token.
+// Refresh tokens are rotated on every use, and the tokens rotated from the same login form a family
+// identified by the session ID carried in the access tokens. Revoking the family ends the session
+
+// Default lifetimes of access and refresh tokens
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Lifetimes of access and refresh tokens (set using ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL)
+var (
+	AccessTokenTTL  = DefaultAccessTokenTTL
+	RefreshTokenTTL = DefaultRefreshTokenTTL
+)
+
+// Name of the cookie holding the refresh token in the admin panel
+const RefreshTokenCookie = "refresh_token"
+
+// How long the revocation status of a session is cached, so every request doesn't query the database.
+// Revoking a session through this instance (or a shared cache) takes effect immediately
+const sessionCacheTTL = time.Minute
+
+// Sets the token lifetimes from the ACCESS_TOKEN_TTL and REFRESH_TOKEN_TTL environment variables (eg. "15m", "720h").
+// The defaults are used for unset variables
+func SetTokenLifetimesFromEnv() error {
+	accessTTL, err := durationFromEnv("ACCESS_TOKEN_TTL", DefaultAccessTokenTTL)
+	if err != nil {
+		return err
+	}
+	refreshTTL, err := durationFromEnv("REFRESH_TOKEN_TTL", DefaultRefreshTokenTTL)
+	if err != nil {
+		return err
+	}
+	AccessTokenTTL, RefreshTokenTTL = accessTTL, refreshTTL
+	return nil
+}
+
+// Generates a random token (eg. a refresh token or a password reset token).
+// Returns the token (sent to the client) and its hash (stored)
+func GenerateToken() (token string, hash string, err error) {
+	token, err = utility.GenerateRandomString(48)
+	if err != nil {
+		return "", "", fmt.Errorf("failed generating token: %w", err)
+	}
+	return token, HashToken(token), nil
+}
+
+// Returns the hex encoded SHA-256 hash of a token (as stored in the database)
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Generates a random session ID (shared by a family of refresh tokens)
+func GenerateSessionID() (string, error) {
+	sessionID, err := utility.GenerateRandomString(32)
+	if err != nil {
+		return "", fmt.Errorf("failed generating session ID: %w", err)
+	}
+	return sessionID, nil
+}
+
+// Records a revoked session in the cache, so access tokens of the session are rejected without
+// waiting for the cached status to expire. Called once the refresh token family has been revoked
+func SessionRevoked(sessionID string) {
+	sessions := sessionCache()
+	// Invalidating the key also stops a check in flight from caching the status it read before the revocation
+	app.Cache.InvalidateTags(sessions.Key(sessionID))
+	// Every access token of the session has expired once the access token lifetime has passed
+	sessions.Set(sessionID, true, AccessTokenTTL)
+}
+
+// Checks whether a session has been revoked. The status is cached briefly
+func isSessionRevoked(sessionID string) (bool, error) {
+	return sessionCache().GetOrLoad(sessionID, sessionCacheTTL, func() (bool, error) {
+		var revoked int64
+		result := app.DbClient.Model(&db.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NOT NULL", sessionID).
+			Count(&revoked)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return revoked > 0, nil
+	})
+}
+
+// Cache of session revocation statuses, shared by every check so concurrent misses call the database once
+var sessionStatuses = struct {
+	mu sync.Mutex
+	// App cache the typed cache was built on
+	built cache.Cache
+	typed *cache.Typed[bool]
+}{}
+
+// Returns the cache of session revocation statuses (true if revoked).
+// Built on first use and rebuilt if the app cache is replaced after the auth state is set
+func sessionCache() *cache.Typed[bool] {
+	sessionStatuses.mu.Lock()
+	defer sessionStatuses.mu.Unlock()
+	if sessionStatuses.typed == nil || sessionStatuses.built != app.Cache {
+		sessionStatuses.built = app.Cache
+		sessionStatuses.typed = cache.NewTyped[bool](app.Cache, "session", cache.TypedOptions[bool]{})
+	}
+	return sessionStatuses.typed
+}
+
+// Used to set the refresh token cookie in the admin panel. Only sent to the admin panel
+func SetRefreshTokenCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    token,
+		Expires:  time.Now().Add(RefreshTokenTTL),
+		HttpOnly: true,
+		Secure:   true, // Set to false if not using HTTPS
+		Path:     "/admin",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Clears the access and refresh token cookies of the admin panel
+func ClearAuthCookies(w http.ResponseWriter) {
+	for _, cookie := range []http.Cookie{{Name: "jwt_token", Path: "/"}, {Name: RefreshTokenCookie, Path: "/admin"}} {
+		cookie.Value = ""
+		cookie.Expires = time.Unix(0, 0)
+		cookie.HttpOnly = true
+		cookie.Secure = true // Set to false if not using HTTPS
+		http.SetCookie(w, &cookie)
+	}
+}
+
+// Returns the duration set in an environment variable or the default if not set
+func durationFromEnv(key string, defaultDuration time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultDuration, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (expected a duration such as 15m)", key, value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// TOTP (RFC 6238)
+// Time-based one time passwords as generated by authenticator apps: HMAC-SHA1 of the number of
+// 30 second steps since the Unix epoch, truncated to 6 digits (RFC 4226). Secrets are base32 encoded.
+
+// Number of digits of a code
+const TOTPDigits = 6
+
+// Duration of a time step (how often codes change)
+const TOTPPeriod = 30 * time.Second
+
+// Steps before and after the current one that are accepted, to allow for clock drift
+const totpSkew = 1
+
+// Secrets are encoded without padding, as expected by authenticator apps
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Generates a random 160 bit secret (the size of a SHA-1 hash, as recommended by RFC 4226)
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// Returns the time step of a time
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// Generates the code of a secret for a time step
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(step)), nil
+}
+
+// Validates a code at the given time. Returns the time step the code belongs to,
+// so callers can reject codes that were already used
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := TOTPStep(t)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, uint64(step))), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Builds the otpauth:// URI that authenticator apps scan (as a QR code) to add an account
+func TOTPURI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(TOTPDigits))
+	values.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + values.Encode()
+}
+
+// Encodes an otpauth:// URI as a QR code PNG data URI (can be used as the src of an image)
+func TOTPQRCode(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", fmt.Errorf("failed generating QR code: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// Name shown for the account in authenticator apps (TWO_FACTOR_ISSUER)
+func TOTPIssuer() string {
+	if issuer := os.Getenv("TWO_FACTOR_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Go-Template"
+}
+
+// HOTP (RFC 4226): HMAC-SHA1 of the counter, dynamically truncated to a number of TOTPDigits digits
+func hotp(key []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, code%modulo)
+}
+
+// Decodes a base32 secret (case insensitive, with or without padding)
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "=")
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,108 @@
+package auth_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+)
+
+// Secret of the RFC 6238 test vectors ("12345678901234567890" in base32)
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B (SHA-1), truncated to 6 digits
+	var tests = []struct {
+		unixTime     int64
+		expectedCode string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range tests {
+		code, err := auth.TOTPCode(rfcSecret, auth.TOTPStep(time.Unix(v.unixTime, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.expectedCode {
+			t.Errorf("%d: expected %s, got %s", v.unixTime, v.expectedCode, code)
+		}
+	}
+
+	if _, err := auth.TOTPCode("not base32!", 1); err == nil {
+		t.Errorf("Expected error for invalid secret")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := auth.TOTPStep(now)
+
+	var tests = []struct {
+		name          string
+		code          string
+		expectedStep  int64
+		expectedValid bool
+	}{
+		{"Current code", "081804", step, true},
+		{"Code with spaces", "081 804", step, true},
+		{"Previous code (clock drift)", codeAt(t, step-1), step - 1, true},
+		{"Next code (clock drift)", codeAt(t, step+1), step + 1, true},
+		{"Fail: Expired code", codeAt(t, step-2), 0, false},
+		{"Fail: Wrong code", "000000", 0, false},
+		{"Fail: Wrong length", "81804", 0, false},
+	}
+	for _, v := range tests {
+		matched, valid := auth.ValidateTOTP(rfcSecret, v.code, now)
+		if valid != v.expectedValid || matched != v.expectedStep {
+			t.Errorf("%s: expected %v (step %d), got %v (step %d)", v.name, v.expectedValid, v.expectedStep, valid, matched)
+		}
+	}
+
+	// Secrets are case insensitive and padding is optional
+	if _, valid := auth.ValidateTOTP(strings.ToLower(rfcSecret)+"====", "081804", now); !valid {
+		t.Errorf("Expected lower case secret to be accepted")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("Expected 32 character secret (160 bits), got %q", secret)
+	}
+
+	uri, err := url.Parse(auth.TOTPURI("Go Template", "user@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Go Template:user@example.com" {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != secret || query.Get("issuer") != "Go Template" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("Unexpected URI parameters %v", query)
+	}
+
+	qrCode, err := auth.TOTPQRCode(uri.String())
+	if err != nil || !strings.HasPrefix(qrCode, "data:image/png;base64,") {
+		t.Errorf("Expected PNG data URI, got %.40q (%v)", qrCode, err)
+	}
+}
+
+// Returns the code of the test secret for a time step
+func codeAt(t *testing.T, step int64) string {
+	code, err := auth.TOTPCode(rfcSecret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
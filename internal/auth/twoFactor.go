@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Two-factor authentication
+// Users who enrolled a TOTP authenticator log in in two steps: the password check returns a challenge
+// token, which is exchanged for a session along with a code from the authenticator (or a recovery code).
+// Two-factor authentication can be required per role, either in TWO_FACTOR_REQUIRED_ROLES (eg. "admin,moderator")
+// or with a Casbin policy granting the "required" action on the "two-factor" object (eg. "p,role:admin,two-factor,required").
+// Users who must use it but haven't enrolled can only access the enrolment pages until they do
+
+// Casbin object and action requiring two-factor authentication for a role
+const (
+	TwoFactorPolicyObject = "two-factor"
+	TwoFactorPolicyAction = "required"
+)
+
+// Name of the cookie holding the login challenge between the two login steps of the admin panel
+const TwoFactorChallengeCookie = "two_factor_challenge"
+
+// Paths that users who must set up two-factor authentication can still access
+var twoFactorEnrolmentPaths = []string{"/api/me/2fa", "/admin/two-factor"}
+
+// Checks whether a user must use two-factor authentication, based on their role (config) or their Casbin policies
+func TwoFactorRequired(userID, role string) bool {
+	for _, requiredRole := range strings.Split(os.Getenv("TWO_FACTOR_REQUIRED_ROLES"), ",") {
+		if requiredRole = strings.TrimSpace(requiredRole); requiredRole != "" && requiredRole == role {
+			return true
+		}
+	}
+	return Authorize(userID, TwoFactorPolicyObject, TwoFactorPolicyAction)
+}
+
+// Checks whether a path is one of the two-factor enrolment pages
+func isTwoFactorEnrolmentPath(path string) bool {
+	for _, enrolmentPath := range twoFactorEnrolmentPaths {
+		if path == enrolmentPath || strings.HasPrefix(path, enrolmentPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Used to set the login challenge cookie in the admin panel. Only sent to the login pages
+func SetTwoFactorChallengeCookie(w http.ResponseWriter, token string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorChallengeCookie,
+		Value:    token,
+		Expires:  time.Now().Add(ttl),
+		HttpOnly: true,
+		Secure:   true, // Set to false if not using HTTPS
+		Path:     "/admin/login",
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Clears the login challenge cookie of the admin panel
+func ClearTwoFactorChallengeCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TwoFactorChallengeCookie,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Secure:   true, // Set to false if not using HTTPS
+		Path:     "/admin/login",
+	})
+}
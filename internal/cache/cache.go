@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
@@ -8,16 +9,114 @@ import (
 // Used in case no TTL is provided
 const defaultTimeToLive = 10 * time.Minute
 
+// Cache is a key value cache with TTLs and tags. CacheMap is the in memory implementation (per instance of the app)
+// and RedisCache is shared by every instance (see NewFromEnv)
+type Cache interface {
+	// Store adds a value with an optional TTL (the default TTL is used if not provided)
+	Store(key, value interface{}, ttl ...time.Duration)
+	// StoreTagged adds a value with a TTL and tags (see InvalidateTags)
+	StoreTagged(key, value interface{}, ttl time.Duration, tags ...string)
+	// Load retrieves an unexpired value
+	Load(key interface{}) (interface{}, bool)
+	Delete(key interface{})
+	// InvalidateTags removes every entry tagged with any of the tags. Returns the number of entries removed
+	InvalidateTags(tags ...string) int
+	// Stats returns the lookup and removal counters and the size of the cache (where known)
+	Stats() Stats
+	// Close releases the resources of the cache (eg. stops the janitor or closes the connection)
+	Close()
+}
+
+// Implemented by caches that can look up a value without counting the lookup
+type peeker interface {
+	peek(key interface{}) (interface{}, bool)
+}
+
+// Implemented by caches that count tag invalidations, so loads in flight can tell their result may be stale
+type generational interface {
+	generation() uint64
+}
+
 // Entry represents a cache entry with a value and an expiration timestamp
 type Entry struct {
 	Value      interface{}
 	Expiration int64
 }
 
-// CacheMap wraps sync.Map and provides basic TTL functionality
+// Options bound the size of a cache and set how often expired entries are removed.
+// Zero values leave the cache unbounded and without a janitor
+type Options struct {
+	// Maximum number of entries. The least recently used entries are evicted to make room
+	MaxEntries int
+	// Memory budget in bytes (estimated using EstimateSize). The least recently used entries are evicted to stay within it
+	MaxBytes int64
+	// How often the janitor removes expired entries
+	CleanupInterval time.Duration
+}
+
+// Stats counts the cache lookups and removals since the cache was created
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// Entries removed to stay within the size bounds
+	Evictions uint64 `json:"evictions"`
+	// Entries removed because their TTL passed
+	Expirations uint64 `json:"expirations"`
+	// Current size
+	Entries int   `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// CacheMap is an in memory cache with TTLs and least recently used (LRU) eviction.
+// It is safe for concurrent use. The zero value is an unbounded cache without a janitor (see New)
 // Example usage: m.Store("key", "value", 10 * time.Second)
 type CacheMap struct {
-	internal sync.Map
+	mu      sync.Mutex
+	options Options
+	// Key => element of the LRU list (most recently used at the front)
+	items map[interface{}]*list.Element
+	lru   *list.List
+	bytes int64
+	stats Stats
+	// Tag => keys of the entries tagged with it
+	tags map[string]map[interface{}]struct{}
+	// Incremented on every tag invalidation, so loads in flight can tell their result may be stale
+	invalidations uint64
+	// Stops the janitor
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  sync.WaitGroup
+}
+
+// Entry stored in the LRU list
+type item struct {
+	key   interface{}
+	entry Entry
+	size  int64
+	tags  []string
+}
+
+// New builds a cache bounded by the options. If a cleanup interval is set, a janitor goroutine
+// removes expired entries until Close is called
+// Example usage: c := cache.New(cache.Options{MaxEntries: 10000, CleanupInterval: time.Minute})
+func New(options Options) *CacheMap {
+	m := &CacheMap{options: options}
+	if options.CleanupInterval > 0 {
+		m.stop = make(chan struct{})
+		m.stopped.Add(1)
+		go m.janitor(options.CleanupInterval)
+	}
+	return m
+}
+
+// Close stops the janitor (if running) and waits for it to exit. The cache can still be used
+func (m *CacheMap) Close() {
+	m.stopOnce.Do(func() {
+		if m.stop != nil {
+			close(m.stop)
+		}
+	})
+	m.stopped.Wait()
 }
 
 // Store adds a value to the map with a specified TTL (in seconds)
@@ -34,35 +133,194 @@ func (m *CacheMap) Store(key, value interface{}, ttl ...time.Duration) {
 	} else {
 		ttlValue = defaultTimeToLive
 	}
+	m.StoreTagged(key, value, ttlValue)
+}
 
+// StoreTagged adds a value to the map with a TTL and tags. InvalidateTags removes every entry with a given tag,
+// so an entry can be tagged with the entities it contains (see EntityTag and ListTag)
+// Example usage: m.StoreTagged("post:5", post, 10*time.Minute, cache.EntityTag("user", post.UserID))
+func (m *CacheMap) StoreTagged(key, value interface{}, ttl time.Duration, tags ...string) {
 	// Create expiration timestamp
-	expiration := time.Now().Add(ttlValue).UnixNano()
+	expiration := time.Now().Add(ttl).UnixNano()
 	// Build entry
 	entry := Entry{Value: value, Expiration: expiration}
-	// Store entry
-	m.internal.Store(key, entry)
+	// Only estimate sizes when there is a memory budget
+	var size int64
+	if m.options.MaxBytes > 0 {
+		size = EstimateSize(key) + EstimateSize(value) + EstimateSize(tags)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+	// Replace the existing entry
+	if element, found := m.items[key]; found {
+		m.removeElement(element)
+	}
+	// Values larger than the whole budget are never stored
+	if m.options.MaxBytes > 0 && size > m.options.MaxBytes {
+		m.stats.Evictions++
+		return
+	}
+	// Store entry as the most recently used
+	m.items[key] = m.lru.PushFront(&item{key: key, entry: entry, size: size, tags: tags})
+	m.bytes += size
+	for _, tag := range tags {
+		if m.tags[tag] == nil {
+			m.tags[tag] = make(map[interface{}]struct{})
+		}
+		m.tags[tag][key] = struct{}{}
+	}
+	m.evict()
 }
 
 // Load retrieves a value from the map, considering its TTL
 // Example usage: value, ok := m.Load("key")
 func (m *CacheMap) Load(key interface{}) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	// Load entry using key
-	result, ok := m.internal.Load(key)
+	element, ok := m.items[key]
 	if !ok {
+		m.stats.Misses++
 		return nil, false
 	}
 	// If found,
-	entry := result.(Entry)
+	found := element.Value.(*item)
 	// check if expired
-	if time.Now().UnixNano() > entry.Expiration {
+	if time.Now().UnixNano() > found.entry.Expiration {
 		// If expired, delete entry and return false
-		m.internal.Delete(key) // Remove expired entry
+		m.removeElement(element) // Remove expired entry
+		m.stats.Expirations++
+		m.stats.Misses++
+		return nil, false
+	}
+	// If not expired, mark as most recently used and return value and true
+	m.lru.MoveToFront(element)
+	m.stats.Hits++
+	return found.entry.Value, true
+}
+
+// Returns an unexpired value without counting the lookup or marking it as used
+func (m *CacheMap) peek(key interface{}) (interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.items[key]
+	if !ok || time.Now().UnixNano() > element.Value.(*item).entry.Expiration {
 		return nil, false
 	}
-	// If not expired, return value and true
-	return entry.Value, true
+	return element.Value.(*item).entry.Value, true
 }
 
 func (m *CacheMap) Delete(key interface{}) {
-	m.internal.Delete(key)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, found := m.items[key]; found {
+		m.removeElement(element)
+	}
+}
+
+// InvalidateTags removes every entry tagged with any of the tags. Returns the number of entries removed
+// Example usage: m.InvalidateTags(cache.EntityTag("user", 5), cache.ListTag("post"))
+func (m *CacheMap) InvalidateTags(tags ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invalidations++
+	removed := 0
+	for _, tag := range tags {
+		for key := range m.tags[tag] {
+			if element, found := m.items[key]; found {
+				m.removeElement(element)
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+// DeleteExpired removes every expired entry. Returns the number of entries removed
+func (m *CacheMap) DeleteExpired() int {
+	now := time.Now().UnixNano()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for _, element := range m.items {
+		if now > element.Value.(*item).entry.Expiration {
+			m.removeElement(element)
+			removed++
+		}
+	}
+	m.stats.Expirations += uint64(removed)
+	return removed
+}
+
+// Len returns the number of entries (including expired entries the janitor hasn't removed yet)
+func (m *CacheMap) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+// Stats returns the hit, miss and eviction counters and the current size of the cache
+func (m *CacheMap) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := m.stats
+	stats.Entries = len(m.items)
+	stats.Bytes = m.bytes
+	return stats
+}
+
+// Removes expired entries every interval until the cache is closed
+func (m *CacheMap) janitor(interval time.Duration) {
+	defer m.stopped.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.DeleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Returns the number of tag invalidations so far
+func (m *CacheMap) generation() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.invalidations
+}
+
+// Initializes the zero value (lock must be held)
+func (m *CacheMap) init() {
+	if m.items == nil {
+		m.items = make(map[interface{}]*list.Element)
+		m.lru = list.New()
+		m.tags = make(map[string]map[interface{}]struct{})
+	}
+}
+
+// Evicts the least recently used entries until the cache is within its bounds (lock must be held)
+func (m *CacheMap) evict() {
+	for m.lru.Len() > 0 &&
+		((m.options.MaxEntries > 0 && m.lru.Len() > m.options.MaxEntries) ||
+			(m.options.MaxBytes > 0 && m.bytes > m.options.MaxBytes)) {
+		m.removeElement(m.lru.Back())
+		m.stats.Evictions++
+	}
+}
+
+// Removes an entry (lock must be held)
+func (m *CacheMap) removeElement(element *list.Element) {
+	removed := m.lru.Remove(element).(*item)
+	delete(m.items, removed.key)
+	m.bytes -= removed.size
+	for _, tag := range removed.tags {
+		delete(m.tags[tag], removed.key)
+		if len(m.tags[tag]) == 0 {
+			delete(m.tags, tag)
+		}
+	}
 }
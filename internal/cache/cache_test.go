@@ -0,0 +1,217 @@
+package cache_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+)
+
+func TestCacheMap_LRU(t *testing.T) {
+	c := cache.New(cache.Options{MaxEntries: 2})
+	c.Store("a", 1)
+	c.Store("b", 2)
+	// Reading a makes b the least recently used entry
+	c.Load("a")
+	c.Store("c", 3)
+
+	var tests = []struct {
+		key   string
+		found bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+	for _, v := range tests {
+		if _, found := c.Load(v.key); found != v.found {
+			t.Errorf("%s: expected found to be %v, got %v", v.key, v.found, found)
+		}
+	}
+	if stats := c.Stats(); stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Expected 2 entries, 1 eviction, 3 hits and 1 miss, got %+v", stats)
+	}
+}
+
+func TestCacheMap_MaxBytes(t *testing.T) {
+	value := strings.Repeat("x", 1000)
+	c := cache.New(cache.Options{MaxBytes: 3500})
+	for i := 0; i < 5; i++ {
+		c.Store(i, value)
+	}
+
+	stats := c.Stats()
+	if stats.Bytes > 3500 || stats.Entries != 3 || stats.Evictions != 2 {
+		t.Errorf("Expected 3 entries within 3500 bytes, got %+v", stats)
+	}
+	// The oldest entries were evicted
+	if _, found := c.Load(0); found {
+		t.Errorf("Expected the least recently used entry to be evicted")
+	}
+	// Values larger than the budget aren't stored
+	c.Store("large", strings.Repeat("x", 5000))
+	if _, found := c.Load("large"); found {
+		t.Errorf("Expected value larger than the budget not to be stored")
+	}
+}
+
+func TestCacheMap_Janitor(t *testing.T) {
+	c := cache.New(cache.Options{CleanupInterval: 10 * time.Millisecond})
+	defer c.Close()
+	c.Store("short", 1, time.Millisecond)
+	c.Store("long", 2, time.Hour)
+
+	// Expired entries are removed without being loaded
+	deadline := time.Now().Add(time.Second)
+	for c.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.Len() != 1 || c.Stats().Expirations != 1 {
+		t.Errorf("Expected the janitor to remove the expired entry, got %+v", c.Stats())
+	}
+
+	// Closing stops the janitor (and can be repeated)
+	c.Close()
+	c.Close()
+	c.Store("after close", 3, time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if c.Len() != 2 {
+		t.Errorf("Expected the janitor to be stopped, got %d entries", c.Len())
+	}
+}
+
+func TestCacheMap_ZeroValue(t *testing.T) {
+	var c cache.CacheMap
+	if _, found := c.Load("missing"); found {
+		t.Errorf("Expected empty cache")
+	}
+	c.Store("key", "value", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if _, found := c.Load("key"); found {
+		t.Errorf("Expected expired entry not to be found")
+	}
+	c.Delete("key")
+	c.Close()
+}
+
+func TestCacheMap_Concurrent(t *testing.T) {
+	c := cache.New(cache.Options{MaxEntries: 50, MaxBytes: 1 << 20, CleanupInterval: time.Millisecond})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 16; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := fmt.Sprintf("post:%d", (worker*i)%100)
+				if _, found := c.Load(key); !found {
+					c.Store(key, &struct{ Title string }{key}, time.Duration(i%5)*time.Millisecond)
+				}
+				if i%50 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Entries > 50 || stats.Hits+stats.Misses != 16*500 {
+		t.Errorf("Expected at most 50 entries and every lookup counted, got %+v", stats)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	var tests = []struct {
+		name       string
+		maxEntries string
+		maxMemory  string
+		interval   string
+		expected   cache.Options
+		valid      bool
+	}{
+		{"Defaults", "", "", "", cache.Options{CleanupInterval: time.Minute}, true},
+		{"Bounded", "10000", "64MB", "30s", cache.Options{MaxEntries: 10000, MaxBytes: 64 << 20, CleanupInterval: 30 * time.Second}, true},
+		{"Bytes without unit", "", "2048", "", cache.Options{MaxBytes: 2048, CleanupInterval: time.Minute}, true},
+		{"Invalid entries", "many", "", "", cache.Options{}, false},
+		{"Invalid memory", "", "lots", "", cache.Options{}, false},
+		{"Invalid interval", "", "", "often", cache.Options{}, false},
+	}
+	for _, v := range tests {
+		options, err := cache.ParseOptions(v.maxEntries, v.maxMemory, v.interval)
+		if (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, err)
+			continue
+		}
+		if v.valid && options != v.expected {
+			t.Errorf("%s: expected %+v, got %+v", v.name, v.expected, options)
+		}
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	type post struct {
+		Title string
+		Tags  []string
+		Next  *post
+	}
+	shared := strings.Repeat("x", 100)
+	small := cache.EstimateSize(&post{Title: "Hi"})
+	large := cache.EstimateSize(&post{Title: shared, Tags: []string{shared, shared}})
+	if small <= 0 || large < small+300 {
+		t.Errorf("Expected sizes to grow with the referenced memory, got %d and %d", small, large)
+	}
+	// Cycles are only counted once
+	cyclic := &post{Title: "Loop"}
+	cyclic.Next = cyclic
+	if size := cache.EstimateSize(cyclic); size <= 0 || size > small*2 {
+		t.Errorf("Expected cyclic value to be counted once, got %d", size)
+	}
+}
+
+func TestCacheMap_InvalidateTags(t *testing.T) {
+	c := cache.New(cache.Options{MaxEntries: 4})
+	c.StoreTagged("post:1", "Post 1", time.Minute, "post:1", "user:1")
+	c.StoreTagged("post:2", "Post 2", time.Minute, "post:2", "user:2")
+	c.StoreTagged("post:list:1", "Page 1", time.Minute, "post:list", "user:1", "user:2")
+	c.Store("other", "Other")
+
+	var tests = []struct {
+		tags          []string
+		expectRemoved int
+		expectKeys    []string
+	}{
+		// Unknown tags remove nothing
+		{[]string{"user:3"}, 0, []string{"post:1", "post:2", "post:list:1", "other"}},
+		// Entity tags remove every entry embedding the entity
+		{[]string{"user:1"}, 2, []string{"post:2", "other"}},
+		// Removed entries are no longer indexed under their other tags
+		{[]string{"user:1", "post:list"}, 0, []string{"post:2", "other"}},
+		{[]string{"post:2"}, 1, []string{"other"}},
+	}
+	for _, v := range tests {
+		if removed := c.InvalidateTags(v.tags...); removed != v.expectRemoved {
+			t.Errorf("%v: expected %d entries removed, got %d", v.tags, v.expectRemoved, removed)
+		}
+		if c.Len() != len(v.expectKeys) {
+			t.Errorf("%v: expected %d entries, got %d", v.tags, len(v.expectKeys), c.Len())
+		}
+		for _, key := range v.expectKeys {
+			if _, found := c.Load(key); !found {
+				t.Errorf("%v: expected %s to remain", v.tags, key)
+			}
+		}
+	}
+
+	// Evicted entries are removed from the tag index
+	for i := 0; i < 5; i++ {
+		c.StoreTagged(i, i, time.Minute, "number")
+	}
+	if removed := c.InvalidateTags("number"); removed != 4 {
+		t.Errorf("Expected the 4 entries left after eviction to be removed, got %d", removed)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// Values stored in caches shared between instances (eg. RedisCache) are serialized using encoding/gob,
+// prefixed with the name of their type. They are loaded as Serialized values, which typed caches decode
+// into their value type
+
+// Serialized is a value loaded from a cache shared between instances. Decode it into the stored type
+// Example usage: var post *db.Post; err := cached.(cache.Serialized).Decode(&post)
+type Serialized struct {
+	// Type of the stored value (eg. "*db.Post")
+	Type string
+	Data []byte
+}
+
+// Decode decodes the value into the target (a pointer to a value of the stored type)
+func (s Serialized) Decode(target interface{}) error {
+	if err := gob.NewDecoder(bytes.NewReader(s.Data)).Decode(target); err != nil {
+		return fmt.Errorf("failed decoding cached %s: %w", s.Type, err)
+	}
+	return nil
+}
+
+// Returns the name of the type of a value (eg. "*db.Post")
+func typeName(value interface{}) string {
+	return fmt.Sprintf("%T", value)
+}
+
+// Serializes a value with the name of its type
+func encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(typeName(value))
+	buffer.WriteByte('\n')
+	if err := gob.NewEncoder(&buffer).Encode(value); err != nil {
+		return nil, fmt.Errorf("failed encoding %T: %w", value, err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// Splits a value serialized by encode into its type name and data
+func decode(data []byte) (Serialized, error) {
+	name, value, found := bytes.Cut(data, []byte{'\n'})
+	if !found {
+		return Serialized{}, errors.New("failed decoding cached value: missing type")
+	}
+	return Serialized{Type: string(name), Data: value}, nil
+}
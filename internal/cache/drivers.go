@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache drivers (selected using the CACHE_DRIVER environment variable)
+const (
+	// In memory cache per instance of the app (default)
+	DriverMemory = "memory"
+	// Redis cache shared by every instance of the app
+	DriverRedis = "redis"
+)
+
+// Redis server used by the Redis driver unless set using REDIS_URL
+const DefaultRedisURL = "redis://localhost:6379/0"
+
+// NewFromEnv builds the cache for the driver set in the CACHE_DRIVER environment variable.
+// The memory driver is bounded by CACHE_MAX_ENTRIES and CACHE_MAX_MEMORY, and expired entries are removed
+// every CACHE_CLEANUP_INTERVAL. The Redis driver connects to REDIS_URL and prefixes keys with CACHE_PREFIX.
+// Returns an error if the driver is unknown, the settings are invalid or Redis can't be reached
+func NewFromEnv() (Cache, error) {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("CACHE_DRIVER")))
+	switch driver {
+	case "", DriverMemory:
+		options, err := ParseOptions(os.Getenv("CACHE_MAX_ENTRIES"), os.Getenv("CACHE_MAX_MEMORY"), os.Getenv("CACHE_CLEANUP_INTERVAL"))
+		if err != nil {
+			return nil, err
+		}
+		return New(options), nil
+	case DriverRedis:
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			url = DefaultRedisURL
+		}
+		options, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+		}
+		prefix, found := os.LookupEnv("CACHE_PREFIX")
+		if !found {
+			prefix = DefaultRedisPrefix
+		}
+		client := redis.NewClient(options)
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed connecting to Redis: %w", err)
+		}
+		return NewRedis(client, prefix), nil
+	}
+	return nil, fmt.Errorf("unknown cache driver %q (expected %s or %s)", driver, DriverMemory, DriverRedis)
+}
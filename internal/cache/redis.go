@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Prefix of the keys written to Redis unless set using CACHE_PREFIX
+const DefaultRedisPrefix = "cache:"
+
+// Stores a value and adds its key to the sets of its tags. Tag sets are kept as long as their longest entry
+// KEYS: the key, then the tag sets. ARGV: the serialized value and the TTL in milliseconds
+var storeTaggedScript = redis.NewScript(`
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if redis.call('PTTL', KEYS[i]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[i], ARGV[2])
+	end
+end
+return 1
+`)
+
+// Removes the entries in the tag sets and the sets. Returns the number of entries removed
+// KEYS: the tag sets
+var invalidateTagsScript = redis.NewScript(`
+local removed = 0
+for i = 1, #KEYS do
+	for _, key in ipairs(redis.call('SMEMBERS', KEYS[i])) do
+		removed = removed + redis.call('DEL', key)
+	end
+	redis.call('DEL', KEYS[i])
+end
+return removed
+`)
+
+// RedisCache is a cache stored in Redis, shared by every instance of the app. Values are serialized
+// using encoding/gob and loaded as Serialized values (decoded by typed caches). Redis errors are logged
+// and treated as misses, so requests fall back to the database.
+// Tags are stored as Redis sets, so a single Redis server (not a cluster) is expected
+// Example usage: c := cache.NewRedis(redis.NewClient(&redis.Options{Addr: "localhost:6379"}), cache.DefaultRedisPrefix)
+type RedisCache struct {
+	client redis.UniversalClient
+	// Prepended to every key, so the cache can share a Redis database
+	prefix string
+	// Counters of this instance
+	hits          uint64
+	misses        uint64
+	invalidations uint64
+}
+
+// NewRedis builds a cache stored in Redis using the client. Close closes the client
+func NewRedis(client redis.UniversalClient, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// Store adds a value with an optional TTL (the default TTL is used if not provided)
+// Example usage: c.Store("key", "value", 10 * time.Second)
+func (c *RedisCache) Store(key, value interface{}, ttl ...time.Duration) {
+	ttlValue := defaultTimeToLive
+	if len(ttl) > 0 {
+		ttlValue = ttl[0]
+	}
+	c.StoreTagged(key, value, ttlValue)
+}
+
+// StoreTagged adds a value with a TTL and tags (see InvalidateTags)
+func (c *RedisCache) StoreTagged(key, value interface{}, ttl time.Duration, tags ...string) {
+	data, err := encode(value)
+	if err != nil {
+		log.Printf("Cache: %v\n", err)
+		return
+	}
+	// Redis TTLs are at least a millisecond
+	milliseconds := ttl.Milliseconds()
+	if milliseconds < 1 {
+		milliseconds = 1
+	}
+	keys := []string{c.key(key)}
+	for _, tag := range tags {
+		keys = append(keys, c.tagKey(tag))
+	}
+	if err := storeTaggedScript.Run(context.Background(), c.client, keys, data, milliseconds).Err(); err != nil {
+		log.Printf("Cache: failed storing %v: %v\n", key, err)
+	}
+}
+
+// Load retrieves an unexpired value
+// Example usage: value, ok := c.Load("key")
+func (c *RedisCache) Load(key interface{}) (interface{}, bool) {
+	value, found := c.peek(key)
+	if found {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return value, found
+}
+
+func (c *RedisCache) Delete(key interface{}) {
+	if err := c.client.Del(context.Background(), c.key(key)).Err(); err != nil {
+		log.Printf("Cache: failed deleting %v: %v\n", key, err)
+	}
+}
+
+// InvalidateTags removes every entry tagged with any of the tags. Returns the number of entries removed
+// Example usage: c.InvalidateTags(cache.EntityTag("user", 5), cache.ListTag("post"))
+func (c *RedisCache) InvalidateTags(tags ...string) int {
+	atomic.AddUint64(&c.invalidations, 1)
+	if len(tags) == 0 {
+		return 0
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = c.tagKey(tag)
+	}
+	removed, err := invalidateTagsScript.Run(context.Background(), c.client, keys).Int()
+	if err != nil {
+		log.Printf("Cache: failed invalidating tags %v: %v\n", tags, err)
+	}
+	return removed
+}
+
+// Stats returns the hits and misses of this instance. Redis handles expiry and eviction,
+// so the other counters and the size aren't reported
+func (c *RedisCache) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
+
+// Close closes the Redis client
+func (c *RedisCache) Close() {
+	if err := c.client.Close(); err != nil {
+		log.Printf("Cache: failed closing Redis client: %v\n", err)
+	}
+}
+
+// Returns a value without counting the lookup
+func (c *RedisCache) peek(key interface{}) (interface{}, bool) {
+	data, err := c.client.Get(context.Background(), c.key(key)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Cache: failed loading %v: %v\n", key, err)
+		}
+		return nil, false
+	}
+	value, err := decode(data)
+	if err != nil {
+		log.Printf("Cache: %v\n", err)
+		return nil, false
+	}
+	return value, true
+}
+
+// Returns the number of tag invalidations by this instance
+func (c *RedisCache) generation() uint64 {
+	return atomic.LoadUint64(&c.invalidations)
+}
+
+// Returns the Redis key of a cache key
+func (c *RedisCache) key(key interface{}) string {
+	return fmt.Sprintf("%s%v", c.prefix, key)
+}
+
+// Returns the Redis key of the set of keys tagged with a tag
+func (c *RedisCache) tagKey(tag string) string {
+	return c.prefix + "tag:" + tag
+}
@@ -0,0 +1,161 @@
+package cache_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Builds a Redis cache connected to an in-process Redis stand-in
+func newRedisCache(t *testing.T, server *miniredis.Miniredis) *cache.RedisCache {
+	c := cache.NewRedis(redis.NewClient(&redis.Options{Addr: server.Addr()}), cache.DefaultRedisPrefix)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestRedisCache_Typed(t *testing.T) {
+	server := miniredis.RunT(t)
+	// Two instances of the app sharing the Redis server
+	first := cache.NewTyped[*db.Post](newRedisCache(t, server), "post", cache.TypedOptions[*db.Post]{})
+	second := cache.NewTyped[*db.Post](newRedisCache(t, server), "post", cache.TypedOptions[*db.Post]{})
+
+	verified := true
+	post := &db.Post{ID: 5, Title: "Title", Body: "Body", UserID: 2, CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		User: db.User{ID: 2, Name: "Jane", Verified: &verified}}
+	if _, err := first.GetOrLoad(5, time.Minute, func() (*db.Post, error) { return post, nil }); err != nil {
+		t.Fatalf("Failed to load post: %v", err)
+	}
+
+	// The other instance finds the serialized post without loading it
+	found, err := second.GetOrLoad(5, time.Minute, func() (*db.Post, error) {
+		t.Errorf("Expected post stored by the other instance to be found")
+		return post, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to find post: %v", err)
+	}
+	if found.Title != post.Title || found.User.Name != "Jane" || !*found.User.Verified || !found.CreatedAt.Equal(post.CreatedAt) {
+		t.Errorf("Expected decoded post to match, got %+v", found)
+	}
+	if !server.Exists("cache:post:5") {
+		t.Errorf("Expected post to be stored under the prefixed key")
+	}
+
+	// Entries expire with their TTL
+	server.FastForward(2 * time.Minute)
+	if _, found := second.Get(5); found {
+		t.Errorf("Expected post to expire")
+	}
+}
+
+func TestRedisCache_InvalidateTags(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newRedisCache(t, server)
+	second := newRedisCache(t, server)
+	lists := cache.NewTyped[*models.BasicPaginatedResponse[db.Post]](first, cache.ListTag("post"), cache.TypedOptions[*models.BasicPaginatedResponse[db.Post]]{
+		Tags: func(list *models.BasicPaginatedResponse[db.Post]) []string {
+			return []string{cache.ListTag("post"), cache.EntityTag("user", 2)}
+		},
+	})
+	posts := []db.Post{{ID: 5, UserID: 2}}
+	lists.Set("page-1", &models.BasicPaginatedResponse[db.Post]{Data: &posts}, time.Minute)
+	first.StoreTagged("post:5", "Post 5", time.Minute, "post:5", cache.EntityTag("user", 2))
+	first.StoreTagged("post:6", "Post 6", time.Minute, "post:6")
+
+	if page, found := lists.Get("page-1"); !found || len(*page.Data) != 1 {
+		t.Fatalf("Expected cached page, got %v (%v)", page, found)
+	}
+	// Invalidating on another instance removes the tagged entries of every instance
+	if removed := second.InvalidateTags(cache.EntityTag("user", 2)); removed != 2 {
+		t.Errorf("Expected 2 entries removed, got %d", removed)
+	}
+	if _, found := lists.Get("page-1"); found {
+		t.Errorf("Expected page embedding the user to be invalidated")
+	}
+	if _, found := first.Load("post:6"); !found {
+		t.Errorf("Expected untagged post to remain")
+	}
+	if server.Exists("cache:tag:user:2") {
+		t.Errorf("Expected invalidated tag set to be removed")
+	}
+	// Tag sets expire with their longest entry
+	first.StoreTagged("post:7", "Post 7", time.Minute, "post:7")
+	first.StoreTagged("post:8", "Post 8", time.Hour, "post:7")
+	if ttl := server.TTL("cache:tag:post:7"); ttl != time.Hour {
+		t.Errorf("Expected tag set TTL of an hour, got %v", ttl)
+	}
+}
+
+func TestRedisCache_NegativeCaching(t *testing.T) {
+	server := miniredis.RunT(t)
+	errNotFound := errors.New("record not found")
+	options := cache.TypedOptions[*db.Post]{NotFound: errNotFound, NegativeTTL: time.Minute}
+	first := cache.NewTyped[*db.Post](newRedisCache(t, server), "post", options)
+	second := cache.NewTyped[*db.Post](newRedisCache(t, server), "post", options)
+
+	first.GetOrLoad(9, time.Minute, func() (*db.Post, error) { return nil, errNotFound })
+	_, err := second.GetOrLoad(9, time.Minute, func() (*db.Post, error) {
+		t.Errorf("Expected not found result stored by the other instance to be used")
+		return nil, errNotFound
+	})
+	if !errors.Is(err, errNotFound) {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestRedisCache_Unavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	c := newRedisCache(t, server)
+	posts := cache.NewTyped[*db.Post](c, "post", cache.TypedOptions[*db.Post]{})
+	server.Close()
+
+	// Redis errors are treated as misses, so the loader is used
+	post, err := posts.GetOrLoad(5, time.Minute, func() (*db.Post, error) { return &db.Post{ID: 5}, nil })
+	if err != nil || post.ID != 5 {
+		t.Errorf("Expected loaded post while Redis is unavailable, got %v (%v)", post, err)
+	}
+	if stats := c.Stats(); stats.Misses != 1 {
+		t.Errorf("Expected 1 miss, got %+v", stats)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	var tests = []struct {
+		driver      string
+		redisURL    string
+		expectRedis bool
+		expectError bool
+	}{
+		{"", "", false, false},
+		{"memory", "", false, false},
+		{"redis", "redis://" + server.Addr() + "/0", true, false},
+		{"Redis", "redis://" + server.Addr(), true, false},
+		// Invalid URL
+		{"redis", "http://" + server.Addr(), false, true},
+		{"memcached", "", false, true},
+	}
+	for _, v := range tests {
+		t.Setenv("CACHE_DRIVER", v.driver)
+		t.Setenv("REDIS_URL", v.redisURL)
+		c, err := cache.NewFromEnv()
+		if (err != nil) != v.expectError {
+			t.Errorf("%q: expected error %v, got %v", v.driver, v.expectError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if _, isRedis := c.(*cache.RedisCache); isRedis != v.expectRedis {
+			t.Errorf("%q: expected Redis cache %v, got %T", v.driver, v.expectRedis, c)
+		}
+		c.Close()
+	}
+}
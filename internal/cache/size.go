@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// EstimateSize returns the approximate number of bytes used by a value, following pointers,
+// slices, maps and interfaces (memory shared by several values is only counted once per value).
+// Used to keep caches within their memory budget
+func EstimateSize(value interface{}) int64 {
+	if value == nil {
+		return 0
+	}
+	return estimateSize(reflect.ValueOf(value), map[uintptr]bool{})
+}
+
+// Returns the size of a value and the memory it references
+func estimateSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	size := int64(v.Type().Size())
+	return size + referencedSize(v, seen)
+}
+
+// Returns the size of the memory referenced by a value (not including the value itself)
+func referencedSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return estimateSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return estimateSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		for i := 0; i < v.Len(); i++ {
+			size += referencedSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += referencedSize(v.Field(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		// Approximate bucket overhead with the size of the keys and values
+		var size int64
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateSize(iter.Key(), seen) + estimateSize(iter.Value(), seen)
+		}
+		return size + int64(unsafe.Sizeof(uintptr(0)))*int64(v.Len())
+	}
+	return 0
+}
+
+// ParseOptions builds cache options from their settings (eg. the CACHE_MAX_ENTRIES, CACHE_MAX_MEMORY and
+// CACHE_CLEANUP_INTERVAL environment variables). Empty settings are left unbounded, except the cleanup interval
+// which defaults to a minute
+// Example usage: cache.ParseOptions("10000", "64MB", "1m")
+func ParseOptions(maxEntries, maxMemory, cleanupInterval string) (Options, error) {
+	options := Options{CleanupInterval: time.Minute}
+	if maxEntries = strings.TrimSpace(maxEntries); maxEntries != "" {
+		entries, err := strconv.Atoi(maxEntries)
+		if err != nil || entries < 0 {
+			return options, fmt.Errorf("invalid maximum number of cache entries %q", maxEntries)
+		}
+		options.MaxEntries = entries
+	}
+	if maxMemory = strings.TrimSpace(maxMemory); maxMemory != "" {
+		bytes, err := parseBytes(maxMemory)
+		if err != nil {
+			return options, err
+		}
+		options.MaxBytes = bytes
+	}
+	if cleanupInterval = strings.TrimSpace(cleanupInterval); cleanupInterval != "" {
+		interval, err := time.ParseDuration(cleanupInterval)
+		if err != nil || interval < 0 {
+			return options, fmt.Errorf("invalid cache cleanup interval %q (expected a duration such as 1m)", cleanupInterval)
+		}
+		options.CleanupInterval = interval
+	}
+	return options, nil
+}
+
+// Parses a number of bytes with an optional unit (eg. 512KB, 64MB, 1GB)
+func parseBytes(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	upper := strings.ToUpper(value)
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	number, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid cache memory budget %q (expected a size such as 64MB)", value)
+	}
+	return number * multiplier, nil
+}
@@ -0,0 +1,19 @@
+package cache
+
+import "fmt"
+
+// Cache entries are tagged with the entities they contain, so a write can invalidate everything
+// related to an entity in one call. Typed caches tag every entry with its own key (eg. "post:5")
+// Example usage: app.Cache.InvalidateTags(cache.EntityTag("user", 5), cache.ListTag("post"))
+
+// EntityTag returns the tag of the entries containing an entity (eg. "user:5").
+// It is the key the entity is cached under by a typed cache with the schema name as prefix
+func EntityTag(schemaName string, id interface{}) string {
+	return fmt.Sprintf("%s:%v", schemaName, id)
+}
+
+// ListTag returns the tag of the cached lists (pages) of a schema (eg. "post:list").
+// Lists are invalidated on every write to the schema
+func ListTag(schemaName string) string {
+	return schemaName + ":list"
+}
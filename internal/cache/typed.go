@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Used for negative caching when no other TTL suits (short, so created values are found soon after)
+const DefaultNegativeTTL = 30 * time.Second
+
+// Returned to the callers waiting on a load whose loader panicked (the panic is raised again in the loading goroutine)
+var ErrLoaderPanicked = errors.New("cache loader panicked")
+
+// TypedOptions configure the tags and negative caching of a typed cache
+type TypedOptions[T any] struct {
+	// Extra tags for a stored value (eg. the tags of the entities it embeds). Every value is also tagged with its key
+	Tags func(T) []string
+	// Error meaning the value doesn't exist (eg. gorm.ErrRecordNotFound). Loader errors matching it (errors.Is)
+	// are cached for NegativeTTL so repeated lookups of missing values don't reach the database.
+	// Cached "not found" results are returned as this error
+	NotFound error
+	// How long not found errors are cached (not cached if zero)
+	NegativeTTL time.Duration
+}
+
+// Typed stores values of a single type in a cache under a key prefix, so call sites don't need type assertions.
+// GetOrLoad collapses concurrent misses for the same key into a single call of the loader.
+// Values loaded from caches shared between instances are decoded into the value type (see Serialized)
+// Example usage: users := cache.NewTyped[*db.User](app.Cache, "user", cache.TypedOptions[*db.User]{})
+type Typed[T any] struct {
+	cache   Cache
+	prefix  string
+	options TypedOptions[T]
+	// Loads in flight (key => call)
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// Load in flight. Callers missing the same key wait for it instead of calling the loader again
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+	// Set when the key is deleted during the load, so the (possibly stale) result isn't stored
+	forgotten bool
+}
+
+// Cached "not found" result (exported field so it can be serialized)
+type negativeEntry struct {
+	NotFound bool
+}
+
+// NewTyped builds a typed cache storing values in the given cache under "<prefix>:<key>" (see EntityTag)
+func NewTyped[T any](c Cache, prefix string, options TypedOptions[T]) *Typed[T] {
+	return &Typed[T]{cache: c, prefix: prefix, options: options, calls: make(map[string]*call[T])}
+}
+
+// Key returns the key a value is stored under in the underlying cache (eg. "user:5")
+func (t *Typed[T]) Key(key interface{}) string {
+	return EntityTag(t.prefix, key)
+}
+
+// Get returns the cached value of a key. Cached "not found" results aren't returned
+func (t *Typed[T]) Get(key interface{}) (T, bool) {
+	value, err, found := t.load(t.Key(key), t.cache.Load)
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+	return value, found
+}
+
+// Set stores the value of a key (the default TTL is used if ttl is zero)
+func (t *Typed[T]) Set(key interface{}, value T, ttl time.Duration) {
+	cacheKey := t.Key(key)
+	t.cache.StoreTagged(cacheKey, value, ttlOrDefault(ttl), t.tags(cacheKey, value)...)
+}
+
+// Delete removes the value (or "not found" result) of a key. A load in flight for the key isn't stored
+func (t *Typed[T]) Delete(key interface{}) {
+	cacheKey := t.Key(key)
+	t.mu.Lock()
+	if inFlight, found := t.calls[cacheKey]; found {
+		inFlight.forgotten = true
+		delete(t.calls, cacheKey)
+	}
+	t.mu.Unlock()
+	t.cache.Delete(cacheKey)
+}
+
+// GetOrLoad returns the cached value of a key, or calls the loader and caches its result for the ttl
+// (the default TTL is used if ttl is zero). Concurrent callers missing the same key share a single loader call.
+// Not found errors are cached if negative caching is configured (see TypedOptions).
+// The result isn't cached if tags were invalidated during the load, as it may be stale
+// Example usage: user, err := users.GetOrLoad(id, 10*time.Minute, func() (*db.User, error) { return repo.FindById(id) })
+func (t *Typed[T]) GetOrLoad(key interface{}, ttl time.Duration, loader func() (T, error)) (T, error) {
+	cacheKey := t.Key(key)
+	if value, err, found := t.load(cacheKey, t.cache.Load); found {
+		return value, err
+	}
+
+	// Wait for the load in flight or start one
+	t.mu.Lock()
+	if inFlight, found := t.calls[cacheKey]; found {
+		t.mu.Unlock()
+		<-inFlight.done
+		return inFlight.value, inFlight.err
+	}
+	// The value may have been stored while waiting for the lock (not counted as another lookup if possible)
+	lookup := t.cache.Load
+	if cache, ok := t.cache.(peeker); ok {
+		lookup = cache.peek
+	}
+	if value, err, found := t.load(cacheKey, lookup); found {
+		t.mu.Unlock()
+		return value, err
+	}
+	current := &call[T]{done: make(chan struct{})}
+	t.calls[cacheKey] = current
+	t.mu.Unlock()
+	generation := t.generation()
+
+	// Release the waiters even if the loader panics, with an error rather than a zero value
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			current.err = fmt.Errorf("%w: %v", ErrLoaderPanicked, recovered)
+		}
+		t.mu.Lock()
+		if t.calls[cacheKey] == current {
+			delete(t.calls, cacheKey)
+		}
+		t.mu.Unlock()
+		close(current.done)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+	current.value, current.err = loader()
+
+	// Store while holding the lock, so a Delete can't slip in between the check and the store
+	t.mu.Lock()
+	if !current.forgotten && t.generation() == generation {
+		t.store(cacheKey, current.value, current.err, ttl)
+	}
+	t.mu.Unlock()
+	return current.value, current.err
+}
+
+// Returns the cached value or "not found" result of a key using the lookup function
+func (t *Typed[T]) load(cacheKey string, lookup func(interface{}) (interface{}, bool)) (T, error, bool) {
+	var zero T
+	cached, found := lookup(cacheKey)
+	if !found {
+		return zero, nil, false
+	}
+	// Decode serialized values (eg. loaded from Redis)
+	if serialized, ok := cached.(Serialized); ok {
+		switch serialized.Type {
+		case typeName(negativeEntry{}):
+			cached = negativeEntry{NotFound: true}
+		case typeName(zero):
+			var value T
+			if err := serialized.Decode(&value); err != nil {
+				return zero, nil, false
+			}
+			cached = value
+		}
+	}
+	switch cached := cached.(type) {
+	case negativeEntry:
+		if t.options.NotFound != nil {
+			return zero, t.options.NotFound, true
+		}
+	case T:
+		return cached, nil, true
+	}
+	// Stored by something else under the same key
+	return zero, nil, false
+}
+
+// Caches the result of a loader call
+func (t *Typed[T]) store(cacheKey string, value T, err error, ttl time.Duration) {
+	if err == nil {
+		t.cache.StoreTagged(cacheKey, value, ttlOrDefault(ttl), t.tags(cacheKey, value)...)
+		return
+	}
+	if t.options.NegativeTTL > 0 && t.options.NotFound != nil && errors.Is(err, t.options.NotFound) {
+		t.cache.StoreTagged(cacheKey, negativeEntry{NotFound: true}, t.options.NegativeTTL, cacheKey)
+	}
+}
+
+// Returns the tags of a stored value: its key and the extra tags from the options
+func (t *Typed[T]) tags(cacheKey string, value T) []string {
+	tags := []string{cacheKey}
+	if t.options.Tags != nil {
+		tags = append(tags, t.options.Tags(value)...)
+	}
+	return tags
+}
+
+// Returns the number of tag invalidations of the cache (zero if not counted)
+func (t *Typed[T]) generation() uint64 {
+	if cache, ok := t.cache.(generational); ok {
+		return cache.generation()
+	}
+	return 0
+}
+
+func ttlOrDefault(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return defaultTimeToLive
+	}
+	return ttl
+}
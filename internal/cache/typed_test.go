@@ -0,0 +1,203 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+)
+
+var errNotFound = errors.New("not found")
+
+func TestTyped_GetOrLoad(t *testing.T) {
+	users := cache.NewTyped[string](&cache.CacheMap{}, "user", cache.TypedOptions[string]{})
+	var loads int32
+	loader := func() (string, error) {
+		atomic.AddInt32(&loads, 1)
+		return "Jane", nil
+	}
+
+	var tests = []struct {
+		key           int
+		expectedLoads int32
+	}{
+		// Miss calls the loader
+		{1, 1},
+		// Hit uses the cached value
+		{1, 1},
+		// Other key calls the loader
+		{2, 2},
+	}
+	for _, v := range tests {
+		value, err := users.GetOrLoad(v.key, time.Minute, loader)
+		if err != nil || value != "Jane" {
+			t.Errorf("Key %d: expected Jane, got %q (%v)", v.key, value, err)
+		}
+		if loaded := atomic.LoadInt32(&loads); loaded != v.expectedLoads {
+			t.Errorf("Key %d: expected %d loads, got %d", v.key, v.expectedLoads, loaded)
+		}
+	}
+	// Values are stored under the prefixed key
+	if value, found := users.Get(1); !found || value != "Jane" {
+		t.Errorf("Expected Get to find the loaded value, got %q (%v)", value, found)
+	}
+	if users.Key(1) != "user:1" {
+		t.Errorf("Expected key user:1, got %s", users.Key(1))
+	}
+	// Errors other than not found aren't cached
+	users.Delete(1)
+	failure := errors.New("connection refused")
+	for i := 0; i < 2; i++ {
+		if _, err := users.GetOrLoad(1, time.Minute, func() (string, error) { return "", failure }); err != failure {
+			t.Errorf("Expected the loader error, got %v", err)
+		}
+	}
+	if _, found := users.Get(1); found {
+		t.Errorf("Expected failed load not to be cached")
+	}
+}
+
+func TestTyped_GetOrLoadConcurrent(t *testing.T) {
+	users := cache.NewTyped[string](&cache.CacheMap{}, "user", cache.TypedOptions[string]{})
+	var loads int32
+	// Hold the loader until every caller has missed
+	release := make(chan struct{})
+	loader := func() (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "Jane", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan string, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _ := users.GetOrLoad(1, time.Minute, loader)
+			results <- value
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if loaded := atomic.LoadInt32(&loads); loaded != 1 {
+		t.Errorf("Expected concurrent misses to share 1 load, got %d", loaded)
+	}
+	for value := range results {
+		if value != "Jane" {
+			t.Errorf("Expected every caller to get Jane, got %q", value)
+		}
+	}
+}
+
+func TestTyped_GetOrLoadPanic(t *testing.T) {
+	users := cache.NewTyped[*string](&cache.CacheMap{}, "user", cache.TypedOptions[*string]{})
+	// Hold the loader until the other caller is waiting on it
+	release := make(chan struct{})
+	loader := func() (*string, error) {
+		<-release
+		panic("database gone")
+	}
+
+	// The panic is raised again in the caller running the loader
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		users.GetOrLoad(1, time.Minute, loader)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Callers waiting on the load get an error instead of a nil value
+	waited := make(chan error, 1)
+	go func() {
+		value, err := users.GetOrLoad(1, time.Minute, func() (*string, error) {
+			t.Error("Expected the waiting caller not to call its loader")
+			return nil, nil
+		})
+		if value != nil {
+			t.Errorf("Expected no value, got %v", value)
+		}
+		waited <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if recovered := <-panicked; recovered != "database gone" {
+		t.Errorf("Expected the loader panic to be raised again, got %v", recovered)
+	}
+	if err := <-waited; !errors.Is(err, cache.ErrLoaderPanicked) {
+		t.Errorf("Expected waiting caller to get the panic error, got %v", err)
+	}
+	// Nothing is cached, so the next caller loads the value again
+	if value, err := users.GetOrLoad(1, time.Minute, func() (*string, error) { name := "Jane"; return &name, nil }); err != nil || *value != "Jane" {
+		t.Errorf("Expected value to be loaded again, got %v (%v)", value, err)
+	}
+}
+
+func TestTyped_NegativeCaching(t *testing.T) {
+	users := cache.NewTyped[*string](&cache.CacheMap{}, "user", cache.TypedOptions[*string]{
+		NotFound:    errNotFound,
+		NegativeTTL: 50 * time.Millisecond,
+	})
+	var loads int32
+	loader := func() (*string, error) {
+		atomic.AddInt32(&loads, 1)
+		return nil, errNotFound
+	}
+
+	// Not found results are cached until the negative TTL passes
+	for i := 0; i < 3; i++ {
+		if _, err := users.GetOrLoad(1, time.Minute, loader); !errors.Is(err, errNotFound) {
+			t.Errorf("Expected not found error, got %v", err)
+		}
+	}
+	if loaded := atomic.LoadInt32(&loads); loaded != 1 {
+		t.Errorf("Expected not found result to be cached, got %d loads", loaded)
+	}
+	// Get doesn't return cached not found results
+	if _, found := users.Get(1); found {
+		t.Errorf("Expected Get not to find a not found result")
+	}
+	time.Sleep(60 * time.Millisecond)
+	users.GetOrLoad(1, time.Minute, loader)
+	if loaded := atomic.LoadInt32(&loads); loaded != 2 {
+		t.Errorf("Expected load after the negative TTL, got %d loads", loaded)
+	}
+	// Delete clears the not found result (eg. when the value is created)
+	users.Delete(1)
+	name := "Jane"
+	value, err := users.GetOrLoad(1, time.Minute, func() (*string, error) { return &name, nil })
+	if err != nil || value != &name {
+		t.Errorf("Expected created value after delete, got %v (%v)", value, err)
+	}
+}
+
+func TestTyped_DeleteDuringLoad(t *testing.T) {
+	users := cache.NewTyped[string](&cache.CacheMap{}, "user", cache.TypedOptions[string]{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		users.GetOrLoad(1, time.Minute, func() (string, error) {
+			close(started)
+			<-release
+			return "stale", nil
+		})
+	}()
+	<-started
+	// Eg. the user is updated while being loaded
+	users.Delete(1)
+	close(release)
+	<-done
+
+	if value, found := users.Get(1); found {
+		t.Errorf("Expected load in flight during delete not to be stored, got %q", value)
+	}
+}
@@ -24,7 +24,7 @@ type AppConfig struct {
 	// Should be set to the base url of the app upon server start
 	BaseURL string
 	// Cache
-	Cache *cache.CacheMap
+	Cache cache.Cache
 	// Core modules
 	User models.ModuleSet
 	Policy models.ModuleSet
@@ -0,0 +1,201 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestApiKeyController_CreateMyApiKey(t *testing.T) {
+	// Create a request url
+	requestUrl := "me/tokens"
+	var tests = []struct {
+		testName               string
+		body                   models.CreateApiKey
+		useToken               bool
+		expectedResponseStatus int
+	}{
+		{"Create key with scope I have", models.CreateApiKey{Name: "Profile reader", Scopes: []db.ApiKeyScope{{Object: "/api/me", Action: "read"}}}, true, http.StatusOK},
+		{"Fail: Scope I don't have", models.CreateApiKey{Name: "User admin", Scopes: []db.ApiKeyScope{{Object: "/api/users", Action: "delete"}}}, true, http.StatusBadRequest},
+		{"Fail: Missing name", models.CreateApiKey{Scopes: []db.ApiKeyScope{{Object: "/api/me", Action: "read"}}}, true, http.StatusBadRequest},
+		// Deny access to user that doesn't have authentication
+		{"Logged out user", models.CreateApiKey{Name: "Profile reader", Scopes: []db.ApiKeyScope{{Object: "/api/me", Action: "read"}}}, false, http.StatusForbidden},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", requestUrl, helpers.BuildReqBody(v.body), v.useToken, testModule.accounts.user.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%s: Got %v want %v.(%v)", v.testName, status, v.expectedResponseStatus, rr.Body)
+			continue
+		}
+
+		// The key is returned once created
+		if v.expectedResponseStatus == http.StatusOK {
+			var body db.ApiKey
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if body.Key == "" || body.UserID != testModule.accounts.user.details.ID || body.Name != v.body.Name {
+				t.Errorf("%s: unexpected key in response %v", v.testName, rr.Body)
+			}
+		}
+	}
+
+	// Clean up created keys
+	testModule.dbClient.Where("user_id = ?", testModule.accounts.user.details.ID).Delete(&db.ApiKey{})
+}
+
+func TestApiKeyController_Authentication(t *testing.T) {
+	key := createApiKeyForUser(t, []db.ApiKeyScope{{Object: "/api/me", Action: "read"}})
+	defer testModule.dbClient.Where("user_id = ?", testModule.accounts.user.details.ID).Delete(&db.ApiKey{})
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		requestUrl             string
+		body                   interface{}
+		expectedResponseStatus int
+	}{
+		{"Use key within its scopes", "GET", "me", nil, http.StatusOK},
+		// The owner can update their profile, but the key isn't scoped to do so
+		{"Fail: Action outside of scopes", "PUT", "me", models.UpdateUser{Name: "Integration"}, http.StatusForbidden},
+		{"Fail: Object outside of scopes", "GET", "me/tokens", nil, http.StatusForbidden},
+		{"Fail: Keys can't create keys", "POST", "me/tokens", models.CreateApiKey{Name: "Nested", Scopes: []db.ApiKeyScope{{Object: "/api/me", Action: "read"}}}, http.StatusForbidden},
+	}
+
+	for _, v := range tests {
+		var req *http.Request
+		var err error
+		if v.body != nil {
+			req, err = helpers.BuildApiRequest(v.method, v.requestUrl, helpers.BuildReqBody(v.body), false, "")
+		} else {
+			req, err = helpers.BuildApiRequest(v.method, v.requestUrl, nil, false, "")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "ApiKey "+key.Key)
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%s: Got %v want %v.(%v)", v.testName, status, v.expectedResponseStatus, rr.Body)
+		}
+	}
+}
+
+func TestApiKeyController_MyApiKeys(t *testing.T) {
+	key := createApiKeyForUser(t, []db.ApiKeyScope{{Object: "/api/me", Action: "read"}})
+	defer testModule.dbClient.Where("user_id = ?", testModule.accounts.user.details.ID).Delete(&db.ApiKey{})
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		requestUrl             string
+		token                  string
+		expectedResponseStatus int
+		expectedCount          int
+	}{
+		{"List my keys", "GET", "me/tokens", testModule.accounts.user.token, http.StatusOK, 1},
+		{"Keys of other users aren't listed", "GET", "me/tokens", testModule.accounts.admin.token, http.StatusOK, 0},
+		{"Fail: Delete key of another user", "DELETE", fmt.Sprintf("me/tokens/%d", key.ID), testModule.accounts.admin.token, http.StatusNotFound, 0},
+		{"Delete my key", "DELETE", fmt.Sprintf("me/tokens/%d", key.ID), testModule.accounts.user.token, http.StatusOK, 0},
+		{"Deleted key isn't listed", "GET", "me/tokens", testModule.accounts.user.token, http.StatusOK, 0},
+		{"Fail: Delete missing key", "DELETE", fmt.Sprintf("me/tokens/%d", key.ID), testModule.accounts.user.token, http.StatusNotFound, 0},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest(v.method, v.requestUrl, nil, true, v.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%s: Got %v want %v.(%v)", v.testName, status, v.expectedResponseStatus, rr.Body)
+			continue
+		}
+
+		if v.method == "GET" {
+			var body []db.ApiKey
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if len(body) != v.expectedCount {
+				t.Errorf("%s: expected %d keys, got %d", v.testName, v.expectedCount, len(body))
+			}
+			// Keys aren't shown after creation
+			for _, listed := range body {
+				if listed.Key != "" {
+					t.Errorf("%s: expected key not to be listed", v.testName)
+				}
+			}
+		}
+	}
+
+	// Deleted keys stop working
+	req, err := helpers.BuildApiRequest("GET", "me", nil, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected deleted key to be rejected, got %v", rr.Code)
+	}
+}
+
+func TestApiKeyController_AdminCreateWithApiKey(t *testing.T) {
+	// Key of the admin scoped to creating keys in the admin panel only
+	key, err := testModule.apiKeys.serv.Create(&models.CreateApiKey{UserID: testModule.accounts.admin.details.ID, Name: "Key creator", Scopes: []db.ApiKeyScope{{Object: "/admin/api-keys/create", Action: "create"}}})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	defer testModule.dbClient.Where("user_id = ?", testModule.accounts.admin.details.ID).Delete(&db.ApiKey{})
+
+	// Keys can't be used to create keys with the owner's other permissions
+	form := url.Values{"name": {"Escalated"}, "scopes": {"delete /api/users"}}
+	req, err := http.NewRequest("POST", "/admin/api-keys/create", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "ApiKey "+key.Key)
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected key creation with an API key to be rejected, got %v (%v)", rr.Code, rr.Body)
+	}
+	var created int64
+	testModule.dbClient.Model(&db.ApiKey{}).Where("user_id = ? AND name = ?", testModule.accounts.admin.details.ID, "Escalated").Count(&created)
+	if created != 0 {
+		t.Errorf("Expected no key to be created, got %d", created)
+	}
+}
+
+// Creates an API key for the basic user with the given scopes
+func createApiKeyForUser(t *testing.T, scopes []db.ApiKeyScope) *db.ApiKey {
+	created, err := testModule.apiKeys.serv.Create(&models.CreateApiKey{UserID: testModule.accounts.user.details.ID, Name: "Integration", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	return created
+}
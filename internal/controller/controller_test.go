@@ -10,6 +10,7 @@ import (
 	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
@@ -35,6 +36,8 @@ type controllerTestModule struct {
 	users    userModule
 	admin    adminpanel.AdminPanelController
 	auth     authModule
+	email    emailModule
+	apiKeys  apiKeyModule
 	router   http.Handler
 	api      routes.Api
 	// For authentication mocking
@@ -47,6 +50,14 @@ type userModule struct {
 	serv coreservices.UserService
 	cont core.UserController
 }
+type emailModule struct {
+	serv coreservices.EmailSuppressionService
+	cont core.EmailController
+}
+type apiKeyModule struct {
+	serv coreservices.ApiKeyService
+	cont core.ApiKeyController
+}
 type authModule struct {
 	repo corerepositories.AuthPolicyRepository
 	serv coreservices.AuthPolicyService
@@ -87,6 +98,9 @@ func TestMain(m *testing.M) {
 	// Setup new cache
 	app.Cache = &cache.CacheMap{}
 
+	// Set the secret signing unsubscribe links
+	email.SetUnsubscribeSecret("test-unsubscribe-secret")
+
 	// Sync app in authentication package for usage in authentication functions
 	SetAppWideState(&app)
 
@@ -126,13 +140,26 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 	t.auth.cont = core.NewAuthPolicyController(t.auth.serv)
 	// Users
 	t.users.repo = corerepositories.NewUserRepository(client)
-	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, jobQueue)
+	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, corerepositories.NewRefreshTokenRepository(client), corerepositories.NewTwoFactorRepository(client), jobQueue)
 	t.users.cont = core.NewUserController(t.users.serv)
 
 	// Action
 	actionRepo := corerepositories.NewActionRepository(client)
 	actionService := coreservices.NewActionService(actionRepo)
 	adminActionController := adminpanel.NewAdminActionController(actionService)
+	// Jobs
+	jobService := coreservices.NewJobService(corerepositories.NewJobRepository(client), jobQueue)
+	adminJobController := adminpanel.NewAdminJobController(jobService, actionService)
+	// Email log
+	emailLogService := coreservices.NewEmailLogService(corerepositories.NewEmailLogRepository(client), jobQueue)
+	jobQueue.SetEmailLogger(emailLogService)
+	// Email suppression list and preferences
+	t.email.serv = coreservices.NewEmailSuppressionService(corerepositories.NewEmailSuppressionRepository(client), corerepositories.NewEmailPreferenceRepository(client))
+	jobQueue.SetSuppressionList(t.email.serv)
+	t.email.cont = core.NewEmailController(t.email.serv)
+	// API keys
+	t.apiKeys.serv = coreservices.NewApiKeyService(corerepositories.NewApiKeyRepository(client))
+	t.apiKeys.cont = core.NewApiKeyController(t.apiKeys.serv)
 
 	// Setup basic modules with new implementation
 	moduleMap := modules.SetupModules(modules.ModulesToSetup, client, actionService)
@@ -143,6 +170,11 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 		adminpanel.NewAdminUserController(t.users.serv, actionService),
 		adminpanel.NewAdminAuthPolicyController(t.auth.serv),
 		adminActionController,
+		adminJobController,
+		adminpanel.NewAdminOutboxController(nil),
+		adminpanel.NewAdminEmailLogController(emailLogService, actionService),
+		adminpanel.NewAdminEmailSuppressionController(t.email.serv, actionService),
+		adminpanel.NewAdminApiKeyController(t.apiKeys.serv, actionService),
 		// Additional modules
 		moduleMap,
 	)
@@ -155,6 +187,8 @@ func (t *controllerTestModule) TestApiSetup(client *gorm.DB) routes.Api {
 		t.admin,
 		t.users.cont,
 		t.auth.cont,
+		t.email.cont,
+		t.apiKeys.cont,
 		moduleMap,
 	)
 
@@ -196,7 +230,7 @@ func (t *controllerTestModule) generateUserWithRoleAndToken(user *models.CreateU
 	// If successful, generate token
 	fmt.Println("Generating token for: ", createdUser.Email)
 	// Set login status to true
-	tokenString, err := auth.GenerateJWT(int(createdUser.ID), createdUser.Email, createdUser.Role)
+	tokenString, err := auth.GenerateAccessToken(int(createdUser.ID), createdUser.Email, createdUser.Role, "", false)
 	if err != nil {
 		fmt.Println("Failed to create JWT")
 	}
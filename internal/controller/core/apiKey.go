@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+	"github.com/go-chi/chi/v5"
+)
+
+type ApiKeyController interface {
+	// API/ME
+	GetMyApiKeys(w http.ResponseWriter, r *http.Request)
+	CreateMyApiKey(w http.ResponseWriter, r *http.Request)
+	DeleteMyApiKey(w http.ResponseWriter, r *http.Request)
+}
+
+type apiKeyController struct {
+	service coreservices.ApiKeyService
+}
+
+func NewApiKeyController(service coreservices.ApiKeyService) ApiKeyController {
+	return &apiKeyController{service}
+}
+
+// API/ME
+// @Summary      Get my API keys
+// @Description  Returns my API keys (without the keys themselves, which are only shown when created)
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {array} db.ApiKey
+// @Failure      400 {string} string "Can't find API keys"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/tokens [get]
+// @Security BearerToken
+func (c apiKeyController) GetMyApiKeys(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	keys, err := c.service.FindByUser(userId)
+	if err != nil {
+		http.Error(w, "Can't find API keys", http.StatusBadRequest)
+		return
+	}
+
+	// Write keys to Response
+	err = request.WriteAsJSON(w, keys)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// @Summary      Create an API key
+// @Description  Creates a long-lived API key for integrations, sent as "Authorization: ApiKey <key>". The key is restricted to the given scopes, which must be permissions I have. The key is only returned once
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        key body models.CreateApiKey true "Name, scopes and optional expiry of the key"
+// @Success      200 {object} db.ApiKey
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      400 {string} string "Failed API key creation"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      403 {string} string "API keys can't create API keys"
+// @Router       /me/tokens [post]
+// @Security BearerToken
+func (c apiKeyController) CreateMyApiKey(w http.ResponseWriter, r *http.Request) {
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	userId, err := strconv.Atoi(tokenData.UserID)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	// Keys could otherwise be used to create keys with more scopes than their own
+	if tokenData.ApiKeyID != 0 {
+		http.Error(w, "API keys can't create API keys", http.StatusForbidden)
+		return
+	}
+
+	var toCreate models.CreateApiKey
+	err = json.NewDecoder(r.Body).Decode(&toCreate)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&toCreate)
+	if !pass {
+		w.WriteHeader(http.StatusBadRequest)
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+
+	// Keys belong to the authenticated user
+	toCreate.UserID = uint(userId)
+	created, err := c.service.Create(&toCreate)
+	if err != nil {
+		if errors.Is(err, coreservices.ErrInvalidApiKeyScope) || errors.Is(err, coreservices.ErrInvalidApiKeyExpiry) {
+			http.Error(w, fmt.Sprintf("Failed API key creation: %s", err), http.StatusBadRequest)
+			return
+		}
+		fmt.Println("Error creating API key: ", err)
+		http.Error(w, "Failed API key creation", http.StatusBadRequest)
+		return
+	}
+
+	// Write created key to Response
+	err = request.WriteAsJSON(w, created)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// @Summary      Delete an API key
+// @Description  Deletes one of my API keys. The key stops working immediately
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int  true  "API key ID"
+// @Success      200 {string} string "Deletion successful!"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      404 {string} string "API key not found"
+// @Router       /me/tokens/{id} [delete]
+// @Security BearerToken
+func (c apiKeyController) DeleteMyApiKey(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+	// Grab URL parameter
+	idParameter, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	// Keys of other users aren't found
+	err = c.service.DeleteForUser(userId, idParameter)
+	if err != nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	// Else write success
+	w.Write([]byte("Deletion successful!"))
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+type EmailController interface {
+	// Unsubscribe links (GET confirmation page / POST unsubscribe)
+	Unsubscribe(w http.ResponseWriter, r *http.Request)
+	// API/ME
+	GetMyEmailPreferences(w http.ResponseWriter, r *http.Request)
+	UpdateMyEmailPreferences(w http.ResponseWriter, r *http.Request)
+}
+
+type emailController struct {
+	service coreservices.EmailSuppressionService
+}
+
+func NewEmailController(service coreservices.EmailSuppressionService) EmailController {
+	return &emailController{service}
+}
+
+// Page served by unsubscribe links. Confirming submits the form to the same link
+// (mail clients following links, eg. to scan them, mustn't unsubscribe the recipient)
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+{{if .Done}}<p>{{.Email}} has been unsubscribed from {{.Category}} emails.</p>
+{{else}}<form method="post">
+<p>Stop sending {{.Category}} emails to {{.Email}}?</p>
+<button type="submit">Unsubscribe</button>
+</form>{{end}}
+</body>
+</html>`))
+
+// API/EMAIL
+// @Summary      Unsubscribe from a category of emails
+// @Description  Unsubscribes the address using the signed link included in non-transactional emails. GET serves a confirmation page, POST unsubscribes (including one-click unsubscribe requests from mail clients).
+// @Tags         Email
+// @Produce      html
+// @Param        email    query      string  true  "Address"
+// @Param        category query      string  true  "Email category"
+// @Param        token    query      string  true  "Signature of the link"
+// @Success      200 {string} string "Unsubscribed"
+// @Failure      400 {string} string "Invalid unsubscribe link"
+// @Failure      500 {string} string "Failed to unsubscribe"
+// @Router       /email/unsubscribe [post]
+func (c emailController) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	// Link parameters (one-click requests post them in the query)
+	address := r.FormValue("email")
+	category := r.FormValue("category")
+	token := r.FormValue("token")
+	if address == "" || category == "" || !email.VerifyUnsubscribeToken(address, category, token) {
+		http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+		return
+	}
+
+	data := struct {
+		Email    string
+		Category string
+		Done     bool
+	}{Email: address, Category: category}
+
+	if r.Method == http.MethodPost {
+		err := c.service.Unsubscribe(address, category)
+		if err != nil {
+			if errors.Is(err, coreservices.ErrInvalidEmailCategory) {
+				http.Error(w, "Invalid unsubscribe link", http.StatusBadRequest)
+				return
+			}
+			fmt.Println("Error unsubscribing: ", err)
+			http.Error(w, "Failed to unsubscribe", http.StatusInternalServerError)
+			return
+		}
+		data.Done = true
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := unsubscribePage.Execute(w, data)
+	if err != nil {
+		fmt.Println("Error writing unsubscribe page: ", err)
+	}
+}
+
+// API/ME
+// @Summary      Get my email preferences
+// @Description  Returns the email categories I can opt out of and whether I receive them
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {array} models.EmailPreference
+// @Failure      400 {string} string "Can't find email preferences"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/email-preferences [get]
+// @Security BearerToken
+func (c emailController) GetMyEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	preferences, err := c.service.FindPreferences(userId)
+	if err != nil {
+		http.Error(w, "Can't find email preferences", http.StatusBadRequest)
+		return
+	}
+
+	// Write preferences to Response
+	err = request.WriteAsJSON(w, preferences)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// @Summary      Update my email preferences
+// @Description  Subscribes to or opts out of email categories (categories not included are unchanged)
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        preferences body models.UpdateEmailPreferences true "Email categories (category => subscribed)"
+// @Success      200 {array} models.EmailPreference
+// @Failure      400 {string} string "Failed email preferences update"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/email-preferences [put]
+// @Security BearerToken
+func (c emailController) UpdateMyEmailPreferences(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	// Decode request body as JSON
+	var toUpdate models.UpdateEmailPreferences
+	err = json.NewDecoder(r.Body).Decode(&toUpdate)
+	if err != nil || len(toUpdate.Categories) == 0 {
+		http.Error(w, "Failed email preferences update: no categories given", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := c.service.UpdatePreferences(userId, &toUpdate)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed email preferences update: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	// Write updated preferences to Response
+	err = request.WriteAsJSON(w, updated)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// Returns the ID of the user the request's authentication token belongs to
+func userIdFromToken(r *http.Request) (int, error) {
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(tokenData.UserID)
+}
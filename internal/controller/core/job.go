@@ -0,0 +1,10 @@
+package core
+
+// Used to init the query params for easy extraction in controller (searched fields)
+// Returns: map[string]string{"age": "int", "name": "string", "active": "bool"}
+func JobConditionQueryParams() map[string]string {
+	return map[string]string{
+		"payload":    "string",
+		"last_error": "string",
+	}
+}
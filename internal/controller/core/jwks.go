@@ -0,0 +1,22 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+)
+
+// JWKS
+// Publishes the public keys verifying access tokens, so other services can verify them
+// @Summary      JSON Web Key Set
+// @Description  Public keys (RS256 or EdDSA) verifying access tokens, identified by the "kid" header of the tokens. Empty if tokens are signed using HMAC
+// @Tags         Login
+// @Produce      json
+// @Success      200 {object} auth.JWKS
+// @Router       /.well-known/jwks.json [get]
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	// Keys only change on restart, so clients may cache them briefly
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	request.WriteAsJSON(w, auth.PublicKeys())
+}
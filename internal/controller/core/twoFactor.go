@@ -0,0 +1,182 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/request"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+// Two-factor login
+// Handler for the second login step of users with two-factor authentication
+// @Summary      Two-factor login
+// @Description  Exchanges the challenge token returned by login (when two_factor_required is set) and a code from the authenticator app (or a recovery code) for an access token and a refresh token
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        login body models.TwoFactorLogin true "Two-Factor Login Form"
+// @Success      200 {object} models.LoginResponse
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid two-factor code"
+// @Failure      429 {string} string "Too many invalid codes, try again later"
+// @Router       /users/login/2fa [post]
+func (c userController) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var login models.TwoFactorLogin
+	err := json.NewDecoder(r.Body).Decode(&login)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&login)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	loginResponse, err := c.service.VerifyTwoFactorLogin(login.ChallengeToken, login.Code)
+	if err != nil {
+		fmt.Printf("Error completing two-factor login: %s\n", err)
+		if errors.Is(err, coreservices.ErrTwoFactorLocked) {
+			http.Error(w, "Too many invalid codes, try again later", http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	// Send tokens to user in body
+	request.WriteAsJSON(w, loginResponse)
+}
+
+// API/ME
+// @Summary      Get my two-factor authentication status
+// @Description  Returns whether two-factor authentication is enabled (and required for my role), and how many recovery codes are left
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} models.TwoFactorStatus
+// @Failure      400 {string} string "Can't find two-factor status"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Router       /me/2fa [get]
+// @Security BearerToken
+func (c userController) GetMyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	status, err := c.service.TwoFactorStatus(userId)
+	if err != nil {
+		http.Error(w, "Can't find two-factor status", http.StatusBadRequest)
+		return
+	}
+
+	// Write status to Response
+	err = request.WriteAsJSON(w, status)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// @Summary      Enrol in two-factor authentication
+// @Description  Starts a TOTP enrolment. Returns the secret, its otpauth:// URI and a QR code to add to an authenticator app. Two-factor authentication is enabled once confirmed
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Success      200 {object} models.TwoFactorEnrolment
+// @Failure      400 {string} string "Failed two-factor enrolment"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      409 {string} string "Two-factor authentication is already enabled"
+// @Router       /me/2fa [post]
+// @Security BearerToken
+func (c userController) EnrolTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	enrolment, err := c.service.BeginTwoFactorEnrolment(userId)
+	if err != nil {
+		fmt.Printf("Error starting two-factor enrolment: %s\n", err)
+		if errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled) {
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed two-factor enrolment", http.StatusBadRequest)
+		return
+	}
+
+	// Write enrolment to Response
+	err = request.WriteAsJSON(w, enrolment)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
+
+// @Summary      Confirm two-factor enrolment
+// @Description  Enables two-factor authentication using a code from the authenticator app. Returns single use recovery codes, which are only shown once. Refresh the tokens afterwards if your role requires two-factor authentication
+// @Tags         My Profile
+// @Accept       json
+// @Produce      json
+// @Param        code body models.TwoFactorCode true "Code from the authenticator app"
+// @Success      200 {object} models.TwoFactorRecoveryCodes
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid two-factor code"
+// @Failure      403 {string} string "Error parsing authentication token"
+// @Failure      409 {string} string "Two-factor authentication is already enabled"
+// @Router       /me/2fa/confirm [post]
+// @Security BearerToken
+func (c userController) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userId, err := userIdFromToken(r)
+	if err != nil {
+		http.Error(w, "Error parsing authentication token", http.StatusForbidden)
+		return
+	}
+
+	var confirmation models.TwoFactorCode
+	err = json.NewDecoder(r.Body).Decode(&confirmation)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&confirmation)
+	if !pass {
+		w.WriteHeader(http.StatusBadRequest)
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+
+	recoveryCodes, err := c.service.ConfirmTwoFactorEnrolment(userId, confirmation.Code)
+	if err != nil {
+		fmt.Printf("Error confirming two-factor enrolment: %s\n", err)
+		switch {
+		case errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled):
+			http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		case errors.Is(err, coreservices.ErrInvalidTwoFactorCode), errors.Is(err, coreservices.ErrTwoFactorNotEnrolled):
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Failed two-factor enrolment", http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Write recovery codes to Response
+	err = request.WriteAsJSON(w, recoveryCodes)
+	if err != nil {
+		fmt.Println("Error writing to JSON", err)
+		return
+	}
+}
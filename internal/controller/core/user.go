@@ -22,10 +22,21 @@ type UserController interface {
 	// API/ME
 	GetMyUserDetails(w http.ResponseWriter, r *http.Request)
 	UpdateMyProfile(w http.ResponseWriter, r *http.Request)
+	// Two-factor authentication (API/ME)
+	GetMyTwoFactor(w http.ResponseWriter, r *http.Request)
+	EnrolTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
 	// Login
 	Login(w http.ResponseWriter, r *http.Request)
+	// Second login step (two-factor authentication)
+	LoginTwoFactor(w http.ResponseWriter, r *http.Request)
+	// Refresh tokens
+	Refresh(w http.ResponseWriter, r *http.Request)
+	// Logout
+	Logout(w http.ResponseWriter, r *http.Request)
 	// Reset password
 	ResetPassword(w http.ResponseWriter, r *http.Request)
+	CompletePasswordReset(w http.ResponseWriter, r *http.Request)
 	// Email Verification
 	ResendVerificationEmail(w http.ResponseWriter, r *http.Request)
 	EmailVerification(w http.ResponseWriter, r *http.Request)
@@ -415,23 +426,109 @@ func (c userController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// else, validation passes and allow through
-	tokenString, err := c.service.LoginUser(&login)
+	loginResponse, err := c.service.LoginUser(&login)
 	if err != nil {
 		fmt.Printf("Error logging in: %s", err)
 		http.Error(w, "Invalid Credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// Build login response
-	var loginResponse = models.LoginResponse{Token: tokenString}
-	// Send to user in body
+	// Send tokens to user in body
 	request.WriteAsJSON(w, loginResponse)
 }
 
+// Refresh tokens
+// Handler to exchange a refresh token for a new token pair
+// @Summary      Refresh tokens
+// @Description  Exchanges a refresh token for a new access token and refresh token. Each refresh token can only be used once: reusing one ends its session
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        token body models.RefreshTokenRequest true "Refresh Token"
+// @Success      200 {object} models.LoginResponse
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid refresh token"
+// @Router       /users/refresh [post]
+func (c userController) Refresh(w http.ResponseWriter, r *http.Request) {
+	// Init models for decoding
+	var refresh models.RefreshTokenRequest
+	// Decode request body as JSON and store in refresh
+	err := json.NewDecoder(r.Body).Decode(&refresh)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&refresh)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	loginResponse, err := c.service.RefreshToken(refresh.RefreshToken)
+	if err != nil {
+		fmt.Printf("Error refreshing tokens: %s\n", err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Send new tokens to user in body
+	request.WriteAsJSON(w, loginResponse)
+}
+
+// Logout
+// Handler to end a session
+// @Summary      Logout
+// @Description  Ends the session of the refresh token in the body, or of the access token if no refresh token is sent. The refresh tokens and access tokens of the session are rejected from then on
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        token body models.RefreshTokenRequest false "Refresh Token"
+// @Success      200 {string} string "Logged out successfully"
+// @Failure      401 {string} string "Invalid refresh token"
+// @Failure      401 {string} string "No session to log out of"
+// @Router       /users/logout [post]
+// @Security BearerToken
+func (c userController) Logout(w http.ResponseWriter, r *http.Request) {
+	// Init models for decoding (the body is optional)
+	var logout models.RefreshTokenRequest
+	json.NewDecoder(r.Body).Decode(&logout)
+
+	// End the session of the refresh token if sent
+	if logout.RefreshToken != "" {
+		err := c.service.Logout(logout.RefreshToken)
+		if err != nil {
+			fmt.Printf("Error logging out: %s\n", err)
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		request.WriteAsJSON(w, "Logged out successfully")
+		return
+	}
+
+	// Else, end the session of the access token
+	tokenData, err := auth.ValidateAndParseToken(r)
+	if err != nil || tokenData.SessionID == "" {
+		http.Error(w, "No session to log out of", http.StatusUnauthorized)
+		return
+	}
+	err = c.service.RevokeSession(tokenData.SessionID)
+	if err != nil {
+		fmt.Printf("Error logging out: %s\n", err)
+		http.Error(w, "Logout failed", http.StatusInternalServerError)
+		return
+	}
+	request.WriteAsJSON(w, "Logged out successfully")
+}
+
 // Reset password
-// Handler to reset password
+// Handler to request a password reset link
 // @Summary      Reset password
-// @Description  Reset password
+// @Description  Sends a link to reset the password (valid for an hour, single use) to the user's email. The password doesn't change until the link is used
 // @Tags         Login
 // @Accept       json
 // @Produce      json
@@ -462,7 +559,7 @@ func (c userController) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// else, validation passes and allow through
-	err = c.service.ResetPasswordAndSendEmail(resetPassword.Email)
+	err = c.service.SendPasswordResetEmail(resetPassword.Email)
 	if err != nil {
 		http.Error(w, "Password reset request failed", http.StatusBadRequest)
 		return
@@ -472,6 +569,49 @@ func (c userController) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	request.WriteAsJSON(w, "Password reset request successful!")
 }
 
+// Complete password reset
+// Handler to set a new password using the token from a password reset email
+// @Summary      Complete password reset
+// @Description  Sets a new password using the token from a password reset email. The token can only be used once, and every session of the user ends
+// @Tags         Login
+// @Accept       json
+// @Produce      json
+// @Param        reset body models.CompletePasswordReset true "Password Reset Form"
+// @Success      200 {string} string "Password reset successful!"
+// @Failure      400 {object} models.ValidationError "Validation Errors"
+// @Failure      401 {string} string "Invalid or expired token"
+// @Router       /users/reset-password [post]
+func (c userController) CompletePasswordReset(w http.ResponseWriter, r *http.Request) {
+	// Grab token and new password from request body
+	var reset models.CompletePasswordReset
+	err := json.NewDecoder(r.Body).Decode(&reset)
+	if err != nil {
+		fmt.Println("Decoding error: ", err)
+		http.Error(w, "Password reset failed", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the incoming DTO
+	pass, valErrors := request.GoValidateStruct(&reset)
+	// If failure detected
+	if !pass {
+		// Write bad request header
+		w.WriteHeader(http.StatusBadRequest)
+		// Write validation errors to JSON
+		request.WriteAsJSON(w, valErrors)
+		return
+	}
+	// else, validation passes and allow through
+	err = c.service.ResetPassword(reset.Token, reset.NewPassword)
+	if err != nil {
+		fmt.Printf("Error resetting password: %s\n", err)
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	request.WriteAsJSON(w, "Password reset successful!")
+}
+
 // Email Verification
 // @Summary      Email Verification
 // @Description  Email Verification
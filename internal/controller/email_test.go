@@ -0,0 +1,129 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestEmailController_MyEmailPreferences(t *testing.T) {
+	// Create a request url
+	requestUrl := "me/email-preferences"
+	var tests = []struct {
+		testName               string
+		method                 string
+		body                   interface{}
+		useToken               bool
+		expectedResponseStatus int
+		expectedMarketing      bool
+	}{
+		{"Users receive every category by default", "GET", nil, true, http.StatusOK, true},
+		{"Opt out of marketing", "PUT", models.UpdateEmailPreferences{Categories: map[string]bool{email.CategoryMarketing: false}}, true, http.StatusOK, false},
+		{"Preferences are kept", "GET", nil, true, http.StatusOK, false},
+		{"Transactional categories can't be opted out of", "PUT", models.UpdateEmailPreferences{Categories: map[string]bool{email.CategoryAccount: false}}, true, http.StatusBadRequest, false},
+		{"Subscribe to marketing", "PUT", models.UpdateEmailPreferences{Categories: map[string]bool{email.CategoryMarketing: true}}, true, http.StatusOK, true},
+		// Deny access to user that doesn't have authentication
+		{"Logged out user", "GET", nil, false, http.StatusForbidden, false},
+	}
+
+	for _, v := range tests {
+		var req *http.Request
+		var err error
+		if v.body != nil {
+			req, err = helpers.BuildApiRequest(v.method, requestUrl, helpers.BuildReqBody(v.body), v.useToken, testModule.accounts.user.token)
+		} else {
+			req, err = helpers.BuildApiRequest(v.method, requestUrl, nil, v.useToken, testModule.accounts.user.token)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%s: Got %v want %v.(%v)", v.testName, status, v.expectedResponseStatus, rr.Body)
+			continue
+		}
+
+		// Check the marketing preference in successful responses
+		if v.expectedResponseStatus == http.StatusOK {
+			var body []models.EmailPreference
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			found := false
+			for _, preference := range body {
+				if preference.Category == email.CategoryAccount {
+					t.Errorf("%s: transactional category %s shouldn't be listed", v.testName, preference.Category)
+				}
+				if preference.Category == email.CategoryMarketing {
+					found = true
+					if preference.Subscribed != v.expectedMarketing {
+						t.Errorf("%s: expected marketing subscribed to be %v, got %v", v.testName, v.expectedMarketing, preference.Subscribed)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s: marketing category not listed in %v", v.testName, body)
+			}
+		}
+	}
+}
+
+func TestEmailController_Unsubscribe(t *testing.T) {
+	address := testModule.accounts.admin.details.Email
+	nonUser := "newsletter-reader@ymail.com"
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		address                string
+		category               string
+		token                  string
+		body                   string
+		expectedResponseStatus int
+		expectedSuppressed     bool
+	}{
+		{"Confirmation page doesn't unsubscribe", "GET", address, email.CategoryNotifications, email.UnsubscribeToken(address, email.CategoryNotifications), "", http.StatusOK, false},
+		{"Invalid signature", "POST", address, email.CategoryNotifications, "forged", "", http.StatusBadRequest, false},
+		{"Signature of another category", "POST", address, email.CategoryNotifications, email.UnsubscribeToken(address, email.CategoryMarketing), "", http.StatusBadRequest, false},
+		{"Transactional category", "POST", address, email.CategoryAccount, email.UnsubscribeToken(address, email.CategoryAccount), "", http.StatusBadRequest, false},
+		{"One-click unsubscribe", "POST", address, email.CategoryNotifications, email.UnsubscribeToken(address, email.CategoryNotifications), "List-Unsubscribe=One-Click", http.StatusOK, true},
+		{"Address without an account", "POST", nonUser, email.CategoryMarketing, email.UnsubscribeToken(nonUser, email.CategoryMarketing), "", http.StatusOK, true},
+	}
+
+	for _, v := range tests {
+		query := url.Values{"email": {v.address}, "category": {v.category}, "token": {v.token}}
+		req, err := http.NewRequest(v.method, email.UnsubscribePath+"?"+query.Encode(), strings.NewReader(v.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		// Create a response recorder
+		rr := httptest.NewRecorder()
+
+		// Send request to mock server
+		testModule.router.ServeHTTP(rr, req)
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%s: Got %v want %v.(%v)", v.testName, status, v.expectedResponseStatus, rr.Body)
+		}
+
+		// Check whether the address receives emails of the category
+		suppressed, err := testModule.email.serv.SuppressedRecipients([]string{v.address}, v.category)
+		if err != nil {
+			t.Fatalf("%s: failed to find suppressed recipients: %v", v.testName, err)
+		}
+		if (len(suppressed) == 1) != v.expectedSuppressed {
+			t.Errorf("%s: expected suppressed to be %v, got %v", v.testName, v.expectedSuppressed, suppressed)
+		}
+	}
+}
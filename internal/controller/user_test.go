@@ -3,10 +3,13 @@ package controller_test
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/models"
@@ -543,6 +546,297 @@ func TestUserController_Login(t *testing.T) {
 	}
 }
 
+// Refresh tokens
+func TestUserController_Refresh(t *testing.T) {
+	login, err := testModule.users.serv.LoginUser(&models.Login{
+		Email:    testModule.accounts.user.details.Email,
+		Password: testModule.accounts.user.details.Password,
+	})
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	var tests = []struct {
+		testName               string
+		data                   models.RefreshTokenRequest
+		expectedResponseStatus int
+	}{
+		{"Refresh using refresh token", models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, http.StatusOK},
+		// Revokes the session
+		{"Fail: Reuse refresh token", models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, http.StatusUnauthorized},
+		{"Fail: Unknown refresh token", models.RefreshTokenRequest{RefreshToken: "unknown"}, http.StatusUnauthorized},
+		{"Fail: Missing refresh token", models.RefreshTokenRequest{}, http.StatusBadRequest},
+	}
+
+	var rotated models.LoginResponse
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", "users/refresh", helpers.BuildReqBody(v.data), false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+		if rr.Code == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &rotated)
+		}
+	}
+
+	// Tokens issued before the reuse was detected are rejected
+	req, err := helpers.BuildApiRequest("GET", "me", nil, true, rotated.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected access token of revoked session to be rejected, got %v", rr.Code)
+	}
+}
+
+// Logout
+func TestUserController_Logout(t *testing.T) {
+	credentials := &models.Login{
+		Email:    testModule.accounts.user.details.Email,
+		Password: testModule.accounts.user.details.Password,
+	}
+	byRefreshToken, err := testModule.users.serv.LoginUser(credentials)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	byAccessToken, err := testModule.users.serv.LoginUser(credentials)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	var tests = []struct {
+		testName               string
+		data                   models.RefreshTokenRequest
+		tokenToUse             string
+		expectedResponseStatus int
+		// Access token expected to be rejected after the request
+		loggedOutToken string
+	}{
+		{"Logout using refresh token", models.RefreshTokenRequest{RefreshToken: byRefreshToken.RefreshToken}, "", http.StatusOK, byRefreshToken.Token},
+		{"Logout using access token", models.RefreshTokenRequest{}, byAccessToken.Token, http.StatusOK, byAccessToken.Token},
+		{"Fail: Unknown refresh token", models.RefreshTokenRequest{RefreshToken: "unknown"}, "", http.StatusUnauthorized, ""},
+		{"Fail: No token", models.RefreshTokenRequest{}, "", http.StatusUnauthorized, ""},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", "users/logout", helpers.BuildReqBody(v.data), v.tokenToUse != "", v.tokenToUse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+
+		// Check the access token of the session is rejected
+		if v.loggedOutToken != "" {
+			req, err := helpers.BuildApiRequest("GET", "me", nil, true, v.loggedOutToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			testModule.router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("%v: expected access token to be rejected, got %v", v.testName, rr.Code)
+			}
+		}
+	}
+}
+
+// Two-factor authentication
+func TestUserController_TwoFactor(t *testing.T) {
+	credentials := models.Login{Email: "two-factor-api@ymail.com", Password: "password"}
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Second",
+		Email:    credentials.Email,
+		Password: credentials.Password,
+		Name:     "Second Factor",
+		Role:     "user",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	token, err := auth.GenerateAccessToken(int(createdUser.ID), createdUser.Email, createdUser.Role, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Enrol
+	rr := serveApiRequest(t, "POST", "me/2fa", nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected enrolment to start, got %v: %v", rr.Code, rr.Body)
+	}
+	var enrolment models.TwoFactorEnrolment
+	json.Unmarshal(rr.Body.Bytes(), &enrolment)
+
+	// Confirm
+	var confirmTests = []struct {
+		testName               string
+		data                   models.TwoFactorCode
+		expectedResponseStatus int
+	}{
+		{"Fail: Missing code", models.TwoFactorCode{}, http.StatusBadRequest},
+		{"Fail: Invalid code", models.TwoFactorCode{Code: totpCode(t, enrolment.Secret, -5)}, http.StatusUnauthorized},
+		{"Confirm enrolment", models.TwoFactorCode{Code: totpCode(t, enrolment.Secret, 0)}, http.StatusOK},
+		{"Fail: Already enabled", models.TwoFactorCode{Code: totpCode(t, enrolment.Secret, 1)}, http.StatusConflict},
+	}
+	var recovery models.TwoFactorRecoveryCodes
+	for _, v := range confirmTests {
+		rr := serveApiRequest(t, "POST", "me/2fa/confirm", v.data, token)
+		if rr.Code != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName, rr.Code, v.expectedResponseStatus, rr.Body)
+		}
+		if rr.Code == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &recovery)
+		}
+	}
+	if len(recovery.RecoveryCodes) != 10 {
+		t.Errorf("Expected 10 recovery codes, got %v", recovery.RecoveryCodes)
+	}
+
+	// Login returns a challenge for the second step
+	rr = serveApiRequest(t, "POST", "users/login", credentials, "")
+	var login models.LoginResponse
+	json.Unmarshal(rr.Body.Bytes(), &login)
+	if rr.Code != http.StatusOK || !login.TwoFactorRequired || login.Token != "" {
+		t.Fatalf("Expected a two-factor challenge, got %v: %v", rr.Code, rr.Body)
+	}
+
+	var loginTests = []struct {
+		testName               string
+		data                   models.TwoFactorLogin
+		expectedResponseStatus int
+	}{
+		{"Fail: Missing code", models.TwoFactorLogin{ChallengeToken: login.ChallengeToken}, http.StatusBadRequest},
+		{"Fail: Invalid code", models.TwoFactorLogin{ChallengeToken: login.ChallengeToken, Code: "000000x"}, http.StatusUnauthorized},
+		{"Fail: Unknown challenge", models.TwoFactorLogin{ChallengeToken: "unknown", Code: recovery.RecoveryCodes[0]}, http.StatusUnauthorized},
+		{"Login using recovery code", models.TwoFactorLogin{ChallengeToken: login.ChallengeToken, Code: recovery.RecoveryCodes[0]}, http.StatusOK},
+		{"Fail: Challenge already completed", models.TwoFactorLogin{ChallengeToken: login.ChallengeToken, Code: recovery.RecoveryCodes[1]}, http.StatusUnauthorized},
+	}
+	var tokens models.LoginResponse
+	for _, v := range loginTests {
+		rr := serveApiRequest(t, "POST", "users/login/2fa", v.data, "")
+		if rr.Code != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName, rr.Code, v.expectedResponseStatus, rr.Body)
+		}
+		if rr.Code == http.StatusOK {
+			json.Unmarshal(rr.Body.Bytes(), &tokens)
+		}
+	}
+
+	// Status
+	rr = serveApiRequest(t, "GET", "me/2fa", nil, tokens.Token)
+	var status models.TwoFactorStatus
+	json.Unmarshal(rr.Body.Bytes(), &status)
+	if rr.Code != http.StatusOK || !status.Enabled || status.RecoveryCodesRemaining != 9 {
+		t.Errorf("Expected two-factor authentication enabled with 9 recovery codes, got %v: %v", rr.Code, rr.Body)
+	}
+
+	// Clean up: Delete created user
+	testModule.users.serv.ResetTwoFactor(int(createdUser.ID))
+	testModule.users.serv.Delete(int(createdUser.ID))
+}
+
+// Roles requiring two-factor authentication
+func TestUserController_TwoFactorRequired(t *testing.T) {
+	t.Setenv("TWO_FACTOR_REQUIRED_ROLES", "user")
+	credentials := models.Login{Email: "two-factor-required@ymail.com", Password: "password"}
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Required",
+		Email:    credentials.Email,
+		Password: credentials.Password,
+		Name:     "Two-Factor Required",
+		Role:     "user",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	login, err := testModule.users.serv.LoginUser(&credentials)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	var tests = []struct {
+		testName               string
+		method                 string
+		url                    string
+		expectedResponseStatus int
+		expectedMessage        string
+	}{
+		{"Fail: Profile blocked until enrolled", "GET", "me", http.StatusForbidden, "Two-factor authentication must be set up\n"},
+		{"Two-factor status", "GET", "me/2fa", http.StatusOK, ""},
+		{"Enrolment", "POST", "me/2fa", http.StatusOK, ""},
+	}
+	for _, v := range tests {
+		rr := serveApiRequest(t, v.method, v.url, nil, login.Token)
+		if rr.Code != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName, rr.Code, v.expectedResponseStatus, rr.Body)
+		}
+		if v.expectedMessage != "" && rr.Body.String() != v.expectedMessage {
+			t.Errorf("%v: The body is: %v. expected: %v.", v.testName, rr.Body.String(), v.expectedMessage)
+		}
+	}
+
+	// Clean up: Delete created user
+	testModule.users.serv.ResetTwoFactor(int(createdUser.ID))
+	testModule.users.serv.Delete(int(createdUser.ID))
+}
+
+// Serves an API request with a JSON body (if any) and an optional access token
+func serveApiRequest(t *testing.T, method string, urlSuffix string, data interface{}, token string) *httptest.ResponseRecorder {
+	var body io.Reader
+	if data != nil {
+		body = helpers.BuildReqBody(data)
+	}
+	req, err := helpers.BuildApiRequest(method, urlSuffix, body, token != "", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// Returns the code of a TOTP secret, a number of time steps from now
+func totpCode(t *testing.T, secret string, steps int64) string {
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// Public keys verifying access tokens
+func TestJWKS(t *testing.T) {
+	req, err := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	testModule.router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Got %v want %v", rr.Code, http.StatusOK)
+	}
+	// Tokens are signed using HMAC_SECRET in tests, so no public keys are published
+	var body auth.JWKS
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Keys == nil || len(body.Keys) != 0 {
+		t.Errorf("Expected an empty key set, got %s (%v)", rr.Body.String(), err)
+	}
+}
+
 func TestUserController_ResetPassword(t *testing.T) {
 	// Create a request url with an "id" URL parameter
 	requestUrl := "users/forgot-password"
@@ -599,6 +893,59 @@ func TestUserController_ResetPassword(t *testing.T) {
 	}
 }
 
+func TestUserController_CompletePasswordReset(t *testing.T) {
+	// Create user with a password reset token
+	createdUser, err := testModule.users.serv.Create(&models.CreateUser{
+		Username: "Forgetful",
+		Email:    "forgot-password@gmail.com",
+		Password: "password",
+		Name:     "Forgot Password",
+	})
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	defer testModule.users.serv.Delete(int(createdUser.ID))
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testModule.users.repo.SetPasswordResetToken(int(createdUser.ID), hash, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		testName               string
+		data                   models.CompletePasswordReset
+		expectedResponseStatus int
+	}{
+		{"Fail: Password too short", models.CompletePasswordReset{Token: token, NewPassword: "new"}, http.StatusBadRequest},
+		{"Fail: Missing token", models.CompletePasswordReset{NewPassword: "newPassword"}, http.StatusBadRequest},
+		{"Fail: Unknown token", models.CompletePasswordReset{Token: "unknown", NewPassword: "newPassword"}, http.StatusUnauthorized},
+		{"Reset password", models.CompletePasswordReset{Token: token, NewPassword: "newPassword"}, http.StatusOK},
+		// Tokens can only be used once
+		{"Fail: Used token", models.CompletePasswordReset{Token: token, NewPassword: "otherPassword"}, http.StatusUnauthorized},
+	}
+
+	for _, v := range tests {
+		req, err := helpers.BuildApiRequest("POST", "users/reset-password", helpers.BuildReqBody(v.data), false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		testModule.router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != v.expectedResponseStatus {
+			t.Errorf("%v: Got %v want %v. \nResp: %v", v.testName,
+				status, v.expectedResponseStatus, rr.Body)
+		}
+	}
+
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("newPassword")) {
+		t.Errorf("Expected new password to be set")
+	}
+}
+
 func TestUserController_ResendVerificationEmail(t *testing.T) {
 	// Create a request url with an "id" URL parameter
 	requestUrl := "users/send-verification-email"
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Long-lived key used by integrations instead of logging in (sent as "Authorization: ApiKey <key>").
+// Requests made with a key act on behalf of its owner, restricted to the scopes of the key.
+// Only the SHA-256 hash of the key is stored, so the key is only shown when created
+type ApiKey struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	// Owner of the key
+	UserID uint   `json:"user_id" gorm:"index"`
+	Name   string `json:"name"`
+	// First characters of the key, to tell keys apart
+	Prefix string `json:"prefix"`
+	// Hex encoded SHA-256 hash of the key
+	KeyHash string `json:"-" gorm:"uniqueIndex"`
+	// Permissions of the owner the key is restricted to
+	Scopes []ApiKeyScope `json:"scopes" gorm:"serializer:json;type:text"`
+	// Keys without an expiry are valid until deleted
+	ExpiresAt  *time.Time `swaggertype:"string" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `swaggertype:"string" json:"last_used_at,omitempty"`
+	// The key itself. Only set when the key is created (never stored)
+	Key string `json:"key,omitempty" gorm:"-"`
+}
+
+// Permission granted to an API key: an action (read, create, update or delete) on an object
+// (a path, which can contain wildcards as in Casbin policies, eg. "/api/posts/*")
+type ApiKeyScope struct {
+	Object string `json:"object"`
+	Action string `json:"action"`
+}
+
+// Returns the scope as shown in the admin panel (eg. "read /api/posts")
+func (scope ApiKeyScope) String() string {
+	return fmt.Sprintf("%s %s", scope.Action, scope.Object)
+}
+
+// Grabs the ID of the schema object as string
+func (key ApiKey) GetID() string {
+	return fmt.Sprint(key.ID)
+}
+
+// Returns the value of an API key field as string (used in admin panel tables)
+func (key ApiKey) ObtainValue(keyValue string) string {
+	expiresAt, lastUsedAt := "Never", "Never"
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.Format(time.RFC3339)
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt = key.LastUsedAt.Format(time.RFC3339)
+	}
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = scope.String()
+	}
+	// Map of API key fields
+	fieldMap := map[string]string{
+		"ID":         fmt.Sprint(key.ID),
+		"CreatedAt":  key.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt":  key.UpdatedAt.Format(time.RFC3339),
+		"UserID":     fmt.Sprint(key.UserID),
+		"Name":       key.Name,
+		"Prefix":     key.Prefix,
+		"Scopes":     strings.Join(scopes, "\n"),
+		"ExpiresAt":  expiresAt,
+		"LastUsedAt": lastUsedAt,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
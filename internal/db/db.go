@@ -44,6 +44,15 @@ func DbConnect(useVerboseLogger bool) *gorm.DB {
 	return db
 }
 
+// Closes the underlying connection pool of a client created by DbConnect
+func DbClose(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to obtain database connection: %w", err)
+	}
+	return sqlDB.Close()
+}
+
 // Extract pointer value as string using data type (used in ObtainValue)
 func PointerToStringWithType(ptr interface{}, dataType string) string {
 	switch dataType {
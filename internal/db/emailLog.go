@@ -0,0 +1,71 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Email log statuses
+const (
+	// Email was accepted by the mail server
+	EmailStatusSent = "sent"
+	// Mail server rejected the email (or couldn't be reached). Email jobs are retried until they run out of attempts
+	EmailStatusFailed = "failed"
+	// Email wasn't sent as every recipient is on the suppression list or opted out of its category
+	EmailStatusSuppressed = "suppressed"
+)
+
+// Email log entry (records the delivery of an email sent by an email job)
+type EmailLog struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time      `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time      `swaggertype:"string" json:"updated_at,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	// Job that sent the email (each attempt of the job updates the same entry)
+	JobID uint `json:"job_id" gorm:"index"`
+	// Email
+	Recipients string `json:"recipients"`                      // Comma separated list of every recipient (including Cc and Bcc)
+	Subject    string `json:"subject"`                         // Subject of the email
+	Template   string `json:"template,omitempty" gorm:"index"` // Template the email was rendered from (if any)
+	Category   string `json:"category,omitempty" gorm:"index"` // Category of the email (see email.Category)
+	// Delivery
+	Status   string     `json:"status" gorm:"index"` // Status of the last attempt
+	Attempts int        `json:"attempts"`            // Number of attempts made to send the email
+	Response string     `json:"response,omitempty"`  // Response of the mail server to the last attempt (or the error if there was no response)
+	SentAt   *time.Time `json:"sent_at,omitempty"`   // Time the mail server accepted the email
+	// Message (JSON encoded), used to resend the email. Bodies are only stored for emails users can opt out of
+	// (not account emails, which can contain reset links and verification codes). Not exposed
+	Message string `json:"-"`
+}
+
+// Grabs the ID of the schema object as string
+func (log EmailLog) GetID() string {
+	return fmt.Sprint(log.ID)
+}
+
+// Returns the value of an email log field as string (used in admin panel tables)
+func (log EmailLog) ObtainValue(keyValue string) string {
+	sentAt := ""
+	if log.SentAt != nil {
+		sentAt = log.SentAt.Format(time.RFC3339)
+	}
+	// Map of email log fields
+	fieldMap := map[string]string{
+		"ID":         fmt.Sprint(log.ID),
+		"CreatedAt":  log.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt":  log.UpdatedAt.Format(time.RFC3339),
+		"JobID":      fmt.Sprint(log.JobID),
+		"Recipients": log.Recipients,
+		"Subject":    log.Subject,
+		"Template":   log.Template,
+		"Category":   log.Category,
+		"Status":     log.Status,
+		"Attempts":   fmt.Sprint(log.Attempts),
+		"Response":   log.Response,
+		"SentAt":     sentAt,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reasons an address is on the email suppression list
+const (
+	// Mail server permanently rejected the address
+	SuppressionReasonHardBounce = "hard-bounce"
+	// Recipient marked an email as spam
+	SuppressionReasonComplaint = "complaint"
+	// Recipient (without an account) used an unsubscribe link
+	SuppressionReasonUnsubscribed = "unsubscribed"
+	// Added by an admin
+	SuppressionReasonManual = "manual"
+)
+
+// Address that mustn't receive non-transactional emails.
+// Deleting an entry removes it for good, so the address receives emails again
+type EmailSuppression struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	// Address (stored in lower case)
+	Email  string `json:"email" gorm:"uniqueIndex"`
+	Reason string `json:"reason" gorm:"index"`
+	// Details of the reason (eg. the response of the mail server that rejected the address)
+	Detail string `json:"detail,omitempty"`
+}
+
+// Grabs the ID of the schema object as string
+func (suppression EmailSuppression) GetID() string {
+	return fmt.Sprint(suppression.ID)
+}
+
+// Returns the value of an email suppression field as string (used in admin panel tables)
+func (suppression EmailSuppression) ObtainValue(keyValue string) string {
+	// Map of email suppression fields
+	fieldMap := map[string]string{
+		"ID":        fmt.Sprint(suppression.ID),
+		"CreatedAt": suppression.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt": suppression.UpdatedAt.Format(time.RFC3339),
+		"Email":     suppression.Email,
+		"Reason":    suppression.Reason,
+		"Detail":    suppression.Detail,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
+
+// Email category a user subscribed to or opted out of.
+// Users without a preference for a category receive its emails
+type EmailPreference struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt  time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_email_preference_user_category"`
+	Category   string    `json:"category" gorm:"uniqueIndex:idx_email_preference_user_category"`
+	Subscribed bool      `json:"subscribed"`
+}
+
+// Grabs the ID of the schema object as string
+func (preference EmailPreference) GetID() string {
+	return fmt.Sprint(preference.ID)
+}
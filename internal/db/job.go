@@ -1,11 +1,33 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Job statuses
+const (
+	// Job is waiting to be picked up by a worker
+	JobStatusPending = "pending"
+	// Job has been claimed by a worker and is being processed
+	JobStatusRunning = "running"
+	// Job failed and is waiting for its next retry
+	JobStatusFailed = "failed"
+	// Job completed successfully
+	JobStatusProcessed = "processed"
+	// Job ran out of attempts and will not be retried
+	JobStatusDead = "dead"
+	// Job was cancelled (eg. from the admin panel or because a job it depends on failed) and will not be run
+	JobStatusCancelled = "cancelled"
+	// Job is waiting for the job it depends on (its parent in a chain) to be processed
+	JobStatusWaiting = "waiting"
+)
+
+// Queue used for jobs that aren't assigned to a named queue
+const DefaultJobQueue = "default"
+
 // Job (used for async jobs)
 type Job struct {
 	ID        uint           `json:"id" gorm:"primaryKey"`
@@ -14,14 +36,131 @@ type Job struct {
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 	JobType   string         // Type of job (e.g., "email", "otherType")
 	// Status
-	Status string `json:"status,omitempty" gorm:"default:'pending'"`
+	Status string `json:"status,omitempty" gorm:"default:'pending';index"`
 	// Payload
-	Payload   string `json:"payload,omitempty"`
-	Processed bool
+	Payload     string `json:"payload,omitempty"` // Sensitive fields are redacted once the job has been processed
+	Processed   bool
+	ProcessedAt *time.Time `json:"processed_at,omitempty" gorm:"index"` // Processed jobs are purged once their retention has passed
+	// Scheduling
+	RunAt    time.Time `json:"run_at,omitempty" gorm:"index"`        // Job will not be run before this time (defaults to creation time)
+	Queue    string    `json:"queue" gorm:"default:'default';index"` // Named queue the job belongs to. Workers subscribe to queues
+	Priority int       `json:"priority" gorm:"default:0;index"`      // Jobs with a higher priority are run first within their queue
+	// Retries
+	Attempts    int       `json:"attempts"`                           // Number of times the job has been attempted
+	MaxAttempts int       `json:"max_attempts" gorm:"default:5"`      // Attempts allowed before the job is marked as dead
+	LastError   string    `json:"last_error,omitempty"`               // Error returned by the last failed attempt
+	NextRunAt   time.Time `json:"next_run_at,omitempty" gorm:"index"` // Job will not be picked up before this time
+	// Lease (held by the worker processing the job)
+	LockedBy    string     `json:"locked_by,omitempty"`                 // Token of the worker claim holding the lease
+	LockedUntil *time.Time `json:"locked_until,omitempty" gorm:"index"` // Lease expiry. Expired leases are released by the reaper
+	// Deduplication
+	UniqueKey   *string    `json:"unique_key,omitempty" gorm:"uniqueIndex"` // Only one job can hold a key at a time
+	UniqueUntil *time.Time `json:"unique_until,omitempty"`                  // Key is held until this time (or until the job is finished if not set)
+	// Batches and chains
+	BatchID  *uint `json:"batch_id,omitempty" gorm:"index"`  // Batch the job belongs to
+	ParentID *uint `json:"parent_id,omitempty" gorm:"index"` // Job that must be processed before this job is run
 }
 
 // Used prior to job creation
 func (job *Job) BeforeCreate(tx *gorm.DB) (err error) {
 	job.CreatedAt = time.Now()
+	// Jobs are due immediately unless scheduled otherwise
+	if job.RunAt.IsZero() {
+		job.RunAt = job.CreatedAt
+	}
+	// Jobs go on the default queue unless assigned otherwise
+	if job.Queue == "" {
+		job.Queue = DefaultJobQueue
+	}
+	// First attempt is made at the scheduled time
+	if job.NextRunAt.IsZero() {
+		job.NextRunAt = job.RunAt
+	}
 	return
 }
+
+// Grabs the ID of the schema object as string
+func (job Job) GetID() string {
+	return fmt.Sprint(job.ID)
+}
+
+// Returns the value of a job field as string (used in admin panel tables)
+func (job Job) ObtainValue(keyValue string) string {
+	// Format optional lease expiry
+	lockedUntil := ""
+	if job.LockedUntil != nil {
+		lockedUntil = job.LockedUntil.Format(time.RFC3339)
+	}
+	processedAt := ""
+	if job.ProcessedAt != nil {
+		processedAt = job.ProcessedAt.Format(time.RFC3339)
+	}
+	// Map of job fields
+	fieldMap := map[string]string{
+		"ID":          fmt.Sprint(job.ID),
+		"CreatedAt":   job.CreatedAt.Format(time.RFC3339),
+		"UpdatedAt":   job.UpdatedAt.Format(time.RFC3339),
+		"JobType":     job.JobType,
+		"Status":      job.Status,
+		"Payload":     job.Payload,
+		"Queue":       job.Queue,
+		"Priority":    fmt.Sprint(job.Priority),
+		"RunAt":       job.RunAt.Format(time.RFC3339),
+		"Attempts":    fmt.Sprintf("%d/%d", job.Attempts, job.MaxAttempts),
+		"LastError":   job.LastError,
+		"NextRunAt":   job.NextRunAt.Format(time.RFC3339),
+		"LockedBy":    job.LockedBy,
+		"LockedUntil": lockedUntil,
+		"UniqueKey":   optionalString(job.UniqueKey),
+		"BatchID":     optionalUint(job.BatchID),
+		"ParentID":    optionalUint(job.ParentID),
+		"ProcessedAt": processedAt,
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
+
+// Formats optional job fields for display
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+func optionalUint(value *uint) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(*value)
+}
+
+// Group of jobs that enqueues a callback job once every job in the group has finished
+type JobBatch struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	Total     int       `json:"total"` // Number of jobs in the batch
+	// Callback job enqueued once the batch has finished
+	CallbackJobType  string `json:"callback_job_type"`
+	CallbackPayload  string `json:"callback_payload,omitempty"`
+	CallbackQueue    string `json:"callback_queue"`
+	CallbackPriority int    `json:"callback_priority"`
+	// Set once every job has been processed, has died or has been cancelled
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Recurring job schedule (used to enqueue jobs on a cron schedule)
+type JobSchedule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	Name      string    `json:"name" gorm:"uniqueIndex"` // Unique name of the schedule
+	Spec      string    `json:"spec"`                    // Cron expression (eg. "0 3 * * *")
+	JobType   string    `json:"job_type"`                // Type of job enqueued on each run
+	Payload   string    `json:"payload,omitempty"`       // Payload of job enqueued on each run
+	Queue     string    `json:"queue"`                   // Named queue of job enqueued on each run
+	Priority  int       `json:"priority"`                // Priority of job enqueued on each run
+	// Runs
+	NextRunAt time.Time  `json:"next_run_at" gorm:"index"` // Time of the next run
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`    // Time of the last run
+}
@@ -0,0 +1,22 @@
+package db
+
+import "time"
+
+// Refresh token issued on login and rotated on every use. Tokens rotated from the same login
+// form a family (a session), which is revoked as a whole on logout or when a used token is reused.
+// Only the SHA-256 hash of the token is stored
+type RefreshToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// Shared by the tokens rotated from the same login. Access tokens carry it as their session ID
+	FamilyID string `json:"family_id" gorm:"index"`
+	// Hex encoded SHA-256 hash of the token
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time `swaggertype:"string" json:"expires_at" gorm:"index"`
+	// Set when the token is exchanged for a new one. Using it again revokes the family
+	UsedAt *time.Time `swaggertype:"string" json:"used_at,omitempty"`
+	// Set when the family is revoked
+	RevokedAt *time.Time `swaggertype:"string" json:"revoked_at,omitempty"`
+}
@@ -10,7 +10,16 @@ var Models = []interface{}{
 	// Core Schemas
 	&User{}, // Used for user management
 	&Job{},  // Used for job queuing
+	&JobSchedule{}, // Used for recurring jobs
+	&JobBatch{}, // Used for job batches
 	&Action{}, // Used for logging actions
+	&EmailLog{}, // Used for logging email deliveries
+	&EmailSuppression{}, // Used for addresses that mustn't receive non-transactional emails
+	&EmailPreference{}, // Used for the email categories users opted out of
+	&RefreshToken{}, // Used for refresh tokens (sessions)
+	&TwoFactor{}, // Used for two-factor authentication (TOTP)
+	&TwoFactorRecoveryCode{}, // Used for two-factor recovery codes
+	&ApiKey{}, // Used for API keys (integrations)
 	// Additional Schemas
 	&Post{},
 }
@@ -26,10 +35,15 @@ type User struct {
 	Username  string         `json:"username,omitempty"`
 	Email     string         `json:"email,omitempty" gorm:"uniqueIndex"`
 	Password  string         `json:"-"`
+	// Locale used for emails sent to the user (eg. "en", "es-MX")
+	Language string `json:"language,omitempty"`
 	// Verification
 	Verified               *bool     `json:"verified,omitempty" gorm:"default:false"`
 	VerificationCode       string    `json:"verification_code,omitempty" gorm:"default:null"`
 	VerificationCodeExpiry time.Time `json:"verification_code_expiry,omitempty" gorm:"default:null"`
+	// Password reset (hash of the single use token sent by email)
+	PasswordResetTokenHash string     `json:"-" gorm:"index;default:null"`
+	PasswordResetExpiry    *time.Time `json:"-" gorm:"default:null"`
 	// Relationships
 	Posts []Post `json:"posts,omitempty" gorm:"foreignKey:UserID"`
 }
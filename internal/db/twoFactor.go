@@ -0,0 +1,35 @@
+package db
+
+import "time"
+
+// TOTP (RFC 6238) authenticator enrolled by a user. Two-factor authentication is enabled once
+// the enrolment is confirmed with a code from the authenticator
+type TwoFactor struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UpdatedAt time.Time `swaggertype:"string" json:"updated_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex"`
+	// Base32 encoded shared secret
+	Secret string `json:"-"`
+	// Set once the user confirms the enrolment. Unconfirmed enrolments aren't used to log in
+	ConfirmedAt *time.Time `swaggertype:"string" json:"confirmed_at,omitempty"`
+	// Time step of the last code accepted, so a code can't be used twice
+	LastUsedStep int64 `json:"-"`
+	// Pending second login step (hash of the challenge token returned after the password check)
+	ChallengeHash      string     `json:"-" gorm:"index;default:null"`
+	ChallengeExpiresAt *time.Time `json:"-" gorm:"default:null"`
+	// Failed codes since the last successful login. Reaching the limit locks the second step for a while
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"-" gorm:"default:null"`
+}
+
+// Single use recovery code, used to log in when the authenticator is unavailable.
+// Only the SHA-256 hash of the code is stored
+type TwoFactorRecoveryCode struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `swaggertype:"string" json:"created_at,omitempty"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	// Hex encoded SHA-256 hash of the code
+	CodeHash string     `json:"-" gorm:"index"`
+	UsedAt   *time.Time `swaggertype:"string" json:"used_at,omitempty"`
+}
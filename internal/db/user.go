@@ -15,6 +15,7 @@ func (schemaObject User) ObtainValue(keyValue string) string {
 		"Name":                   schemaObject.Name,
 		"Username":               schemaObject.Username,
 		"Email":                  schemaObject.Email,
+		"Language":               schemaObject.Language,
 		"Verified":               fmt.Sprint(PointerToStringWithType(schemaObject.Verified, "bool")),
 		"VerificationCode":       schemaObject.VerificationCode,
 		"VerificationCodeExpiry": schemaObject.VerificationCodeExpiry.Format(time.RFC3339),
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Core email categories. Users can opt out of non-transactional categories
+const (
+	// Emails about the user's account (eg. verification, password reset)
+	CategoryAccount = "account"
+	// Notifications about activity in the app
+	CategoryNotifications = "notifications"
+	// Newsletters and product announcements
+	CategoryMarketing = "marketing"
+)
+
+// Category groups emails users can opt out of (unless transactional)
+type Category struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Transactional emails are always sent, even if the recipient has opted out or is on the suppression list
+	Transactional bool `json:"transactional"`
+}
+
+// Registry of email categories
+var categories = struct {
+	mu   sync.RWMutex
+	list map[string]Category
+}{
+	list: map[string]Category{
+		CategoryAccount:       {Name: CategoryAccount, Description: "Account verification and password resets", Transactional: true},
+		CategoryNotifications: {Name: CategoryNotifications, Description: "Notifications about your activity", Transactional: false},
+		CategoryMarketing:     {Name: CategoryMarketing, Description: "Newsletters and product announcements", Transactional: false},
+	},
+}
+
+// RegisterCategory adds an email category (replacing a category with the same name).
+// Used by modules to add categories users can opt out of
+func RegisterCategory(category Category) {
+	categories.mu.Lock()
+	defer categories.mu.Unlock()
+	categories.list[category.Name] = category
+}
+
+// Categories returns the registered email categories sorted by name
+func Categories() []Category {
+	categories.mu.RLock()
+	defer categories.mu.RUnlock()
+	list := make([]Category, 0, len(categories.list))
+	for _, category := range categories.list {
+		list = append(list, category)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// FindCategory returns a registered email category
+func FindCategory(name string) (Category, bool) {
+	categories.mu.RLock()
+	defer categories.mu.RUnlock()
+	category, ok := categories.list[strings.TrimSpace(name)]
+	return category, ok
+}
+
+// IsTransactional reports whether emails of a category bypass opt-outs and the suppression list.
+// Only registered transactional categories do, messages without a category are checked against the list
+func IsTransactional(category string) bool {
+	found, ok := FindCategory(category)
+	return ok && found.Transactional
+}
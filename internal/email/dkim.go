@@ -0,0 +1,94 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// Headers signed by DKIM (RFC 6376 section 5.4.1). List-Unsubscribe is signed so it can't be replaced
+var dkimHeaderKeys = []string{"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post"}
+
+// DKIMOptions holds the settings used to sign emails using DKIM.
+// The public key must be published in the DNS TXT record <Selector>._domainkey.<Domain>
+type DKIMOptions struct {
+	// Domain signing the email (usually the domain of the from address)
+	Domain   string
+	Selector string
+	// Private key (RSA or Ed25519, see ParseDKIMPrivateKey)
+	Signer crypto.Signer
+}
+
+// DKIMOptionsFromEnv reads the DKIM settings from the environment (DKIM_DOMAIN, DKIM_SELECTOR and
+// the PEM encoded private key in DKIM_PRIVATE_KEY or the file at DKIM_PRIVATE_KEY_FILE).
+// Returns nil if DKIM signing isn't configured
+func DKIMOptionsFromEnv() (*DKIMOptions, error) {
+	domain := strings.TrimSpace(os.Getenv("DKIM_DOMAIN"))
+	selector := strings.TrimSpace(os.Getenv("DKIM_SELECTOR"))
+	key := os.Getenv("DKIM_PRIVATE_KEY")
+	keyFile := os.Getenv("DKIM_PRIVATE_KEY_FILE")
+	if domain == "" && selector == "" && key == "" && keyFile == "" {
+		return nil, nil
+	}
+	if domain == "" || selector == "" || (key == "" && keyFile == "") {
+		return nil, errors.New("DKIM signing requires DKIM_DOMAIN, DKIM_SELECTOR and DKIM_PRIVATE_KEY or DKIM_PRIVATE_KEY_FILE")
+	}
+
+	pemBytes := []byte(key)
+	if key == "" {
+		var err error
+		pemBytes, err = os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DKIM private key: %w", err)
+		}
+	}
+	signer, err := ParseDKIMPrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &DKIMOptions{Domain: domain, Selector: selector, Signer: signer}, nil
+}
+
+// ParseDKIMPrivateKey parses a PEM encoded RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8) private key
+func ParseDKIMPrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("invalid DKIM private key: no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DKIM private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("invalid DKIM private key: unsupported key type")
+	}
+	return signer, nil
+}
+
+// Sign returns the message with a DKIM-Signature header prepended
+func (o *DKIMOptions) Sign(msg []byte) ([]byte, error) {
+	var signed bytes.Buffer
+	err := dkim.Sign(&signed, bytes.NewReader(msg), &dkim.SignOptions{
+		Domain:                 o.Domain,
+		Selector:               o.Selector,
+		Signer:                 o.Signer,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimHeaderKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign email using DKIM: %w", err)
+	}
+	return signed.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+)
+
+// Email drivers (selected using the EMAIL_DRIVER environment variable)
+const (
+	// Sends emails using the SMTP settings (default)
+	DriverSMTP = "smtp"
+	// Writes each email as a .eml file into the outbox directory (viewable in the admin panel)
+	DriverFile = "file"
+	// Writes each email to the log
+	DriverLog = "log"
+)
+
+// Directory emails are written to by the file driver unless set using EMAIL_OUTBOX_DIR
+const DefaultOutboxDir = "outbox"
+
+// Address emails are sent from by the file and log drivers when no from address or SMTP username is set
+const defaultFromAddress = "noreply@localhost"
+
+// NewEmailFromEnv builds the email service for the driver set in the EMAIL_DRIVER environment variable.
+// Returns an error if the driver is unknown
+func NewEmailFromEnv() (Email, error) {
+	driver := strings.ToLower(strings.TrimSpace(os.Getenv("EMAIL_DRIVER")))
+	switch driver {
+	case "", DriverSMTP:
+		return NewSMTPEmail()
+	case DriverFile:
+		return NewFileEmail(OutboxDirFromEnv(), fromFromEnv()), nil
+	case DriverLog:
+		return NewLogEmail(fromFromEnv()), nil
+	}
+	return nil, fmt.Errorf("unknown email driver %q (expected %s, %s or %s)", driver, DriverSMTP, DriverFile, DriverLog)
+}
+
+// OutboxDirFromEnv returns the directory emails are written to by the file driver
+func OutboxDirFromEnv() string {
+	if dir := os.Getenv("EMAIL_OUTBOX_DIR"); dir != "" {
+		return dir
+	}
+	return DefaultOutboxDir
+}
+
+// Returns the sender of emails (the address including the name if set)
+func fromFromEnv() string {
+	address := os.Getenv("SMTP_FROM_ADDRESS")
+	if address == "" {
+		address = os.Getenv("SMTP_USERNAME")
+	}
+	if address == "" {
+		address = defaultFromAddress
+	}
+	return formatFrom(os.Getenv("SMTP_FROM_NAME"), address)
+}
+
+// Writes each email as a .eml file into a directory
+type fileEmail struct {
+	Dir         string
+	FromAddress string
+}
+
+// Builds an email service that writes each email as a .eml file into the given directory.
+// Used in local development to capture emails without an SMTP server (see Outbox)
+func NewFileEmail(dir, fromAddress string) Email {
+	return &fileEmail{Dir: dir, FromAddress: fromAddress}
+}
+
+// Writes the email message into the outbox directory
+func (e *fileEmail) Send(message EmailMessage) error {
+	_, err := e.SendWithResponse(message)
+	return err
+}
+
+// Writes the email message into the outbox directory. Returns the path of the file written as the response
+func (e *fileEmail) SendWithResponse(message EmailMessage) (string, error) {
+	msg, err := message.Bytes(e.FromAddress)
+	if err != nil {
+		return "", err
+	}
+	// Record every recipient (Bcc recipients aren't included in the message headers)
+	envelope := fmt.Sprintf("%s: %s\r\n", envelopeHeader, strings.Join(message.Recipients(), ", "))
+
+	if err := os.MkdirAll(e.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed creating outbox directory: %w", err)
+	}
+	// Name files by the time they were sent so they are listed in order
+	suffix, err := utility.GenerateRandomString(6)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405.000000000"), suffix)
+
+	// Write to a temporary file first so the outbox never lists a partially written email
+	tmpPath := filepath.Join(e.Dir, name+".tmp")
+	if err := os.WriteFile(tmpPath, append([]byte(envelope), msg...), 0644); err != nil {
+		return "", fmt.Errorf("failed writing email to outbox: %w", err)
+	}
+	path := filepath.Join(e.Dir, name+outboxExtension)
+	if err := os.Rename(tmpPath, path); err != nil {
+		return "", fmt.Errorf("failed writing email to outbox: %w", err)
+	}
+	return fmt.Sprintf("written to %s", path), nil
+}
+
+// Writes each email to the log
+type logEmail struct {
+	FromAddress string
+}
+
+// Builds an email service that writes each email to the log instead of sending it
+func NewLogEmail(fromAddress string) Email {
+	return &logEmail{FromAddress: fromAddress}
+}
+
+// Writes the email message to the log (text body if available, else the HTML body)
+func (e *logEmail) Send(message EmailMessage) error {
+	if err := message.Validate(); err != nil {
+		return err
+	}
+	body := message.TextBody
+	if body == "" {
+		body = message.HTMLBody
+	}
+	attachments := make([]string, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		attachments = append(attachments, attachment.Filename)
+	}
+
+	log.Printf("Email from %s to %s (cc: %s, bcc: %s)\nSubject: %s\nAttachments: %s\n%s\n",
+		e.FromAddress,
+		strings.Join(message.To, ", "),
+		strings.Join(message.Cc, ", "),
+		strings.Join(message.Bcc, ", "),
+		message.Subject,
+		strings.Join(attachments, ", "),
+		body,
+	)
+	return nil
+}
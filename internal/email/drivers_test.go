@@ -0,0 +1,130 @@
+package email_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+)
+
+func TestFileEmail_Outbox(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox := email.NewOutbox(dir)
+
+	// An outbox that hasn't been written to yet is empty
+	messages, err := outbox.List()
+	if err != nil || len(messages) != 0 {
+		t.Fatalf("Expected empty outbox, got %d messages (%v)", len(messages), err)
+	}
+
+	mail := email.NewFileEmail(dir, "noreply@example.com")
+	sent := []email.EmailMessage{
+		email.NewHTMLMessage("first@example.com", "Verify your email", `<a href="http://localhost/verify?token=abc">Verify</a>`),
+		{
+			To:          []string{"second@example.com"},
+			Bcc:         []string{"hidden@example.com"},
+			Subject:     "Your invoice – March",
+			TextBody:    "Invoice attached",
+			Attachments: []email.Attachment{{Filename: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+		},
+	}
+	for _, message := range sent {
+		if err := mail.Send(message); err != nil {
+			t.Fatalf("Failed to send %q: %v", message.Subject, err)
+		}
+	}
+
+	// Messages are listed newest first
+	messages, err = outbox.List()
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d (%v)", len(messages), err)
+	}
+	invoice, verify := messages[0], messages[1]
+
+	var tests = []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"Verify from", verify.From, "noreply@example.com"},
+		{"Verify to", verify.To, "first@example.com"},
+		{"Verify subject", verify.Subject, "Verify your email"},
+		{"Verify HTML body", verify.HTMLBody, sent[0].HTMLBody},
+		{"Invoice subject", invoice.Subject, "Your invoice – March"},
+		{"Invoice recipients", invoice.Recipients, "second@example.com, hidden@example.com"},
+		{"Invoice text body", invoice.TextBody, "Invoice attached"},
+		{"Invoice attachments", invoice.ObtainValue("Attachments"), "invoice.pdf"},
+	}
+	for _, v := range tests {
+		if v.got != v.expected {
+			t.Errorf("%s: expected %q, got %q", v.name, v.expected, v.got)
+		}
+	}
+
+	// Find by ID
+	found, err := outbox.Find(verify.ID)
+	if err != nil || found.Subject != verify.Subject {
+		t.Errorf("Expected to find %q, got %v (%v)", verify.Subject, found, err)
+	}
+
+	// Delete
+	if err := outbox.Delete(verify.ID); err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if _, err := outbox.Find(verify.ID); !errors.Is(err, email.ErrMessageNotFound) {
+		t.Errorf("Expected deleted message to be not found, got %v", err)
+	}
+	if err := outbox.Delete(verify.ID); !errors.Is(err, email.ErrMessageNotFound) {
+		t.Errorf("Expected deleting a missing message to fail, got %v", err)
+	}
+}
+
+func TestOutbox_FindOutsideDir(t *testing.T) {
+	dir := t.TempDir()
+	outbox := email.NewOutbox(filepath.Join(dir, "outbox"))
+	// A message outside of the outbox directory
+	if err := os.WriteFile(filepath.Join(dir, "secret.eml"), []byte("Subject: Secret\r\n\r\nSecret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, id := range []string{"../secret", "", ".", "..", "a/../../secret"} {
+		if _, err := outbox.Find(id); !errors.Is(err, email.ErrMessageNotFound) {
+			t.Errorf("Expected %q to be not found, got %v", id, err)
+		}
+		if err := outbox.Delete(id); !errors.Is(err, email.ErrMessageNotFound) {
+			t.Errorf("Expected deleting %q to fail, got %v", id, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "secret.eml")); err != nil {
+		t.Errorf("Expected file outside the outbox to be kept: %v", err)
+	}
+}
+
+func TestNewEmailFromEnv(t *testing.T) {
+	var tests = []struct {
+		driver  string
+		smtpTLS string
+		valid   bool
+	}{
+		{"", "", true},
+		{"smtp", "", true},
+		{"file", "", true},
+		{" file ", "", true},
+		{"LOG", "", true},
+		{"carrier-pigeon", "", false},
+		{"flie", "", false},
+		// Invalid SMTP settings aren't replaced with weaker defaults
+		{"smtp", "sometimes", false},
+		{"", "sometimes", false},
+	}
+	for _, v := range tests {
+		t.Setenv("EMAIL_DRIVER", v.driver)
+		t.Setenv("SMTP_TLS", v.smtpTLS)
+		mail, err := email.NewEmailFromEnv()
+		if (err == nil) != v.valid || (err == nil && mail == nil) {
+			t.Errorf("%q (SMTP_TLS %q): expected valid to be %v, got %v", v.driver, v.smtpTLS, v.valid, err)
+		}
+	}
+}
@@ -1,57 +1,229 @@
 package email
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/smtp"
-	"os"
+	"net/textproto"
+	"time"
 )
 
+// Email is implemented by the services used to send email messages
 type Email interface {
-	SendEmail(recipient, subject, body string) error
+	Send(message EmailMessage) error
 }
 
-// Email struct
+// ResponseSender is implemented by email services that report the response of the mail server
+// (eg. "250 2.0.0 Ok: queued as 4F2A1"). Used to record the response in the email log
+type ResponseSender interface {
+	SendWithResponse(message EmailMessage) (string, error)
+}
+
+// SendWithResponse sends the message using the email service, returning the response of the mail server
+// if the service reports it (see ResponseSender). When the message is rejected, the response is the
+// reply of the mail server if available (eg. "550 5.1.1 User unknown")
+func SendWithResponse(service Email, message EmailMessage) (string, error) {
+	if sender, ok := service.(ResponseSender); ok {
+		return sender.SendWithResponse(message)
+	}
+	return "", service.Send(message)
+}
+
+// Email struct (sends emails using SMTP)
 type email struct {
-	Auth        smtp.Auth
-	SmtpAddress string
-	FromAddress string
-	SendMail    func(from, recipient, body string) error
+	Config SMTPConfig
+	Auth   smtp.Auth
+}
+
+// NewSMTPEmail builds the SMTP email service using the settings in the environment (see SMTPConfigFromEnv).
+// Returns an error if a setting is invalid, rather than sending emails with weaker settings (eg. without TLS or DKIM)
+func NewSMTPEmail() (Email, error) {
+	config, err := SMTPConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewSMTPEmailWithConfig(config)
+}
+
+// NewSMTPEmailWithConfig builds an SMTP email service using the given settings.
+// Returns an error if a setting is invalid
+func NewSMTPEmailWithConfig(config SMTPConfig) (Email, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return newSMTPEmail(config), nil
+}
+
+func newSMTPEmail(config SMTPConfig) *email {
+	mailer := &email{Config: config}
+	if config.Username != "" {
+		mailer.Auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return mailer
+}
+
+// Sends email message using SMTP
+func (e *email) Send(message EmailMessage) error {
+	_, err := e.SendWithResponse(message)
+	return err
 }
 
-func NewSMTPEmail() Email {
-	return &email{
-		Auth:        smtp.PlainAuth("", os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("SMTP_HOST")),
-		SmtpAddress: os.Getenv("SMTP_HOST") + ":" + os.Getenv("SMTP_PORT"),
-		FromAddress: os.Getenv("SMTP_USERNAME"),
+// Sends email message using SMTP, returning the response of the SMTP server
+func (e *email) SendWithResponse(message EmailMessage) (string, error) {
+	// Build the MIME message (headers followed by the body)
+	msg, err := message.Bytes(e.Config.From())
+	if err != nil {
+		return "", err
+	}
+	// Sign the message so receiving servers can verify it was sent by the domain
+	if e.Config.DKIM != nil {
+		if msg, err = e.Config.DKIM.Sign(msg); err != nil {
+			return "", err
+		}
+	}
+
+	// This sends the email to every recipient (including Bcc)
+	response, err := e.sendMail(message.Recipients(), msg)
+	if err != nil {
+		return smtpResponse(err), fmt.Errorf("smtp.SendMail() failed with: %w", err)
+	}
+	return response, nil
+}
+
+// Sends the message to the recipients like smtp.SendMail, but applies the TLS mode and timeouts
+// of the config and returns the response of the SMTP server once it has accepted the message
+func (e *email) sendMail(recipients []string, msg []byte) (string, error) {
+	conn, err := e.dial()
+	if err != nil {
+		return "", err
+	}
+	// The whole conversation must finish within the send timeout
+	conn.SetDeadline(time.Now().Add(e.Config.SendTimeout))
+
+	client, err := smtp.NewClient(conn, e.Config.Host)
+	if err != nil {
+		conn.Close()
+		return "", err
+	}
+	defer client.Close()
+
+	// Upgrade the connection to TLS (required or if supported by the server)
+	if e.Config.TLSMode == SMTPTLSStartTLS || e.Config.TLSMode == SMTPTLSOpportunistic {
+		ok, _ := client.Extension("STARTTLS")
+		if !ok && e.Config.TLSMode == SMTPTLSStartTLS {
+			return "", ErrStartTLSUnsupported
+		}
+		if ok {
+			if err := client.StartTLS(e.tlsConfig()); err != nil {
+				return "", err
+			}
+		}
+	}
+	// Authenticate if supported by the server
+	if ok, _ := client.Extension("AUTH"); ok && e.Auth != nil {
+		if err := client.Auth(e.Auth); err != nil {
+			return "", err
+		}
+	}
+
+	// Envelope
+	if err := client.Mail(e.Config.FromAddress); err != nil {
+		return "", err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return "", &RecipientError{Address: recipient, Err: err}
+		}
 	}
+
+	// Send the message and read the server's response
+	response, err := sendData(client.Text, msg)
+	if err != nil {
+		return "", err
+	}
+	client.Quit()
+	return response, nil
 }
 
-// Sends email using SMTP
-func (e *email) SendEmail(recipient, subject, body string) error {
-	// Set MIME and other headers
-	headers := make(map[string]string)
-	headers["From"] = e.FromAddress
-	headers["To"] = recipient
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=\"utf-8\""
+// Connects to the SMTP server (using TLS in implicit TLS mode) within the dial timeout
+func (e *email) dial() (net.Conn, error) {
+	address := net.JoinHostPort(e.Config.Host, e.Config.Port)
+	dialer := &net.Dialer{Timeout: e.Config.DialTimeout}
+	if e.Config.TLSMode == SMTPTLSImplicit {
+		return tls.DialWithDialer(dialer, "tcp", address, e.tlsConfig())
+	}
+	return dialer.Dial("tcp", address)
+}
 
-	// Build the headers
-	header := ""
-	for k, v := range headers {
-		header += fmt.Sprintf("%s: %s\r\n", k, v)
+// TLS settings used to connect to the server
+func (e *email) tlsConfig() *tls.Config {
+	config := &tls.Config{}
+	if e.Config.TLSConfig != nil {
+		config = e.Config.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = e.Config.Host
 	}
+	return config
+}
 
-	// The msg parameter should be an RFC 822-style email with headers first,
-	// a blank line, and then the message body (Go Template).
-	msg := []byte(
-		header + "\r\n" +
-			body + "\r\n")
+// Sends the message using the DATA command. Returns the response of the server once the message has been sent
+func sendData(text *textproto.Conn, msg []byte) (string, error) {
+	id, err := text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	text.StartResponse(id)
+	_, _, err = text.ReadResponse(354)
+	text.EndResponse(id)
+	if err != nil {
+		return "", err
+	}
 
-	// This sends the email with a plain auth setup
-	err := smtp.SendMail(e.SmtpAddress, e.Auth, e.FromAddress, []string{recipient}, msg)
+	writer := text.DotWriter()
+	if _, err := writer.Write(msg); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	code, response, err := text.ReadResponse(250)
 	if err != nil {
-		return fmt.Errorf("smtp.SendMail() failed with: %s", err)
+		return "", err
+	}
+	return fmt.Sprintf("%d %s", code, response), nil
+}
+
+// RecipientError is returned when the mail server rejects a recipient of the message
+type RecipientError struct {
+	Address string
+	Err     error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("recipient %s rejected: %v", e.Address, e.Err)
+}
+
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent reports whether the mail server permanently rejected the recipient (5xx reply, eg. "550 User unknown").
+// Permanently rejected (hard bounced) addresses are added to the suppression list
+func (e *RecipientError) Permanent() bool {
+	var reply *textproto.Error
+	return errors.As(e.Err, &reply) && reply.Code >= 500 && reply.Code < 600
+}
+
+// Returns the reply of the SMTP server that caused an error (empty if the error wasn't a reply)
+func smtpResponse(err error) string {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		// Formatted like the server's reply (textproto.Error quotes the message)
+		return fmt.Sprintf("%03d %s", reply.Code, reply.Msg)
 	}
-	return nil
+	return ""
 }
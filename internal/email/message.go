@@ -0,0 +1,270 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+)
+
+// Returned when a message can't be sent as it is missing recipients or a body
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// EmailMessage is an email sent to one or more recipients.
+// Messages with both an HTML and a text body are sent as multipart/alternative
+// so mail clients can pick the version they display.
+type EmailMessage struct {
+	// Recipients
+	To  []string
+	Cc  []string
+	Bcc []string // Not included in the message headers
+	// Address replies are sent to (optional)
+	ReplyTo string
+	Subject string
+	// At least one body is required
+	HTMLBody string
+	TextBody string
+	// Files attached to the message
+	Attachments []Attachment
+	// Category of the email (see Category). Recipients can opt out of non-transactional categories
+	Category string `json:",omitempty"`
+	// Link used to unsubscribe the recipient (sent in the List-Unsubscribe header)
+	UnsubscribeURL string `json:",omitempty"`
+}
+
+// Attachment is a file attached to an email message
+type Attachment struct {
+	Filename string
+	// MIME type of the file (default: application/octet-stream)
+	ContentType string
+	Data        []byte
+}
+
+// Builds a message with an HTML body sent to a single recipient
+func NewHTMLMessage(recipient, subject, htmlBody string) EmailMessage {
+	return EmailMessage{To: []string{recipient}, Subject: subject, HTMLBody: htmlBody}
+}
+
+// Validate checks the message has a recipient and a body, and that its addresses are valid
+func (m EmailMessage) Validate() error {
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrInvalidMessage)
+	}
+	if m.HTMLBody == "" && m.TextBody == "" {
+		return fmt.Errorf("%w: no body", ErrInvalidMessage)
+	}
+	addresses := m.Recipients()
+	if m.ReplyTo != "" {
+		addresses = append(addresses, m.ReplyTo)
+	}
+	for _, address := range addresses {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("%w: invalid address %q", ErrInvalidMessage, address)
+		}
+	}
+	return nil
+}
+
+// Recipients returns every address the message is delivered to (To, Cc and Bcc)
+func (m EmailMessage) Recipients() []string {
+	recipients := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	recipients = append(recipients, m.To...)
+	recipients = append(recipients, m.Cc...)
+	recipients = append(recipients, m.Bcc...)
+	return recipients
+}
+
+// WithoutRecipients returns a copy of the message that isn't sent to the given addresses
+func (m EmailMessage) WithoutRecipients(addresses ...string) EmailMessage {
+	excluded := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		excluded[normalizeAddress(address)] = true
+	}
+	filter := func(recipients []string) []string {
+		var kept []string
+		for _, recipient := range recipients {
+			if !excluded[normalizeAddress(recipient)] {
+				kept = append(kept, recipient)
+			}
+		}
+		return kept
+	}
+	m.To, m.Cc, m.Bcc = filter(m.To), filter(m.Cc), filter(m.Bcc)
+	return m
+}
+
+// Bytes builds the RFC 5322 message sent from the given address, with its headers
+// followed by the MIME encoded body. Bcc recipients are left out of the headers.
+func (m EmailMessage) Bytes(from string) ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	var msg bytes.Buffer
+
+	// Write the message headers
+	headers := []struct{ key, value string }{
+		{"From", from},
+		{"To", strings.Join(m.To, ", ")},
+		{"Cc", strings.Join(m.Cc, ", ")},
+		{"Reply-To", m.ReplyTo},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", buildMessageID(from)},
+		{"MIME-Version", "1.0"},
+	}
+	// One-click unsubscribe (RFC 8058)
+	if m.UnsubscribeURL != "" {
+		headers = append(headers,
+			struct{ key, value string }{"List-Unsubscribe", "<" + m.UnsubscribeURL + ">"},
+			struct{ key, value string }{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+		)
+	}
+	for _, header := range headers {
+		if header.value != "" {
+			fmt.Fprintf(&msg, "%s: %s\r\n", header.key, header.value)
+		}
+	}
+
+	// Without attachments, the body is the message content
+	if len(m.Attachments) == 0 {
+		if err := m.writeBody(writeHeaderTo(&msg)); err != nil {
+			return nil, err
+		}
+		return msg.Bytes(), nil
+	}
+
+	// Else, send the body followed by the attachments as multipart/mixed
+	mixed := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", mixed.Boundary())
+	err := m.writeBody(func(header textproto.MIMEHeader) (io.Writer, error) {
+		return mixed.CreatePart(header)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range m.Attachments {
+		if err := writeAttachment(mixed, attachment); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// Creates a part of the message with the given headers, returning the writer used for its content
+type createPart func(header textproto.MIMEHeader) (io.Writer, error)
+
+// Writes the message body using createPart. Messages with an HTML and a text body are written as multipart/alternative
+func (m EmailMessage) writeBody(create createPart) error {
+	// Single body
+	if m.HTMLBody == "" {
+		return writeText(create, "text/plain", m.TextBody)
+	}
+	if m.TextBody == "" {
+		return writeText(create, "text/html", m.HTMLBody)
+	}
+
+	// Text and HTML alternatives (in order of preference, the last being preferred)
+	var alternatives bytes.Buffer
+	alternative := multipart.NewWriter(&alternatives)
+	for _, body := range []struct{ contentType, content string }{{"text/plain", m.TextBody}, {"text/html", m.HTMLBody}} {
+		if err := writeText(alternative.CreatePart, body.contentType, body.content); err != nil {
+			return err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()}))
+	part, err := create(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(alternatives.Bytes())
+	return err
+}
+
+// Writes a quoted-printable encoded text part
+func writeText(create createPart, contentType, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=\"utf-8\"")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := create(header)
+	if err != nil {
+		return err
+	}
+	encoder := quotedprintable.NewWriter(part)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Writes a base64 encoded attachment
+func writeAttachment(writer *multipart.Writer, attachment Attachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// Wrap encoded lines at 76 characters
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(part, encoded+"\r\n")
+	return err
+}
+
+// Returns a createPart that writes the part's headers straight into the message (for messages with a single part)
+func writeHeaderTo(msg *bytes.Buffer) createPart {
+	return func(header textproto.MIMEHeader) (io.Writer, error) {
+		for key, values := range header {
+			for _, value := range values {
+				fmt.Fprintf(msg, "%s: %s\r\n", key, value)
+			}
+		}
+		msg.WriteString("\r\n")
+		return msg, nil
+	}
+}
+
+// Builds a unique Message-ID using the domain of the sender's address
+func buildMessageID(from string) string {
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, found := strings.Cut(address.Address, "@"); found {
+			domain = host
+		}
+	}
+	random, err := utility.GenerateRandomString(16)
+	if err != nil {
+		random = fmt.Sprint(time.Now().UnixNano())
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), random, domain)
+}
@@ -0,0 +1,147 @@
+package email_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+)
+
+func TestEmailMessage_Bytes(t *testing.T) {
+	message := email.EmailMessage{
+		To:       []string{"first@example.com", "second@example.com"},
+		Cc:       []string{"cc@example.com"},
+		Bcc:      []string{"hidden@example.com"},
+		ReplyTo:  "support@example.com",
+		Subject:  "Your invoice – March",
+		HTMLBody: "<p>Please find your invoice attached.</p>",
+		TextBody: "Please find your invoice attached.",
+		Attachments: []email.Attachment{
+			{Filename: "invoice.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF"), 50)},
+		},
+	}
+	raw, err := message.Bytes("noreply@example.com")
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+
+	// Check the headers
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	var headerTests = []struct {
+		header   string
+		expected string
+	}{
+		{"From", "noreply@example.com"},
+		{"To", "first@example.com, second@example.com"},
+		{"Cc", "cc@example.com"},
+		{"Bcc", ""},
+		{"Reply-To", "support@example.com"},
+		{"MIME-Version", "1.0"},
+	}
+	for _, v := range headerTests {
+		if got := parsed.Header.Get(v.header); got != v.expected {
+			t.Errorf("Expected %s header %q, got %q", v.header, v.expected, got)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != message.Subject {
+		t.Errorf("Expected subject %q, got %q (%v)", message.Subject, subject, err)
+	}
+	if strings.Contains(string(raw), "hidden@example.com") {
+		t.Errorf("Expected Bcc recipients to be left out of the message")
+	}
+
+	// The message should contain the alternative bodies followed by the attachment
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expected multipart/mixed message, got %q (%v)", mediaType, err)
+	}
+	mixed := multipart.NewReader(parsed.Body, params["boundary"])
+
+	bodyPart, err := mixed.NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read body part: %v", err)
+	}
+	mediaType, params, _ = mime.ParseMediaType(bodyPart.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative body, got %q", mediaType)
+	}
+	alternatives := multipart.NewReader(bodyPart, params["boundary"])
+	for _, expected := range []struct{ mediaType, content string }{{"text/plain", message.TextBody}, {"text/html", message.HTMLBody}} {
+		part, err := alternatives.NextRawPart()
+		if err != nil {
+			t.Fatalf("Failed to read %s part: %v", expected.mediaType, err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		content, _ := io.ReadAll(quotedprintable.NewReader(part))
+		if mediaType != expected.mediaType || string(content) != expected.content {
+			t.Errorf("Expected %s part %q, got %s part %q", expected.mediaType, expected.content, mediaType, content)
+		}
+	}
+
+	attachmentPart, err := mixed.NextPart()
+	if err != nil {
+		t.Fatalf("Failed to read attachment part: %v", err)
+	}
+	if attachmentPart.FileName() != "invoice.pdf" || attachmentPart.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected invoice.pdf attachment, got %q (%s)", attachmentPart.FileName(), attachmentPart.Header.Get("Content-Type"))
+	}
+	encoded, _ := io.ReadAll(attachmentPart)
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !bytes.Equal(data, message.Attachments[0].Data) {
+		t.Errorf("Expected attachment data to be kept (%v)", err)
+	}
+}
+
+func TestEmailMessage_BytesSinglePart(t *testing.T) {
+	raw, err := email.NewHTMLMessage("user@example.com", "Hello", "<p>Hello</p>").Bytes("noreply@example.com")
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(parsed.Header.Get("Content-Type")); mediaType != "text/html" {
+		t.Errorf("Expected text/html message, got %q", mediaType)
+	}
+	body, _ := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if string(body) != "<p>Hello</p>" {
+		t.Errorf("Expected body %q, got %q", "<p>Hello</p>", body)
+	}
+}
+
+func TestEmailMessage_Validate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		message email.EmailMessage
+		valid   bool
+	}{
+		{"Valid", email.EmailMessage{To: []string{"user@example.com"}, TextBody: "Hi"}, true},
+		{"Bcc only", email.EmailMessage{Bcc: []string{"user@example.com"}, HTMLBody: "Hi"}, true},
+		{"No recipients", email.EmailMessage{TextBody: "Hi"}, false},
+		{"No body", email.EmailMessage{To: []string{"user@example.com"}}, false},
+		{"Invalid address", email.EmailMessage{To: []string{"user@example.com\r\nBcc: other@example.com"}, TextBody: "Hi"}, false},
+		{"Invalid reply to", email.EmailMessage{To: []string{"user@example.com"}, ReplyTo: "support", TextBody: "Hi"}, false},
+	}
+	for _, v := range tests {
+		err := v.message.Validate()
+		if (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, err)
+		}
+		if err != nil && !errors.Is(err, email.ErrInvalidMessage) {
+			t.Errorf("%s: expected ErrInvalidMessage, got %v", v.name, err)
+		}
+	}
+}
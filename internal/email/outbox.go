@@ -0,0 +1,229 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Header recording every recipient of an email written by the file driver
+const envelopeHeader = "X-Envelope-To"
+
+// Extension of the files written by the file driver
+const outboxExtension = ".eml"
+
+// Returned when an outbox message can't be found
+var ErrMessageNotFound = errors.New("outbox message not found")
+
+// Outbox reads the emails written into a directory by the file driver
+type Outbox struct {
+	Dir string
+}
+
+// Builds an outbox reading the emails in the given directory
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{Dir: dir}
+}
+
+// OutboxMessage is an email captured by the file driver
+type OutboxMessage struct {
+	// Name of the .eml file (without the extension)
+	ID      string
+	Date    time.Time
+	From    string
+	To      string
+	Cc      string
+	ReplyTo string
+	// Every recipient the email was sent to (including Bcc)
+	Recipients string
+	Subject    string
+	HTMLBody   string
+	TextBody   string
+	// File names of the attachments
+	Attachments []string
+}
+
+// List returns the messages in the outbox, newest first.
+// Returns an empty list if the outbox directory doesn't exist yet
+func (o *Outbox) List() ([]OutboxMessage, error) {
+	entries, err := os.ReadDir(o.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []OutboxMessage{}, nil
+		}
+		return nil, fmt.Errorf("failed reading outbox: %w", err)
+	}
+
+	messages := []OutboxMessage{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != outboxExtension {
+			continue
+		}
+		message, err := o.Find(strings.TrimSuffix(entry.Name(), outboxExtension))
+		if err != nil {
+			fmt.Printf("Error reading outbox message %s: %v\n", entry.Name(), err)
+			continue
+		}
+		messages = append(messages, *message)
+	}
+	// File names start with the time they were written
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID > messages[j].ID })
+	return messages, nil
+}
+
+// Find reads a message from the outbox by ID. Returns ErrMessageNotFound if it doesn't exist
+func (o *Outbox) Find(id string) (*OutboxMessage, error) {
+	path, err := o.path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	parsed, err := mail.ReadMessage(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing message %s: %w", id, err)
+	}
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		subject = parsed.Header.Get("Subject")
+	}
+	message := &OutboxMessage{
+		ID:         id,
+		From:       parsed.Header.Get("From"),
+		To:         parsed.Header.Get("To"),
+		Cc:         parsed.Header.Get("Cc"),
+		ReplyTo:    parsed.Header.Get("Reply-To"),
+		Recipients: parsed.Header.Get(envelopeHeader),
+		Subject:    subject,
+	}
+	if date, err := parsed.Header.Date(); err == nil {
+		message.Date = date
+	}
+
+	// Extract the bodies and attachments
+	err = message.readPart(parsed.Header.Get("Content-Type"), parsed.Header.Get("Content-Transfer-Encoding"), "", parsed.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading message %s: %w", id, err)
+	}
+	return message, nil
+}
+
+// Delete removes messages from the outbox by ID
+func (o *Outbox) Delete(ids ...string) error {
+	for _, id := range ids {
+		path, err := o.path(id)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return ErrMessageNotFound
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Builds the path of a message, refusing IDs that point outside the outbox directory
+func (o *Outbox) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", ErrMessageNotFound
+	}
+	return filepath.Join(o.Dir, id+outboxExtension), nil
+}
+
+// Reads a MIME part of the message, recording its bodies and attachments
+func (m *OutboxMessage) readPart(contentType, transferEncoding, disposition string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	// Record attachments by file name
+	if dispositionType, dispositionParams, err := mime.ParseMediaType(disposition); err == nil && dispositionType == "attachment" {
+		m.Attachments = append(m.Attachments, dispositionParams["filename"])
+		return nil
+	}
+
+	// Read each part of multipart content
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			// Quoted-printable parts are decoded by the reader
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = m.readPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Decode single part content
+	if strings.EqualFold(transferEncoding, "quoted-printable") {
+		body = quotedprintable.NewReader(body)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case "text/html":
+		m.HTMLBody = string(content)
+	case "text/plain":
+		m.TextBody = string(content)
+	}
+	return nil
+}
+
+// Grabs the ID of the message (used in admin panel tables)
+func (m OutboxMessage) GetID() string {
+	return m.ID
+}
+
+// Returns the value of a message field as string (used in admin panel tables)
+func (m OutboxMessage) ObtainValue(keyValue string) string {
+	date := ""
+	if !m.Date.IsZero() {
+		date = m.Date.Format(time.RFC3339)
+	}
+	// Map of message fields
+	fieldMap := map[string]string{
+		"ID":          m.ID,
+		"Date":        date,
+		"From":        m.From,
+		"To":          m.To,
+		"Cc":          m.Cc,
+		"ReplyTo":     m.ReplyTo,
+		"Recipients":  m.Recipients,
+		"Subject":     m.Subject,
+		"TextBody":    m.TextBody,
+		"HTMLBody":    m.HTMLBody,
+		"Attachments": strings.Join(m.Attachments, ", "),
+	}
+	// Return value of key
+	return fieldMap[keyValue]
+}
@@ -0,0 +1,137 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLS modes of SMTP connections (set using SMTP_TLS)
+const (
+	// Connects using TLS (SMTPS, usually port 465)
+	SMTPTLSImplicit = "implicit"
+	// Upgrades the connection using STARTTLS. Emails aren't sent if the server doesn't support it
+	SMTPTLSStartTLS = "starttls"
+	// Upgrades the connection using STARTTLS if the server supports it (default unless port 465 is used)
+	SMTPTLSOpportunistic = "opportunistic"
+	// Never encrypts the connection (local SMTP servers only)
+	SMTPTLSNone = "none"
+)
+
+// Default SMTP timeouts (set using SMTP_DIAL_TIMEOUT and SMTP_SEND_TIMEOUT)
+const (
+	DefaultSMTPDialTimeout = 10 * time.Second
+	DefaultSMTPSendTimeout = 60 * time.Second
+)
+
+// Returned when STARTTLS is required but the SMTP server doesn't support it
+var ErrStartTLSUnsupported = errors.New("smtp server doesn't support STARTTLS")
+
+// SMTPConfig holds the settings of the SMTP email service
+type SMTPConfig struct {
+	Host string
+	Port string
+	// Credentials (emails are sent without authenticating if the username is empty)
+	Username string
+	Password string
+	// Sender of emails (the address defaults to the username)
+	FromAddress string
+	FromName    string
+	// How the connection is encrypted (see SMTPTLSImplicit, SMTPTLSStartTLS, SMTPTLSOpportunistic and SMTPTLSNone)
+	TLSMode string
+	// TLS settings used to connect (optional). The server name defaults to the host
+	TLSConfig *tls.Config
+	// Maximum time to connect to the server
+	DialTimeout time.Duration
+	// Maximum time to send an email once connected
+	SendTimeout time.Duration
+	// Signs emails using DKIM (optional)
+	DKIM *DKIMOptions
+}
+
+// SMTPConfigFromEnv reads the SMTP settings from the environment. Returns an error if a setting is invalid
+func SMTPConfigFromEnv() (SMTPConfig, error) {
+	config := SMTPConfig{
+		Host:        os.Getenv("SMTP_HOST"),
+		Port:        os.Getenv("SMTP_PORT"),
+		Username:    os.Getenv("SMTP_USERNAME"),
+		Password:    os.Getenv("SMTP_PASSWORD"),
+		FromAddress: os.Getenv("SMTP_FROM_ADDRESS"),
+		FromName:    os.Getenv("SMTP_FROM_NAME"),
+		TLSMode:     strings.ToLower(strings.TrimSpace(os.Getenv("SMTP_TLS"))),
+	}
+
+	var err error
+	if config.DialTimeout, err = durationFromEnv("SMTP_DIAL_TIMEOUT", DefaultSMTPDialTimeout); err != nil {
+		return config, err
+	}
+	if config.SendTimeout, err = durationFromEnv("SMTP_SEND_TIMEOUT", DefaultSMTPSendTimeout); err != nil {
+		return config, err
+	}
+	if config.DKIM, err = DKIMOptionsFromEnv(); err != nil {
+		return config, err
+	}
+	return config.withDefaults()
+}
+
+// Fills in default settings and validates the config
+func (c SMTPConfig) withDefaults() (SMTPConfig, error) {
+	if c.FromAddress == "" {
+		c.FromAddress = c.Username
+	}
+	if c.TLSMode == "" {
+		c.TLSMode = SMTPTLSOpportunistic
+		// Port 465 is used for SMTP over TLS
+		if c.Port == "465" {
+			c.TLSMode = SMTPTLSImplicit
+		}
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = DefaultSMTPDialTimeout
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = DefaultSMTPSendTimeout
+	}
+
+	switch c.TLSMode {
+	case SMTPTLSImplicit, SMTPTLSStartTLS, SMTPTLSOpportunistic, SMTPTLSNone:
+	default:
+		return c, fmt.Errorf("invalid SMTP_TLS %q (expected %s, %s, %s or %s)", c.TLSMode, SMTPTLSImplicit, SMTPTLSStartTLS, SMTPTLSOpportunistic, SMTPTLSNone)
+	}
+	if c.FromAddress != "" {
+		if _, err := mail.ParseAddress(c.FromAddress); err != nil {
+			return c, fmt.Errorf("invalid from address %q: %w", c.FromAddress, err)
+		}
+	}
+	return c, nil
+}
+
+// From returns the From header of emails (eg. "Go Template" <noreply@example.com>)
+func (c SMTPConfig) From() string {
+	return formatFrom(c.FromName, c.FromAddress)
+}
+
+// Returns the address including the sender's name (if set)
+func formatFrom(name, address string) string {
+	if name == "" {
+		return address
+	}
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+// Returns the duration set in an environment variable (eg. "30s") or the default if not set
+func durationFromEnv(key string, defaultDuration time.Duration) (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return defaultDuration, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (expected a duration such as 30s)", key, value)
+	}
+	return duration, nil
+}
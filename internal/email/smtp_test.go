@@ -0,0 +1,383 @@
+package email_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+func TestSMTPEmail_Send(t *testing.T) {
+	serverTLS, clientTLS := standInCertificates(t)
+
+	var tests = []struct {
+		name string
+		// Stand-in settings
+		offerStartTLS bool
+		implicitTLS   bool
+		// Client settings
+		tlsMode string
+		// Expected outcome
+		wantTLS bool
+		wantErr error
+	}{
+		{"Opportunistic STARTTLS", true, false, email.SMTPTLSOpportunistic, true, nil},
+		{"Opportunistic without STARTTLS", false, false, email.SMTPTLSOpportunistic, false, nil},
+		{"Required STARTTLS", true, false, email.SMTPTLSStartTLS, true, nil},
+		{"Required STARTTLS unsupported", false, false, email.SMTPTLSStartTLS, false, email.ErrStartTLSUnsupported},
+		{"Implicit TLS", false, true, email.SMTPTLSImplicit, true, nil},
+		{"No TLS", true, false, email.SMTPTLSNone, false, nil},
+	}
+	for _, v := range tests {
+		server := startSMTPStandIn(t, serverTLS, v.offerStartTLS, v.implicitTLS)
+		mailer, err := email.NewSMTPEmailWithConfig(email.SMTPConfig{
+			Host:        "127.0.0.1",
+			Port:        server.port,
+			Username:    "mailer",
+			Password:    "secret",
+			FromAddress: "noreply@example.com",
+			FromName:    "Go Template",
+			TLSMode:     v.tlsMode,
+			TLSConfig:   clientTLS,
+			DialTimeout: time.Second,
+			SendTimeout: 5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("%s: failed to build email service: %v", v.name, err)
+		}
+
+		response, err := email.SendWithResponse(mailer, email.NewHTMLMessage("user@example.com", "Hello", "<p>Hello</p>"))
+		if !errors.Is(err, v.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.wantErr, err)
+			continue
+		}
+		if v.wantErr != nil {
+			continue
+		}
+
+		received := server.lastMessage(t)
+		if received.tls != v.wantTLS {
+			t.Errorf("%s: expected TLS to be %v, got %v", v.name, v.wantTLS, received.tls)
+		}
+		if response != "250 2.0.0 Ok: queued" {
+			t.Errorf("%s: expected the server's response, got %q", v.name, response)
+		}
+		if received.auth != "mailer:secret" || received.from != "noreply@example.com" || strings.Join(received.to, ",") != "user@example.com" {
+			t.Errorf("%s: expected authenticated envelope, got %+v", v.name, received)
+		}
+		if from := received.header(t).Get("From"); from != `"Go Template" <noreply@example.com>` {
+			t.Errorf("%s: expected From header with the sender's name, got %q", v.name, from)
+		}
+	}
+}
+
+func TestSMTPEmail_RejectedRecipient(t *testing.T) {
+	server := startSMTPStandIn(t, nil, false, false)
+	mailer, _ := email.NewSMTPEmailWithConfig(email.SMTPConfig{Host: "127.0.0.1", Port: server.port, FromAddress: "noreply@example.com"})
+
+	response, err := email.SendWithResponse(mailer, email.NewHTMLMessage("unknown@example.com", "Hello", "<p>Hello</p>"))
+	var recipientErr *email.RecipientError
+	if !errors.As(err, &recipientErr) || recipientErr.Address != "unknown@example.com" || !recipientErr.Permanent() {
+		t.Fatalf("Expected permanent recipient error, got %v", err)
+	}
+	if response != "550 5.1.1 User unknown" {
+		t.Errorf("Expected the server's reply as response, got %q", response)
+	}
+}
+
+func TestSMTPEmail_Timeouts(t *testing.T) {
+	// Server that accepts connections but never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	mailer, _ := email.NewSMTPEmailWithConfig(email.SMTPConfig{Host: "127.0.0.1", Port: port, FromAddress: "noreply@example.com", SendTimeout: 200 * time.Millisecond})
+	start := time.Now()
+	err = mailer.Send(email.NewHTMLMessage("user@example.com", "Hello", "<p>Hello</p>"))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected send to time out after 200ms, took %s", elapsed)
+	}
+}
+
+func TestSMTPEmail_DKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	signer, err := email.ParseDKIMPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+
+	server := startSMTPStandIn(t, nil, false, false)
+	mailer, _ := email.NewSMTPEmailWithConfig(email.SMTPConfig{
+		Host:        "127.0.0.1",
+		Port:        server.port,
+		FromAddress: "noreply@example.com",
+		DKIM:        &email.DKIMOptions{Domain: "example.com", Selector: "mail", Signer: signer},
+	})
+	message := email.EmailMessage{To: []string{"user@example.com"}, Subject: "Signed", HTMLBody: "<p>Signed</p>", TextBody: "Signed", UnsubscribeURL: "http://localhost/unsubscribe"}
+	if err := mailer.Send(message); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	// Verify the signature using the public key published for the selector
+	publicKey, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(server.lastMessage(t).data), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.example.com" {
+				return nil, errors.New("no record")
+			}
+			return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(publicKey)}, nil
+		},
+	})
+	if err != nil || len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("Expected a valid DKIM signature, got %v (%v)", verifications, err)
+	}
+	if verifications[0].Domain != "example.com" || !containsFold(verifications[0].HeaderKeys, "List-Unsubscribe") {
+		t.Errorf("Expected signature of example.com covering List-Unsubscribe, got %+v", verifications[0])
+	}
+
+	// Invalid keys are rejected
+	if _, err := email.ParseDKIMPrivateKey([]byte("not a key")); err == nil {
+		t.Errorf("Expected invalid key to be rejected")
+	}
+}
+
+func TestSMTPConfigFromEnv(t *testing.T) {
+	var tests = []struct {
+		name        string
+		env         map[string]string
+		wantTLSMode string
+		wantFrom    string
+		valid       bool
+	}{
+		{"Defaults", map[string]string{"SMTP_PORT": "587", "SMTP_USERNAME": "mailer@example.com"}, email.SMTPTLSOpportunistic, "mailer@example.com", true},
+		{"Port 465 uses implicit TLS", map[string]string{"SMTP_PORT": "465", "SMTP_USERNAME": "mailer@example.com"}, email.SMTPTLSImplicit, "mailer@example.com", true},
+		{"From name and address", map[string]string{"SMTP_USERNAME": "apikey", "SMTP_FROM_ADDRESS": "noreply@example.com", "SMTP_FROM_NAME": "Go Template", "SMTP_TLS": "STARTTLS"}, email.SMTPTLSStartTLS, `"Go Template" <noreply@example.com>`, true},
+		{"Invalid TLS mode", map[string]string{"SMTP_TLS": "sometimes"}, "", "", false},
+		{"Invalid timeout", map[string]string{"SMTP_SEND_TIMEOUT": "soon"}, "", "", false},
+		{"Incomplete DKIM settings", map[string]string{"DKIM_DOMAIN": "example.com"}, "", "", false},
+	}
+	for _, v := range tests {
+		for _, key := range []string{"SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD", "SMTP_FROM_ADDRESS", "SMTP_FROM_NAME", "SMTP_TLS", "SMTP_DIAL_TIMEOUT", "SMTP_SEND_TIMEOUT", "DKIM_DOMAIN", "DKIM_SELECTOR", "DKIM_PRIVATE_KEY", "DKIM_PRIVATE_KEY_FILE"} {
+			t.Setenv(key, v.env[key])
+		}
+		config, err := email.SMTPConfigFromEnv()
+		if (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, err)
+			continue
+		}
+		if v.valid && (config.TLSMode != v.wantTLSMode || config.From() != v.wantFrom) {
+			t.Errorf("%s: expected TLS mode %q and from %q, got %q and %q", v.name, v.wantTLSMode, v.wantFrom, config.TLSMode, config.From())
+		}
+	}
+}
+
+// Local SMTP server standing in for a mail server in tests
+type smtpStandIn struct {
+	port          string
+	tlsConfig     *tls.Config
+	offerStartTLS bool
+	mu            sync.Mutex
+	messages      []receivedMessage
+}
+
+// Message received by the stand-in
+type receivedMessage struct {
+	tls  bool
+	auth string
+	from string
+	to   []string
+	data []byte
+}
+
+// Starts a stand-in listening on a random local port. Recipients starting with "unknown" are rejected
+func startSMTPStandIn(t *testing.T, tlsConfig *tls.Config, offerStartTLS, implicitTLS bool) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if implicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpStandIn{tlsConfig: tlsConfig, offerStartTLS: offerStartTLS}
+	_, server.port, _ = net.SplitHostPort(listener.Addr().String())
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, implicitTLS)
+		}
+	}()
+	return server
+}
+
+// Handles an SMTP conversation
+func (s *smtpStandIn) serve(conn net.Conn, isTLS bool) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	message := receivedMessage{tls: isTLS}
+	text.PrintfLine("220 stand-in ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			extensions := []string{"stand-in", "8BITMIME", "AUTH PLAIN"}
+			if s.offerStartTLS && !message.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			for i, extension := range extensions {
+				separator := "-"
+				if i == len(extensions)-1 {
+					separator = " "
+				}
+				text.PrintfLine("250%s%s", separator, extension)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, text, message.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(argument, "PLAIN "))
+			parts := strings.Split(string(credentials), "\x00")
+			if len(parts) == 3 {
+				message.auth = parts[1] + ":" + parts[2]
+			}
+			text.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			// Drop parameters (eg. BODY=8BITMIME)
+			address, _, _ := strings.Cut(strings.TrimPrefix(argument, "FROM:"), " ")
+			message.from = strings.Trim(address, "<>")
+			text.PrintfLine("250 2.1.0 Ok")
+		case "RCPT":
+			recipient := strings.Trim(strings.TrimPrefix(argument, "TO:"), "<>")
+			if strings.HasPrefix(recipient, "unknown") {
+				text.PrintfLine("550 5.1.1 User unknown")
+				continue
+			}
+			message.to = append(message.to, recipient)
+			text.PrintfLine("250 2.1.5 Ok")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			// Keep the CRLF line endings of the message (DotReader converts them to LF)
+			message.data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			text.PrintfLine("250 2.0.0 Ok: queued")
+		case "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			text.PrintfLine("250 2.0.0 Ok")
+		}
+	}
+}
+
+// Returns the last message received by the stand-in
+func (s *smtpStandIn) lastMessage(t *testing.T) receivedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		t.Fatalf("Expected the stand-in to receive a message")
+	}
+	return s.messages[len(s.messages)-1]
+}
+
+// Parses the headers of a received message
+func (m receivedMessage) header(t *testing.T) mail.Header {
+	parsed, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(m.data)))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	return parsed.Header
+}
+
+// Builds a self-signed certificate for 127.0.0.1, returning the stand-in's TLS config and a client config trusting it
+func standInCertificates(t *testing.T) (*tls.Config, *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "stand-in"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(certificate)
+	roots := x509.NewCertPool()
+	roots.AddCert(parsed)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}}},
+		&tls.Config{RootCAs: roots}
+}
+
+// Reports whether the list contains the value (case insensitively)
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
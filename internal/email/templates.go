@@ -0,0 +1,295 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Templates used by the core services
+const (
+	EmailVerificationTemplate = "email-verification"
+	PasswordResetTemplate     = "password-reset"
+)
+
+// Locale used when a template isn't available in the requested locale
+const DefaultLocale = "en"
+
+// Extensions of the HTML and plain-text variants of a template
+const (
+	htmlTemplateExtension = ".html.tmpl"
+	textTemplateExtension = ".txt.tmpl"
+)
+
+// Name of the base layout files and the template they define
+const layoutName = "layout"
+
+// Returned when a template hasn't been registered
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// Core email templates and the base layout
+//
+//go:embed templates
+var templateFiles embed.FS
+
+// Registry of email templates used by the app.
+// Parsed once at startup, modules register their own templates using RegisterTemplates
+var registry = mustLoadCoreTemplates()
+
+// TemplateRegistry holds email templates parsed into a base layout.
+// Each template has an HTML and a plain-text variant, in the default locale and optionally other locales.
+type TemplateRegistry struct {
+	mu            sync.RWMutex
+	defaultLocale string
+	htmlLayout    *htmltemplate.Template
+	textLayout    *texttemplate.Template
+	// Templates by name and locale
+	templates map[string]map[string]*emailTemplate
+}
+
+// An email template parsed into the layout
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// RenderedEmail is the output of an email template
+type RenderedEmail struct {
+	// Name of the template rendered
+	Template string
+	Subject  string
+	HTMLBody string
+	TextBody string
+}
+
+// Builds an email message for the rendered email sent to the recipients
+func (r RenderedEmail) Message(recipients ...string) EmailMessage {
+	return EmailMessage{
+		To:       recipients,
+		Subject:  r.Subject,
+		HTMLBody: r.HTMLBody,
+		TextBody: r.TextBody,
+	}
+}
+
+// Builds a template registry using the layout.html.tmpl and layout.txt.tmpl files in the layouts file system.
+// Both files define the "layout" template which renders the "content" template of each email
+func NewTemplateRegistry(layouts fs.FS, defaultLocale string) (*TemplateRegistry, error) {
+	htmlLayout, err := htmltemplate.ParseFS(layouts, layoutName+htmlTemplateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing HTML email layout: %w", err)
+	}
+	textLayout, err := texttemplate.ParseFS(layouts, layoutName+textTemplateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing text email layout: %w", err)
+	}
+	if htmlLayout.Lookup(layoutName) == nil || textLayout.Lookup(layoutName) == nil {
+		return nil, fmt.Errorf("email layouts must define the %q template", layoutName)
+	}
+
+	return &TemplateRegistry{
+		defaultLocale: normalizeLocale(defaultLocale),
+		htmlLayout:    htmlLayout,
+		textLayout:    textLayout,
+		templates:     map[string]map[string]*emailTemplate{},
+	}, nil
+}
+
+// Register parses the email templates in a file system into the layout.
+// Templates in the root directory are in the default locale, templates in a sub directory
+// are in the locale the directory is named after (eg. es/password-reset.html.tmpl).
+//
+// Each template is a pair of files: <name>.html.tmpl and <name>.txt.tmpl, both defining the "content"
+// template. The text variant also defines the "subject" template. Layout files are skipped.
+// Templates replace registered templates with the same name and locale (eg. to customise the core templates)
+func (t *TemplateRegistry) Register(templates fs.FS) error {
+	// Find the directory of each template by name and locale
+	dirs := map[string]map[string]string{}
+	err := fs.WalkDir(templates, ".", func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// Only the root directory and locale directories hold templates
+			if strings.Count(filePath, "/") > 0 {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		name, ok := templateName(path.Base(filePath))
+		if !ok || (name == layoutName && path.Dir(filePath) == ".") {
+			return nil
+		}
+		dir := path.Dir(filePath)
+		locale := t.defaultLocale
+		if dir != "." {
+			locale = normalizeLocale(dir)
+		}
+		if dirs[name] == nil {
+			dirs[name] = map[string]string{}
+		}
+		dirs[name][locale] = dir
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed reading email templates: %w", err)
+	}
+
+	// Parse the templates before registering any of them
+	parsed := map[string]map[string]*emailTemplate{}
+	for name, locales := range dirs {
+		parsed[name] = map[string]*emailTemplate{}
+		for locale, dir := range locales {
+			template, err := t.parse(templates, dir, name)
+			if err != nil {
+				return fmt.Errorf("failed parsing email template %s (%s): %w", name, locale, err)
+			}
+			parsed[name][locale] = template
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, locales := range parsed {
+		if t.templates[name] == nil {
+			t.templates[name] = map[string]*emailTemplate{}
+		}
+		for locale, template := range locales {
+			t.templates[name][locale] = template
+		}
+	}
+	return nil
+}
+
+// Render executes a template in the locale, falling back to the base language (eg. "es" for "es-MX")
+// and then the default locale. Returns ErrTemplateNotFound if the template hasn't been registered
+func (t *TemplateRegistry) Render(name, locale string, data interface{}) (*RenderedEmail, error) {
+	template, err := t.find(name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := template.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed rendering subject of email template %s: %w", name, err)
+	}
+	if err := template.html.ExecuteTemplate(&html, layoutName, data); err != nil {
+		return nil, fmt.Errorf("failed rendering email template %s: %w", name, err)
+	}
+	if err := template.text.ExecuteTemplate(&text, layoutName, data); err != nil {
+		return nil, fmt.Errorf("failed rendering email template %s: %w", name, err)
+	}
+
+	return &RenderedEmail{
+		Template: name,
+		// Subjects are a single line
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		HTMLBody: html.String(),
+		TextBody: strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
+
+// Finds the template to use for the locale
+func (t *TemplateRegistry) find(name, locale string) (*emailTemplate, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	locales, ok := t.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	locale = normalizeLocale(locale)
+	language, _, _ := strings.Cut(locale, "-")
+	for _, candidate := range []string{locale, language, t.defaultLocale} {
+		if template, ok := locales[candidate]; ok {
+			return template, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, name, locale)
+}
+
+// Parses the HTML and text variant of a template into clones of the layout
+func (t *TemplateRegistry) parse(templates fs.FS, dir, name string) (*emailTemplate, error) {
+	htmlFile := path.Join(dir, name+htmlTemplateExtension)
+	textFile := path.Join(dir, name+textTemplateExtension)
+	for _, file := range []string{htmlFile, textFile} {
+		if _, err := fs.Stat(templates, file); err != nil {
+			return nil, fmt.Errorf("missing %s: %w", file, err)
+		}
+	}
+
+	// Clone the layouts so each template defines its own content
+	htmlLayout, err := t.htmlLayout.Clone()
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmlLayout.ParseFS(templates, htmlFile)
+	if err != nil {
+		return nil, err
+	}
+	textLayout, err := t.textLayout.Clone()
+	if err != nil {
+		return nil, err
+	}
+	text, err := textLayout.ParseFS(templates, textFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the templates used by the layout and subject are defined
+	if html.Lookup("content") == nil {
+		return nil, fmt.Errorf("%s must define the \"content\" template", htmlFile)
+	}
+	if text.Lookup("content") == nil || text.Lookup("subject") == nil {
+		return nil, fmt.Errorf("%s must define the \"content\" and \"subject\" templates", textFile)
+	}
+	return &emailTemplate{html: html, text: text}, nil
+}
+
+// Returns the name of the template a file belongs to
+func templateName(fileName string) (string, bool) {
+	for _, extension := range []string{htmlTemplateExtension, textTemplateExtension} {
+		if strings.HasSuffix(fileName, extension) {
+			return strings.TrimSuffix(fileName, extension), true
+		}
+	}
+	return "", false
+}
+
+// Normalizes a locale so "pt_BR" and "pt-br" match a "pt-BR" directory
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// Parses the core templates embedded in the app
+func mustLoadCoreTemplates() *TemplateRegistry {
+	files, err := fs.Sub(templateFiles, "templates")
+	if err != nil {
+		panic(err)
+	}
+	registry, err := NewTemplateRegistry(files, DefaultLocale)
+	if err != nil {
+		panic(err)
+	}
+	if err := registry.Register(files); err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// RegisterTemplates adds email templates to the registry used by the app (see TemplateRegistry.Register).
+// Used by modules to register their own templates
+func RegisterTemplates(templates fs.FS) error {
+	return registry.Register(templates)
+}
+
+// RenderTemplate renders a registered email template in the locale (see TemplateRegistry.Render)
+func RenderTemplate(name, locale string, data interface{}) (*RenderedEmail, error) {
+	return registry.Render(name, locale, data)
+}
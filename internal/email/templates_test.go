@@ -0,0 +1,124 @@
+package email_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+)
+
+// Layouts and templates used to test the registry
+var testTemplates = fstest.MapFS{
+	"layout.html.tmpl":        {Data: []byte(`{{define "layout"}}<html lang="{{block "lang" .}}en{{end}}"><body>{{template "content" .}}</body></html>{{end}}`)},
+	"layout.txt.tmpl":         {Data: []byte(`{{define "layout"}}{{template "content" .}}` + "\n--\nFooter{{end}}")},
+	"welcome.html.tmpl":       {Data: []byte(`{{define "content"}}<p>Welcome {{.Name}}</p>{{end}}`)},
+	"welcome.txt.tmpl":        {Data: []byte(`{{define "subject"}}Welcome {{.Name}}{{end}}{{define "content"}}Welcome {{.Name}}{{end}}`)},
+	"es/welcome.html.tmpl":    {Data: []byte(`{{define "lang"}}es{{end}}{{define "content"}}<p>Bienvenido {{.Name}}</p>{{end}}`)},
+	"es/welcome.txt.tmpl":     {Data: []byte(`{{define "subject"}}Bienvenido {{.Name}}{{end}}{{define "content"}}Bienvenido {{.Name}}{{end}}`)},
+	"pt-BR/welcome.html.tmpl": {Data: []byte(`{{define "content"}}<p>Bem-vindo {{.Name}}</p>{{end}}`)},
+	"pt-BR/welcome.txt.tmpl":  {Data: []byte(`{{define "subject"}}Bem-vindo {{.Name}}{{end}}{{define "content"}}Bem-vindo {{.Name}}{{end}}`)},
+}
+
+func TestTemplateRegistry_Render(t *testing.T) {
+	registry, err := email.NewTemplateRegistry(testTemplates, email.DefaultLocale)
+	if err != nil {
+		t.Fatalf("Failed to build registry: %v", err)
+	}
+	if err := registry.Register(testTemplates); err != nil {
+		t.Fatalf("Failed to register templates: %v", err)
+	}
+	data := struct{ Name string }{Name: "<Ana>"}
+
+	var tests = []struct {
+		name     string
+		locale   string
+		expected email.RenderedEmail
+	}{
+		{"Default locale", "", email.RenderedEmail{Template: "welcome", Subject: "Welcome <Ana>", HTMLBody: `<html lang="en"><body><p>Welcome &lt;Ana&gt;</p></body></html>`, TextBody: "Welcome <Ana>\n--\nFooter\n"}},
+		{"Locale", "es", email.RenderedEmail{Template: "welcome", Subject: "Bienvenido <Ana>", HTMLBody: `<html lang="es"><body><p>Bienvenido &lt;Ana&gt;</p></body></html>`, TextBody: "Bienvenido <Ana>\n--\nFooter\n"}},
+		{"Regional locale falls back to language", "es-MX", email.RenderedEmail{Template: "welcome", Subject: "Bienvenido <Ana>", HTMLBody: `<html lang="es"><body><p>Bienvenido &lt;Ana&gt;</p></body></html>`, TextBody: "Bienvenido <Ana>\n--\nFooter\n"}},
+		{"Regional locale", "pt_br", email.RenderedEmail{Template: "welcome", Subject: "Bem-vindo <Ana>", HTMLBody: `<html lang="en"><body><p>Bem-vindo &lt;Ana&gt;</p></body></html>`, TextBody: "Bem-vindo <Ana>\n--\nFooter\n"}},
+		{"Unknown locale falls back to default", "fr", email.RenderedEmail{Template: "welcome", Subject: "Welcome <Ana>", HTMLBody: `<html lang="en"><body><p>Welcome &lt;Ana&gt;</p></body></html>`, TextBody: "Welcome <Ana>\n--\nFooter\n"}},
+	}
+	for _, v := range tests {
+		rendered, err := registry.Render("welcome", v.locale, data)
+		if err != nil {
+			t.Errorf("%s: failed to render: %v", v.name, err)
+			continue
+		}
+		if *rendered != v.expected {
+			t.Errorf("%s: expected %+v, got %+v", v.name, v.expected, *rendered)
+		}
+	}
+
+	if _, err := registry.Render("missing", "", data); !errors.Is(err, email.ErrTemplateNotFound) {
+		t.Errorf("Expected ErrTemplateNotFound for a missing template, got %v", err)
+	}
+}
+
+func TestTemplateRegistry_Register(t *testing.T) {
+	var tests = []struct {
+		name      string
+		templates fstest.MapFS
+		valid     bool
+	}{
+		{"Override template", fstest.MapFS{
+			"welcome.html.tmpl": {Data: []byte(`{{define "content"}}<p>Hi {{.Name}}</p>{{end}}`)},
+			"welcome.txt.tmpl":  {Data: []byte(`{{define "subject"}}Hi{{end}}{{define "content"}}Hi {{.Name}}{{end}}`)},
+		}, true},
+		{"Missing text variant", fstest.MapFS{
+			"invoice.html.tmpl": {Data: []byte(`{{define "content"}}Invoice{{end}}`)},
+		}, false},
+		{"Missing subject", fstest.MapFS{
+			"invoice.html.tmpl": {Data: []byte(`{{define "content"}}Invoice{{end}}`)},
+			"invoice.txt.tmpl":  {Data: []byte(`{{define "content"}}Invoice{{end}}`)},
+		}, false},
+		{"Invalid template", fstest.MapFS{
+			"invoice.html.tmpl": {Data: []byte(`{{define "content"}}{{.Total}{{end}}`)},
+			"invoice.txt.tmpl":  {Data: []byte(`{{define "subject"}}Invoice{{end}}{{define "content"}}Invoice{{end}}`)},
+		}, false},
+	}
+	for _, v := range tests {
+		registry, err := email.NewTemplateRegistry(testTemplates, email.DefaultLocale)
+		if err != nil {
+			t.Fatalf("Failed to build registry: %v", err)
+		}
+		if err := registry.Register(testTemplates); err != nil {
+			t.Fatalf("Failed to register templates: %v", err)
+		}
+
+		err = registry.Register(v.templates)
+		if (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, err)
+		}
+		// Invalid templates don't replace registered templates
+		rendered, err := registry.Render("welcome", "", struct{ Name string }{"Ana"})
+		if err != nil {
+			t.Fatalf("%s: failed to render: %v", v.name, err)
+		}
+		if expected := map[bool]string{true: "Hi", false: "Welcome Ana"}[v.valid]; rendered.Subject != expected {
+			t.Errorf("%s: expected subject %q, got %q", v.name, expected, rendered.Subject)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	// The core templates are available in English and Spanish
+	for _, name := range []string{email.EmailVerificationTemplate, email.PasswordResetTemplate} {
+		for _, locale := range []string{"en", "es"} {
+			rendered, err := email.RenderTemplate(name, locale, map[string]string{"Name": "Ana", "TokenUrl": "http://localhost/verify", "ResetUrl": "http://localhost/reset", "ExpiresIn": "60"})
+			if err != nil {
+				t.Errorf("%s (%s): failed to render: %v", name, locale, err)
+				continue
+			}
+			if rendered.Subject == "" || !strings.Contains(rendered.HTMLBody, "Ana") || !strings.Contains(rendered.TextBody, "Ana") {
+				t.Errorf("%s (%s): expected subject and bodies, got %+v", name, locale, rendered)
+			}
+			if !strings.Contains(rendered.HTMLBody, `lang="`+locale+`"`) {
+				t.Errorf("%s (%s): expected HTML body in %s", name, locale, locale)
+			}
+		}
+	}
+}
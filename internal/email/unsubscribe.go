@@ -0,0 +1,83 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Path of the endpoint handling unsubscribe links
+const UnsubscribePath = "/api/email/unsubscribe"
+
+// Secret signing unsubscribe links (EMAIL_UNSUBSCRIBE_SECRET). Links aren't signed or accepted while it's empty
+var unsubscribeSecret = struct {
+	mu  sync.RWMutex
+	key []byte
+}{}
+
+// LoadUnsubscribeSecretFromEnv sets the secret signing unsubscribe links from EMAIL_UNSUBSCRIBE_SECRET.
+// Called once the environment variables are loaded, fails if the secret isn't set
+func LoadUnsubscribeSecretFromEnv() error {
+	secret := os.Getenv("EMAIL_UNSUBSCRIBE_SECRET")
+	if strings.TrimSpace(secret) == "" {
+		return errors.New("EMAIL_UNSUBSCRIBE_SECRET must be set to sign unsubscribe links")
+	}
+	SetUnsubscribeSecret(secret)
+	return nil
+}
+
+// SetUnsubscribeSecret sets the secret signing unsubscribe links
+func SetUnsubscribeSecret(secret string) {
+	unsubscribeSecret.mu.Lock()
+	defer unsubscribeSecret.mu.Unlock()
+	unsubscribeSecret.key = []byte(secret)
+}
+
+// UnsubscribeToken signs an address and category, so unsubscribe links can't be forged for other addresses.
+// Returns an empty token if no secret is set
+func UnsubscribeToken(address, category string) string {
+	unsubscribeSecret.mu.RLock()
+	defer unsubscribeSecret.mu.RUnlock()
+	if len(unsubscribeSecret.key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, unsubscribeSecret.key)
+	mac.Write([]byte(normalizeAddress(address) + "\n" + category))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyUnsubscribeToken checks a token was signed for the address and category.
+// Tokens are always rejected if no secret is set
+func VerifyUnsubscribeToken(address, category, token string) bool {
+	expected := UnsubscribeToken(address, category)
+	if expected == "" {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// UnsubscribeURL builds the signed link used to unsubscribe an address from a category of email.
+// Include it in the body of non-transactional emails, it is also sent in the List-Unsubscribe header.
+// Returns an empty link if no secret is set
+func UnsubscribeURL(address, category string) string {
+	token := UnsubscribeToken(address, category)
+	if token == "" {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("email", normalizeAddress(address))
+	query.Set("category", category)
+	query.Set("token", token)
+	// SERVER_PORT is prefixed with :
+	return "http://" + os.Getenv("SERVER_BASE_URL") + os.Getenv("SERVER_PORT") + UnsubscribePath + "?" + query.Encode()
+}
+
+// Addresses are compared case insensitively
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
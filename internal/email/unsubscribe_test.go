@@ -0,0 +1,133 @@
+package email_test
+
+import (
+	"bytes"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+)
+
+func TestVerifyUnsubscribeToken(t *testing.T) {
+	email.SetUnsubscribeSecret("test-unsubscribe-secret")
+	token := email.UnsubscribeToken("User@Example.com", email.CategoryMarketing)
+
+	var tests = []struct {
+		name     string
+		address  string
+		category string
+		token    string
+		valid    bool
+	}{
+		{"Valid", "User@Example.com", email.CategoryMarketing, token, true},
+		{"Addresses are case insensitive", "user@example.com", email.CategoryMarketing, token, true},
+		{"Other address", "other@example.com", email.CategoryMarketing, token, false},
+		{"Other category", "user@example.com", email.CategoryNotifications, token, false},
+		{"Forged token", "user@example.com", email.CategoryMarketing, "forged", false},
+		{"Missing token", "user@example.com", email.CategoryMarketing, "", false},
+	}
+	for _, v := range tests {
+		if valid := email.VerifyUnsubscribeToken(v.address, v.category, v.token); valid != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, valid)
+		}
+	}
+
+	// Links carry a token that verifies
+	link, err := url.Parse(email.UnsubscribeURL("User@Example.com", email.CategoryMarketing))
+	if err != nil {
+		t.Fatalf("Failed to parse unsubscribe link: %v", err)
+	}
+	query := link.Query()
+	if link.Path != email.UnsubscribePath || !email.VerifyUnsubscribeToken(query.Get("email"), query.Get("category"), query.Get("token")) {
+		t.Errorf("Expected a valid unsubscribe link, got %s", link)
+	}
+}
+
+func TestLoadUnsubscribeSecretFromEnv(t *testing.T) {
+	email.SetUnsubscribeSecret("test-unsubscribe-secret")
+	token := email.UnsubscribeToken("user@example.com", email.CategoryMarketing)
+
+	var tests = []struct {
+		name    string
+		secret  string
+		wantErr bool
+		signed  bool
+	}{
+		{"Missing secret", "", true, false},
+		{"Blank secret", "  ", true, false},
+		{"Secret set", "test-unsubscribe-secret", false, true},
+	}
+	for _, v := range tests {
+		// Start without a secret, so links are only signed once loaded
+		email.SetUnsubscribeSecret("")
+		t.Setenv("EMAIL_UNSUBSCRIBE_SECRET", v.secret)
+
+		err := email.LoadUnsubscribeSecretFromEnv()
+		if (err != nil) != v.wantErr {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.wantErr, err)
+		}
+		// Links aren't signed or accepted without a secret
+		if signed := email.UnsubscribeURL("user@example.com", email.CategoryMarketing) != ""; signed != v.signed {
+			t.Errorf("%s: expected link to be signed %v, got %v", v.name, v.signed, signed)
+		}
+		if valid := email.VerifyUnsubscribeToken("user@example.com", email.CategoryMarketing, token); valid != v.signed {
+			t.Errorf("%s: expected token to be valid %v, got %v", v.name, v.signed, valid)
+		}
+	}
+}
+
+func TestEmailMessage_Unsubscribe(t *testing.T) {
+	message := email.EmailMessage{
+		To:             []string{"first@example.com", "Opted-Out@example.com"},
+		Bcc:            []string{"opted-out@example.com"},
+		Subject:        "News",
+		TextBody:       "News",
+		Category:       email.CategoryMarketing,
+		UnsubscribeURL: "http://localhost/api/email/unsubscribe?token=abc",
+	}
+
+	// Non-transactional emails carry one-click unsubscribe headers
+	raw, err := message.Bytes("noreply@example.com")
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe"); got != "<"+message.UnsubscribeURL+">" {
+		t.Errorf("Expected List-Unsubscribe header, got %q", got)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe-Post"); got != "List-Unsubscribe=One-Click" {
+		t.Errorf("Expected List-Unsubscribe-Post header, got %q", got)
+	}
+
+	// Suppressed recipients are removed from every field
+	if got := message.WithoutRecipients("opted-out@example.com").Recipients(); !reflect.DeepEqual(got, []string{"first@example.com"}) {
+		t.Errorf("Expected only first@example.com to remain, got %v", got)
+	}
+}
+
+func TestIsTransactional(t *testing.T) {
+	email.RegisterCategory(email.Category{Name: "invoices", Description: "Invoices", Transactional: true})
+
+	var tests = []struct {
+		category      string
+		transactional bool
+	}{
+		{email.CategoryAccount, true},
+		{email.CategoryMarketing, false},
+		{"invoices", true},
+		// Emails without a category are still checked against the suppression list
+		{"", false},
+		// Unknown categories can be opted out of
+		{"unknown", false},
+	}
+	for _, v := range tests {
+		if got := email.IsTransactional(v.category); got != v.transactional {
+			t.Errorf("%q: expected transactional to be %v, got %v", v.category, v.transactional, got)
+		}
+	}
+}
@@ -70,9 +70,18 @@ func BuildMetaData(dbClient *gorm.DB, dbSchema interface{}, limit int, offset in
 	if err != nil {
 		return nil, err
 	}
+	// Build metadata object
+	metaData := BuildPageMetaData(*totalCount, limit, offset)
+
+	// Return meta data
+	return &metaData, nil
+}
+
+// Build pagination meta data from the total number of records, the page size and the offset
+func BuildPageMetaData(totalCount int64, limit int, offset int) models.SchemaMetaData {
 	// Find the total number of pages from total count and limit
-	totalPages := int(*totalCount) / limit
-	if int(*totalCount)%limit != 0 {
+	totalPages := int(totalCount) / limit
+	if int(totalCount)%limit != 0 {
 		totalPages += 1
 	}
 	// Calculate current page
@@ -90,10 +99,7 @@ func BuildMetaData(dbClient *gorm.DB, dbSchema interface{}, limit int, offset in
 		prevPage = &prev
 	}
 	// Build metadata object
-	metaData := models.NewSchemaMetaData(*totalCount, limit, totalPages, currentPage, nextPage, prevPage)
-
-	// Return meta data
-	return &metaData, nil
+	return models.NewSchemaMetaData(totalCount, limit, totalPages, currentPage, nextPage, prevPage)
 }
 
 // Count using conditions
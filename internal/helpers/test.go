@@ -10,9 +10,11 @@ import (
 	"net/http"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/glebarez/sqlite"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -25,6 +27,11 @@ func SetupTestDatabase() *gorm.DB {
 	if err != nil {
 		fmt.Printf("failed to open database: %v", err)
 	}
+	// Each connection opens its own in-memory database, so only use one
+	// (otherwise goroutines such as queue workers may find an empty database)
+	if sqlDB, err := dbClient.DB(); err == nil {
+		sqlDB.SetMaxOpenConns(1)
+	}
 
 	// Migrate the database schema
 	for _, table := range db.Models {
@@ -171,14 +178,35 @@ func HashPassAndGenerateUserInDb(user *db.User, client *gorm.DB, t *testing.T) (
 }
 
 // Mocking
-// Mock Email
+// Mock Email (records the messages sent)
 type EmailMock struct {
+	mu   sync.Mutex
+	sent []email.EmailMessage
 }
 
-func (e *EmailMock) SendEmail(recipient, subject, body string) error {
+func (e *EmailMock) Send(message email.EmailMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent = append(e.sent, message)
 	return nil
 }
 
+// Returns the messages sent to a recipient
+func (e *EmailMock) SentTo(recipient string) []email.EmailMessage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	messages := []email.EmailMessage{}
+	for _, message := range e.sent {
+		for _, to := range message.To {
+			if to == recipient {
+				messages = append(messages, message)
+				break
+			}
+		}
+	}
+	return messages
+}
+
 // A helper function to build an API request that starts with url of '/api/'
 func BuildApiRequest(method string, urlSuffix string, body io.Reader, authHeaderRequired bool, token string) (request *http.Request, err error) {
 	req, err := http.NewRequest(method, fmt.Sprintf("/api/%v", urlSuffix), body)
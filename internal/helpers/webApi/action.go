@@ -12,6 +12,7 @@ type ActionService interface {
 	// Record action in database
 	RecordAction(r *http.Request, schemaName string, schemaID uint, recordAction *models.RecordedAction, changeObjects helpers.ChangeLogInput) error
 	RecordBulkDelete(r *http.Request, schemaName, pluralSchemaName string, schemaIDs []int, recordAction *models.RecordedAction) error
+	RecordBulkAction(r *http.Request, schemaName string, schemaIDs []int, recordAction *models.RecordedAction, description string) error
 	// CRUD operations
 	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Action], error)
 	FindById(int) (*db.Action, error)
@@ -1,10 +1,8 @@
 package webapi
 
 import (
-	"bytes"
-	"html/template"
-
 	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
 	"gorm.io/gorm"
 )
 
@@ -55,19 +53,13 @@ func NewAdminController[Serv any, AS ActionService](controllerFunc func(Serv, AS
 	}
 }
 
-// LoadTemplate parses an HTML template, executes it with the provided data, and returns the result as a string.
-func LoadTemplate(templateFilePath string, data interface{}) (string, error) {
-	// Parse the template file
-	t, err := template.ParseFiles(templateFilePath)
-	if err != nil {
-		return "", err
-	}
-
-	// Build the template with the injected data
-	var tpl bytes.Buffer
-	if err := t.Execute(&tpl, data); err != nil {
-		return "", err
+// Helper function that takes a job handler creation function and returns a function that takes a service interface and returns the module's job handlers
+func NewJobHandlers[Serv any](handlerFunc func(Serv) []queue.JobHandler) func(interface{}) []queue.JobHandler {
+	return func(serviceInterface interface{}) []queue.JobHandler {
+		service, ok := serviceInterface.(Serv)
+		if !ok {
+			panic("Incorrect service type")
+		}
+		return handlerFunc(service)
 	}
-
-	return tpl.String(), nil
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+type CreateApiKey struct {
+	// Owner of the key (the authenticated user)
+	UserID uint   `json:"-" valid:""`
+	Name   string `json:"name" valid:"required,maxstringlength(100)"`
+	// Permissions of the owner the key is restricted to (eg. {"object": "/api/posts", "action": "read"})
+	Scopes []db.ApiKeyScope `json:"scopes" valid:"required"`
+	// Optional expiry (eg. "2030-01-01T00:00:00Z"). Keys without one are valid until deleted
+	ExpiresAt *time.Time `json:"expires_at,omitempty" valid:""`
+}
+
+type UpdateApiKey struct {
+	Name      string     `json:"name,omitempty" valid:"required,maxstringlength(100)"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" valid:""`
+}
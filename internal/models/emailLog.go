@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type CreateEmailLog struct {
+	JobID      uint   `json:"job_id,omitempty" valid:""`
+	Recipients string `json:"recipients,omitempty" valid:"required"`
+	Subject    string `json:"subject,omitempty" valid:""`
+	Template   string `json:"template,omitempty" valid:""`
+	Category   string `json:"category,omitempty" valid:""`
+	Status     string `json:"status,omitempty" valid:"in(sent|failed|suppressed),required"`
+	Response   string `json:"response,omitempty" valid:""`
+	// JSON encoded email message (used to resend the email)
+	Message string `json:"-" valid:""`
+}
+
+type UpdateEmailLog struct {
+	Status   string     `json:"status,omitempty" valid:"in(sent|failed|suppressed)"`
+	Attempts int        `json:"attempts,omitempty" valid:""`
+	Response string     `json:"response,omitempty" valid:""`
+	SentAt   *time.Time `json:"sent_at,omitempty" valid:""`
+}
@@ -0,0 +1,24 @@
+package models
+
+type CreateEmailSuppression struct {
+	Email  string `json:"email,omitempty" valid:"email,required"`
+	Reason string `json:"reason,omitempty" valid:"in(hard-bounce|complaint|unsubscribed|manual),required"`
+	Detail string `json:"detail,omitempty" valid:""`
+}
+
+type UpdateEmailSuppression struct {
+	Reason string `json:"reason,omitempty" valid:"in(hard-bounce|complaint|unsubscribed|manual)"`
+	Detail string `json:"detail,omitempty" valid:""`
+}
+
+// Whether a user receives the emails of a category
+type EmailPreference struct {
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Subscribed  bool   `json:"subscribed"`
+}
+
+// Email categories a user subscribes to (category => subscribed)
+type UpdateEmailPreferences struct {
+	Categories map[string]bool `json:"categories" valid:"-"`
+}
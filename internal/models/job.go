@@ -0,0 +1,9 @@
+package models
+
+// Filters used to narrow down the list of jobs (empty fields are ignored).
+// Unlike search conditions, filters are combined using AND
+type JobFilter struct {
+	Status  string `json:"status,omitempty"`
+	JobType string `json:"job_type,omitempty"`
+	Queue   string `json:"queue,omitempty"`
+}
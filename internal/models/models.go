@@ -35,6 +35,13 @@ type BulkDeleteResponse struct {
 	Errors         []error `json:"errors"`
 }
 
+// Response for bulk actions that update records (eg. bulk retry)
+type BulkUpdateResponse struct {
+	Success        bool    `json:"success"`
+	UpdatedRecords int64   `json:"updated_records"`
+	Errors         []error `json:"errors"`
+}
+
 // Schema meta data (attached to find all requests)
 type SchemaMetaData interface {
 	CalculateCurrentlyShowingRecords() int
@@ -9,7 +9,54 @@ import (
 )
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	// Short-lived access token (sent as "Authorization: Bearer <token>")
+	Token string `json:"token,omitempty"`
+	// Exchanged for a new token pair at /api/users/refresh. Can only be used once
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Seconds until the access token expires
+	ExpiresIn int `json:"expires_in,omitempty"`
+	// Set instead of the tokens for users with two-factor authentication. The challenge token
+	// is exchanged for the tokens at /api/users/login/2fa along with a code
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
+
+// Used to refresh the token pair or to log out
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
+}
+
+// Second login step of users with two-factor authentication
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token" valid:"required"`
+	// Code from the authenticator app or a recovery code
+	Code string `json:"code" valid:"required"`
+}
+
+// Used to confirm a two-factor enrolment
+type TwoFactorCode struct {
+	Code string `json:"code" valid:"required"`
+}
+
+// Secret of a new two-factor enrolment, to be added to an authenticator app
+type TwoFactorEnrolment struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI of the account and its QR code (PNG data URI)
+	URI    string `json:"otpauth_uri"`
+	QRCode string `json:"qr_code"`
+}
+
+// Single use codes returned once two-factor authentication is enabled. They're only shown once
+type TwoFactorRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Two-factor authentication status of a user
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Whether the user's role requires two-factor authentication
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
 }
 
 type ChangePassword struct {
@@ -25,6 +72,7 @@ type CreateUser struct {
 	Password string `json:"password" valid:"length(6|30),required"`
 	Name     string `json:"name" valid:"length(6|80),required"`
 	Email    string `json:"email" valid:"email,required"`
+	Language string `json:"language,omitempty" valid:"length(2|10)"`
 	Verified bool   `json:"verified,omitempty"`
 	Role     string `json:"role,omitempty" valid:""`
 }
@@ -35,6 +83,7 @@ type UpdateUser struct {
 	Password string `json:"password,omitempty" valid:"length(6|30)"`
 	Name     string `json:"name,omitempty" valid:"length(6|80)"`
 	Email    string `json:"email,omitempty" valid:"email"`
+	Language string `json:"language,omitempty" valid:"length(2|10)"`
 	Verified bool   `json:"verified,omitempty"`
 	Role     string `json:"role,omitempty" valid:""`
 }
@@ -43,6 +92,12 @@ type ResetPasswordAndEmailVerification struct {
 	Email string `json:"email" valid:"email,required"`
 }
 
+// Sets a new password using the token from a password reset email
+type CompletePasswordReset struct {
+	Token       string `json:"token" valid:"required"`
+	NewPassword string `json:"new_password" valid:"length(6|30),required"`
+}
+
 type PaginatedUsers struct {
 	Data *[]db.User     `json:"data"`
 	Meta SchemaMetaData `json:"meta"`
@@ -68,6 +123,7 @@ type UserWithRole struct {
 	Email     string         `json:"email,omitempty"`
 	Password  string         `json:"-"`
 	Role      string         `json:"role,omitempty"`
+	Language  string         `json:"language,omitempty"`
 	// Verification
 	Verified               *bool     `json:"verified,omitempty" gorm:"default:false"`
 	VerificationCode       string    `json:"verification_code,omitempty" gorm:"default:null"`
@@ -82,6 +138,7 @@ func (schemaObject UserWithRole) ObtainValue(keyValue string) string {
 		"Name":                   schemaObject.Name,
 		"Username":               schemaObject.Username,
 		"Email":                  schemaObject.Email,
+		"Language":               schemaObject.Language,
 		"Verified":               fmt.Sprint(db.PointerToStringWithType(schemaObject.Verified, "bool")),
 		"VerificationCode":       schemaObject.VerificationCode,
 		"VerificationCodeExpiry": schemaObject.VerificationCodeExpiry.Format(time.RFC3339),
@@ -20,6 +20,10 @@ var ModulesToSetup = []EntityConfig{
 		NewService:         webapi.NewService(moduleservices.NewPostService),
 		NewController:      webapi.NewController(modulecontrollers.NewPostController),
 		NewAdminController: webapi.NewAdminController(adminpanel.NewAdminPostController),
+		// Optional: register background job handlers for the module
+		// eg. NewJobHandlers: webapi.NewJobHandlers(moduleservices.NewPostJobHandlers),
+		// Optional: register email templates for the module
+		// eg. EmailTemplates: moduleservices.PostEmailTemplates,
 	},
 	// ADD ADDITIONAL BASIC MODULES HERE
 }
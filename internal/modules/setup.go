@@ -1,8 +1,13 @@
 package modules
 
 import (
+	"fmt"
+	"io/fs"
+
+	"github.com/dmawardi/Go-Template/internal/email"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
 	"gorm.io/gorm"
 )
 
@@ -18,6 +23,20 @@ func SetupModules(modulesToSetup []EntityConfig, client *gorm.DB, actionService
 		service := module.NewService(repo)
 		controller := module.NewController(service)
 
+		// Register the module's background job handlers (if any)
+		if module.NewJobHandlers != nil {
+			for _, handler := range module.NewJobHandlers(service) {
+				queue.RegisterHandler(handler)
+			}
+		}
+
+		// Register the module's email templates (if any)
+		if module.EmailTemplates != nil {
+			if err := email.RegisterTemplates(module.EmailTemplates); err != nil {
+				panic(fmt.Sprintf("Failed registering email templates for module %s: %v", module.Name, err))
+			}
+		}
+
 		// Assign constructor function to newAdminController
 		newAdminController := module.NewAdminController
 		// If admin controller constructor is not nil, add it to the module map
@@ -59,6 +78,11 @@ type EntityConfig struct {
 	NewService         func(interface{}) interface{}
 	NewController      func(interface{}) interface{}
 	NewAdminController func(interface{}, webapi.ActionService) models.BasicAdminController
+	// NewJobHandlers is optional and is used to register the module's background job handlers (built using the module service)
+	NewJobHandlers func(interface{}) []queue.JobHandler
+	// EmailTemplates is optional and holds the module's email templates (see email.TemplateRegistry.Register)
+	// eg. embed a templates directory in the module's package and pass it using fs.Sub
+	EmailTemplates fs.FS
 	// PolicySet is used to setup the different policies for the module
 	// The policy set will set the policy for the non-admin CRUD portion of the API
 	PolicySet ModulePolicySet
@@ -0,0 +1,304 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+// Returned when a chain or batch is added without any jobs
+var ErrNoJobs = errors.New("no jobs given")
+
+// NewJob describes a job added as part of a chain or batch
+type NewJob struct {
+	JobType string
+	Payload string
+	// Unique keys are not supported in chains and batches
+	Options JobOptions
+}
+
+// BatchCompletion is the payload of the callback job enqueued once a batch has finished.
+// Register the callback job type with a handler accepting this type.
+type BatchCompletion struct {
+	BatchID uint `json:"batch_id"`
+	// Number of jobs in the batch
+	Total int `json:"total"`
+	// Number of jobs that were processed successfully
+	Processed int `json:"processed"`
+	// Number of jobs that died or were cancelled
+	Failed int `json:"failed"`
+	// Payload given for the callback job when the batch was added
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AddChain adds jobs that are run one after another. Each job is only run once the job before it
+// has been processed. If a job in the chain dies, the jobs after it are cancelled.
+// Example usage: q.AddChain(queue.NewJob{JobType: "resize", Payload: payload}, queue.NewJob{JobType: "publish", Payload: payload})
+func (q *Queue) AddChain(jobs ...NewJob) error {
+	built, err := buildJobs(q.IsRegistered, jobs)
+	if err != nil {
+		return err
+	}
+
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		for i, job := range built {
+			// Jobs after the first wait for the job before them
+			if i > 0 {
+				job.Status = db.JobStatusWaiting
+				job.ParentID = &built[i-1].ID
+			}
+			if err := tx.Create(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed adding chain: %w", err)
+	}
+	q.notifyIfDue(built[0])
+	return nil
+}
+
+// AddBatch adds a group of jobs that are run independently. Once every job in the batch
+// has been processed, has died or has been cancelled, the callback job is enqueued with a
+// BatchCompletion payload (containing the callback payload and the number of failed jobs).
+// Example usage: q.AddBatch(jobs, queue.NewJob{JobType: "import-complete", Payload: `{"import_id":1}`})
+func (q *Queue) AddBatch(jobs []NewJob, callback NewJob) (*db.JobBatch, error) {
+	built, batch, err := buildBatch(q.IsRegistered, jobs, callback)
+	if err != nil {
+		return nil, err
+	}
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		for _, job := range built {
+			job.BatchID = &batch.ID
+			if err := tx.Create(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed adding batch: %w", err)
+	}
+	for _, job := range built {
+		q.notifyIfDue(job)
+	}
+	return batch, nil
+}
+
+// Builds the jobs of a chain or batch
+func buildJobs(isRegistered func(jobType string) bool, jobs []NewJob) ([]*db.Job, error) {
+	if len(jobs) == 0 {
+		return nil, ErrNoJobs
+	}
+	built := make([]*db.Job, 0, len(jobs))
+	for _, newJob := range jobs {
+		if newJob.Options.UniqueKey != "" {
+			return nil, errors.New("unique keys are not supported in chains and batches")
+		}
+		job, err := buildJob(isRegistered, newJob.JobType, newJob.Payload, newJob.Options)
+		if err != nil {
+			return nil, err
+		}
+		built = append(built, job)
+	}
+	return built, nil
+}
+
+// Builds the jobs of a batch along with the batch record holding its callback job
+func buildBatch(isRegistered func(jobType string) bool, jobs []NewJob, callback NewJob) ([]*db.Job, *db.JobBatch, error) {
+	built, err := buildJobs(isRegistered, jobs)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Check the callback job can be run
+	callbackJob, err := buildJob(isRegistered, callback.JobType, callback.Payload, callback.Options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid batch callback: %w", err)
+	}
+	if callback.Payload != "" && !json.Valid([]byte(callback.Payload)) {
+		return nil, nil, errors.New("invalid batch callback: payload must be valid JSON")
+	}
+
+	batch := &db.JobBatch{
+		Total:            len(built),
+		CallbackJobType:  callbackJob.JobType,
+		CallbackPayload:  callbackJob.Payload,
+		CallbackQueue:    callbackJob.Queue,
+		CallbackPriority: callbackJob.Priority,
+	}
+	return built, batch, nil
+}
+
+// Follows up on a job that has been saved: releases or cancels the jobs waiting on it
+// once it has been processed, has died or has been cancelled, and completes its batch if it was the last job
+func (q *Queue) jobFinished(job *db.Job) error {
+	// Batches containing jobs that have finished
+	batchIDs := []uint{}
+	switch job.Status {
+	case db.JobStatusProcessed:
+		if err := q.releaseWaitingJobs(job); err != nil {
+			return err
+		}
+	case db.JobStatusDead, db.JobStatusCancelled:
+		cancelledBatchIDs, err := q.cancelWaitingJobs(job)
+		if err != nil {
+			return err
+		}
+		batchIDs = append(batchIDs, cancelledBatchIDs...)
+	default:
+		// Job will be retried
+		return nil
+	}
+	if job.BatchID != nil {
+		batchIDs = append(batchIDs, *job.BatchID)
+	}
+
+	for _, batchID := range batchIDs {
+		if err := q.completeBatch(batchID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Releases the jobs waiting on a processed job so they can be run
+func (q *Queue) releaseWaitingJobs(parent *db.Job) error {
+	result := q.db.Model(&db.Job{}).
+		Where("parent_id = ? AND status = ?", parent.ID, db.JobStatusWaiting).
+		Updates(map[string]interface{}{"status": db.JobStatusPending, "next_run_at": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("failed releasing jobs waiting on job %d: %w", parent.ID, result.Error)
+	}
+	if result.RowsAffected > 0 {
+		q.notifyAll()
+	}
+	return nil
+}
+
+// Cancels the jobs waiting on a dead or cancelled job, along with the jobs waiting on them (the rest of the chain).
+// Returns the batches of the cancelled jobs
+func (q *Queue) cancelWaitingJobs(parent *db.Job) ([]uint, error) {
+	var batchIDs []uint
+	parentIDs := []uint{parent.ID}
+	for len(parentIDs) > 0 {
+		// Find the jobs waiting on the current parents
+		var waiting []db.Job
+		err := q.db.Where("parent_id IN ? AND status = ?", parentIDs, db.JobStatusWaiting).Find(&waiting).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed finding jobs waiting on job %d: %w", parent.ID, err)
+		}
+
+		parentIDs = []uint{}
+		for _, job := range waiting {
+			// Cancel the job, recording the reason and redacting its payload
+			redactPayload(&job)
+			result := q.db.Model(&db.Job{}).
+				Where("id = ? AND status = ?", job.ID, db.JobStatusWaiting).
+				Updates(map[string]interface{}{
+					"status":     db.JobStatusCancelled,
+					"last_error": fmt.Sprintf("cancelled as job %d in its chain was not processed", parent.ID),
+					"payload":    job.Payload,
+				})
+			if result.Error != nil {
+				return nil, fmt.Errorf("failed cancelling job %d: %w", job.ID, result.Error)
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			parentIDs = append(parentIDs, job.ID)
+			if job.BatchID != nil {
+				batchIDs = append(batchIDs, *job.BatchID)
+			}
+		}
+	}
+	return batchIDs, nil
+}
+
+// Marks a batch as finished and enqueues its callback job once all of its jobs have finished.
+// The callback job is enqueued exactly once, even when the last jobs finish at the same time
+func (q *Queue) completeBatch(batchID uint) error {
+	// Check if any jobs in the batch haven't finished
+	var unfinished int64
+	err := q.db.Model(&db.Job{}).Where("batch_id = ? AND status NOT IN ?", batchID, finishedJobStatuses).Count(&unfinished).Error
+	if err != nil {
+		return fmt.Errorf("failed checking batch %d: %w", batchID, err)
+	}
+	if unfinished > 0 {
+		return nil
+	}
+
+	var callback *db.Job
+	err = q.db.Transaction(func(tx *gorm.DB) error {
+		// Mark the batch as finished. Only succeeds for the first job to finish the batch
+		result := tx.Model(&db.JobBatch{}).
+			Where("id = ? AND finished_at IS NULL", batchID).
+			Update("finished_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		var batch db.JobBatch
+		if err := tx.First(&batch, batchID).Error; err != nil {
+			return err
+		}
+		// Count the jobs that were processed
+		var processed int64
+		err := tx.Model(&db.Job{}).Where("batch_id = ? AND status = ?", batchID, db.JobStatusProcessed).Count(&processed).Error
+		if err != nil {
+			return err
+		}
+
+		// Enqueue the callback job
+		callback, err = buildBatchCallback(batch, int(processed))
+		if err != nil {
+			return err
+		}
+		return tx.Create(callback).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed completing batch %d: %w", batchID, err)
+	}
+	if callback != nil {
+		q.notifyIfDue(callback)
+	}
+	return nil
+}
+
+// Builds the callback job of a finished batch, given the number of its jobs that were processed
+func buildBatchCallback(batch db.JobBatch, processed int) (*db.Job, error) {
+	// Build callback payload
+	completion := BatchCompletion{
+		BatchID:   batch.ID,
+		Total:     batch.Total,
+		Processed: processed,
+		Failed:    batch.Total - processed,
+	}
+	if batch.CallbackPayload != "" {
+		completion.Payload = json.RawMessage(batch.CallbackPayload)
+	}
+	payload, err := json.Marshal(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.Job{
+		JobType:     batch.CallbackJobType,
+		Payload:     string(payload),
+		Status:      db.JobStatusPending,
+		MaxAttempts: DefaultMaxAttempts,
+		Queue:       batch.CallbackQueue,
+		Priority:    batch.CallbackPriority,
+	}, nil
+}
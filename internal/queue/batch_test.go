@@ -0,0 +1,162 @@
+package queue_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	"gorm.io/gorm"
+)
+
+// Handlers used for chained and batched jobs
+func init() {
+	queue.Register("noop", func(payload map[string]string) error {
+		return nil
+	})
+	queue.Register("batch-done", func(payload queue.BatchCompletion) error {
+		return nil
+	})
+}
+
+func TestQueue_AddChain(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	err := jobQueue.AddChain(
+		queue.NewJob{JobType: "noop", Payload: `{"step":"1"}`},
+		queue.NewJob{JobType: "noop", Payload: `{"step":"2"}`},
+		queue.NewJob{JobType: "noop", Payload: `{"step":"3"}`},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add chain: %v", err)
+	}
+
+	// Jobs should be run one at a time, in order
+	for _, step := range []string{"1", "2", "3"} {
+		job := runNextJob(t, jobQueue)
+		if job.Payload != `{"step":"`+step+`"}` {
+			t.Errorf("Expected step %s to run, got %s", step, job.Payload)
+		}
+		// The next job isn't released until this one has been processed
+		if _, err := jobQueue.GetJob(); step != "3" && err == nil {
+			t.Errorf("Expected no job to be due before step %s is processed", step)
+		}
+		if err := jobQueue.MarkJobAsProcessed(job); err != nil {
+			t.Fatalf("Failed to mark job as processed: %v", err)
+		}
+	}
+
+	// Chains with unregistered job types are rejected
+	err = jobQueue.AddChain(queue.NewJob{JobType: "noop"}, queue.NewJob{JobType: "unregistered"})
+	if !errors.Is(err, queue.ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType, got %v", err)
+	}
+}
+
+func TestQueue_AddChainFailure(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	err := jobQueue.AddChain(
+		queue.NewJob{JobType: "failing", Payload: "{}"},
+		queue.NewJob{JobType: "noop", Payload: "{}"},
+		queue.NewJob{JobType: "noop", Payload: "{}"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add chain: %v", err)
+	}
+
+	// Fail the first job until it dies
+	job := runNextJob(t, jobQueue)
+	for job.Status != db.JobStatusDead {
+		if err := jobQueue.MarkJobAsFailed(job, errors.New("job failed")); err != nil {
+			t.Fatalf("Failed to mark job as failed: %v", err)
+		}
+	}
+
+	// The rest of the chain should be cancelled
+	var jobs []db.Job
+	client.Where("id <> ?", job.ID).Find(&jobs)
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs after the failed job, got %d", len(jobs))
+	}
+	for _, chained := range jobs {
+		if chained.Status != db.JobStatusCancelled {
+			t.Errorf("Expected job %d to be cancelled, got %s", chained.ID, chained.Status)
+		}
+		if chained.LastError == "" {
+			t.Errorf("Expected job %d to record why it was cancelled", chained.ID)
+		}
+	}
+}
+
+func TestQueue_AddBatch(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	batch, err := jobQueue.AddBatch([]queue.NewJob{
+		{JobType: "noop", Payload: "{}"},
+		{JobType: "noop", Payload: "{}"},
+		{JobType: "failing", Payload: "{}"},
+	}, queue.NewJob{JobType: "batch-done", Payload: `{"import_id":7}`})
+	if err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+
+	// Finish every job in the batch (the failing job dies)
+	for i := 0; i < 3; i++ {
+		job := runNextJob(t, jobQueue)
+		// The callback shouldn't be enqueued before the batch has finished
+		if job.JobType == "batch-done" {
+			t.Fatalf("Callback job enqueued before the batch finished")
+		}
+		if job.JobType == "failing" {
+			job.MaxAttempts = 1
+			err = jobQueue.MarkJobAsFailed(job, errors.New("job failed"))
+		} else {
+			err = jobQueue.MarkJobAsProcessed(job)
+		}
+		if err != nil {
+			t.Fatalf("Failed to finish job: %v", err)
+		}
+	}
+
+	// The callback job should be enqueued once with the batch results
+	var callbacks []db.Job
+	client.Where("job_type = ?", "batch-done").Find(&callbacks)
+	if len(callbacks) != 1 {
+		t.Fatalf("Expected 1 callback job, got %d", len(callbacks))
+	}
+	var completion queue.BatchCompletion
+	if err := json.Unmarshal([]byte(callbacks[0].Payload), &completion); err != nil {
+		t.Fatalf("Failed to decode callback payload: %v", err)
+	}
+	if completion.BatchID != batch.ID || completion.Total != 3 || completion.Processed != 2 || completion.Failed != 1 {
+		t.Errorf("Unexpected batch completion: %+v", completion)
+	}
+	if string(completion.Payload) != `{"import_id":7}` {
+		t.Errorf("Expected callback payload to be passed on, got %s", completion.Payload)
+	}
+
+	stored := db.JobBatch{}
+	client.First(&stored, batch.ID)
+	if stored.FinishedAt == nil {
+		t.Errorf("Expected batch to be marked as finished")
+	}
+}
+
+// Claims the next due job
+func runNextJob(t *testing.T, jobQueue *queue.Queue) *db.Job {
+	t.Helper()
+	job, err := jobQueue.GetJob()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("Expected a job to be due")
+		}
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	return job
+}
@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned when a cron expression can't be parsed
+var ErrInvalidCronSpec = errors.New("invalid cron expression")
+
+// CronSchedule is a parsed five field cron expression
+// (minute, hour, day of month, month and day of week)
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Day of month/week restricted (not "*")
+	// When both are restricted, a day matching either field is a match (standard cron behaviour)
+	domRestricted, dowRestricted bool
+}
+
+// Shorthand expressions supported in place of five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Range of values allowed in each cron field
+type cronBounds struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteBounds = cronBounds{"minute", 0, 59}
+	hourBounds   = cronBounds{"hour", 0, 23}
+	domBounds    = cronBounds{"day of month", 1, 31}
+	monthBounds  = cronBounds{"month", 1, 12}
+	dowBounds    = cronBounds{"day of week", 0, 7} // 0 and 7 are both Sunday
+)
+
+// ParseCron parses a standard five field cron expression.
+// Fields support "*", single values, ranges (1-5), steps (*/15, 1-30/5) and lists (1,15,30).
+// The shorthand expressions @yearly, @monthly, @weekly, @daily and @hourly are also supported.
+// Example usage: queue.ParseCron("0 3 * * *") // Every day at 3am
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	// Expand shorthand expressions
+	if expanded, found := cronDescriptors[spec]; found {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, found %d in %q", ErrInvalidCronSpec, len(fields), spec)
+	}
+
+	// Parse each field into a bit set of allowed values
+	schedule := &CronSchedule{}
+	bounds := []cronBounds{minuteBounds, hourBounds, domBounds, monthBounds, dowBounds}
+	sets := []*uint64{&schedule.minute, &schedule.hour, &schedule.dom, &schedule.month, &schedule.dow}
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidCronSpec, spec, err)
+		}
+		*sets[i] = set
+	}
+	// Sunday can be written as 0 or 7
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domRestricted = fields[2] != "*"
+	schedule.dowRestricted = fields[4] != "*"
+
+	return schedule, nil
+}
+
+// Next returns the first time after t that matches the schedule.
+// Returns the zero time if no match is found within five years (eg. "0 0 30 2 *").
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	// Start from the next whole minute
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		// Skip to the start of the next month if the month doesn't match
+		if !hasBit(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		// Skip to the start of the next day if the day doesn't match
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		// Skip to the start of the next hour if the hour doesn't match
+		if !hasBit(s.hour, t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		// Skip to the next minute if the minute doesn't match
+		if !hasBit(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Checks if the day of t matches the day of month and day of week fields
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := hasBit(s.dom, t.Day())
+	dowMatch := hasBit(s.dow, int(t.Weekday()))
+	// If both fields are restricted, either can match
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Parses a single cron field into a bit set of allowed values
+func parseCronField(field string, bounds cronBounds) (uint64, error) {
+	var set uint64
+	// Iterate through comma separated parts
+	for _, part := range strings.Split(field, ",") {
+		// Split off the step if present (eg. */15)
+		rangePart, step := part, 1
+		if before, after, found := strings.Cut(part, "/"); found {
+			parsedStep, err := strconv.Atoi(after)
+			if err != nil || parsedStep < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", after, bounds.name)
+			}
+			rangePart, step = before, parsedStep
+		}
+
+		// Determine the range of values
+		start, end := bounds.min, bounds.max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(from, bounds); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseCronValue(to, bounds); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// A single value with a step runs until the end of the range (eg. 5/15)
+				end = bounds.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, bounds.name)
+			}
+		}
+
+		// Set allowed values
+		for value := start; value <= end; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+// Parses a single value within a cron field and checks it is within bounds
+func parseCronValue(value string, bounds cronBounds) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", value, bounds.name)
+	}
+	if parsed < bounds.min || parsed > bounds.max {
+		return 0, fmt.Errorf("value %d out of range (%d-%d) in %s field", parsed, bounds.min, bounds.max, bounds.name)
+	}
+	return parsed, nil
+}
+
+// Checks if a value is set in a bit set
+func hasBit(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
@@ -0,0 +1,76 @@
+package queue_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Saturday 18th October 2025, 10:30
+	from := time.Date(2025, time.October, 18, 10, 30, 15, 0, time.UTC)
+
+	var tests = []struct {
+		name     string
+		spec     string
+		expected time.Time
+	}{
+		{"Every minute", "* * * * *", time.Date(2025, time.October, 18, 10, 31, 0, 0, time.UTC)},
+		{"Every 15 minutes", "*/15 * * * *", time.Date(2025, time.October, 18, 10, 45, 0, 0, time.UTC)},
+		{"Nightly", "0 3 * * *", time.Date(2025, time.October, 19, 3, 0, 0, 0, time.UTC)},
+		{"Daily shorthand", "@daily", time.Date(2025, time.October, 19, 0, 0, 0, 0, time.UTC)},
+		{"Hour range", "0 9-17 * * *", time.Date(2025, time.October, 18, 11, 0, 0, 0, time.UTC)},
+		{"List", "5,40 * * * *", time.Date(2025, time.October, 18, 10, 40, 0, 0, time.UTC)},
+		{"Weekdays", "0 9 * * 1-5", time.Date(2025, time.October, 20, 9, 0, 0, 0, time.UTC)},
+		{"Sunday as 7", "0 0 * * 7", time.Date(2025, time.October, 19, 0, 0, 0, 0, time.UTC)},
+		{"Monthly", "@monthly", time.Date(2025, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{"Day of month or week", "0 0 1 * 1", time.Date(2025, time.October, 20, 0, 0, 0, 0, time.UTC)},
+		{"Leap day", "0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, v := range tests {
+		schedule, err := queue.ParseCron(v.spec)
+		if err != nil {
+			t.Errorf("%s: failed to parse %q: %v", v.name, v.spec, err)
+			continue
+		}
+		next := schedule.Next(from)
+		if !next.Equal(v.expected) {
+			t.Errorf("%s: expected next run of %q to be %v, got %v", v.name, v.spec, v.expected, next)
+		}
+	}
+
+	// Schedules that can never match should return the zero time
+	schedule, err := queue.ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Failed to parse schedule: %v", err)
+	}
+	if next := schedule.Next(from); !next.IsZero() {
+		t.Errorf("Expected no next run, got %v", next)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	var tests = []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	}
+
+	for _, spec := range tests {
+		_, err := queue.ParseCron(spec)
+		if !errors.Is(err, queue.ErrInvalidCronSpec) {
+			t.Errorf("Expected ErrInvalidCronSpec for %q, got %v", spec, err)
+		}
+	}
+}
@@ -2,23 +2,168 @@ package queue
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
 )
 
-// EmailJobPayload defines the structure of the email job payload
+// Job type used for sending emails
+const EmailJobType = "email"
+
+// Returned when sending an email whose content was redacted (eg. a dead or cancelled email job that was retried)
+var ErrEmailRedacted = errors.New("email content was redacted and can't be sent")
+
+// EmailJobPayload defines the structure of the email job payload.
+// Carries the full message so queued emails keep every field
 type EmailJobPayload struct {
-	Recipient string
-	Subject   string
-	Body      string
+	email.EmailMessage
+	// Name of the template the message was rendered from (if any, recorded in the email log)
+	Template string `json:",omitempty"`
+	// Fields of jobs queued before full messages were supported (sent as an HTML email to a single recipient)
+	Recipient string `json:",omitempty"`
+	Body      string `json:",omitempty"`
+}
+
+// Builds the payload of a job sending the given message
+func NewEmailJobPayload(message email.EmailMessage) EmailJobPayload {
+	return EmailJobPayload{EmailMessage: message}
+}
+
+// Builds the payload of a job sending a rendered email template to the recipients
+func NewTemplateEmailJobPayload(rendered email.RenderedEmail, recipients ...string) EmailJobPayload {
+	return EmailJobPayload{EmailMessage: rendered.Message(recipients...), Template: rendered.Template}
+}
+
+// Message returns the email message sent by the job
+func (p EmailJobPayload) Message() email.EmailMessage {
+	message := p.EmailMessage
+	if p.Recipient != "" {
+		message.To = append(message.To, p.Recipient)
+	}
+	if p.Body != "" && message.HTMLBody == "" {
+		message.HTMLBody = p.Body
+	}
+	return message
+}
+
+// EmailDelivery describes an attempt to send the email of an email job
+type EmailDelivery struct {
+	// Job sending the email (0 if the email wasn't sent by a stored job)
+	JobID    uint
+	Template string
+	Message  email.EmailMessage
+	// Response of the mail server (if reported by the email service)
+	Response string
+	// Error returned by the email service (nil if the email was accepted)
+	Err error
+	// Recipients left out because they're on the suppression list or opted out of the email's category.
+	// The email isn't sent if every recipient was suppressed (Message has no recipients)
+	Suppressed []string
+}
+
+// EmailLogger records the delivery of the emails sent by email jobs
+type EmailLogger interface {
+	// Called after each attempt to send the email of a job
+	LogEmailDelivery(delivery EmailDelivery) error
+}
+
+// SuppressionList holds the addresses that mustn't receive non-transactional emails
+// (hard bounced, complained, unsubscribed or opted out of a category)
+type SuppressionList interface {
+	// Returns the recipients that mustn't receive emails of the category
+	SuppressedRecipients(recipients []string, category string) ([]string, error)
+	// Adds an address the mail server permanently rejected to the list
+	SuppressBounce(address, response string) error
+}
+
+// SetEmailLogger sets the logger recording the delivery of emails sent by email jobs.
+// Must be called before workers are started
+func (q *Queue) SetEmailLogger(logger EmailLogger) {
+	q.emailLogger = logger
+}
+
+// SetSuppressionList sets the list checked before sending non-transactional emails.
+// Must be called before workers are started
+func (q *Queue) SetSuppressionList(list SuppressionList) {
+	q.suppressionList = list
 }
 
 // ProcessEmailJob processes an email job
 func (q *Queue) ProcessEmailJob(payload string) error {
+	return q.processEmailJob(&db.Job{JobType: EmailJobType, Payload: payload})
+}
+
+// Processes an email job, recording the delivery in the email log
+func (q *Queue) processEmailJob(job *db.Job) error {
+	return sendEmailJob(q.mailService, q.emailLogger, q.suppressionList, job)
+}
+
+// Sends the email described by an email job's payload using the given mail service.
+// Suppressed recipients are left out of non-transactional emails (if a suppression list is set)
+// and each attempt is recorded by the email logger (if set)
+func sendEmailJob(mailService email.Email, logger EmailLogger, suppressionList SuppressionList, job *db.Job) error {
 	var emailPayload EmailJobPayload
 	// Unmarshal the payload into the email payload struct
-	if err := json.Unmarshal([]byte(payload), &emailPayload); err != nil {
+	if err := json.Unmarshal([]byte(job.Payload), &emailPayload); err != nil {
 		return err
 	}
+	message := emailPayload.Message()
+	// Don't send placeholders in place of the content
+	if message.HTMLBody == RedactedValue || message.TextBody == RedactedValue {
+		return ErrEmailRedacted
+	}
+
+	// Leave out recipients that mustn't receive the email (transactional emails are always sent)
+	var suppressed []string
+	if suppressionList != nil && !email.IsTransactional(message.Category) {
+		var err error
+		suppressed, err = suppressionList.SuppressedRecipients(message.Recipients(), message.Category)
+		if err != nil {
+			// Retry later rather than risk emailing an address that opted out
+			return err
+		}
+		message = message.WithoutRecipients(suppressed...)
+		// Skip the email if nobody is left to receive it
+		if len(message.Recipients()) == 0 {
+			logEmailDelivery(logger, EmailDelivery{JobID: job.ID, Template: emailPayload.Template, Message: message, Suppressed: suppressed})
+			return nil
+		}
+	}
+	// Let a single recipient unsubscribe from the category
+	if !email.IsTransactional(message.Category) && message.Category != "" && message.UnsubscribeURL == "" && len(message.Recipients()) == 1 {
+		message.UnsubscribeURL = email.UnsubscribeURL(message.Recipients()[0], message.Category)
+	}
 
 	// Use the mail service to send the email
-	return q.mailService.SendEmail(emailPayload.Recipient, emailPayload.Subject, emailPayload.Body)
+	response, err := email.SendWithResponse(mailService, message)
+
+	// Stop sending emails to addresses the mail server permanently rejected
+	var recipientErr *email.RecipientError
+	if suppressionList != nil && errors.As(err, &recipientErr) && recipientErr.Permanent() {
+		if suppressErr := suppressionList.SuppressBounce(recipientErr.Address, response); suppressErr != nil {
+			log.Printf("Error suppressing bounced address %s: %v\n", recipientErr.Address, suppressErr)
+		}
+	}
+
+	logEmailDelivery(logger, EmailDelivery{
+		JobID:      job.ID,
+		Template:   emailPayload.Template,
+		Message:    message,
+		Response:   response,
+		Err:        err,
+		Suppressed: suppressed,
+	})
+	return err
+}
+
+// Records an attempt to send an email (failing to record it doesn't fail the job, as the email may have been sent)
+func logEmailDelivery(logger EmailLogger, delivery EmailDelivery) {
+	if logger == nil {
+		return
+	}
+	if err := logger.LogEmailDelivery(delivery); err != nil {
+		log.Printf("Error recording delivery of email job %d: %v\n", delivery.JobID, err)
+	}
 }
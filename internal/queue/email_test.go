@@ -0,0 +1,202 @@
+package queue_test
+
+import (
+	"encoding/json"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestEmailJobPayload_Message(t *testing.T) {
+	message := email.EmailMessage{
+		To:          []string{"user@example.com"},
+		Bcc:         []string{"audit@example.com"},
+		ReplyTo:     "support@example.com",
+		Subject:     "Invoice",
+		HTMLBody:    "<p>Invoice</p>",
+		TextBody:    "Invoice",
+		Attachments: []email.Attachment{{Filename: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}},
+	}
+
+	var tests = []struct {
+		name     string
+		payload  string
+		expected email.EmailMessage
+	}{
+		{"Full message", mustMarshal(t, queue.NewEmailJobPayload(message)), message},
+		{"Queued before full messages", `{"Recipient":"user@example.com","Subject":"Hi","Body":"<p>Hi</p>"}`, email.NewHTMLMessage("user@example.com", "Hi", "<p>Hi</p>")},
+	}
+	for _, v := range tests {
+		var payload queue.EmailJobPayload
+		if err := json.Unmarshal([]byte(v.payload), &payload); err != nil {
+			t.Fatalf("%s: failed to decode payload: %v", v.name, err)
+		}
+		if got := payload.Message(); !reflect.DeepEqual(got, v.expected) {
+			t.Errorf("%s: expected message %+v, got %+v", v.name, v.expected, got)
+		}
+	}
+}
+
+func TestMemoryQueue_EmailLogger(t *testing.T) {
+	mail := &rejectingEmail{rejected: "bounce@example.com"}
+	logger := &recordingEmailLogger{}
+	jobQueue := queue.NewSyncMemoryQueue(mail)
+	jobQueue.SetEmailLogger(logger)
+
+	rendered := email.RenderedEmail{Template: "welcome", Subject: "Welcome", HTMLBody: "<p>Welcome</p>", TextBody: "Welcome"}
+	for _, recipient := range []string{"user@example.com", "bounce@example.com"} {
+		if err := jobQueue.AddJob(queue.EmailJobType, mustMarshal(t, queue.NewTemplateEmailJobPayload(rendered, recipient))); err != nil {
+			t.Fatalf("Failed to add job: %v", err)
+		}
+	}
+
+	// Every attempt is recorded with the job, template and response of the mail server
+	if len(logger.deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries to be logged, got %d", len(logger.deliveries))
+	}
+	var tests = []struct {
+		name         string
+		delivery     queue.EmailDelivery
+		wantTo       string
+		wantResponse string
+		wantErr      bool
+	}{
+		{"Accepted", logger.deliveries[0], "user@example.com", "250 2.0.0 Ok", false},
+		{"Rejected", logger.deliveries[1], "bounce@example.com", "550 5.1.1 User unknown", true},
+	}
+	for _, v := range tests {
+		if v.delivery.JobID == 0 || v.delivery.Template != "welcome" || v.delivery.Message.To[0] != v.wantTo {
+			t.Errorf("%s: expected job ID, template and recipient to be logged, got %+v", v.name, v.delivery)
+		}
+		if v.delivery.Response != v.wantResponse || (v.delivery.Err != nil) != v.wantErr {
+			t.Errorf("%s: expected response %q (error %v), got %q (%v)", v.name, v.wantResponse, v.wantErr, v.delivery.Response, v.delivery.Err)
+		}
+	}
+}
+
+func TestMemoryQueue_SuppressionList(t *testing.T) {
+	mail := &rejectingEmail{rejected: "bounce@example.com"}
+	logger := &recordingEmailLogger{}
+	suppressionList := &staticSuppressionList{suppressed: map[string]bool{"opted-out@example.com": true}}
+	jobQueue := queue.NewSyncMemoryQueue(mail)
+	jobQueue.SetEmailLogger(logger)
+	jobQueue.SetSuppressionList(suppressionList)
+	email.SetUnsubscribeSecret("test-unsubscribe-secret")
+
+	var tests = []struct {
+		name            string
+		message         email.EmailMessage
+		wantSent        []string
+		wantSuppressed  []string
+		wantUnsubscribe bool
+	}{
+		{"Every recipient suppressed", email.EmailMessage{To: []string{"Opted-Out@example.com"}, Category: email.CategoryMarketing}, []string{}, []string{"Opted-Out@example.com"}, false},
+		{"Suppressed recipient left out", email.EmailMessage{To: []string{"user@example.com"}, Bcc: []string{"opted-out@example.com"}, Category: email.CategoryMarketing}, []string{"user@example.com"}, []string{"opted-out@example.com"}, true},
+		{"Transactional emails bypass the list", email.EmailMessage{To: []string{"opted-out@example.com"}, Category: email.CategoryAccount}, []string{"opted-out@example.com"}, nil, false},
+		// Emails without a category can't be unsubscribed from, but suppressed addresses are left out
+		{"Emails without a category check the list", email.EmailMessage{To: []string{"user@example.com"}, Bcc: []string{"opted-out@example.com"}}, []string{"user@example.com"}, []string{"opted-out@example.com"}, false},
+	}
+	for _, v := range tests {
+		logger.deliveries = nil
+		v.message.Subject, v.message.TextBody = "News", "News"
+		if err := jobQueue.AddJob(queue.EmailJobType, mustMarshal(t, queue.NewEmailJobPayload(v.message))); err != nil {
+			t.Fatalf("%s: failed to add job: %v", v.name, err)
+		}
+		if len(logger.deliveries) != 1 {
+			t.Fatalf("%s: expected 1 delivery to be logged, got %d", v.name, len(logger.deliveries))
+		}
+		delivery := logger.deliveries[0]
+		if sent := delivery.Message.Recipients(); !reflect.DeepEqual(sent, v.wantSent) {
+			t.Errorf("%s: expected email sent to %v, got %v", v.name, v.wantSent, sent)
+		}
+		if !reflect.DeepEqual(delivery.Suppressed, v.wantSuppressed) {
+			t.Errorf("%s: expected %v to be suppressed, got %v", v.name, v.wantSuppressed, delivery.Suppressed)
+		}
+		// Non-transactional emails to a single recipient include an unsubscribe link
+		if hasLink := strings.Contains(delivery.Message.UnsubscribeURL, email.UnsubscribePath); hasLink != v.wantUnsubscribe {
+			t.Errorf("%s: expected unsubscribe link %v, got %q", v.name, v.wantUnsubscribe, delivery.Message.UnsubscribeURL)
+		}
+	}
+
+	// Addresses the mail server permanently rejects are suppressed
+	message := email.EmailMessage{To: []string{"bounce@example.com"}, Subject: "News", TextBody: "News", Category: email.CategoryMarketing}
+	jobQueue.AddJob(queue.EmailJobType, mustMarshal(t, queue.NewEmailJobPayload(message)))
+	if !suppressionList.suppressed["bounce@example.com"] {
+		t.Errorf("Expected bounced address to be suppressed")
+	}
+	// Bounced addresses only receive transactional emails
+	for _, category := range []string{email.CategoryNotifications, "", email.CategoryAccount} {
+		logger.deliveries = nil
+		message.Category = category
+		jobQueue.AddJob(queue.EmailJobType, mustMarshal(t, queue.NewEmailJobPayload(message)))
+		if len(logger.deliveries) != 1 {
+			t.Fatalf("%q: expected 1 delivery to be logged, got %d", category, len(logger.deliveries))
+		}
+		wantSent := email.IsTransactional(category)
+		if sent := len(logger.deliveries[0].Message.Recipients()) == 1; sent != wantSent {
+			t.Errorf("%q: expected email to bounced address sent %v, got %v", category, wantSent, sent)
+		}
+	}
+}
+
+// Suppression list holding a fixed set of addresses
+type staticSuppressionList struct {
+	suppressed map[string]bool
+}
+
+func (l *staticSuppressionList) SuppressedRecipients(recipients []string, category string) ([]string, error) {
+	var suppressed []string
+	for _, recipient := range recipients {
+		if l.suppressed[strings.ToLower(recipient)] {
+			suppressed = append(suppressed, recipient)
+		}
+	}
+	return suppressed, nil
+}
+
+func (l *staticSuppressionList) SuppressBounce(address, response string) error {
+	l.suppressed[strings.ToLower(address)] = true
+	return nil
+}
+
+// Email service that rejects emails sent to one recipient
+type rejectingEmail struct {
+	rejected string
+}
+
+func (e *rejectingEmail) Send(message email.EmailMessage) error {
+	_, err := e.SendWithResponse(message)
+	return err
+}
+
+func (e *rejectingEmail) SendWithResponse(message email.EmailMessage) (string, error) {
+	for _, recipient := range message.Recipients() {
+		if recipient == e.rejected {
+			return "550 5.1.1 User unknown", &email.RecipientError{Address: recipient, Err: &textproto.Error{Code: 550, Msg: "5.1.1 User unknown"}}
+		}
+	}
+	return "250 2.0.0 Ok", nil
+}
+
+// Email logger that keeps the deliveries logged
+type recordingEmailLogger struct {
+	deliveries []queue.EmailDelivery
+}
+
+func (l *recordingEmailLogger) LogEmailDelivery(delivery queue.EmailDelivery) error {
+	l.deliveries = append(l.deliveries, delivery)
+	return nil
+}
+
+// Encodes a value as JSON
+func mustMarshal(t *testing.T, value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to encode %v: %v", value, err)
+	}
+	return string(encoded)
+}
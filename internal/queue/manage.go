@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+)
+
+// Statuses a stored job must have to be retried or cancelled
+var (
+	RetryableJobStatuses   = []string{db.JobStatusFailed, db.JobStatusDead, db.JobStatusCancelled}
+	CancellableJobStatuses = []string{db.JobStatusPending, db.JobStatusWaiting, db.JobStatusFailed}
+)
+
+// JobManager is used to retry, cancel and delete stored jobs (eg. from the admin panel).
+// Changes are followed up in the same way as jobs finished by workers, so the chains
+// and batches of the jobs are kept up to date.
+type JobManager interface {
+	// Requeues failed, dead or cancelled jobs with a fresh set of attempts. Returns the number of jobs requeued
+	RetryJobs(ids []uint) (int64, error)
+	// Cancels pending, waiting or failed jobs. Returns the number of jobs cancelled
+	CancelJobs(ids []uint) (int64, error)
+	// Deletes jobs that aren't running. Returns ErrJobRunning naming the running jobs that were skipped
+	DeleteJobs(ids []uint) error
+}
+
+// Returned when deleting running jobs, which could still be processed by a worker
+var ErrJobRunning = errors.New("running jobs can't be deleted")
+
+// Ensure the database queue can manage its jobs
+var _ JobManager = (*Queue)(nil)
+
+// RetryJobs requeues the failed, dead or cancelled jobs with the given IDs (other jobs are skipped).
+// Dead and cancelled jobs have had their sensitive fields redacted (eg. email jobs fail with ErrEmailRedacted).
+// The jobs after a requeued job in its chain that were cancelled are restored, so they're run once it has been processed.
+// A job in a chain waits for the job before it if that job hasn't been processed.
+func (q *Queue) RetryJobs(ids []uint) (int64, error) {
+	var jobs []db.Job
+	err := q.db.Where("id IN ? AND status IN ?", ids, RetryableJobStatuses).Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var retried int64
+	for _, job := range jobs {
+		status, err := q.retryStatus(job)
+		if err != nil {
+			return retried, err
+		}
+		// Skip jobs that were changed in the meantime
+		result := q.db.Model(&db.Job{}).
+			Where("id = ? AND status IN ?", job.ID, RetryableJobStatuses).
+			Updates(map[string]interface{}{
+				"status":       status,
+				"processed":    false,
+				"attempts":     0,
+				"next_run_at":  time.Now(),
+				"locked_by":    "",
+				"locked_until": nil,
+			})
+		if result.Error != nil {
+			return retried, fmt.Errorf("failed retrying job %d: %w", job.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		retried++
+		if err := q.restoreCancelledJobs(job.ID); err != nil {
+			return retried, err
+		}
+	}
+	// Wake the workers to pick up the requeued jobs
+	if retried > 0 {
+		q.notifyAll()
+	}
+	return retried, nil
+}
+
+// CancelJobs cancels the pending, waiting or failed jobs with the given IDs (other jobs are skipped), redacting their payloads.
+// The jobs after a cancelled job in its chain are cancelled, and its batch is completed if it was the last job.
+func (q *Queue) CancelJobs(ids []uint) (int64, error) {
+	var jobs []db.Job
+	err := q.db.Where("id IN ? AND status IN ?", ids, CancellableJobStatuses).Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var cancelled int64
+	for i := range jobs {
+		job := &jobs[i]
+		// Skip jobs that were claimed by a worker in the meantime. The sensitive fields of cancelled jobs aren't kept
+		redactPayload(job)
+		result := q.db.Model(&db.Job{}).
+			Where("id = ? AND status IN ?", job.ID, CancellableJobStatuses).
+			Updates(map[string]interface{}{"status": db.JobStatusCancelled, "payload": job.Payload})
+		if result.Error != nil {
+			return cancelled, fmt.Errorf("failed cancelling job %d: %w", job.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		cancelled++
+		job.Status = db.JobStatusCancelled
+		if err := q.jobFinished(job); err != nil {
+			return cancelled, err
+		}
+	}
+	return cancelled, nil
+}
+
+// DeleteJobs deletes the jobs with the given IDs. Unfinished jobs are treated as cancelled:
+// the jobs after them in their chain are cancelled and their batches are completed if they were the last job.
+// Running jobs are skipped (a worker could still process them), and reported with ErrJobRunning
+func (q *Queue) DeleteJobs(ids []uint) error {
+	var jobs []db.Job
+	err := q.db.Where("id IN ?", ids).Find(&jobs).Error
+	if err != nil {
+		return err
+	}
+
+	var running []uint
+	for i := range jobs {
+		job := &jobs[i]
+		// Skip jobs that are running (or were claimed by a worker in the meantime)
+		result := q.db.Where("id = ? AND status <> ?", job.ID, db.JobStatusRunning).Delete(&db.Job{})
+		if result.Error != nil {
+			return fmt.Errorf("failed deleting job %d: %w", job.ID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			running = append(running, job.ID)
+			continue
+		}
+		// Finished jobs have already been followed up
+		if utility.ArrayContainsString(finishedJobStatuses, job.Status) {
+			continue
+		}
+		job.Status = db.JobStatusCancelled
+		if err := q.jobFinished(job); err != nil {
+			return err
+		}
+	}
+	if len(running) > 0 {
+		return fmt.Errorf("jobs %v: %w", running, ErrJobRunning)
+	}
+	return nil
+}
+
+// Returns the status of a requeued job: jobs in a chain wait for the job before them until it has been processed
+func (q *Queue) retryStatus(job db.Job) (string, error) {
+	if job.ParentID == nil {
+		return db.JobStatusPending, nil
+	}
+	var parents []db.Job
+	err := q.db.Where("id = ?", *job.ParentID).Limit(1).Find(&parents).Error
+	if err != nil {
+		return "", fmt.Errorf("failed finding job before job %d in its chain: %w", job.ID, err)
+	}
+	// Jobs whose parent has been deleted are run straight away
+	if len(parents) == 0 || parents[0].Status == db.JobStatusProcessed {
+		return db.JobStatusPending, nil
+	}
+	return db.JobStatusWaiting, nil
+}
+
+// Restores the cancelled jobs after a requeued job in its chain, so they wait for it to be processed
+func (q *Queue) restoreCancelledJobs(parentID uint) error {
+	parentIDs := []uint{parentID}
+	for len(parentIDs) > 0 {
+		// Find the cancelled jobs of the current parents
+		var cancelled []db.Job
+		err := q.db.Where("parent_id IN ? AND status = ?", parentIDs, db.JobStatusCancelled).Find(&cancelled).Error
+		if err != nil {
+			return fmt.Errorf("failed finding cancelled jobs after job %d: %w", parentID, err)
+		}
+
+		parentIDs = []uint{}
+		for _, job := range cancelled {
+			result := q.db.Model(&db.Job{}).
+				Where("id = ? AND status = ?", job.ID, db.JobStatusCancelled).
+				Updates(map[string]interface{}{
+					"status":     db.JobStatusWaiting,
+					"processed":  false,
+					"attempts":   0,
+					"last_error": "",
+				})
+			if result.Error != nil {
+				return fmt.Errorf("failed restoring job %d: %w", job.ID, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				parentIDs = append(parentIDs, job.ID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package queue_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	"gorm.io/gorm"
+)
+
+func TestQueue_CancelJobsChainParent(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	chain := addTestChain(t, client, jobQueue)
+
+	// Cancelling the first job cancels the rest of the chain
+	cancelled, err := jobQueue.CancelJobs([]uint{chain[0].ID})
+	if err != nil || cancelled != 1 {
+		t.Fatalf("Expected 1 job to be cancelled, got %d (%v)", cancelled, err)
+	}
+	checkJobStatuses(t, client, chain, db.JobStatusCancelled, db.JobStatusCancelled, db.JobStatusCancelled)
+	if _, err := jobQueue.GetJob(); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected no jobs to be due, got %v", err)
+	}
+
+	// Retrying the first job brings back the rest of the chain, which waits for it
+	retried, err := jobQueue.RetryJobs([]uint{chain[0].ID})
+	if err != nil || retried != 1 {
+		t.Fatalf("Expected 1 job to be retried, got %d (%v)", retried, err)
+	}
+	checkJobStatuses(t, client, chain, db.JobStatusPending, db.JobStatusWaiting, db.JobStatusWaiting)
+
+	// The chain is run in order
+	for i := range chain {
+		job := runNextJob(t, jobQueue)
+		if job.ID != chain[i].ID {
+			t.Errorf("Expected job %d to run, got %d", chain[i].ID, job.ID)
+		}
+		if err := jobQueue.MarkJobAsProcessed(job); err != nil {
+			t.Fatalf("Failed to mark job as processed: %v", err)
+		}
+	}
+}
+
+func TestQueue_RetryJobsDeadChainParent(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	chain := addTestChain(t, client, jobQueue)
+
+	// The first job dies, cancelling the rest of the chain
+	job := runNextJob(t, jobQueue)
+	job.MaxAttempts = 1
+	if err := jobQueue.MarkJobAsFailed(job, errors.New("job failed")); err != nil {
+		t.Fatalf("Failed to mark job as failed: %v", err)
+	}
+	checkJobStatuses(t, client, chain, db.JobStatusDead, db.JobStatusCancelled, db.JobStatusCancelled)
+
+	// Retrying a later job of the chain waits for the dead job
+	retried, err := jobQueue.RetryJobs([]uint{chain[1].ID})
+	if err != nil || retried != 1 {
+		t.Fatalf("Expected 1 job to be retried, got %d (%v)", retried, err)
+	}
+	checkJobStatuses(t, client, chain, db.JobStatusDead, db.JobStatusWaiting, db.JobStatusWaiting)
+
+	// Retrying the dead job releases the rest of the chain once it has been processed
+	retried, err = jobQueue.RetryJobs([]uint{chain[0].ID})
+	if err != nil || retried != 1 {
+		t.Fatalf("Expected 1 job to be retried, got %d (%v)", retried, err)
+	}
+	job = runNextJob(t, jobQueue)
+	if job.ID != chain[0].ID {
+		t.Fatalf("Expected job %d to run, got %d", chain[0].ID, job.ID)
+	}
+	if err := jobQueue.MarkJobAsProcessed(job); err != nil {
+		t.Fatalf("Failed to mark job as processed: %v", err)
+	}
+	checkJobStatuses(t, client, chain, db.JobStatusProcessed, db.JobStatusPending, db.JobStatusWaiting)
+
+	// Jobs restored with the chain no longer record why they were cancelled
+	stored := db.Job{}
+	client.First(&stored, chain[2].ID)
+	if stored.LastError != "" {
+		t.Errorf("Expected the reason the job was cancelled to be cleared, got %q", stored.LastError)
+	}
+}
+
+func TestQueue_CancelJobsBatchMember(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	batch, err := jobQueue.AddBatch([]queue.NewJob{
+		{JobType: "noop", Payload: "{}"},
+		{JobType: "noop", Payload: "{}"},
+	}, queue.NewJob{JobType: "batch-done", Payload: "{}"})
+	if err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+
+	// Process one job and cancel the other (the last open job of the batch)
+	processed := runNextJob(t, jobQueue)
+	if err := jobQueue.MarkJobAsProcessed(processed); err != nil {
+		t.Fatalf("Failed to mark job as processed: %v", err)
+	}
+	var open db.Job
+	client.Where("batch_id = ? AND status = ?", batch.ID, db.JobStatusPending).First(&open)
+	cancelled, err := jobQueue.CancelJobs([]uint{open.ID})
+	if err != nil || cancelled != 1 {
+		t.Fatalf("Expected 1 job to be cancelled, got %d (%v)", cancelled, err)
+	}
+
+	// The callback job should be enqueued with the cancelled job counted as failed
+	var callbacks []db.Job
+	client.Where("job_type = ?", "batch-done").Find(&callbacks)
+	if len(callbacks) != 1 {
+		t.Fatalf("Expected 1 callback job, got %d", len(callbacks))
+	}
+	var completion queue.BatchCompletion
+	if err := json.Unmarshal([]byte(callbacks[0].Payload), &completion); err != nil {
+		t.Fatalf("Failed to decode callback payload: %v", err)
+	}
+	if completion.Total != 2 || completion.Processed != 1 || completion.Failed != 1 {
+		t.Errorf("Unexpected batch completion: %+v", completion)
+	}
+}
+
+func TestQueue_DeleteJobs(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	chain := addTestChain(t, client, jobQueue)
+
+	// Deleting an unfinished job cancels the rest of its chain
+	if err := jobQueue.DeleteJobs([]uint{chain[0].ID}); err != nil {
+		t.Fatalf("Failed to delete job: %v", err)
+	}
+	if err := client.First(&db.Job{}, chain[0].ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected job to be deleted, got %v", err)
+	}
+	checkJobStatuses(t, client, chain[1:], db.JobStatusCancelled, db.JobStatusCancelled)
+
+	// Deleting the last open job of a batch completes it
+	batch, err := jobQueue.AddBatch([]queue.NewJob{{JobType: "noop", Payload: "{}"}}, queue.NewJob{JobType: "batch-done", Payload: "{}"})
+	if err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+	var member db.Job
+	client.Where("batch_id = ?", batch.ID).First(&member)
+	if err := jobQueue.DeleteJobs([]uint{member.ID}); err != nil {
+		t.Fatalf("Failed to delete job: %v", err)
+	}
+	var callbacks int64
+	client.Model(&db.Job{}).Where("job_type = ?", "batch-done").Count(&callbacks)
+	if callbacks != 1 {
+		t.Errorf("Expected 1 callback job, got %d", callbacks)
+	}
+}
+
+func TestQueue_DeleteJobsRunning(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	chain := addTestChain(t, client, jobQueue)
+	running := runNextJob(t, jobQueue)
+
+	// Running jobs are skipped (a worker could still process them), the other jobs are still deleted
+	err := jobQueue.DeleteJobs([]uint{running.ID, chain[2].ID})
+	if !errors.Is(err, queue.ErrJobRunning) || !strings.Contains(err.Error(), fmt.Sprint(running.ID)) {
+		t.Errorf("Expected running job %d to be reported, got %v", running.ID, err)
+	}
+	if err := client.First(&db.Job{}, chain[2].ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected waiting job to be deleted, got %v", err)
+	}
+	// The chain of the running job is left to the worker
+	checkJobStatuses(t, client, chain[:2], db.JobStatusRunning, db.JobStatusWaiting)
+}
+
+// Adds a chain of 3 jobs. Returns the jobs in order
+func addTestChain(t *testing.T, client *gorm.DB, jobQueue *queue.Queue) []db.Job {
+	t.Helper()
+	err := jobQueue.AddChain(
+		queue.NewJob{JobType: "noop", Payload: "{}"},
+		queue.NewJob{JobType: "noop", Payload: "{}"},
+		queue.NewJob{JobType: "noop", Payload: "{}"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add chain: %v", err)
+	}
+	var chain []db.Job
+	client.Order("id asc").Find(&chain)
+	return chain
+}
+
+// Checks the stored statuses of the given jobs
+func checkJobStatuses(t *testing.T, client *gorm.DB, jobs []db.Job, statuses ...string) {
+	t.Helper()
+	for i, job := range jobs {
+		stored := db.Job{}
+		client.First(&stored, job.ID)
+		if stored.Status != statuses[i] {
+			t.Errorf("Expected job %d to be %s, got %s", job.ID, statuses[i], stored.Status)
+		}
+	}
+}
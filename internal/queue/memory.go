@@ -0,0 +1,591 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+)
+
+// MemoryQueue is a job queue that keeps its jobs in memory.
+// Used in tests and lightweight deployments running a single instance of the app
+// (jobs are lost when the app stops). Handlers, schedules, priorities, retries,
+// unique keys, chains and batches work as they do with the database backed Queue.
+//
+// A synchronous queue runs the jobs that are due as they are added, before AddJob returns.
+// An asynchronous queue leaves them to the workers started by StartWorkers.
+// The jobs added can be read back using Jobs and JobsOfType.
+type MemoryQueue struct {
+	mailService email.Email
+	// Records the delivery of emails (optional, see SetEmailLogger)
+	emailLogger EmailLogger
+	// Addresses that mustn't receive non-transactional emails (optional, see SetSuppressionList)
+	suppressionList SuppressionList
+	// Handlers built into the queue (job type => handler)
+	handlers map[string]builtInHandler
+	// Run due jobs as they are added
+	synchronous bool
+	// Guards the jobs, batches, schedules and subscribers below
+	mu sync.Mutex
+	// Jobs and batches added to the queue
+	jobs        []*db.Job
+	batches     map[uint]*db.JobBatch
+	nextJobID   uint
+	nextBatchID uint
+	// Next run of each recurring job (schedule name => time)
+	nextRuns map[string]time.Time
+	// Idle workers waiting to be woken when a job is added
+	subscribers []*subscriber
+	// Worker settings
+	pollInterval      time.Duration
+	schedulerInterval time.Duration
+	// Tracks the running workers and scheduler (used for graceful shutdown)
+	running sync.WaitGroup
+}
+
+// Class method for creating a new in-memory job queue.
+// Jobs are run by the workers started by StartWorkers.
+func NewMemoryQueue(mailService email.Email) *MemoryQueue {
+	q := &MemoryQueue{
+		mailService:       mailService,
+		batches:           make(map[uint]*db.JobBatch),
+		nextRuns:          make(map[string]time.Time),
+		pollInterval:      DefaultPollInterval,
+		schedulerInterval: DefaultSchedulerInterval,
+	}
+	// Register built in handlers
+	q.handlers = map[string]builtInHandler{
+		EmailJobType: func(job *db.Job) error { return sendEmailJob(q.mailService, q.emailLogger, q.suppressionList, job) },
+		PurgeJobsJobType: func(job *db.Job) error {
+			q.PurgeProcessedJobs(time.Now())
+			return nil
+		},
+	}
+	return q
+}
+
+// Class method for creating a new in-memory job queue that runs jobs as they are added.
+// Delayed jobs and retries are run once they are due by the workers started by StartWorkers
+// (or when RunDueJobs is called).
+func NewSyncMemoryQueue(mailService email.Email) *MemoryQueue {
+	q := NewMemoryQueue(mailService)
+	q.synchronous = true
+	return q
+}
+
+// AddJob adds a new job to the default queue to be run as soon as possible.
+// Returns ErrUnknownJobType if no handler is registered for the job type.
+func (q *MemoryQueue) AddJob(jobType, payload string) error {
+	return q.AddJobWithOptions(jobType, payload, JobOptions{})
+}
+
+// AddJobIn adds a new job to the default queue to be run after the given delay.
+func (q *MemoryQueue) AddJobIn(jobType, payload string, delay time.Duration) error {
+	return q.AddJobWithOptions(jobType, payload, JobOptions{RunAt: time.Now().Add(delay)})
+}
+
+// AddJobAt adds a new job to the default queue to be run at (or after) the given time.
+func (q *MemoryQueue) AddJobAt(jobType, payload string, runAt time.Time) error {
+	return q.AddJobWithOptions(jobType, payload, JobOptions{RunAt: runAt})
+}
+
+// AddJobWithOptions adds a new job to the queue using the given options.
+// Returns ErrUnknownJobType if no handler is registered for the job type and
+// ErrDuplicateJob if the job's unique key is held by another job.
+func (q *MemoryQueue) AddJobWithOptions(jobType, payload string, opts JobOptions) error {
+	job, err := buildJob(q.IsRegistered, jobType, payload, opts)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	if opts.UniqueKey != "" {
+		now := time.Now()
+		if q.uniqueKeyHeld(opts.UniqueKey, now) {
+			q.mu.Unlock()
+			return ErrDuplicateJob
+		}
+		uniqueKey := opts.UniqueKey
+		job.UniqueKey = &uniqueKey
+		if opts.UniqueFor > 0 {
+			uniqueUntil := now.Add(opts.UniqueFor)
+			job.UniqueUntil = &uniqueUntil
+		}
+	}
+	q.store(job)
+	q.mu.Unlock()
+
+	q.jobsAdded()
+	return nil
+}
+
+// AddChain adds jobs that are run one after another (see Queue.AddChain)
+func (q *MemoryQueue) AddChain(jobs ...NewJob) error {
+	built, err := buildJobs(q.IsRegistered, jobs)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	for i, job := range built {
+		// Jobs after the first wait for the job before them
+		if i > 0 {
+			job.Status = db.JobStatusWaiting
+			job.ParentID = &built[i-1].ID
+		}
+		q.store(job)
+	}
+	q.mu.Unlock()
+
+	q.jobsAdded()
+	return nil
+}
+
+// AddBatch adds a group of jobs that are run independently, followed by a callback job (see Queue.AddBatch)
+func (q *MemoryQueue) AddBatch(jobs []NewJob, callback NewJob) (*db.JobBatch, error) {
+	built, batch, err := buildBatch(q.IsRegistered, jobs, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.nextBatchID++
+	batch.ID = q.nextBatchID
+	batch.CreatedAt = time.Now()
+	batch.UpdatedAt = batch.CreatedAt
+	q.batches[batch.ID] = batch
+	for _, job := range built {
+		job.BatchID = &batch.ID
+		q.store(job)
+	}
+	created := *batch
+	q.mu.Unlock()
+
+	q.jobsAdded()
+	return &created, nil
+}
+
+// IsRegistered checks if a handler has been registered for a job type
+func (q *MemoryQueue) IsRegistered(jobType string) bool {
+	_, found := q.handlerFor(jobType)
+	return found
+}
+
+// Finds the handler for a job type. Handlers built into the queue take precedence
+func (q *MemoryQueue) handlerFor(jobType string) (builtInHandler, bool) {
+	if handler, found := q.handlers[jobType]; found {
+		return handler, true
+	}
+	return registeredHandler(jobType)
+}
+
+// SetEmailLogger sets the logger recording the delivery of emails sent by email jobs.
+// Must be called before workers are started
+func (q *MemoryQueue) SetEmailLogger(logger EmailLogger) {
+	q.emailLogger = logger
+}
+
+// SetSuppressionList sets the list checked before sending non-transactional emails.
+// Must be called before workers are started
+func (q *MemoryQueue) SetSuppressionList(list SuppressionList) {
+	q.suppressionList = list
+}
+
+// Jobs returns a copy of every job added to the queue (in the order they were added)
+func (q *MemoryQueue) Jobs() []db.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := make([]db.Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs
+}
+
+// JobsOfType returns a copy of the jobs of a job type added to the queue (in the order they were added)
+// Example usage: emails := q.JobsOfType(queue.EmailJobType)
+func (q *MemoryQueue) JobsOfType(jobType string) []db.Job {
+	jobs := []db.Job{}
+	for _, job := range q.Jobs() {
+		if job.JobType == jobType {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// RunDueJobs runs the jobs that are due in the given queues (or all queues if none are given)
+// until none are left, including jobs released or added while running. Returns the number of jobs run.
+// Failed jobs are retried once their retry time has passed.
+func (q *MemoryQueue) RunDueJobs(queues ...string) int {
+	run := 0
+	for q.runNext(queues) {
+		run++
+	}
+	return run
+}
+
+// StartWorkers starts the workers for each subscription along with the recurring job scheduler.
+// If no subscriptions are given, DefaultConcurrency workers are started for all queues.
+// Everything started stops once the context is cancelled (see Wait).
+func (q *MemoryQueue) StartWorkers(ctx context.Context, subscriptions ...Subscription) {
+	if len(subscriptions) == 0 {
+		subscriptions = []Subscription{{Concurrency: DefaultConcurrency}}
+	}
+	for _, subscription := range subscriptions {
+		for i := 0; i < subscription.Concurrency; i++ {
+			q.start(func() { q.worker(ctx, subscription.Queues...) })
+		}
+	}
+	q.start(func() { q.scheduler(ctx) })
+}
+
+// Wait blocks until the workers and scheduler started by StartWorkers have stopped.
+// Returns the context's error if it is done first.
+func (q *MemoryQueue) Wait(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// EnqueueDueSchedules enqueues a job for each registered schedule that is due at the given time.
+// Schedules are first due at their next run after the first call. Returns the number of jobs enqueued.
+func (q *MemoryQueue) EnqueueDueSchedules(now time.Time) int {
+	q.mu.Lock()
+	enqueued := 0
+	for _, schedule := range registeredSchedules() {
+		cron, err := ParseCron(schedule.Spec)
+		if err != nil {
+			log.Printf("Scheduler: Skipping schedule %s: %v\n", schedule.Name, err)
+			continue
+		}
+		// Schedule the first run of new schedules
+		nextRun, found := q.nextRuns[schedule.Name]
+		if !found {
+			q.nextRuns[schedule.Name] = cron.Next(now)
+			continue
+		}
+		// Skip schedules that aren't due yet
+		if nextRun.After(now) {
+			continue
+		}
+		// Move the schedule on to its next run (runs missed are enqueued once)
+		q.nextRuns[schedule.Name] = cron.Next(now)
+
+		// Enqueue the job for this run
+		q.store(&db.Job{
+			JobType:     schedule.JobType,
+			Payload:     schedule.Payload,
+			Status:      db.JobStatusPending,
+			MaxAttempts: DefaultMaxAttempts,
+			RunAt:       nextRun,
+			Queue:       schedule.Queue,
+			Priority:    schedule.Priority,
+		})
+		enqueued++
+	}
+	q.mu.Unlock()
+
+	if enqueued > 0 {
+		q.jobsAdded()
+	}
+	return enqueued
+}
+
+// Stores a new job, applying the defaults set on jobs stored in the database
+func (q *MemoryQueue) store(job *db.Job) {
+	q.nextJobID++
+	job.ID = q.nextJobID
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	if job.RunAt.IsZero() {
+		job.RunAt = job.CreatedAt
+	}
+	if job.Queue == "" {
+		job.Queue = DefaultQueue
+	}
+	if job.NextRunAt.IsZero() {
+		job.NextRunAt = job.RunAt
+	}
+	q.jobs = append(q.jobs, job)
+}
+
+// Checks if a job holds the given unique key at the given time
+func (q *MemoryQueue) uniqueKeyHeld(uniqueKey string, now time.Time) bool {
+	for _, job := range q.jobs {
+		if job.UniqueKey == nil || *job.UniqueKey != uniqueKey {
+			continue
+		}
+		// Key is held until the window passes, or until the job is finished if no window is set
+		if job.UniqueUntil != nil {
+			if job.UniqueUntil.After(now) {
+				return true
+			}
+		} else if !utility.ArrayContainsString(finishedJobStatuses, job.Status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Runs the jobs that are due if the queue is synchronous, otherwise wakes the workers to run them
+func (q *MemoryQueue) jobsAdded() {
+	if q.synchronous {
+		q.RunDueJobs()
+		return
+	}
+	q.wakeWorkers()
+}
+
+// Claims and runs the next job that is due in the given queues. Returns false if no job is due
+func (q *MemoryQueue) runNext(queues []string) bool {
+	job := q.claim(queues, time.Now())
+	if job == nil {
+		return false
+	}
+
+	// Process the job using the handler registered for its job type
+	var err error
+	handler, found := q.handlerFor(job.JobType)
+	if found {
+		err = handler(job)
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUnknownJobType, job.JobType)
+	}
+
+	q.mu.Lock()
+	if err != nil {
+		log.Printf("MemoryQueue: Error processing job %d (attempt %d): %v\n", job.ID, job.Attempts+1, err)
+		// Record the failure so the job is retried later (or marked as dead)
+		recordFailure(job, err)
+	} else {
+		recordSuccess(job)
+	}
+	job.UpdatedAt = time.Now()
+	q.jobFinished(job)
+	q.mu.Unlock()
+
+	// Wake the workers to pick up any jobs released by this one
+	q.wakeWorkers()
+	return true
+}
+
+// Claims the next job that is due to run from the given queues (or any queue if none are given).
+// Jobs are claimed in the same order as Queue.GetJob. Returns nil if no job is due
+func (q *MemoryQueue) claim(queues []string, now time.Time) *db.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var next *db.Job
+	for _, job := range q.jobs {
+		// Skip jobs that aren't due
+		if job.Processed || (job.Status != db.JobStatusPending && job.Status != db.JobStatusFailed) {
+			continue
+		}
+		if job.RunAt.After(now) || job.NextRunAt.After(now) {
+			continue
+		}
+		if len(queues) > 0 && !utility.ArrayContainsString(queues, job.Queue) {
+			continue
+		}
+		// Jobs with the highest priority first, followed by the jobs that have been waiting the longest
+		if next == nil || job.Priority > next.Priority ||
+			(job.Priority == next.Priority && job.NextRunAt.Before(next.NextRunAt)) {
+			next = job
+		}
+	}
+	if next != nil {
+		next.Status = db.JobStatusRunning
+	}
+	return next
+}
+
+// Releases or cancels the jobs waiting on a finished job and completes its batch
+// if it was the last job (see Queue.jobFinished). Must be called holding the lock
+func (q *MemoryQueue) jobFinished(job *db.Job) {
+	batchIDs := []uint{}
+	switch job.Status {
+	case db.JobStatusProcessed:
+		// Release the jobs waiting on the job
+		for _, waiting := range q.jobs {
+			if waiting.ParentID != nil && *waiting.ParentID == job.ID && waiting.Status == db.JobStatusWaiting {
+				waiting.Status = db.JobStatusPending
+				waiting.NextRunAt = time.Now()
+			}
+		}
+	case db.JobStatusDead:
+		batchIDs = append(batchIDs, q.cancelWaitingJobs(job)...)
+	default:
+		// Job will be retried
+		return
+	}
+	if job.BatchID != nil {
+		batchIDs = append(batchIDs, *job.BatchID)
+	}
+
+	for _, batchID := range batchIDs {
+		q.completeBatch(batchID)
+	}
+}
+
+// Cancels the jobs waiting on a dead job, along with the rest of its chain.
+// Returns the batches of the cancelled jobs
+func (q *MemoryQueue) cancelWaitingJobs(parent *db.Job) []uint {
+	var batchIDs []uint
+	parentIDs := []uint{parent.ID}
+	for len(parentIDs) > 0 {
+		waitingOn := parentIDs
+		parentIDs = []uint{}
+		for _, job := range q.jobs {
+			if job.ParentID == nil || job.Status != db.JobStatusWaiting || !containsID(waitingOn, *job.ParentID) {
+				continue
+			}
+			// Cancel the job, recording the reason
+			job.Status = db.JobStatusCancelled
+			job.LastError = fmt.Sprintf("cancelled as job %d in its chain failed", parent.ID)
+			redactPayload(job)
+			job.UpdatedAt = time.Now()
+			parentIDs = append(parentIDs, job.ID)
+			if job.BatchID != nil {
+				batchIDs = append(batchIDs, *job.BatchID)
+			}
+		}
+	}
+	return batchIDs
+}
+
+// Marks a batch as finished and enqueues its callback job once all of its jobs have finished
+func (q *MemoryQueue) completeBatch(batchID uint) {
+	batch, found := q.batches[batchID]
+	if !found || batch.FinishedAt != nil {
+		return
+	}
+	// Check if any jobs in the batch haven't finished
+	processed := 0
+	for _, job := range q.jobs {
+		if job.BatchID == nil || *job.BatchID != batchID {
+			continue
+		}
+		if !utility.ArrayContainsString(finishedJobStatuses, job.Status) {
+			return
+		}
+		if job.Status == db.JobStatusProcessed {
+			processed++
+		}
+	}
+
+	// Mark the batch as finished and enqueue the callback job
+	finishedAt := time.Now()
+	batch.FinishedAt = &finishedAt
+	callback, err := buildBatchCallback(*batch, processed)
+	if err != nil {
+		log.Printf("MemoryQueue: Error completing batch %d: %v\n", batchID, err)
+		return
+	}
+	q.store(callback)
+}
+
+// Processes jobs from the given queues (or all queues if none are given).
+// Returns once the context is cancelled. A job that is being processed is finished first.
+func (q *MemoryQueue) worker(ctx context.Context, queues ...string) {
+	// Subscribe to be woken when a job is added
+	sub := q.subscribe(queues)
+	defer q.unsubscribe(sub)
+	for {
+		// Stop claiming jobs once shutting down
+		if ctx.Err() != nil {
+			return
+		}
+		if q.runNext(queues) {
+			continue
+		}
+		// Wait until a job is added or the poll interval passes (picks up delayed jobs and retries)
+		timer := time.NewTimer(q.pollInterval)
+		select {
+		case <-sub.wake:
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+}
+
+// Periodically enqueues the recurring jobs that are due. Returns once the context is cancelled.
+func (q *MemoryQueue) scheduler(ctx context.Context) {
+	ticker := time.NewTicker(q.schedulerInterval)
+	defer ticker.Stop()
+	for {
+		q.EnqueueDueSchedules(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Runs fn in a goroutine tracked by Wait
+func (q *MemoryQueue) start(fn func()) {
+	q.running.Add(1)
+	go func() {
+		defer q.running.Done()
+		fn()
+	}()
+}
+
+// Registers a worker waiting on the given queues. Returns the subscription used to wake it
+func (q *MemoryQueue) subscribe(queues []string) *subscriber {
+	sub := &subscriber{queues: queues, wake: make(chan struct{}, 1)}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subscribers = append(q.subscribers, sub)
+	return sub
+}
+
+// Removes a worker's subscription (once the worker has stopped)
+func (q *MemoryQueue) unsubscribe(sub *subscriber) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, existing := range q.subscribers {
+		if existing == sub {
+			q.subscribers = append(q.subscribers[:i], q.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Wakes all idle workers without blocking
+func (q *MemoryQueue) wakeWorkers() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, sub := range q.subscribers {
+		sub.wakeUp()
+	}
+}
+
+// Checks if a list of IDs contains an ID
+func containsID(ids []uint, id uint) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
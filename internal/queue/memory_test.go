@@ -0,0 +1,168 @@
+package queue_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestMemoryQueue_Synchronous(t *testing.T) {
+	jobQueue := queue.NewSyncMemoryQueue(&helpers.EmailMock{})
+
+	// Jobs that are due are run before AddJob returns
+	err := jobQueue.AddJob(queue.EmailJobType, `{"Recipient":"test@example.com","Subject":"Hi","Body":"Hello"}`)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	emails := jobQueue.JobsOfType(queue.EmailJobType)
+	if len(emails) != 1 {
+		t.Fatalf("Expected 1 email job, got %d", len(emails))
+	}
+	if emails[0].Status != db.JobStatusProcessed || emails[0].Attempts != 1 {
+		t.Errorf("Expected email job to be processed in 1 attempt, got status %s after %d attempts", emails[0].Status, emails[0].Attempts)
+	}
+
+	// Failed jobs are scheduled for a retry
+	err = jobQueue.AddJob("failing", "{}")
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	failed := jobQueue.JobsOfType("failing")
+	if len(failed) != 1 {
+		t.Fatalf("Expected 1 failing job, got %d", len(failed))
+	}
+	if failed[0].Status != db.JobStatusFailed || failed[0].LastError != "job failed" || !failed[0].NextRunAt.After(time.Now()) {
+		t.Errorf("Expected failing job to be scheduled for a retry, got status %s (%q) due at %v", failed[0].Status, failed[0].LastError, failed[0].NextRunAt)
+	}
+
+	// Delayed jobs aren't run until they are due
+	err = jobQueue.AddJobIn("noop", "{}", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	if run := jobQueue.RunDueJobs(); run != 0 {
+		t.Errorf("Expected no jobs to be due, %d were run", run)
+	}
+	if delayed := jobQueue.JobsOfType("noop"); len(delayed) != 1 || delayed[0].Status != db.JobStatusPending {
+		t.Errorf("Expected delayed job to be pending")
+	}
+
+	// Unregistered job types are rejected
+	err = jobQueue.AddJob("unregistered", "{}")
+	if !errors.Is(err, queue.ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType, got %v", err)
+	}
+}
+
+func TestMemoryQueue_AddJobUniqueKey(t *testing.T) {
+	jobQueue := queue.NewMemoryQueue(&helpers.EmailMock{})
+	opts := queue.JobOptions{UniqueKey: "noop:1"}
+
+	// The key is held while the job hasn't been run
+	if err := jobQueue.AddJobWithOptions("noop", "{}", opts); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	err := jobQueue.AddJobWithOptions("noop", "{}", opts)
+	if !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+
+	// The key is released once the job has been processed
+	if run := jobQueue.RunDueJobs(); run != 1 {
+		t.Fatalf("Expected 1 job to be run, %d were run", run)
+	}
+	if err := jobQueue.AddJobWithOptions("noop", "{}", opts); err != nil {
+		t.Errorf("Expected key to be released, got %v", err)
+	}
+
+	// A key held for a window isn't released when the job is processed
+	windowOpts := queue.JobOptions{UniqueKey: "noop:2", UniqueFor: time.Hour}
+	if err := jobQueue.AddJobWithOptions("noop", "{}", windowOpts); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	jobQueue.RunDueJobs()
+	err = jobQueue.AddJobWithOptions("noop", "{}", windowOpts)
+	if !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+}
+
+func TestMemoryQueue_ChainsAndBatches(t *testing.T) {
+	jobQueue := queue.NewMemoryQueue(&helpers.EmailMock{})
+
+	err := jobQueue.AddChain(
+		queue.NewJob{JobType: "noop", Payload: `{"step":"1"}`},
+		queue.NewJob{JobType: "noop", Payload: `{"step":"2"}`},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add chain: %v", err)
+	}
+	// Only the first job of the chain is due
+	jobs := jobQueue.JobsOfType("noop")
+	if jobs[0].Status != db.JobStatusPending || jobs[1].Status != db.JobStatusWaiting {
+		t.Errorf("Expected statuses pending and waiting, got %s and %s", jobs[0].Status, jobs[1].Status)
+	}
+
+	batch, err := jobQueue.AddBatch(
+		[]queue.NewJob{{JobType: "noop", Payload: "{}"}, {JobType: "noop", Payload: "{}"}},
+		queue.NewJob{JobType: "batch-done", Payload: `{"import_id":1}`},
+	)
+	if err != nil {
+		t.Fatalf("Failed to add batch: %v", err)
+	}
+
+	// Run everything, including the released chain job and the batch callback
+	if run := jobQueue.RunDueJobs(); run != 5 {
+		t.Errorf("Expected 5 jobs to be run, %d were run", run)
+	}
+	for _, job := range jobQueue.Jobs() {
+		if job.Status != db.JobStatusProcessed {
+			t.Errorf("Expected job %d to be processed, got %s", job.ID, job.Status)
+		}
+	}
+
+	// The callback should receive the batch's results
+	callbacks := jobQueue.JobsOfType("batch-done")
+	if len(callbacks) != 1 {
+		t.Fatalf("Expected 1 batch callback job, got %d", len(callbacks))
+	}
+	var completion queue.BatchCompletion
+	if err := json.Unmarshal([]byte(callbacks[0].Payload), &completion); err != nil {
+		t.Fatalf("Failed to decode batch completion: %v", err)
+	}
+	if completion.BatchID != batch.ID || completion.Processed != 2 || completion.Failed != 0 || string(completion.Payload) != `{"import_id":1}` {
+		t.Errorf("Unexpected batch completion: %+v", completion)
+	}
+}
+
+func TestMemoryQueue_Workers(t *testing.T) {
+	jobQueue := queue.NewMemoryQueue(&helpers.EmailMock{})
+	ctx, cancel := context.WithCancel(context.Background())
+	jobQueue.StartWorkers(ctx)
+
+	// Workers are woken as soon as a job is added
+	if err := jobQueue.AddJob("noop", "{}"); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for jobQueue.Jobs()[0].Status != db.JobStatusProcessed {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected job to be processed by a worker")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Workers stop once the context is cancelled
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel()
+	if err := jobQueue.Wait(waitCtx); err != nil {
+		t.Errorf("Expected workers to stop, got %v", err)
+	}
+}
@@ -1,19 +1,119 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Number of attempts a job is given before it is marked as dead
+const DefaultMaxAttempts = 5
+
+// Retry backoff settings. The delay doubles after each failed attempt
+// starting from baseRetryDelay and never exceeds maxRetryDelay
+const (
+	baseRetryDelay = 5 * time.Second
+	maxRetryDelay  = 1 * time.Hour
+)
+
+// Named queues
+const (
+	// Queue used for jobs that aren't assigned to a named queue
+	DefaultQueue = db.DefaultJobQueue
+	// Queue for time sensitive jobs (eg. password reset emails)
+	HighPriorityQueue = "high"
+)
+
+// Job priorities. Jobs with a higher priority are run first within their queue
+const (
+	PriorityLow    = -10
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// Worker settings
+const (
+	// Number of workers started when no concurrency is configured
+	DefaultConcurrency = 1
+	// How long a worker waits before checking for jobs again when none are due
+	DefaultPollInterval = 5 * time.Second
+	// How long a claimed job is leased to a worker before it can be released by the reaper
+	DefaultLeaseDuration = 5 * time.Minute
+	// Shortest lease accepted (leases are checked and renewed at a fraction of their duration)
+	MinLeaseDuration = 10 * time.Millisecond
+)
+
+// Returned when a worker tries to update a job it no longer holds the lease for
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Returned when a job is added with a unique key that is held by another job
+var ErrDuplicateJob = errors.New("job with the same unique key already exists")
+
+// Statuses of jobs that will not be run again (unless retried from the admin panel)
+var finishedJobStatuses = []string{db.JobStatusProcessed, db.JobStatusDead, db.JobStatusCancelled}
+
+// JobQueue is implemented by the job queues jobs can be added to.
+// Queue (backed by the database) is used in production. MemoryQueue keeps jobs in memory
+// and is used in tests and lightweight deployments.
+type JobQueue interface {
+	// Adding jobs
+	AddJob(jobType, payload string) error
+	AddJobIn(jobType, payload string, delay time.Duration) error
+	AddJobAt(jobType, payload string, runAt time.Time) error
+	AddJobWithOptions(jobType, payload string, opts JobOptions) error
+	AddChain(jobs ...NewJob) error
+	AddBatch(jobs []NewJob, callback NewJob) (*db.JobBatch, error)
+	// Checks if a handler has been registered for a job type
+	IsRegistered(jobType string) bool
+	// Sets the logger recording the delivery of emails sent by email jobs
+	SetEmailLogger(logger EmailLogger)
+	// Sets the list of addresses that mustn't receive non-transactional emails
+	SetSuppressionList(list SuppressionList)
+	// Running jobs (see Queue.StartWorkers)
+	StartWorkers(ctx context.Context, subscriptions ...Subscription)
+	Wait(ctx context.Context) error
+}
+
+// Ensure both queues implement JobQueue
+var (
+	_ JobQueue = (*Queue)(nil)
+	_ JobQueue = (*MemoryQueue)(nil)
 )
 
 // Queue represents a job queue backed by a SQL database.
+// Jobs are claimed using row level locks and leases, so multiple workers and
+// multiple instances of the app can safely share the same jobs table.
 type Queue struct {
-	db          *gorm.DB   // Database connection
-	mu          sync.Mutex // Mutex for synchronizing access
-	cond        *sync.Cond // Condition variable for signaling
+	db          *gorm.DB // Database connection
 	mailService email.Email
+	// Records the delivery of emails (optional, see SetEmailLogger)
+	emailLogger EmailLogger
+	// Addresses that mustn't receive non-transactional emails (optional, see SetSuppressionList)
+	suppressionList SuppressionList
+	// Handlers built into the queue (job type => handler)
+	handlers map[string]builtInHandler
+	// Idle workers waiting to be woken when a job is added to one of their queues
+	subscribersMu sync.RWMutex
+	subscribers   []*subscriber
+	// Worker settings
+	pollInterval      time.Duration
+	leaseDuration     time.Duration
+	schedulerInterval time.Duration
+	// Identifies this queue instance in job leases
+	instanceID string
+	claims     atomic.Uint64
+	// Tracks the running workers, reaper and scheduler (used for graceful shutdown)
+	running sync.WaitGroup
 }
 
 // Class method for creating a new job queue
@@ -21,59 +121,439 @@ type Queue struct {
 func NewQueue(db *gorm.DB, mailService email.Email) *Queue {
 	// Create the queue
 	q := &Queue{
-		db:          db,
-		mailService: mailService,
+		db:                db,
+		mailService:       mailService,
+		pollInterval:      DefaultPollInterval,
+		leaseDuration:     DefaultLeaseDuration,
+		schedulerInterval: DefaultSchedulerInterval,
+		instanceID:        buildInstanceID(),
+	}
+	// Register built in handlers
+	q.handlers = map[string]builtInHandler{
+		EmailJobType:     q.processEmailJob,
+		PurgeJobsJobType: q.processPurgeJobsJob,
 	}
-	// Initialize the mutex and condition variable
-	q.cond = sync.NewCond(&q.mu)
 	return q
 }
 
-// AddJob adds a new job to the queue.
+// SetLeaseDuration sets how long claimed jobs are leased to a worker before the reaper can release them.
+// Leases are renewed while jobs run, so this only limits how long a crashed worker holds its job.
+// Returns an error (keeping the current duration) if the duration is shorter than MinLeaseDuration.
+// Must be called before workers are started
+func (q *Queue) SetLeaseDuration(duration time.Duration) error {
+	if duration < MinLeaseDuration {
+		return fmt.Errorf("invalid lease duration %s: must be at least %s", duration, MinLeaseDuration)
+	}
+	q.leaseDuration = duration
+	return nil
+}
+
+// JobOptions are used to control how and when a job is run
+type JobOptions struct {
+	// Named queue to add the job to (default: DefaultQueue)
+	Queue string
+	// Jobs with a higher priority are run first within their queue (default: PriorityNormal)
+	Priority int
+	// Job will not be run before this time (default: now)
+	RunAt time.Time
+	// Prevents duplicate jobs. While a job holds the key, adding another job
+	// with the same key returns ErrDuplicateJob (only supported for single jobs)
+	UniqueKey string
+	// How long the key is held from when the job is added.
+	// If not set, the key is held until the job is processed, dies or is cancelled
+	UniqueFor time.Duration
+}
+
+// AddJob adds a new job to the default queue to be run as soon as possible.
 // The jobType is a string that identifies the type of job.
 // The payload is a string that contains the job data.
+// Returns ErrUnknownJobType if no handler is registered for the job type.
 func (q *Queue) AddJob(jobType, payload string) error {
-	// Lock the queue
-	q.mu.Lock()
-	// Unlock the queue when the function returns
-	defer q.mu.Unlock()
+	return q.AddJobWithOptions(jobType, payload, JobOptions{})
+}
 
-	// Create a new job
-	job := db.Job{
-		JobType: jobType,
-		Payload: payload,
+// AddJobIn adds a new job to the default queue to be run after the given delay.
+// Example usage: q.AddJobIn(queue.EmailJobType, payload, 24*time.Hour)
+func (q *Queue) AddJobIn(jobType, payload string, delay time.Duration) error {
+	return q.AddJobWithOptions(jobType, payload, JobOptions{RunAt: time.Now().Add(delay)})
+}
+
+// AddJobAt adds a new job to the default queue to be run at (or after) the given time.
+func (q *Queue) AddJobAt(jobType, payload string, runAt time.Time) error {
+	return q.AddJobWithOptions(jobType, payload, JobOptions{RunAt: runAt})
+}
+
+// AddJobWithOptions adds a new job to the queue using the given options.
+// Example usage: q.AddJobWithOptions(queue.EmailJobType, payload, queue.JobOptions{Queue: queue.HighPriorityQueue, Priority: queue.PriorityHigh})
+// Returns ErrUnknownJobType if no handler is registered for the job type and
+// ErrDuplicateJob if the job's unique key is held by another job.
+func (q *Queue) AddJobWithOptions(jobType, payload string, opts JobOptions) error {
+	job, err := buildJob(q.IsRegistered, jobType, payload, opts)
+	if err != nil {
+		return err
 	}
 
 	// Store the job in the database
-	if err := q.db.Create(&job).Error; err != nil {
+	if opts.UniqueKey != "" {
+		err = q.createUniqueJob(job, opts.UniqueKey, opts.UniqueFor)
+	} else {
+		err = q.db.Create(job).Error
+	}
+	if err != nil {
 		return err
 	}
-	q.cond.Signal() // Signal any waiting workers that a job is available
+	// Wake the idle workers of the job's queue so a due job is picked up straight away
+	q.notifyIfDue(job)
 	return nil
 }
 
-// GetJob retrieves the next unprocessed job from the queue.
-func (q *Queue) GetJob() (*db.Job, error) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// Builds a pending job using the given options. Returns ErrUnknownJobType if no handler is registered for the job type
+func buildJob(isRegistered func(jobType string) bool, jobType, payload string, opts JobOptions) (*db.Job, error) {
+	// Refuse jobs that could never be processed
+	if !isRegistered(jobType) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+	// Apply defaults
+	if opts.Queue == "" {
+		opts.Queue = DefaultQueue
+	}
+	if opts.RunAt.IsZero() {
+		opts.RunAt = time.Now()
+	}
+
+	// Create a new job
+	return &db.Job{
+		JobType:     jobType,
+		Payload:     payload,
+		Status:      db.JobStatusPending,
+		MaxAttempts: DefaultMaxAttempts,
+		RunAt:       opts.RunAt,
+		Queue:       opts.Queue,
+		Priority:    opts.Priority,
+	}, nil
+}
+
+// Stores a job holding the given unique key. Returns ErrDuplicateJob if the key is held by another job.
+// The unique index on the key ensures only one job is stored, even when jobs are added concurrently
+func (q *Queue) createUniqueJob(job *db.Job, uniqueKey string, uniqueFor time.Duration) error {
+	now := time.Now()
+	job.UniqueKey = &uniqueKey
+	if uniqueFor > 0 {
+		uniqueUntil := now.Add(uniqueFor)
+		job.UniqueUntil = &uniqueUntil
+	}
 
+	// Release the key from a job whose hold has ended (window passed, job finished or deleted)
+	err := q.db.Unscoped().Model(&db.Job{}).
+		Where("unique_key = ?", uniqueKey).
+		Where("(unique_until IS NOT NULL AND unique_until <= ?) OR (unique_until IS NULL AND status IN ?) OR deleted_at IS NOT NULL", now, finishedJobStatuses).
+		Update("unique_key", nil).Error
+	if err != nil {
+		return fmt.Errorf("failed releasing unique key %s: %w", uniqueKey, err)
+	}
+
+	// Check if the key is still held
+	held, err := q.uniqueKeyHeld(uniqueKey)
+	if err != nil {
+		return err
+	}
+	if held {
+		return ErrDuplicateJob
+	}
+
+	// Store the job. Fails on the unique index if another job has taken the key in the meantime
+	if err := q.db.Create(job).Error; err != nil {
+		if held, heldErr := q.uniqueKeyHeld(uniqueKey); heldErr == nil && held {
+			return ErrDuplicateJob
+		}
+		return err
+	}
+	return nil
+}
+
+// Checks if a job holds the given unique key
+func (q *Queue) uniqueKeyHeld(uniqueKey string) (bool, error) {
+	var count int64
+	err := q.db.Unscoped().Model(&db.Job{}).Where("unique_key = ?", uniqueKey).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Wakes the idle workers of the job's queue if the job is due
+func (q *Queue) notifyIfDue(job *db.Job) {
+	if job.Status == db.JobStatusPending && !job.RunAt.After(time.Now()) {
+		q.notify(job.Queue)
+	}
+}
+
+// GetJob claims the next job that is due to run from the given queues (or any queue if none are given).
+// Pending jobs whose run time has passed and failed jobs whose retry time has passed are eligible.
+// Jobs with the highest priority are claimed first, followed by the jobs that have been waiting the longest.
+// The claimed job is marked as running and leased to the caller until the lease expires.
+func (q *Queue) GetJob(queues ...string) (*db.Job, error) {
 	var job db.Job
-	// Fetch the first unprocessed job from the database
-	if err := q.db.Where("processed = ?", false).First(&job).Error; err != nil {
+	err := q.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("processed = ? AND status IN ?", false, []string{db.JobStatusPending, db.JobStatusFailed}).
+			Where("run_at IS NULL OR run_at <= ?", now).
+			Where("next_run_at IS NULL OR next_run_at <= ?", now)
+		// Limit to the subscribed queues
+		if len(queues) > 0 {
+			query = query.Where("queue IN ?", queues)
+		}
+
+		// Lock the next job, skipping jobs locked by other workers
+		err := query.Order("priority desc, next_run_at asc, id asc").First(&job).Error
+		if err != nil {
+			return err
+		}
+
+		// Take out a lease on the job
+		lockedUntil := time.Now().Add(q.leaseDuration)
+		job.Status = db.JobStatusRunning
+		job.LockedBy = q.newClaimToken()
+		job.LockedUntil = &lockedUntil
+		return tx.Model(&job).Select("status", "locked_by", "locked_until").Updates(&job).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return &job, nil
 }
 
-// MarkJobAsProcessed marks a job as processed in the database.
-func (q *Queue) MarkJobAsProcessed(job *db.Job) error {
-	// Lock the queue
-	q.mu.Lock()
-	defer q.mu.Unlock()
+// RenewLease extends the lease on a claimed job by the lease duration.
+// Workers renew the lease of the job they're processing automatically.
+// Returns ErrLeaseLost if the job's lease has been released since it was claimed.
+func (q *Queue) RenewLease(job *db.Job) error {
+	lockedUntil, err := q.renewLease(job.ID, job.LockedBy)
+	if err != nil {
+		return err
+	}
+	job.LockedUntil = &lockedUntil
+	return nil
+}
+
+// Extends the lease on a job. The update only applies if the job is still held under the same lease
+func (q *Queue) renewLease(jobID uint, lockedBy string) (time.Time, error) {
+	lockedUntil := time.Now().Add(q.leaseDuration)
+	result := q.db.Model(&db.Job{}).
+		Where("id = ? AND locked_by = ? AND status = ?", jobID, lockedBy, db.JobStatusRunning).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return time.Time{}, ErrLeaseLost
+	}
+	return lockedUntil, nil
+}
 
+// MarkJobAsProcessed marks a job as processed in the database and redacts the sensitive fields of its payload.
+// Jobs waiting on it in a chain are released and its batch is completed if it was the last job.
+// Returns ErrLeaseLost if the job's lease has been released since it was claimed.
+func (q *Queue) MarkJobAsProcessed(job *db.Job) error {
 	// Mark the job as processed
+	recordSuccess(job)
+	// Update the job in the database, releasing the lease
+	if err := q.saveAndRelease(job); err != nil {
+		return err
+	}
+	return q.jobFinished(job)
+}
+
+// MarkJobAsFailed records a failed attempt for a job.
+// The job is scheduled for a retry with exponential backoff, or marked as dead
+// if it has run out of attempts (cancelling the jobs waiting on it in a chain).
+// Returns ErrLeaseLost if the job's lease has been released since it was claimed.
+func (q *Queue) MarkJobAsFailed(job *db.Job, jobErr error) error {
+	recordFailure(job, jobErr)
+	// Update the job in the database, releasing the lease
+	if err := q.saveAndRelease(job); err != nil {
+		return err
+	}
+	return q.jobFinished(job)
+}
+
+// ReleaseExpiredLeases releases running jobs whose lease has expired
+// (eg. the worker processing them crashed or the instance was stopped).
+// The interrupted run is counted as a failed attempt. Returns the number of jobs released.
+func (q *Queue) ReleaseExpiredLeases() (int, error) {
+	var expired []db.Job
+	// Find running jobs with an expired lease, skipping any being released by another instance
+	err := q.db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND locked_until < ?", db.JobStatusRunning, time.Now()).
+		Find(&expired).Error
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range expired {
+		job := &expired[i]
+		recordFailure(job, errors.New("job lease expired before the job was completed"))
+		// Skip jobs that were completed or claimed again in the meantime
+		if err := q.saveAndRelease(job); err != nil {
+			if errors.Is(err, ErrLeaseLost) {
+				continue
+			}
+			return released, err
+		}
+		released++
+		if err := q.jobFinished(job); err != nil {
+			return released, err
+		}
+	}
+	// Wake the workers to pick up the released jobs
+	if released > 0 {
+		q.notifyAll()
+	}
+	return released, nil
+}
+
+// Saves the job's progress and releases its lease.
+// The update only applies if the job is still held under the same lease
+func (q *Queue) saveAndRelease(job *db.Job) error {
+	lockedBy := job.LockedBy
+	job.LockedBy = ""
+	job.LockedUntil = nil
+
+	result := q.db.Model(&db.Job{}).
+		Where("id = ? AND locked_by = ?", job.ID, lockedBy).
+		Select("attempts", "processed", "processed_at", "payload", "status", "last_error", "next_run_at", "locked_by", "locked_until").
+		Updates(job)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Records a successful attempt on the job, redacting the sensitive fields of its payload
+func recordSuccess(job *db.Job) {
+	processedAt := time.Now()
+	job.Attempts++
 	job.Processed = true
-	job.Status = "processed"
-	// Update the job in the database, returning any error
-	return q.db.Save(job).Error
+	job.ProcessedAt = &processedAt
+	job.Status = db.JobStatusProcessed
+	job.LastError = ""
+	redactPayload(job)
+}
+
+// Records a failed attempt on the job, scheduling a retry or marking it as dead (redacting its payload)
+func recordFailure(job *db.Job, jobErr error) {
+	// Record the attempt
+	job.Attempts++
+	job.LastError = jobErr.Error()
+
+	// Jobs created before retries were tracked have no limit set
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	// If out of attempts, move to the terminal dead state (the sensitive fields aren't kept once the job won't run again)
+	if job.Attempts >= maxAttempts {
+		job.Status = db.JobStatusDead
+		redactPayload(job)
+	} else {
+		// Else, schedule the next attempt
+		job.Status = db.JobStatusFailed
+		job.NextRunAt = time.Now().Add(retryDelay(job.Attempts))
+	}
+}
+
+// Calculates the delay before the next attempt based on the number of attempts made
+func retryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		// Stop doubling once the cap is reached
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// An idle worker waiting for jobs on its queues
+type subscriber struct {
+	// Queues the worker is subscribed to (all queues if empty)
+	queues []string
+	wake   chan struct{}
+}
+
+// Registers a worker waiting on the given queues. Returns the channel used to wake it
+func (q *Queue) subscribe(queues []string) *subscriber {
+	sub := &subscriber{queues: queues, wake: make(chan struct{}, 1)}
+	q.subscribersMu.Lock()
+	defer q.subscribersMu.Unlock()
+
+	q.subscribers = append(q.subscribers, sub)
+	return sub
+}
+
+// Removes a worker's subscription (once the worker has stopped)
+func (q *Queue) unsubscribe(sub *subscriber) {
+	q.subscribersMu.Lock()
+	defer q.subscribersMu.Unlock()
+
+	for i, existing := range q.subscribers {
+		if existing == sub {
+			q.subscribers = append(q.subscribers[:i], q.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Wakes the idle workers subscribed to a queue without blocking
+func (q *Queue) notify(queueName string) {
+	q.subscribersMu.RLock()
+	defer q.subscribersMu.RUnlock()
+
+	for _, sub := range q.subscribers {
+		if len(sub.queues) == 0 || utility.ArrayContainsString(sub.queues, queueName) {
+			sub.wakeUp()
+		}
+	}
+}
+
+// Wakes all idle workers without blocking
+func (q *Queue) notifyAll() {
+	q.subscribersMu.RLock()
+	defer q.subscribersMu.RUnlock()
+
+	for _, sub := range q.subscribers {
+		sub.wakeUp()
+	}
+}
+
+// Wakes the worker if it isn't already due to wake
+func (sub *subscriber) wakeUp() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Builds a token that uniquely identifies a single job claim
+func (q *Queue) newClaimToken() string {
+	return fmt.Sprintf("%s:%d", q.instanceID, q.claims.Add(1))
+}
+
+// Builds an ID for this queue instance (hostname, process ID and a random suffix)
+func buildInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	suffix, err := utility.GenerateRandomString(6)
+	if err != nil {
+		suffix = fmt.Sprint(time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), suffix)
 }
@@ -0,0 +1,611 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	"gorm.io/gorm"
+)
+
+// Signals that a slow job has started
+var slowJobStarted = make(chan struct{}, 1)
+
+// Counts the runs of long jobs
+var longJobRuns atomic.Int32
+
+// Handler used for jobs that always fail
+func init() {
+	queue.Register("failing", func(payload map[string]string) error {
+		return errors.New("job failed")
+	})
+	// Handler used for jobs that outlast the lease in TestQueue_WorkerRenewsLease
+	queue.Register("long", func(payload map[string]string) error {
+		longJobRuns.Add(1)
+		time.Sleep(300 * time.Millisecond)
+		return nil
+	})
+	// Handler used for jobs that take a while to process
+	queue.Register("slow", func(payload map[string]string) error {
+		slowJobStarted <- struct{}{}
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+}
+
+func TestQueue_MarkJobAsFailed(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Add a job that can never be processed
+	err := jobQueue.AddJob("failing", "{}")
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	job, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.MaxAttempts != queue.DefaultMaxAttempts {
+		t.Errorf("Expected max attempts of %d, got %d", queue.DefaultMaxAttempts, job.MaxAttempts)
+	}
+
+	// Fail the first attempt
+	processErr := jobQueue.ProcessJob(job.JobType, job.Payload)
+	if processErr == nil {
+		t.Fatalf("Expected failing job to fail")
+	}
+	err = jobQueue.MarkJobAsFailed(job, processErr)
+	if err != nil {
+		t.Fatalf("Failed to mark job as failed: %v", err)
+	}
+
+	// Check the failure was recorded and the job backed off
+	stored := db.Job{}
+	client.First(&stored, job.ID)
+	if stored.Status != db.JobStatusFailed {
+		t.Errorf("Expected status %s, got %s", db.JobStatusFailed, stored.Status)
+	}
+	if stored.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", stored.Attempts)
+	}
+	if stored.LastError != processErr.Error() {
+		t.Errorf("Expected last error %q, got %q", processErr.Error(), stored.LastError)
+	}
+	if !stored.NextRunAt.After(time.Now()) {
+		t.Errorf("Expected next run to be in the future, got %v", stored.NextRunAt)
+	}
+
+	// The job should not be picked up again until it is due
+	_, err = jobQueue.GetJob()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected no due jobs, got %v", err)
+	}
+
+	// Exhaust the remaining attempts
+	for stored.Attempts < stored.MaxAttempts {
+		err = jobQueue.MarkJobAsFailed(&stored, processErr)
+		if err != nil {
+			t.Fatalf("Failed to mark job as failed: %v", err)
+		}
+	}
+	if stored.Status != db.JobStatusDead {
+		t.Errorf("Expected status %s, got %s", db.JobStatusDead, stored.Status)
+	}
+}
+
+func TestQueue_GetJobSkipsBlockedJob(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Add a failing job followed by a valid one
+	jobQueue.AddJob("failing", "{}")
+	jobQueue.AddJob(queue.EmailJobType, `{"Recipient":"test@example.com","Subject":"Hello","Body":"Hi"}`)
+
+	// Fail the first job
+	first, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	jobQueue.MarkJobAsFailed(first, errors.New("job failed"))
+
+	// The next job should be the email job
+	second, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if second.JobType != queue.EmailJobType {
+		t.Errorf("Expected email job, got %s", second.JobType)
+	}
+}
+
+func TestQueue_AddJobUnknownType(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Jobs without a handler should be refused at enqueue time
+	err := jobQueue.AddJob("not-registered", "{}")
+	if !errors.Is(err, queue.ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType, got %v", err)
+	}
+	var count int64
+	client.Model(&db.Job{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no jobs to be stored, found %d", count)
+	}
+}
+
+func TestQueue_Register(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	type thumbnailPayload struct {
+		ImageID int
+		Width   int
+	}
+	// Register a typed handler
+	var received thumbnailPayload
+	queue.Register("thumbnail", func(payload thumbnailPayload) error {
+		received = payload
+		return nil
+	})
+
+	// Payload should be decoded into the handler's type
+	err := jobQueue.ProcessJob("thumbnail", `{"ImageID":4,"Width":200}`)
+	if err != nil {
+		t.Fatalf("Failed to process job: %v", err)
+	}
+	if received.ImageID != 4 || received.Width != 200 {
+		t.Errorf("Expected decoded payload, got %+v", received)
+	}
+
+	// Payloads that can't be decoded should return an error
+	err = jobQueue.ProcessJob("thumbnail", "not json")
+	if err == nil {
+		t.Errorf("Expected error decoding invalid payload")
+	}
+}
+
+func TestQueue_GetJobClaimsLease(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	jobQueue.AddJob("failing", "{}")
+	jobQueue.AddJob("failing", "{}")
+
+	// Two claims should never return the same job
+	first, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	second, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Errorf("Expected different jobs, both claims returned job %d", first.ID)
+	}
+
+	// Claimed jobs should be marked as running and leased
+	stored := db.Job{}
+	client.First(&stored, first.ID)
+	if stored.Status != db.JobStatusRunning {
+		t.Errorf("Expected status %s, got %s", db.JobStatusRunning, stored.Status)
+	}
+	if stored.LockedBy == "" || stored.LockedUntil == nil || !stored.LockedUntil.After(time.Now()) {
+		t.Errorf("Expected job to be leased, got locked by %q until %v", stored.LockedBy, stored.LockedUntil)
+	}
+
+	// No jobs should be left to claim
+	_, err = jobQueue.GetJob()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected no jobs to claim, got %v", err)
+	}
+
+	// Completing the job should release the lease
+	err = jobQueue.MarkJobAsProcessed(first)
+	if err != nil {
+		t.Fatalf("Failed to mark job as processed: %v", err)
+	}
+	stored = db.Job{}
+	client.First(&stored, first.ID)
+	if stored.Status != db.JobStatusProcessed || stored.LockedBy != "" || stored.LockedUntil != nil {
+		t.Errorf("Expected processed job with no lease, got %+v", stored)
+	}
+}
+
+func TestQueue_ReleaseExpiredLeases(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	jobQueue.AddJob("failing", "{}")
+	job, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	// Leases that haven't expired should be left alone
+	released, err := jobQueue.ReleaseExpiredLeases()
+	if err != nil || released != 0 {
+		t.Fatalf("Expected no leases to be released, got %d (%v)", released, err)
+	}
+
+	// Expire the lease (as if the worker had crashed)
+	client.Model(&db.Job{}).Where("id = ?", job.ID).Update("locked_until", time.Now().Add(-time.Minute))
+	released, err = jobQueue.ReleaseExpiredLeases()
+	if err != nil || released != 1 {
+		t.Fatalf("Expected 1 lease to be released, got %d (%v)", released, err)
+	}
+
+	// The interrupted run should count as a failed attempt
+	stored := db.Job{}
+	client.First(&stored, job.ID)
+	if stored.Status != db.JobStatusFailed {
+		t.Errorf("Expected status %s, got %s", db.JobStatusFailed, stored.Status)
+	}
+	if stored.Attempts != 1 || stored.LockedBy != "" || stored.LockedUntil != nil {
+		t.Errorf("Expected 1 attempt and no lease, got %+v", stored)
+	}
+
+	// The original worker no longer holds the lease
+	err = jobQueue.MarkJobAsProcessed(job)
+	if !errors.Is(err, queue.ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestQueue_RenewLease(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	jobQueue.AddJob("failing", "{}")
+	job, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+
+	// Renewing a lease that is about to expire keeps it from being released
+	client.Model(&db.Job{}).Where("id = ?", job.ID).Update("locked_until", time.Now().Add(time.Second))
+	err = jobQueue.RenewLease(job)
+	if err != nil {
+		t.Fatalf("Failed to renew lease: %v", err)
+	}
+	stored := db.Job{}
+	client.First(&stored, job.ID)
+	if stored.LockedUntil == nil || !stored.LockedUntil.After(time.Now().Add(time.Minute)) {
+		t.Errorf("Expected lease to be extended, got %v", stored.LockedUntil)
+	}
+
+	// Once released, the lease can't be renewed
+	client.Model(&db.Job{}).Where("id = ?", job.ID).Update("locked_until", time.Now().Add(-time.Minute))
+	released, err := jobQueue.ReleaseExpiredLeases()
+	if err != nil || released != 1 {
+		t.Fatalf("Expected 1 lease to be released, got %d (%v)", released, err)
+	}
+	err = jobQueue.RenewLease(job)
+	if !errors.Is(err, queue.ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestQueue_SetLeaseDuration(t *testing.T) {
+	jobQueue := queue.NewQueue(helpers.SetupTestDatabase(), &helpers.EmailMock{})
+
+	var tests = []struct {
+		duration time.Duration
+		valid    bool
+	}{
+		{queue.DefaultLeaseDuration, true},
+		{queue.MinLeaseDuration, true},
+		// The reaper and lease renewal tickers can't run at a fraction of these
+		{0, false},
+		{-time.Minute, false},
+		{time.Nanosecond, false},
+	}
+	for _, v := range tests {
+		if err := jobQueue.SetLeaseDuration(v.duration); (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.duration, v.valid, err)
+		}
+	}
+
+	// Invalid durations keep the previous lease, so workers still start
+	ctx, cancel := context.WithCancel(context.Background())
+	jobQueue.StartWorkers(ctx)
+	cancel()
+	if err := jobQueue.Wait(context.Background()); err != nil {
+		t.Errorf("Failed waiting for workers: %v", err)
+	}
+}
+
+func TestQueue_WorkerRenewsLease(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	// The job takes several lease durations, and the reaper runs every half lease
+	if err := jobQueue.SetLeaseDuration(60 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to set lease duration: %v", err)
+	}
+	longJobRuns.Store(0)
+
+	err := jobQueue.AddJob("long", "{}")
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobQueue.StartWorkers(ctx, queue.Subscription{Concurrency: 2})
+	// Wait for the job to be processed
+	stored := db.Job{}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		client.First(&stored)
+		if stored.Status == db.JobStatusProcessed {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	if err := jobQueue.Wait(waitCtx); err != nil {
+		t.Fatalf("Expected workers to stop, got %v", err)
+	}
+
+	// The lease should have been kept while the job ran, so it was run once and completed
+	client.First(&stored)
+	if stored.Status != db.JobStatusProcessed || stored.Attempts != 1 {
+		t.Errorf("Expected job processed in 1 attempt, got status %s after %d attempt(s) (%s)", stored.Status, stored.Attempts, stored.LastError)
+	}
+	if runs := longJobRuns.Load(); runs != 1 {
+		t.Errorf("Expected job to run once, ran %d times", runs)
+	}
+}
+
+func TestQueue_AddJobAt(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Schedule a job for the future
+	err := jobQueue.AddJobIn("failing", "{}", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	stored := db.Job{}
+	client.First(&stored)
+	if !stored.RunAt.After(time.Now().Add(23 * time.Hour)) {
+		t.Errorf("Expected job to run in 24 hours, got %v", stored.RunAt)
+	}
+
+	// The job should not be picked up until it is due
+	_, err = jobQueue.GetJob()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected no due jobs, got %v", err)
+	}
+
+	// Bring the job forward
+	client.Model(&db.Job{}).Where("id = ?", stored.ID).Updates(map[string]interface{}{
+		"run_at":      time.Now().Add(-time.Minute),
+		"next_run_at": time.Now().Add(-time.Minute),
+	})
+	job, err := jobQueue.GetJob()
+	if err != nil {
+		t.Fatalf("Expected due job to be claimed: %v", err)
+	}
+	if job.ID != stored.ID {
+		t.Errorf("Expected job %d, got %d", stored.ID, job.ID)
+	}
+
+	// Unknown job types should be refused
+	err = jobQueue.AddJobAt("not-registered", "{}", time.Now())
+	if !errors.Is(err, queue.ErrUnknownJobType) {
+		t.Errorf("Expected ErrUnknownJobType, got %v", err)
+	}
+}
+
+func TestQueue_EnqueueDueSchedules(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	// Two queues sharing the same database (as if on separate instances)
+	firstQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	secondQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	queue.RegisterSchedule(queue.Schedule{Name: "test-hourly", Spec: "@hourly", JobType: "failing", Payload: "{}"})
+	// Both instances sync the schedule on startup
+	for _, q := range []*queue.Queue{firstQueue, secondQueue} {
+		if err := q.SyncSchedules(); err != nil {
+			t.Fatalf("Failed to sync schedules: %v", err)
+		}
+	}
+	var schedule db.JobSchedule
+	client.Where("name = ?", "test-hourly").First(&schedule)
+	var count int64
+	client.Model(&db.JobSchedule{}).Where("name = ?", "test-hourly").Count(&count)
+	if count != 1 {
+		t.Fatalf("Expected schedule to be stored once, found %d", count)
+	}
+
+	// Nothing should be enqueued before the schedule is due
+	enqueued, err := firstQueue.EnqueueDueSchedules(time.Now())
+	if err != nil || enqueued != 0 {
+		t.Fatalf("Expected no jobs to be enqueued, got %d (%v)", enqueued, err)
+	}
+
+	// Once due, the run should be enqueued exactly once across both instances
+	due := schedule.NextRunAt.Add(time.Second)
+	total := 0
+	for _, q := range []*queue.Queue{firstQueue, secondQueue, firstQueue} {
+		enqueued, err := q.EnqueueDueSchedules(due)
+		if err != nil {
+			t.Fatalf("Failed to enqueue due schedules: %v", err)
+		}
+		total += enqueued
+	}
+	if total != 1 {
+		t.Errorf("Expected 1 job to be enqueued, got %d", total)
+	}
+
+	// The job should be scheduled for the run time and the schedule moved on
+	var job db.Job
+	client.Where("job_type = ?", "failing").First(&job)
+	if !job.RunAt.Equal(schedule.NextRunAt) {
+		t.Errorf("Expected job to run at %v, got %v", schedule.NextRunAt, job.RunAt)
+	}
+	var updated db.JobSchedule
+	client.First(&updated, schedule.ID)
+	if !updated.NextRunAt.Equal(schedule.NextRunAt.Add(time.Hour)) {
+		t.Errorf("Expected next run at %v, got %v", schedule.NextRunAt.Add(time.Hour), updated.NextRunAt)
+	}
+	if updated.LastRunAt == nil || !updated.LastRunAt.Equal(schedule.NextRunAt) {
+		t.Errorf("Expected last run at %v, got %v", schedule.NextRunAt, updated.LastRunAt)
+	}
+}
+
+func TestQueue_GetJobPriorityAndQueues(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Add jobs to separate queues with different priorities
+	jobQueue.AddJob("failing", `{"name":"normal"}`)
+	jobQueue.AddJobWithOptions("failing", `{"name":"low"}`, queue.JobOptions{Priority: queue.PriorityLow})
+	jobQueue.AddJobWithOptions("failing", `{"name":"high"}`, queue.JobOptions{Priority: queue.PriorityHigh})
+	jobQueue.AddJobWithOptions("failing", `{"name":"urgent"}`, queue.JobOptions{Queue: queue.HighPriorityQueue})
+
+	// Workers subscribed to a queue should only claim jobs from that queue
+	job, err := jobQueue.GetJob(queue.HighPriorityQueue)
+	if err != nil {
+		t.Fatalf("Failed to get job: %v", err)
+	}
+	if job.Payload != `{"name":"urgent"}` || job.Queue != queue.HighPriorityQueue {
+		t.Errorf("Expected urgent job from the %s queue, got %s from %s", queue.HighPriorityQueue, job.Payload, job.Queue)
+	}
+	_, err = jobQueue.GetJob(queue.HighPriorityQueue)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected no jobs left in the %s queue, got %v", queue.HighPriorityQueue, err)
+	}
+
+	// Jobs in the default queue should be claimed in priority order
+	for _, expected := range []string{`{"name":"high"}`, `{"name":"normal"}`, `{"name":"low"}`} {
+		job, err := jobQueue.GetJob(queue.DefaultQueue)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Payload != expected {
+			t.Errorf("Expected job %s, got %s", expected, job.Payload)
+		}
+	}
+}
+
+func TestParseSubscriptions(t *testing.T) {
+	var tests = []struct {
+		config   string
+		expected []queue.Subscription
+		valid    bool
+	}{
+		{"", nil, true},
+		{"4", []queue.Subscription{{Concurrency: 4}}, true},
+		{"high=4, default=2", []queue.Subscription{{Queues: []string{"high"}, Concurrency: 4}, {Queues: []string{"default"}, Concurrency: 2}}, true},
+		{"high=0", nil, false},
+		{"high=many", nil, false},
+	}
+
+	for _, v := range tests {
+		subscriptions, err := queue.ParseSubscriptions(v.config)
+		if (err == nil) != v.valid {
+			t.Errorf("%q: expected valid to be %t, got error %v", v.config, v.valid, err)
+			continue
+		}
+		if !reflect.DeepEqual(subscriptions, v.expected) {
+			t.Errorf("%q: expected %+v, got %+v", v.config, v.expected, subscriptions)
+		}
+	}
+}
+
+func TestQueue_WaitFinishesCurrentJob(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	err := jobQueue.AddJob("slow", "{}")
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+
+	// Start a worker and shut it down while the job is being processed
+	ctx, cancel := context.WithCancel(context.Background())
+	jobQueue.StartWorkers(ctx)
+	select {
+	case <-slowJobStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected worker to start the job")
+	}
+	cancel()
+
+	// Wait for the worker, reaper and scheduler to stop
+	waitCtx, cancelWait := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelWait()
+	err = jobQueue.Wait(waitCtx)
+	if err != nil {
+		t.Fatalf("Expected workers to stop, got %v", err)
+	}
+
+	// The job should have been finished before the worker stopped
+	stored := db.Job{}
+	client.First(&stored)
+	if stored.Status != db.JobStatusProcessed {
+		t.Errorf("Expected status %s, got %s", db.JobStatusProcessed, stored.Status)
+	}
+}
+
+func TestQueue_AddJobUniqueKey(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	// Key held for a window
+	opts := queue.JobOptions{UniqueKey: "report:1", UniqueFor: time.Hour}
+	err := jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	err = jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+	// Other keys aren't affected
+	err = jobQueue.AddJobWithOptions("failing", "{}", queue.JobOptions{UniqueKey: "report:2", UniqueFor: time.Hour})
+	if err != nil {
+		t.Errorf("Failed to add job with another key: %v", err)
+	}
+
+	// Once the window has passed, the key can be used again
+	client.Model(&db.Job{}).Where("unique_key = ?", "report:1").Update("unique_until", time.Now().Add(-time.Minute))
+	err = jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if err != nil {
+		t.Errorf("Expected key to be released after the window, got %v", err)
+	}
+
+	// Key held until the job has finished
+	opts = queue.JobOptions{UniqueKey: "sync"}
+	err = jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	err = jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if !errors.Is(err, queue.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+	client.Model(&db.Job{}).Where("unique_key = ?", "sync").Update("status", db.JobStatusProcessed)
+	err = jobQueue.AddJobWithOptions("failing", "{}", opts)
+	if err != nil {
+		t.Errorf("Expected key to be released once the job finished, got %v", err)
+	}
+
+	var count int64
+	client.Model(&db.Job{}).Count(&count)
+	if count != 5 {
+		t.Errorf("Expected 5 jobs, got %d", count)
+	}
+}
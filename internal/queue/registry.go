@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+)
+
+// Returned when a job type has no registered handler
+var ErrUnknownJobType = errors.New("unknown job type")
+
+// JobHandler pairs a job type with the function used to process its payload
+type JobHandler struct {
+	JobType string
+	Handle  func(payload string) error
+}
+
+// Handlers built into a queue are passed the job being processed
+type builtInHandler = func(job *db.Job) error
+
+// Registry of job handlers available to every queue (job type => handler)
+var registry = struct {
+	mu       sync.RWMutex
+	handlers map[string]func(payload string) error
+}{handlers: make(map[string]func(payload string) error)}
+
+// NewJobHandler builds a job handler for a job type.
+// The JSON payload of each job is decoded into T before being passed to the handler.
+// Example usage: queue.NewJobHandler("thumbnail", func(p ThumbnailPayload) error { ... })
+func NewJobHandler[T any](jobType string, handler func(T) error) JobHandler {
+	return JobHandler{
+		JobType: jobType,
+		Handle: func(payload string) error {
+			var decoded T
+			// Decode the payload into the handler's payload type
+			if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
+				return fmt.Errorf("failed decoding %s job payload: %w", jobType, err)
+			}
+			return handler(decoded)
+		},
+	}
+}
+
+// Register registers a typed handler for a job type.
+// Registering the same job type again replaces the previous handler.
+// Example usage: queue.Register("thumbnail", func(p ThumbnailPayload) error { ... })
+func Register[T any](jobType string, handler func(T) error) {
+	RegisterHandler(NewJobHandler(jobType, handler))
+}
+
+// RegisterHandler registers a prebuilt job handler (see NewJobHandler)
+func RegisterHandler(handler JobHandler) {
+	if handler.JobType == "" || handler.Handle == nil {
+		panic("queue: job handler requires a job type and a handle function")
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	registry.handlers[handler.JobType] = handler.Handle
+}
+
+// IsRegistered checks if a handler has been registered for a job type
+func (q *Queue) IsRegistered(jobType string) bool {
+	_, found := q.handlerFor(jobType)
+	return found
+}
+
+// Finds the handler for a job type. Handlers built into the queue take precedence
+func (q *Queue) handlerFor(jobType string) (builtInHandler, bool) {
+	if handler, found := q.handlers[jobType]; found {
+		return handler, true
+	}
+	return registeredHandler(jobType)
+}
+
+// Finds the handler registered for a job type (registered handlers are passed the job's payload)
+func registeredHandler(jobType string) (builtInHandler, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+
+	handler, found := registry.handlers[jobType]
+	if !found {
+		return nil, false
+	}
+	return func(job *db.Job) error { return handler(job.Payload) }, true
+}
@@ -0,0 +1,258 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+	"gorm.io/gorm"
+)
+
+// How long finished (processed, dead or cancelled) jobs are kept before being purged (unless set for the job type)
+const DefaultRetention = 7 * 24 * time.Hour
+
+// Value that replaces sensitive payload fields once a job has finished
+const RedactedValue = "[redacted]"
+
+// Job type used for purging finished jobs whose retention has passed
+const PurgeJobsJobType = "purge-jobs"
+
+// Recurring job that purges finished jobs every hour
+var PurgeJobsSchedule = Schedule{
+	Name:    "hourly-purge-jobs",
+	Spec:    "0 * * * *",
+	JobType: PurgeJobsJobType,
+	Payload: "{}",
+}
+
+// Retention sets how long finished jobs of a job type are kept before being purged.
+// A negative duration keeps them forever
+type Retention struct {
+	// Job type the retention applies to (all job types without their own retention if empty)
+	JobType string
+	KeepFor time.Duration
+}
+
+// Registry of retention periods and sensitive payload fields available to every queue
+var retention = struct {
+	mu sync.RWMutex
+	// Retention of job types without their own retention
+	defaultKeepFor time.Duration
+	// Job type => retention
+	keepFor map[string]time.Duration
+	// Job type => payload fields redacted once a job has finished
+	sensitiveFields map[string][]string
+}{
+	defaultKeepFor:  DefaultRetention,
+	keepFor:         make(map[string]time.Duration),
+	sensitiveFields: make(map[string][]string),
+}
+
+// Email bodies contain passwords and verification codes, and attachments can contain personal documents
+func init() {
+	RegisterSensitiveFields(EmailJobType, "HTMLBody", "TextBody", "Attachments", "Body")
+}
+
+// SetRetention sets how long finished jobs are kept, replacing any retention previously set for the same job types.
+// Example usage: queue.SetRetention(queue.Retention{KeepFor: 7 * 24 * time.Hour}, queue.Retention{JobType: queue.EmailJobType, KeepFor: 24 * time.Hour})
+func SetRetention(retentions ...Retention) {
+	retention.mu.Lock()
+	defer retention.mu.Unlock()
+
+	for _, r := range retentions {
+		if r.JobType == "" {
+			retention.defaultKeepFor = r.KeepFor
+			continue
+		}
+		retention.keepFor[r.JobType] = r.KeepFor
+	}
+}
+
+// ParseRetention parses retention periods from a comma separated list of jobType=duration pairs.
+// A duration on its own sets the retention of all job types without their own retention.
+// Example usage: queue.ParseRetention("168h,email=24h")
+func ParseRetention(config string) ([]Retention, error) {
+	var retentions []Retention
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Split job type from duration (if present)
+		jobType, duration, found := strings.Cut(entry, "=")
+		if !found {
+			jobType, duration = "", entry
+		}
+		keepFor, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return nil, fmt.Errorf("invalid job retention %q", entry)
+		}
+		retentions = append(retentions, Retention{JobType: strings.TrimSpace(jobType), KeepFor: keepFor})
+	}
+	return retentions, nil
+}
+
+// RegisterSensitiveFields registers payload fields of a job type that are redacted once a job has finished
+// (processed, dead or cancelled). Jobs that fail keep their payload until they run out of attempts, so they can be retried.
+// Example usage: queue.RegisterSensitiveFields("send-invoice", "CardNumber")
+func RegisterSensitiveFields(jobType string, fields ...string) {
+	retention.mu.Lock()
+	defer retention.mu.Unlock()
+
+	retention.sensitiveFields[jobType] = append(retention.sensitiveFields[jobType], fields...)
+}
+
+// Returns the retention of each job type with its own retention, along with the default retention
+func retentionPeriods() (map[string]time.Duration, time.Duration) {
+	retention.mu.RLock()
+	defer retention.mu.RUnlock()
+
+	keepFor := make(map[string]time.Duration, len(retention.keepFor))
+	for jobType, duration := range retention.keepFor {
+		keepFor[jobType] = duration
+	}
+	return keepFor, retention.defaultKeepFor
+}
+
+// Returns the retention of a job type
+func retentionFor(jobType string) time.Duration {
+	keepFor, defaultKeepFor := retentionPeriods()
+	if duration, found := keepFor[jobType]; found {
+		return duration
+	}
+	return defaultKeepFor
+}
+
+// Replaces the sensitive string fields of a job's payload with RedactedValue and clears its other sensitive fields.
+// Payloads that aren't JSON objects are left as they are
+func redactPayload(job *db.Job) {
+	retention.mu.RLock()
+	fields := retention.sensitiveFields[job.JobType]
+	retention.mu.RUnlock()
+	if len(fields) == 0 {
+		return
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return
+	}
+	redacted, _ := json.Marshal(RedactedValue)
+	for _, field := range fields {
+		value, found := payload[field]
+		if !found {
+			continue
+		}
+		// Other values (eg. attachments) are cleared so the payload still decodes into its type
+		if len(value) > 0 && value[0] == '"' {
+			payload[field] = redacted
+		} else {
+			payload[field] = json.RawMessage("null")
+		}
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	job.Payload = string(encoded)
+}
+
+// PurgeProcessedJobs permanently deletes finished (processed, dead or cancelled) jobs whose retention has passed at the given time,
+// along with finished batches older than the default retention. Returns the number of jobs deleted.
+func (q *Queue) PurgeProcessedJobs(now time.Time) (int64, error) {
+	keepFor, defaultKeepFor := retentionPeriods()
+	var purged int64
+
+	// Purge job types with their own retention
+	jobTypes := make([]string, 0, len(keepFor))
+	for jobType, duration := range keepFor {
+		jobTypes = append(jobTypes, jobType)
+		if duration < 0 {
+			continue
+		}
+		deleted, err := q.purgeJobs(now.Add(-duration), func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("job_type = ?", jobType)
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+	}
+
+	// Purge all other job types
+	if defaultKeepFor >= 0 {
+		deleted, err := q.purgeJobs(now.Add(-defaultKeepFor), func(tx *gorm.DB) *gorm.DB {
+			if len(jobTypes) > 0 {
+				return tx.Where("job_type NOT IN ?", jobTypes)
+			}
+			return tx
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += deleted
+
+		// Purge finished batches
+		err = q.db.Where("finished_at < ?", now.Add(-defaultKeepFor)).Delete(&db.JobBatch{}).Error
+		if err != nil {
+			return purged, fmt.Errorf("failed purging job batches: %w", err)
+		}
+	}
+	return purged, nil
+}
+
+// Processes the recurring purge jobs job
+func (q *Queue) processPurgeJobsJob(job *db.Job) error {
+	_, err := q.PurgeProcessedJobs(time.Now())
+	return err
+}
+
+// Permanently deletes the finished jobs (limited to the job types selected by the scope) that finished before the cutoff.
+// Dead and cancelled jobs (and jobs processed before processing times were recorded) use their last update instead
+func (q *Queue) purgeJobs(cutoff time.Time, jobTypes func(tx *gorm.DB) *gorm.DB) (int64, error) {
+	result := q.db.Unscoped().
+		Scopes(jobTypes).
+		Where("status IN ?", finishedJobStatuses).
+		Where("processed_at < ? OR (processed_at IS NULL AND updated_at < ?)", cutoff, cutoff).
+		Delete(&db.Job{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed purging finished jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// PurgeProcessedJobs removes finished (processed, dead or cancelled) jobs whose retention has passed at the given time,
+// along with finished batches older than the default retention. Returns the number of jobs removed.
+func (q *MemoryQueue) PurgeProcessedJobs(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	kept := make([]*db.Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		keepFor := retentionFor(job.JobType)
+		// Dead and cancelled jobs finished at their last update
+		finishedAt := job.UpdatedAt
+		if job.ProcessedAt != nil {
+			finishedAt = *job.ProcessedAt
+		}
+		if utility.ArrayContainsString(finishedJobStatuses, job.Status) && keepFor >= 0 && finishedAt.Before(now.Add(-keepFor)) {
+			continue
+		}
+		kept = append(kept, job)
+	}
+	purged := len(q.jobs) - len(kept)
+	q.jobs = kept
+
+	// Purge finished batches
+	_, defaultKeepFor := retentionPeriods()
+	for id, batch := range q.batches {
+		if defaultKeepFor >= 0 && batch.FinishedAt != nil && batch.FinishedAt.Before(now.Add(-defaultKeepFor)) {
+			delete(q.batches, id)
+		}
+	}
+	return purged
+}
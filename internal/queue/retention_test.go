@@ -0,0 +1,188 @@
+package queue_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers"
+	"github.com/dmawardi/Go-Template/internal/queue"
+)
+
+func TestQueue_MarkJobAsProcessedRedactsPayload(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+
+	err := jobQueue.AddJob(queue.EmailJobType, `{"Recipient":"test@example.com","Subject":"Password reset","Body":"Your new password is hunter2","Attachments":[{"Filename":"password.txt","Data":"aHVudGVyMg=="}]}`)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	job := runNextJob(t, jobQueue)
+	if err := jobQueue.MarkJobAsProcessed(job); err != nil {
+		t.Fatalf("Failed to mark job as processed: %v", err)
+	}
+
+	// The email body should be redacted, keeping the other fields
+	stored := db.Job{}
+	client.First(&stored, job.ID)
+	if strings.Contains(stored.Payload, "hunter2") || strings.Contains(stored.Payload, "aHVudGVyMg==") || !strings.Contains(stored.Payload, queue.RedactedValue) {
+		t.Errorf("Expected email body and attachments to be redacted, got %s", stored.Payload)
+	}
+	// The redacted payload can still be decoded
+	var payload queue.EmailJobPayload
+	if err := json.Unmarshal([]byte(stored.Payload), &payload); err != nil || len(payload.Attachments) != 0 {
+		t.Errorf("Expected redacted payload to decode without attachments, got %+v (%v)", payload, err)
+	}
+	if !strings.Contains(stored.Payload, "test@example.com") {
+		t.Errorf("Expected recipient to be kept, got %s", stored.Payload)
+	}
+	if stored.ProcessedAt == nil {
+		t.Errorf("Expected processed time to be recorded")
+	}
+}
+
+func TestQueue_FinishedJobsRedactPayload(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	const payload = `{"To":["test@example.com"],"Subject":"Verify","HTMLBody":"Your code is 123456"}`
+
+	// A job that runs out of attempts
+	if err := jobQueue.AddJob(queue.EmailJobType, payload); err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	dead := runNextJob(t, jobQueue)
+	dead.MaxAttempts = 1
+	if err := jobQueue.MarkJobAsFailed(dead, errors.New("mail server down")); err != nil {
+		t.Fatalf("Failed to mark job as failed: %v", err)
+	}
+	// A cancelled job, along with the rest of its chain
+	err := jobQueue.AddChain(queue.NewJob{JobType: queue.EmailJobType, Payload: payload}, queue.NewJob{JobType: queue.EmailJobType, Payload: payload})
+	if err != nil {
+		t.Fatalf("Failed to add chain: %v", err)
+	}
+	var chain []db.Job
+	client.Where("id > ?", dead.ID).Order("id").Find(&chain)
+	if _, err := jobQueue.CancelJobs([]uint{chain[0].ID}); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+
+	for _, id := range []uint{dead.ID, chain[0].ID, chain[1].ID} {
+		stored := db.Job{}
+		client.First(&stored, id)
+		if strings.Contains(stored.Payload, "123456") || !strings.Contains(stored.Payload, "test@example.com") {
+			t.Errorf("Expected email body of %s job %d to be redacted, got %s", stored.Status, id, stored.Payload)
+		}
+	}
+
+	// Retried jobs don't send the redacted content
+	if _, err := jobQueue.RetryJobs([]uint{dead.ID}); err != nil {
+		t.Fatalf("Failed to retry job: %v", err)
+	}
+	retried := runNextJob(t, jobQueue)
+	if err := jobQueue.ProcessEmailJob(retried.Payload); !errors.Is(err, queue.ErrEmailRedacted) {
+		t.Errorf("Expected redacted email not to be sent, got %v", err)
+	}
+}
+
+func TestQueue_PurgeProcessedJobs(t *testing.T) {
+	client := helpers.SetupTestDatabase()
+	jobQueue := queue.NewQueue(client, &helpers.EmailMock{})
+	// Keep noop jobs for an hour and all other jobs for a day
+	queue.SetRetention(queue.Retention{KeepFor: 24 * time.Hour}, queue.Retention{JobType: "noop", KeepFor: time.Hour})
+	defer queue.SetRetention(queue.Retention{KeepFor: queue.DefaultRetention}, queue.Retention{JobType: "noop", KeepFor: queue.DefaultRetention})
+
+	now := time.Now()
+	hoursAgo := func(hours int) *time.Time {
+		processedAt := now.Add(-time.Duration(hours) * time.Hour)
+		return &processedAt
+	}
+	jobs := []db.Job{
+		// Past the noop retention
+		{JobType: "noop", Status: db.JobStatusProcessed, Processed: true, ProcessedAt: hoursAgo(2)},
+		// Within the noop retention
+		{JobType: "noop", Status: db.JobStatusProcessed, Processed: true, ProcessedAt: hoursAgo(0)},
+		// Within the default retention
+		{JobType: queue.EmailJobType, Status: db.JobStatusProcessed, Processed: true, ProcessedAt: hoursAgo(2)},
+		// Past the default retention
+		{JobType: queue.EmailJobType, Status: db.JobStatusProcessed, Processed: true, ProcessedAt: hoursAgo(48)},
+		// Dead and cancelled jobs use the time they finished (their last update)
+		{JobType: "noop", Status: db.JobStatusDead, LastError: "failed", UpdatedAt: *hoursAgo(48)},
+		{JobType: "noop", Status: db.JobStatusCancelled, UpdatedAt: *hoursAgo(0)},
+		{JobType: queue.EmailJobType, Status: db.JobStatusCancelled, UpdatedAt: *hoursAgo(48)},
+		// Jobs that haven't finished are never purged
+		{JobType: "noop", Status: db.JobStatusFailed, LastError: "failed", UpdatedAt: *hoursAgo(48)},
+	}
+	for i := range jobs {
+		if err := client.Create(&jobs[i]).Error; err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	purged, err := jobQueue.PurgeProcessedJobs(now)
+	if err != nil {
+		t.Fatalf("Failed to purge jobs: %v", err)
+	}
+	if purged != 4 {
+		t.Errorf("Expected 4 jobs to be purged, got %d", purged)
+	}
+
+	// Check the remaining jobs (purged jobs are deleted permanently)
+	var remaining []uint
+	client.Unscoped().Model(&db.Job{}).Order("id").Pluck("id", &remaining)
+	expected := []uint{jobs[1].ID, jobs[2].ID, jobs[5].ID, jobs[7].ID}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("Expected jobs %v to remain, got %v", expected, remaining)
+	}
+}
+
+func TestMemoryQueue_PurgeProcessedJobs(t *testing.T) {
+	jobQueue := queue.NewSyncMemoryQueue(&helpers.EmailMock{})
+
+	err := jobQueue.AddJob(queue.EmailJobType, `{"Recipient":"test@example.com","Subject":"Hi","Body":"Your code is 123456"}`)
+	if err != nil {
+		t.Fatalf("Failed to add job: %v", err)
+	}
+	// The email body should be redacted once sent
+	if payload := jobQueue.Jobs()[0].Payload; strings.Contains(payload, "123456") {
+		t.Errorf("Expected email body to be redacted, got %s", payload)
+	}
+
+	// Jobs are kept until their retention has passed
+	if purged := jobQueue.PurgeProcessedJobs(time.Now()); purged != 0 {
+		t.Errorf("Expected no jobs to be purged, got %d", purged)
+	}
+	if purged := jobQueue.PurgeProcessedJobs(time.Now().Add(queue.DefaultRetention + time.Minute)); purged != 1 {
+		t.Errorf("Expected 1 job to be purged, got %d", purged)
+	}
+	if len(jobQueue.Jobs()) != 0 {
+		t.Errorf("Expected no jobs to remain")
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	var tests = []struct {
+		config   string
+		expected []queue.Retention
+		valid    bool
+	}{
+		{"", nil, true},
+		{"168h", []queue.Retention{{KeepFor: 168 * time.Hour}}, true},
+		{"168h, email=24h", []queue.Retention{{KeepFor: 168 * time.Hour}, {JobType: "email", KeepFor: 24 * time.Hour}}, true},
+		{"email=-1h", []queue.Retention{{JobType: "email", KeepFor: -time.Hour}}, true},
+		{"email=week", nil, false},
+	}
+	for _, v := range tests {
+		retentions, err := queue.ParseRetention(v.config)
+		if (err == nil) != v.valid {
+			t.Errorf("Config %q: expected valid to be %v, got error %v", v.config, v.valid, err)
+			continue
+		}
+		if !reflect.DeepEqual(retentions, v.expected) {
+			t.Errorf("Config %q: expected %v, got %v", v.config, v.expected, retentions)
+		}
+	}
+}
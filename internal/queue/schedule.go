@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How often the scheduler checks for recurring jobs that are due
+const DefaultSchedulerInterval = 30 * time.Second
+
+// Schedule describes a recurring job enqueued on a cron schedule
+type Schedule struct {
+	// Unique name of the schedule (eg. "purge-verification-codes")
+	Name string
+	// Cron expression (eg. "0 3 * * *")
+	Spec string
+	// Job type and payload of the job enqueued on each run
+	JobType string
+	Payload string
+	// Named queue and priority of the job enqueued on each run (default: DefaultQueue, PriorityNormal)
+	Queue    string
+	Priority int
+}
+
+// Registry of recurring job schedules available to every queue (name => schedule)
+var schedules = struct {
+	mu        sync.RWMutex
+	schedules map[string]Schedule
+}{schedules: make(map[string]Schedule)}
+
+// RegisterSchedule registers a recurring job.
+// Registering the same name again replaces the previous schedule.
+// Panics if the cron expression is invalid.
+// Example usage: queue.RegisterSchedule(queue.Schedule{Name: "nightly-purge", Spec: "0 3 * * *", JobType: "purge", Payload: "{}"})
+func RegisterSchedule(schedule Schedule) {
+	if schedule.Name == "" || schedule.JobType == "" {
+		panic("queue: schedule requires a name and a job type")
+	}
+	cron, err := ParseCron(schedule.Spec)
+	if err != nil {
+		panic(fmt.Sprintf("queue: schedule %s: %v", schedule.Name, err))
+	}
+	if cron.Next(time.Now()).IsZero() {
+		panic(fmt.Sprintf("queue: schedule %s never runs", schedule.Name))
+	}
+	if schedule.Queue == "" {
+		schedule.Queue = DefaultQueue
+	}
+	schedules.mu.Lock()
+	defer schedules.mu.Unlock()
+
+	schedules.schedules[schedule.Name] = schedule
+}
+
+// Returns a copy of the registered schedules
+func registeredSchedules() []Schedule {
+	schedules.mu.RLock()
+	defer schedules.mu.RUnlock()
+
+	registered := make([]Schedule, 0, len(schedules.schedules))
+	for _, schedule := range schedules.schedules {
+		registered = append(registered, schedule)
+	}
+	return registered
+}
+
+// Scheduler stores the registered schedules and periodically enqueues recurring jobs that are due.
+// Returns once the context is cancelled.
+func (q *Queue) Scheduler(ctx context.Context) {
+	if err := q.SyncSchedules(); err != nil {
+		log.Printf("Scheduler: Error syncing schedules: %v\n", err)
+	}
+
+	ticker := time.NewTicker(q.schedulerInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := q.EnqueueDueSchedules(time.Now()); err != nil {
+			log.Printf("Scheduler: Error enqueuing recurring jobs: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncSchedules stores the registered schedules in the database.
+// Schedules already stored (eg. by another instance) are only updated if their definition has changed.
+func (q *Queue) SyncSchedules() error {
+	for _, schedule := range registeredSchedules() {
+		cron, err := ParseCron(schedule.Spec)
+		if err != nil {
+			return err
+		}
+		// Build schedule record
+		record := db.JobSchedule{
+			Name:      schedule.Name,
+			Spec:      schedule.Spec,
+			JobType:   schedule.JobType,
+			Payload:   schedule.Payload,
+			Queue:     schedule.Queue,
+			Priority:  schedule.Priority,
+			NextRunAt: cron.Next(time.Now()),
+		}
+
+		// Create the schedule if it doesn't exist yet
+		err = q.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&record).Error
+		if err != nil {
+			return fmt.Errorf("failed storing schedule %s: %w", schedule.Name, err)
+		}
+
+		// Update the stored schedule if its definition has changed
+		err = q.db.Model(&db.JobSchedule{}).
+			Where("name = ? AND (spec <> ? OR job_type <> ? OR payload <> ? OR queue <> ? OR priority <> ?)",
+				schedule.Name, schedule.Spec, schedule.JobType, schedule.Payload, schedule.Queue, schedule.Priority).
+			Updates(map[string]interface{}{
+				"spec":        schedule.Spec,
+				"job_type":    schedule.JobType,
+				"payload":     schedule.Payload,
+				"queue":       schedule.Queue,
+				"priority":    schedule.Priority,
+				"next_run_at": record.NextRunAt,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("failed updating schedule %s: %w", schedule.Name, err)
+		}
+	}
+	return nil
+}
+
+// EnqueueDueSchedules enqueues a job for each stored schedule that is due at the given time.
+// Runs missed while no scheduler was running are enqueued once.
+// Each run is enqueued exactly once, even with schedulers running on several instances.
+// Returns the number of jobs enqueued.
+func (q *Queue) EnqueueDueSchedules(now time.Time) (int, error) {
+	var due []db.JobSchedule
+	if err := q.db.Where("next_run_at <= ?", now).Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	enqueued := 0
+	for _, schedule := range due {
+		cron, err := ParseCron(schedule.Spec)
+		if err != nil {
+			log.Printf("Scheduler: Skipping schedule %s: %v\n", schedule.Name, err)
+			continue
+		}
+		scheduledAt := schedule.NextRunAt
+
+		err = q.db.Transaction(func(tx *gorm.DB) error {
+			// Move the schedule on to its next run. Only succeeds if no other scheduler has claimed this run
+			result := tx.Model(&db.JobSchedule{}).
+				Where("id = ? AND next_run_at = ?", schedule.ID, scheduledAt).
+				Updates(map[string]interface{}{"next_run_at": cron.Next(now), "last_run_at": scheduledAt})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errScheduleClaimed
+			}
+
+			// Enqueue the job for this run
+			return tx.Create(&db.Job{
+				JobType:     schedule.JobType,
+				Payload:     schedule.Payload,
+				Status:      db.JobStatusPending,
+				MaxAttempts: DefaultMaxAttempts,
+				RunAt:       scheduledAt,
+				Queue:       schedule.Queue,
+				Priority:    schedule.Priority,
+			}).Error
+		})
+		if err != nil {
+			if errors.Is(err, errScheduleClaimed) {
+				continue
+			}
+			return enqueued, fmt.Errorf("failed enqueuing job for schedule %s: %w", schedule.Name, err)
+		}
+		enqueued++
+	}
+	// Wake the workers to pick up the enqueued jobs
+	if enqueued > 0 {
+		q.notifyAll()
+	}
+	return enqueued, nil
+}
+
+// Used to roll back a run already enqueued by another scheduler
+var errScheduleClaimed = errors.New("schedule run already claimed")
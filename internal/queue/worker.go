@@ -1,47 +1,221 @@
 package queue
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dmawardi/Go-Template/internal/db"
 	"gorm.io/gorm"
 )
 
-// Worker processes jobs from the queue.
-func (q *Queue) Worker() {
+// Subscription sets the number of workers processing jobs from a set of named queues
+type Subscription struct {
+	// Queues the workers process jobs from (all queues if empty)
+	Queues []string
+	// Number of workers
+	Concurrency int
+}
+
+// StartWorkers starts the workers for each subscription along with a reaper
+// that releases jobs whose lease has expired and the recurring job scheduler.
+// If no subscriptions are given, DefaultConcurrency workers are started for all queues.
+// Everything started stops once the context is cancelled (see Wait).
+// Safe to call on multiple instances of the app sharing the same database.
+// Example usage: q.StartWorkers(ctx, queue.Subscription{Queues: []string{queue.HighPriorityQueue}, Concurrency: 4}, queue.Subscription{Concurrency: 2})
+func (q *Queue) StartWorkers(ctx context.Context, subscriptions ...Subscription) {
+	if len(subscriptions) == 0 {
+		subscriptions = []Subscription{{Concurrency: DefaultConcurrency}}
+	}
+	for _, subscription := range subscriptions {
+		for i := 0; i < subscription.Concurrency; i++ {
+			q.start(func() { q.Worker(ctx, subscription.Queues...) })
+		}
+	}
+	q.start(func() { q.Reaper(ctx) })
+	q.start(func() { q.Scheduler(ctx) })
+}
+
+// Wait blocks until the workers, reaper and scheduler started by StartWorkers have stopped
+// (ie. workers have finished their current job after the StartWorkers context was cancelled).
+// Returns the context's error if it is done first.
+func (q *Queue) Wait(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Runs fn in a goroutine tracked by Wait
+func (q *Queue) start(fn func()) {
+	q.running.Add(1)
+	go func() {
+		defer q.running.Done()
+		fn()
+	}()
+}
+
+// ParseSubscriptions parses worker subscriptions from a comma separated list of queue=concurrency pairs.
+// A number on its own sets the number of workers for all queues.
+// Example usage: queue.ParseSubscriptions("high=4,default=2") or queue.ParseSubscriptions("4")
+func ParseSubscriptions(config string) ([]Subscription, error) {
+	var subscriptions []Subscription
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// Split queue name from concurrency (if present)
+		queueName, concurrency, found := strings.Cut(entry, "=")
+		if !found {
+			queueName, concurrency = "", entry
+		}
+		workers, err := strconv.Atoi(strings.TrimSpace(concurrency))
+		if err != nil || workers < 1 {
+			return nil, fmt.Errorf("invalid worker concurrency %q", entry)
+		}
+
+		subscription := Subscription{Concurrency: workers}
+		if queueName = strings.TrimSpace(queueName); queueName != "" {
+			subscription.Queues = []string{queueName}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// Worker processes jobs from the given queues (or all queues if none are given).
+// Returns once the context is cancelled. A job that is being processed is finished first.
+func (q *Queue) Worker(ctx context.Context, queues ...string) {
+	// Subscribe to be woken when a job is added to one of the queues
+	sub := q.subscribe(queues)
+	defer q.unsubscribe(sub)
 	for {
-		// Get the next job
-		job, err := q.GetJob()
+		// Stop claiming jobs once shutting down
+		if ctx.Err() != nil {
+			return
+		}
+		// Claim the next job
+		job, err := q.GetJob(queues...)
 		if err != nil {
 			// If there's another error aside from "record not found", log it
 			if !errors.Is(err, gorm.ErrRecordNotFound) {
 				log.Printf("Worker: Error getting job: %v\n", err)
 			}
-			// Wait for a signal that a job is available
-			time.Sleep(5 * time.Second)
+			// Wait until a job is added or the poll interval passes
+			q.wait(ctx, sub)
 			continue
 		}
-		// Process the job using the Process function with the payload
-		if err := q.ProcessJob(job.JobType, job.Payload); err != nil {
-			log.Printf("Worker: Error processing job: %v\n", err)
-			time.Sleep(5 * time.Second)
+
+		// Process the job using the handler for its job type (renewing its lease while it runs)
+		if err := q.processLeasedJob(job); err != nil {
+			log.Printf("Worker: Error processing job %d (attempt %d): %v\n", job.ID, job.Attempts+1, err)
+			// Record the failure so the job is retried later (or marked as dead)
+			if err := q.MarkJobAsFailed(job, err); err != nil {
+				log.Printf("Worker: Error marking job %d as failed: %v\n", job.ID, err)
+			} else if job.Status == db.JobStatusDead {
+				log.Printf("Worker: Job %d has run out of attempts and is now dead\n", job.ID)
+			}
 			continue
 		}
 		// Mark the job as processed
 		if err := q.MarkJobAsProcessed(job); err != nil {
-			log.Printf("Worker: Error marking job as processed: %v\n", err)
-			time.Sleep(5 * time.Second)
+			log.Printf("Worker: Error marking job %d as processed: %v\n", job.ID, err)
+		}
+	}
+}
+
+// Reaper periodically releases jobs whose lease has expired so they can be retried.
+// Returns once the context is cancelled.
+func (q *Queue) Reaper(ctx context.Context) {
+	ticker := time.NewTicker(q.leaseDuration / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		released, err := q.ReleaseExpiredLeases()
+		if err != nil {
+			log.Printf("Reaper: Error releasing expired leases: %v\n", err)
 			continue
 		}
+		if released > 0 {
+			log.Printf("Reaper: Released %d job(s) with an expired lease\n", released)
+		}
 	}
 }
 
+// ProcessJob processes a job payload using the handler registered for the job type
 func (q *Queue) ProcessJob(jobType, payload string) error {
-	switch jobType {
-	case "email":
-		return q.ProcessEmailJob(payload)
-	default:
-		return errors.New("unknown job type")
+	return q.processJob(&db.Job{JobType: jobType, Payload: payload})
+}
+
+// Processes a job using the handler registered for its job type
+func (q *Queue) processJob(job *db.Job) error {
+	handler, found := q.handlerFor(job.JobType)
+	if !found {
+		return fmt.Errorf("%w: %s", ErrUnknownJobType, job.JobType)
+	}
+	return handler(job)
+}
+
+// Processes a claimed job, renewing its lease while the handler runs so that jobs
+// running longer than the lease duration aren't released by the reaper and run twice
+func (q *Queue) processLeasedJob(job *db.Job) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		q.keepLeaseAlive(job.ID, job.LockedBy, stop)
+	}()
+	// Stop renewing before the job is updated by the worker
+	defer func() {
+		close(stop)
+		<-stopped
+	}()
+	return q.processJob(job)
+}
+
+// Renews a job's lease every third of the lease duration until stopped or the lease is lost
+func (q *Queue) keepLeaseAlive(jobID uint, lockedBy string, stop <-chan struct{}) {
+	ticker := time.NewTicker(q.leaseDuration / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := q.renewLease(jobID, lockedBy); err != nil {
+			log.Printf("Worker: Error renewing lease of job %d: %v\n", jobID, err)
+			if errors.Is(err, ErrLeaseLost) {
+				return
+			}
+		}
+	}
+}
+
+// Blocks until a worker is woken by a new job, the poll interval passes or the context is cancelled.
+// Polling picks up jobs added by other instances and retries that have become due
+func (q *Queue) wait(ctx context.Context, sub *subscriber) {
+	timer := time.NewTimer(q.pollInterval)
+	defer timer.Stop()
+	select {
+	case <-sub.wake:
+	case <-timer.C:
+	case <-ctx.Done():
 	}
 }
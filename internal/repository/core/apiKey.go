@@ -0,0 +1,131 @@
+package corerepositories
+
+import (
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository interface {
+	// Find a list of the API keys of every user in the Database
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.ApiKey], error)
+	FindById(int) (*db.ApiKey, error)
+	// Finds the API keys of a user (newest first)
+	FindByUserID(userID uint) ([]db.ApiKey, error)
+	Create(key *db.ApiKey) (*db.ApiKey, error)
+	Update(int, *db.ApiKey) (*db.ApiKey, error)
+	Delete(int) error
+	BulkDelete([]int) error
+}
+
+type apiKeyRepository struct {
+	DB *gorm.DB
+}
+
+func NewApiKeyRepository(db *gorm.DB) ApiKeyRepository {
+	return &apiKeyRepository{db}
+}
+
+// Creates an API key in the database
+func (r *apiKeyRepository) Create(key *db.ApiKey) (*db.ApiKey, error) {
+	result := r.DB.Create(key)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed creating API key: %w", result.Error)
+	}
+	return key, nil
+}
+
+// Find a list of API keys in the database
+func (r *apiKeyRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.ApiKey], error) {
+	// Build meta data for API keys
+	metaData, err := data.BuildMetaData(r.DB, db.ApiKey{}, limit, offset, order, conditions)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all API keys based on the received parameters
+	var keys []db.ApiKey
+	err = data.QueryAll(r.DB, &keys, limit, offset, order, conditions, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of API keys: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.ApiKey]{
+		Data: &keys,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find API key in database by ID
+func (r *apiKeyRepository) FindById(id int) (*db.ApiKey, error) {
+	key := db.ApiKey{}
+	result := r.DB.First(&key, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &key, nil
+}
+
+// Find the API keys of a user
+func (r *apiKeyRepository) FindByUserID(userID uint) ([]db.ApiKey, error) {
+	keys := []db.ApiKey{}
+	result := r.DB.Where("user_id = ?", userID).Order("created_at DESC").Order("id DESC").Find(&keys)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return keys, nil
+}
+
+// Delete API key in database (the key stops working immediately)
+func (r *apiKeyRepository) Delete(id int) error {
+	key := db.ApiKey{}
+	result := r.DB.Delete(&key, id)
+	if result.Error != nil {
+		fmt.Println("error in deleting API key: ", result.Error)
+		return result.Error
+	}
+	return nil
+}
+
+// Bulk delete API keys in database
+func (r *apiKeyRepository) BulkDelete(ids []int) error {
+	err := data.BulkDeleteByIds(db.ApiKey{}, ids, r.DB)
+	if err != nil {
+		fmt.Println("error in deleting API keys: ", err)
+		return err
+	}
+	return nil
+}
+
+// Updates API key in database (name and expiry)
+func (r *apiKeyRepository) Update(id int, key *db.ApiKey) (*db.ApiKey, error) {
+	// Find API key by id
+	found, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("API key to update not found: ", err)
+		return nil, err
+	}
+
+	// Update found API key
+	updateResult := r.DB.Model(found).Updates(map[string]interface{}{
+		"name":       key.Name,
+		"expires_at": key.ExpiresAt,
+	})
+	if updateResult.Error != nil {
+		fmt.Println("API key update failed: ", updateResult.Error)
+		return nil, updateResult.Error
+	}
+
+	// Retrieve changed API key by id
+	updated, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("API key to update not found: ", err)
+		return nil, err
+	}
+	return updated, nil
+}
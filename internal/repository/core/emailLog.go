@@ -0,0 +1,141 @@
+package corerepositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+type EmailLogRepository interface {
+	// Find a list of all email log entries in the Database
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error)
+	FindById(int) (*db.EmailLog, error)
+	// Finds the entry recording the email sent by a job
+	FindByJobID(jobID uint) (*db.EmailLog, error)
+	Create(emailLog *db.EmailLog) (*db.EmailLog, error)
+	Update(int, *db.EmailLog) (*db.EmailLog, error)
+	Delete(int) error
+	BulkDelete([]int) error
+	// Permanently deletes entries created before the given time
+	DeleteCreatedBefore(before time.Time) (int64, error)
+}
+
+type emailLogRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailLogRepository(db *gorm.DB) EmailLogRepository {
+	return &emailLogRepository{db}
+}
+
+// Creates an email log entry in the database
+func (r *emailLogRepository) Create(emailLog *db.EmailLog) (*db.EmailLog, error) {
+	result := r.DB.Create(emailLog)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed creating email log: %w", result.Error)
+	}
+
+	return emailLog, nil
+}
+
+// Find a list of email log entries in the database
+func (r *emailLogRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error) {
+	// Build meta data for email log entries
+	metaData, err := data.BuildMetaData(r.DB, db.EmailLog{}, limit, offset, order, conditions)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all email log entries based on the received parameters
+	var emailLogs []db.EmailLog
+	err = data.QueryAll(r.DB, &emailLogs, limit, offset, order, conditions, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of email logs: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.EmailLog]{
+		Data: &emailLogs,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find email log entry in database by ID
+func (r *emailLogRepository) FindById(id int) (*db.EmailLog, error) {
+	emailLog := db.EmailLog{}
+	result := r.DB.First(&emailLog, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &emailLog, nil
+}
+
+// Find the email log entry of a job
+func (r *emailLogRepository) FindByJobID(jobID uint) (*db.EmailLog, error) {
+	emailLog := db.EmailLog{}
+	result := r.DB.Where("job_id = ?", jobID).First(&emailLog)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &emailLog, nil
+}
+
+// Delete email log entry in database
+func (r *emailLogRepository) Delete(id int) error {
+	emailLog := db.EmailLog{}
+	result := r.DB.Delete(&emailLog, id)
+	if result.Error != nil {
+		fmt.Println("error in deleting email log: ", result.Error)
+		return result.Error
+	}
+	return nil
+}
+
+// Bulk delete email log entries in database
+func (r *emailLogRepository) BulkDelete(ids []int) error {
+	err := data.BulkDeleteByIds(db.EmailLog{}, ids, r.DB)
+	if err != nil {
+		fmt.Println("error in deleting email logs: ", err)
+		return err
+	}
+	return nil
+}
+
+// Permanently deletes email log entries created before the given time (including deleted entries)
+func (r *emailLogRepository) DeleteCreatedBefore(before time.Time) (int64, error) {
+	result := r.DB.Unscoped().Where("created_at < ?", before).Delete(&db.EmailLog{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed deleting old email logs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Updates email log entry in database
+func (r *emailLogRepository) Update(id int, emailLog *db.EmailLog) (*db.EmailLog, error) {
+	// Find email log entry by id
+	found, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("Email log to update not found: ", err)
+		return nil, err
+	}
+
+	// Update found email log entry
+	updateResult := r.DB.Model(found).Updates(emailLog)
+	if updateResult.Error != nil {
+		fmt.Println("Email log update failed: ", updateResult.Error)
+		return nil, updateResult.Error
+	}
+
+	// Retrieve changed email log entry by id
+	updated, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("Email log to update not found: ", err)
+		return nil, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,211 @@
+package corerepositories
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EmailSuppressionRepository interface {
+	// Find a list of all suppressed addresses in the Database
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailSuppression], error)
+	FindById(int) (*db.EmailSuppression, error)
+	// Finds the entries of the given addresses that are on the suppression list
+	FindByEmails(emails []string) ([]db.EmailSuppression, error)
+	Create(suppression *db.EmailSuppression) (*db.EmailSuppression, error)
+	Update(int, *db.EmailSuppression) (*db.EmailSuppression, error)
+	Delete(int) error
+	BulkDelete([]int) error
+}
+
+type emailSuppressionRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailSuppressionRepository(db *gorm.DB) EmailSuppressionRepository {
+	return &emailSuppressionRepository{db}
+}
+
+// Adds an address to the suppression list. Addresses are stored in lower case
+func (r *emailSuppressionRepository) Create(suppression *db.EmailSuppression) (*db.EmailSuppression, error) {
+	suppression.Email = strings.ToLower(strings.TrimSpace(suppression.Email))
+	result := r.DB.Create(suppression)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed creating email suppression: %w", result.Error)
+	}
+
+	return suppression, nil
+}
+
+// Find a list of suppressed addresses in the database
+func (r *emailSuppressionRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailSuppression], error) {
+	// Build meta data for suppressed addresses
+	metaData, err := data.BuildMetaData(r.DB, db.EmailSuppression{}, limit, offset, order, conditions)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all suppressed addresses based on the received parameters
+	var suppressions []db.EmailSuppression
+	err = data.QueryAll(r.DB, &suppressions, limit, offset, order, conditions, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of email suppressions: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.EmailSuppression]{
+		Data: &suppressions,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find suppressed address in database by ID
+func (r *emailSuppressionRepository) FindById(id int) (*db.EmailSuppression, error) {
+	suppression := db.EmailSuppression{}
+	result := r.DB.First(&suppression, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &suppression, nil
+}
+
+// Find the entries of the addresses on the suppression list (addresses are compared case insensitively)
+func (r *emailSuppressionRepository) FindByEmails(emails []string) ([]db.EmailSuppression, error) {
+	suppressions := []db.EmailSuppression{}
+	if len(emails) == 0 {
+		return suppressions, nil
+	}
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(strings.TrimSpace(email))
+	}
+	result := r.DB.Where("email IN ?", lowered).Find(&suppressions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return suppressions, nil
+}
+
+// Delete suppressed address in database (removing it from the list for good)
+func (r *emailSuppressionRepository) Delete(id int) error {
+	suppression := db.EmailSuppression{}
+	result := r.DB.Delete(&suppression, id)
+	if result.Error != nil {
+		fmt.Println("error in deleting email suppression: ", result.Error)
+		return result.Error
+	}
+	return nil
+}
+
+// Bulk delete suppressed addresses in database
+func (r *emailSuppressionRepository) BulkDelete(ids []int) error {
+	err := data.BulkDeleteByIds(db.EmailSuppression{}, ids, r.DB)
+	if err != nil {
+		fmt.Println("error in deleting email suppressions: ", err)
+		return err
+	}
+	return nil
+}
+
+// Updates suppressed address in database
+func (r *emailSuppressionRepository) Update(id int, suppression *db.EmailSuppression) (*db.EmailSuppression, error) {
+	// Find suppressed address by id
+	found, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("Email suppression to update not found: ", err)
+		return nil, err
+	}
+
+	// Update found suppressed address
+	updateResult := r.DB.Model(found).Updates(suppression)
+	if updateResult.Error != nil {
+		fmt.Println("Email suppression update failed: ", updateResult.Error)
+		return nil, updateResult.Error
+	}
+
+	// Retrieve changed suppressed address by id
+	updated, err := r.FindById(id)
+	if err != nil {
+		fmt.Println("Email suppression to update not found: ", err)
+		return nil, err
+	}
+	return updated, nil
+}
+
+type EmailPreferenceRepository interface {
+	// Finds the email categories a user subscribed to or opted out of
+	FindByUserID(userID uint) ([]db.EmailPreference, error)
+	// Creates or updates the preference of a user for an email category
+	Upsert(preference *db.EmailPreference) error
+	// Finds the addresses of users that opted out of an email category
+	FindUnsubscribedEmails(emails []string, category string) ([]string, error)
+	// Finds the ID of the user with an address (compared case insensitively, as addresses in emails are lower case)
+	FindUserIDByEmail(email string) (uint, error)
+}
+
+type emailPreferenceRepository struct {
+	DB *gorm.DB
+}
+
+func NewEmailPreferenceRepository(db *gorm.DB) EmailPreferenceRepository {
+	return &emailPreferenceRepository{db}
+}
+
+// Find the email preferences of a user
+func (r *emailPreferenceRepository) FindByUserID(userID uint) ([]db.EmailPreference, error) {
+	preferences := []db.EmailPreference{}
+	result := r.DB.Where("user_id = ?", userID).Order("category").Find(&preferences)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return preferences, nil
+}
+
+// Create the preference of a user for an email category, or update it if the user already has one
+func (r *emailPreferenceRepository) Upsert(preference *db.EmailPreference) error {
+	result := r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"subscribed", "updated_at"}),
+	}).Create(preference)
+	if result.Error != nil {
+		return fmt.Errorf("failed saving email preference: %w", result.Error)
+	}
+	return nil
+}
+
+// Find the addresses (in lower case) of the users that opted out of the category
+func (r *emailPreferenceRepository) FindUnsubscribedEmails(emails []string, category string) ([]string, error) {
+	unsubscribed := []string{}
+	if len(emails) == 0 {
+		return unsubscribed, nil
+	}
+	lowered := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(strings.TrimSpace(email))
+	}
+	result := r.DB.Model(&db.EmailPreference{}).
+		Joins("JOIN users ON users.id = email_preferences.user_id AND users.deleted_at IS NULL").
+		Where("email_preferences.category = ? AND email_preferences.subscribed = ?", category, false).
+		Where("LOWER(users.email) IN ?", lowered).
+		Pluck("LOWER(users.email)", &unsubscribed)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return unsubscribed, nil
+}
+
+// Find the ID of the user an address belongs to
+func (r *emailPreferenceRepository) FindUserIDByEmail(email string) (uint, error) {
+	user := db.User{}
+	result := r.DB.Select("id").Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return user.ID, nil
+}
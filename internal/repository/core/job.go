@@ -0,0 +1,128 @@
+package corerepositories
+
+import (
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/data"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+type JobRepository interface {
+	// Find a list of all jobs in the Database matching the filter
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters, filter models.JobFilter) (*models.BasicPaginatedResponse[db.Job], error)
+	FindById(int) (*db.Job, error)
+	// Finds the distinct job types stored
+	FindJobTypes() ([]string, error)
+	Delete(int) error
+	BulkDelete([]int) error
+}
+
+type jobRepository struct {
+	DB *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) JobRepository {
+	return &jobRepository{db}
+}
+
+// Find a list of jobs in the database
+func (r *jobRepository) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters, filter models.JobFilter) (*models.BasicPaginatedResponse[db.Job], error) {
+	// Build query with filter and conditions applied
+	query := r.filteredQuery(conditions, filter)
+
+	// Build meta data for jobs
+	metaData, err := data.BuildMetaData(query, db.Job{}, limit, offset, order, nil)
+	if err != nil {
+		fmt.Printf("Error building meta data: %s", err)
+		return nil, err
+	}
+
+	// Query all jobs based on the received parameters
+	var jobs []db.Job
+	err = data.QueryAll(query, &jobs, limit, offset, order, nil, []string{})
+	if err != nil {
+		fmt.Printf("Error querying db for list of jobs: %s", err)
+		return nil, err
+	}
+
+	return &models.BasicPaginatedResponse[db.Job]{
+		Data: &jobs,
+		Meta: *metaData,
+	}, nil
+}
+
+// Find job in database by ID
+func (r *jobRepository) FindById(id int) (*db.Job, error) {
+	// Create an empty ref object of type job
+	job := db.Job{}
+	// Check if job exists in db
+	result := r.DB.First(&job, id)
+	// If error detected
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// else
+	return &job, nil
+}
+
+// Finds the distinct job types stored
+func (r *jobRepository) FindJobTypes() ([]string, error) {
+	var jobTypes []string
+	result := r.DB.Model(&db.Job{}).Distinct().Order("job_type").Pluck("job_type", &jobTypes)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return jobTypes, nil
+}
+
+// Delete job in database
+func (r *jobRepository) Delete(id int) error {
+	// Create an empty ref object of type job
+	job := db.Job{}
+	// Check if job exists in db
+	result := r.DB.Delete(&job, id)
+
+	// If error detected
+	if result.Error != nil {
+		fmt.Println("error in deleting job: ", result.Error)
+		return result.Error
+	}
+	// else
+	return nil
+}
+
+// Bulk delete jobs in database
+func (r *jobRepository) BulkDelete(ids []int) error {
+	// Delete jobs with specified IDs
+	err := data.BulkDeleteByIds(db.Job{}, ids, r.DB)
+	if err != nil {
+		fmt.Println("error in deleting jobs: ", err)
+		return err
+	}
+	// else
+	return nil
+}
+
+// Builds a query for jobs matching the filter (combined using AND) and
+// the search conditions (combined using OR)
+func (r *jobRepository) filteredQuery(conditions []models.QueryConditionParameters, filter models.JobFilter) *gorm.DB {
+	query := r.DB.Model(&db.Job{})
+	// Apply filters
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.JobType != "" {
+		query = query.Where("job_type = ?", filter.JobType)
+	}
+	if filter.Queue != "" {
+		query = query.Where("queue = ?", filter.Queue)
+	}
+	// Group conditions so they don't bypass the filters
+	if len(conditions) > 0 {
+		query = query.Where(data.AddWhereConditionsToQuery(r.DB.Session(&gorm.Session{NewDB: true}), conditions))
+	}
+	// Allow the query to be reused for counting and finding
+	return query.Session(&gorm.Session{})
+}
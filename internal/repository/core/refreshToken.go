@@ -0,0 +1,105 @@
+package corerepositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository interface {
+	Create(token *db.RefreshToken) (*db.RefreshToken, error)
+	// Finds a refresh token by the hash of the token
+	FindByHash(hash string) (*db.RefreshToken, error)
+	// Marks an unused token as used. Returns false if the token was already used (eg. by a concurrent request)
+	MarkUsed(id uint) (bool, error)
+	// Revokes every token of a family (session)
+	RevokeFamily(familyID string) error
+	// Revokes every session of a user. Returns the IDs of the sessions revoked
+	RevokeUser(userID uint) ([]string, error)
+	// Deletes the tokens that expired before the given time. Returns the number of tokens deleted
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type refreshTokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db}
+}
+
+// Creates a refresh token in the database
+func (r *refreshTokenRepository) Create(token *db.RefreshToken) (*db.RefreshToken, error) {
+	result := r.DB.Create(token)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed creating refresh token: %w", result.Error)
+	}
+	return token, nil
+}
+
+// Find refresh token in database by the hash of the token
+func (r *refreshTokenRepository) FindByHash(hash string) (*db.RefreshToken, error) {
+	token := db.RefreshToken{}
+	result := r.DB.Where("token_hash = ?", hash).First(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &token, nil
+}
+
+// Marks a refresh token as used. The update only applies to unused tokens,
+// so only one of several concurrent requests using the same token succeeds
+func (r *refreshTokenRepository) MarkUsed(id uint) (bool, error) {
+	result := r.DB.Model(&db.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed marking refresh token as used: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revokes the tokens of a family that aren't revoked yet
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+	result := r.DB.Model(&db.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed revoking refresh tokens: %w", result.Error)
+	}
+	return nil
+}
+
+// Revokes the unexpired sessions of a user (eg. when their password changes)
+func (r *refreshTokenRepository) RevokeUser(userID uint) ([]string, error) {
+	var familyIDs []string
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+			Distinct().Pluck("family_id", &familyIDs)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(familyIDs) == 0 {
+			return nil
+		}
+		return tx.Model(&db.RefreshToken{}).
+			Where("family_id IN ? AND revoked_at IS NULL", familyIDs).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed revoking sessions: %w", err)
+	}
+	return familyIDs, nil
+}
+
+// Deletes refresh tokens that expired before the given time
+func (r *refreshTokenRepository) DeleteExpired(before time.Time) (int64, error) {
+	result := r.DB.Where("expires_at < ?", before).Delete(&db.RefreshToken{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed deleting expired refresh tokens: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
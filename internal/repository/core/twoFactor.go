@@ -0,0 +1,208 @@
+package corerepositories
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepository interface {
+	// Finds the two-factor enrolment of a user
+	FindByUserID(userID uint) (*db.TwoFactor, error)
+	// Finds the enrolment with a pending login challenge using the hash of the challenge token
+	FindByChallenge(hash string) (*db.TwoFactor, error)
+	// Starts an enrolment with a new secret, replacing any unconfirmed enrolment of the user
+	SaveSecret(userID uint, secret string) (*db.TwoFactor, error)
+	// Confirms an enrolment and replaces the recovery codes of the user. Returns false if it was already confirmed
+	Confirm(userID uint, step int64, recoveryCodeHashes []string) (bool, error)
+	// Sets the pending login challenge of a user
+	SetChallenge(userID uint, hash string, expiresAt time.Time) error
+	// Ends a login challenge once its code is accepted and clears the failed attempts.
+	// Returns false if the challenge was already completed (eg. by a concurrent request)
+	CompleteChallenge(userID uint, hash string) (bool, error)
+	// Records a failed code. Once maxAttempts is reached, the pending challenge is cleared and the
+	// second step is locked until lockUntil. Returns true if the second step was locked
+	RecordFailedAttempt(userID uint, maxAttempts int, lockUntil time.Time) (bool, error)
+	// Records the time step of an accepted code. Returns false if a code of that step (or a later one) was used
+	UseStep(userID uint, step int64) (bool, error)
+	// Marks an unused recovery code as used. Returns false if no unused code matches
+	UseRecoveryCode(userID uint, hash string) (bool, error)
+	// Counts the unused recovery codes of a user
+	CountRecoveryCodes(userID uint) (int64, error)
+	// Removes the enrolment and recovery codes of a user
+	Delete(userID uint) error
+}
+
+type twoFactorRepository struct {
+	DB *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) TwoFactorRepository {
+	return &twoFactorRepository{db}
+}
+
+// Find two-factor enrolment in database by user ID
+func (r *twoFactorRepository) FindByUserID(userID uint) (*db.TwoFactor, error) {
+	twoFactor := db.TwoFactor{}
+	result := r.DB.Where("user_id = ?", userID).First(&twoFactor)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &twoFactor, nil
+}
+
+// Find two-factor enrolment in database by the hash of its pending login challenge
+func (r *twoFactorRepository) FindByChallenge(hash string) (*db.TwoFactor, error) {
+	twoFactor := db.TwoFactor{}
+	result := r.DB.Where("challenge_hash = ?", hash).First(&twoFactor)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &twoFactor, nil
+}
+
+// Replaces the unconfirmed enrolment of a user. Fails if the user has a confirmed enrolment (unique user ID)
+func (r *twoFactorRepository) SaveSecret(userID uint, secret string) (*db.TwoFactor, error) {
+	twoFactor := &db.TwoFactor{UserID: userID, Secret: secret}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND confirmed_at IS NULL", userID).Delete(&db.TwoFactor{})
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(twoFactor).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed saving two-factor secret: %w", err)
+	}
+	return twoFactor, nil
+}
+
+// Confirms an unconfirmed enrolment and replaces the user's recovery codes in the same transaction
+func (r *twoFactorRepository) Confirm(userID uint, step int64, recoveryCodeHashes []string) (bool, error) {
+	confirmed := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.TwoFactor{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		confirmed = true
+
+		if err := tx.Where("user_id = ?", userID).Delete(&db.TwoFactorRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := []db.TwoFactorRecoveryCode{}
+		for _, hash := range recoveryCodeHashes {
+			codes = append(codes, db.TwoFactorRecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed confirming two-factor enrolment: %w", err)
+	}
+	return confirmed, nil
+}
+
+// Sets the pending login challenge of a user, replacing any earlier challenge
+func (r *twoFactorRepository) SetChallenge(userID uint, hash string, expiresAt time.Time) error {
+	result := r.DB.Model(&db.TwoFactor{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"challenge_hash": hash, "challenge_expires_at": expiresAt})
+	if result.Error != nil {
+		return fmt.Errorf("failed setting two-factor challenge: %w", result.Error)
+	}
+	return nil
+}
+
+// Clears a login challenge. The update only applies while the challenge is pending,
+// so only one of several concurrent requests completing it succeeds
+func (r *twoFactorRepository) CompleteChallenge(userID uint, hash string) (bool, error) {
+	result := r.DB.Model(&db.TwoFactor{}).
+		Where("user_id = ? AND challenge_hash = ?", userID, hash).
+		Updates(map[string]interface{}{"challenge_hash": nil, "challenge_expires_at": nil, "failed_attempts": 0})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed completing two-factor challenge: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Increments the failed attempts of a user and locks the second step once the limit is reached
+func (r *twoFactorRepository) RecordFailedAttempt(userID uint, maxAttempts int, lockUntil time.Time) (bool, error) {
+	locked := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&db.TwoFactor{}).
+			Where("user_id = ?", userID).
+			Update("failed_attempts", gorm.Expr("failed_attempts + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		// Lock once the limit is reached. Attempts start again after the lock
+		result = tx.Model(&db.TwoFactor{}).
+			Where("user_id = ? AND failed_attempts >= ?", userID, maxAttempts).
+			Updates(map[string]interface{}{"locked_until": lockUntil, "failed_attempts": 0, "challenge_hash": nil, "challenge_expires_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		locked = result.RowsAffected == 1
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed recording two-factor attempt: %w", err)
+	}
+	return locked, nil
+}
+
+// Records the time step of an accepted code. Codes of the same or an earlier step are rejected from then on
+func (r *twoFactorRepository) UseStep(userID uint, step int64) (bool, error) {
+	result := r.DB.Model(&db.TwoFactor{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed recording two-factor code: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Marks an unused recovery code as used. The update only applies to unused codes,
+// so a code can only be used once
+func (r *twoFactorRepository) UseRecoveryCode(userID uint, hash string) (bool, error) {
+	result := r.DB.Model(&db.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("failed using recovery code: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Counts the unused recovery codes of a user
+func (r *twoFactorRepository) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	result := r.DB.Model(&db.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed counting recovery codes: %w", result.Error)
+	}
+	return count, nil
+}
+
+// Removes the enrolment and recovery codes of a user (eg. when an admin resets their two-factor authentication)
+func (r *twoFactorRepository) Delete(userID uint) error {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&db.TwoFactorRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&db.TwoFactor{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed deleting two-factor enrolment: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package corerepositories
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers/data"
@@ -21,6 +22,19 @@ type UserRepository interface {
 	FindByEmail(string) (*db.User, error)
 	// Verification
 	FindByVerificationCode(string) (*db.User, error)
+	// Puts back the previous verification code (clearing it if empty), unless the stored code has changed
+	RestoreVerificationCode(id int, code string, previousCode string, previousExpiry time.Time) error
+	// Clears verification codes that have expired. Returns the number of users updated
+	ClearExpiredVerificationCodes() (int64, error)
+	// Password reset
+	// Stores the hash of a password reset token (replacing any previous token)
+	SetPasswordResetToken(id int, hash string, expiry time.Time) error
+	// Puts back the previous password reset token (clearing it if empty), unless the stored token has changed
+	RestorePasswordResetToken(id int, hash string, previousHash string, previousExpiry *time.Time) error
+	// Sets the (hashed) password of the user with an unexpired password reset token, and clears the token
+	ResetPassword(tokenHash string, hashedPassword string) (*db.User, error)
+	// Clears password reset tokens that have expired. Returns the number of users updated
+	ClearExpiredPasswordResetTokens() (int64, error)
 }
 
 type userRepository struct {
@@ -70,7 +84,7 @@ func (r *userRepository) FindById(userId int) (*db.User, error) {
 	// Create an empty ref object of type user
 	user := db.User{}
 	// Check if user exists in db
-	result := r.DB.Select("ID", "name", "username", "email", "verified", "password", "created_at", "updated_at", "deleted_at", "verification_code_expiry").First(&user, userId)
+	result := r.DB.Select("ID", "name", "username", "email", "language", "verified", "password", "created_at", "updated_at", "deleted_at", "verification_code_expiry").First(&user, userId)
 
 	// If error detected
 	if result.Error != nil {
@@ -166,3 +180,97 @@ func (r *userRepository) FindByVerificationCode(token string) (*db.User, error)
 	// else
 	return &user, nil
 }
+
+// Stores the hash of a password reset token and its expiry. Replaces the previous token, so only the latest link works
+func (r *userRepository) SetPasswordResetToken(id int, hash string, expiry time.Time) error {
+	result := r.DB.Model(&db.User{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"password_reset_token_hash": hash, "password_reset_expiry": expiry})
+	if result.Error != nil {
+		return fmt.Errorf("failed storing password reset token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Replaces the password reset token with the previous one (or clears it if there was none).
+// The update only applies while the token is still stored, so newer tokens aren't replaced
+func (r *userRepository) RestorePasswordResetToken(id int, hash string, previousHash string, previousExpiry *time.Time) error {
+	updates := map[string]interface{}{"password_reset_token_hash": nil, "password_reset_expiry": nil}
+	if previousHash != "" {
+		updates = map[string]interface{}{"password_reset_token_hash": previousHash, "password_reset_expiry": previousExpiry}
+	}
+	result := r.DB.Model(&db.User{}).
+		Where("id = ? AND password_reset_token_hash = ?", id, hash).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed restoring password reset token: %w", result.Error)
+	}
+	return nil
+}
+
+// Sets the password of the user with the (unexpired) password reset token and clears the token.
+// The update only applies while the token is stored, so the token can only be used once
+func (r *userRepository) ResetPassword(tokenHash string, hashedPassword string) (*db.User, error) {
+	// Find the user with the token
+	user := db.User{}
+	result := r.DB.Where("password_reset_token_hash = ? AND password_reset_expiry > ?", tokenHash, time.Now()).First(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	// Set the password and clear the token (unless used by a concurrent request)
+	result = r.DB.Model(&db.User{}).
+		Where("id = ? AND password_reset_token_hash = ?", user.ID, tokenHash).
+		Updates(map[string]interface{}{"password": hashedPassword, "password_reset_token_hash": nil, "password_reset_expiry": nil})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed resetting password: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &user, nil
+}
+
+// Clears password reset tokens (and their expiry) that have expired
+func (r *userRepository) ClearExpiredPasswordResetTokens() (int64, error) {
+	result := r.DB.Model(&db.User{}).
+		Where("password_reset_token_hash IS NOT NULL AND password_reset_expiry < ?", time.Now()).
+		Updates(map[string]interface{}{"password_reset_token_hash": nil, "password_reset_expiry": nil})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed clearing expired password reset tokens: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Replaces the verification code with the previous one (or clears it if there was none).
+// The update only applies while the code is still stored, so newer codes aren't replaced
+func (r *userRepository) RestoreVerificationCode(id int, code string, previousCode string, previousExpiry time.Time) error {
+	updates := map[string]interface{}{"verification_code": nil, "verification_code_expiry": nil}
+	if previousCode != "" {
+		updates = map[string]interface{}{"verification_code": previousCode, "verification_code_expiry": previousExpiry}
+	}
+	result := r.DB.Model(&db.User{}).
+		Where("id = ? AND verification_code = ?", id, code).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed restoring verification code: %w", result.Error)
+	}
+	return nil
+}
+
+// Clears verification codes (and their expiry) that have expired
+func (r *userRepository) ClearExpiredVerificationCodes() (int64, error) {
+	result := r.DB.Model(&db.User{}).
+		Where("verification_code IS NOT NULL AND verification_code <> '' AND verification_code_expiry < ?", time.Now()).
+		Updates(map[string]interface{}{"verification_code": nil, "verification_code_expiry": nil})
+
+	// If error detected
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed clearing expired verification codes: %w", result.Error)
+	}
+	// else
+	return result.RowsAffected, nil
+}
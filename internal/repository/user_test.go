@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
@@ -137,6 +138,53 @@ func TestUserRepository_FindByVerificationCode(t *testing.T) {
 	testModule.dbClient.Delete(createdUser)
 }
 
+func TestUserRepository_ClearExpiredVerificationCodes(t *testing.T) {
+	// Create a user with an expired verification code and one with a valid code
+	expiredUser, err := hashPassAndGenerateUserInDb(&db.User{
+		Username:               "Expired",
+		Email:                  "expired@ymail.com",
+		Password:               "password",
+		Name:                   "Expired",
+		VerificationCode:       "expired-code",
+		VerificationCodeExpiry: time.Now().Add(-time.Hour),
+	}, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	validUser, err := hashPassAndGenerateUserInDb(&db.User{
+		Username:               "Valid",
+		Email:                  "valid@ymail.com",
+		Password:               "password",
+		Name:                   "Valid",
+		VerificationCode:       "valid-code",
+		VerificationCodeExpiry: time.Now().Add(time.Hour),
+	}, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	// Test function
+	cleared, err := testModule.users.repo.ClearExpiredVerificationCodes()
+	if err != nil {
+		t.Fatalf("failed to clear expired verification codes: %v", err)
+	}
+	if cleared != 1 {
+		t.Errorf("expected 1 verification code to be cleared, got %d", cleared)
+	}
+
+	// Only the expired code should be cleared
+	if _, err := testModule.users.repo.FindByVerificationCode("expired-code"); err == nil {
+		t.Errorf("expected expired verification code to be cleared")
+	}
+	if _, err := testModule.users.repo.FindByVerificationCode("valid-code"); err != nil {
+		t.Errorf("expected valid verification code to be kept: %v", err)
+	}
+
+	// Clean up: Delete created users
+	testModule.dbClient.Delete(expiredUser)
+	testModule.dbClient.Delete(validUser)
+}
+
 func TestUserRepository_Delete(t *testing.T) {
 	createdUser, err := hashPassAndGenerateUserInDb(&db.User{
 		Username: "Jabar",
@@ -56,6 +56,100 @@ func AddAdminActionRouteSet(router *chi.Mux, protected bool, urlExtension string
 	return router
 }
 
+// Adds routes for managing users in the admin panel, including resetting their two-factor authentication
+func AddAdminUserRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminUserController) *chi.Mux {
+	// List, create, edit and delete
+	router = AddAdminRouteSet(router, protected, urlExtension, controller)
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Reset two-factor authentication (GET confirmation / POST reset)
+		mux.Get(fmt.Sprintf("/admin/%s/reset-two-factor/{id}", urlExtension), controller.ResetTwoFactor)
+		mux.Post(fmt.Sprintf("/admin/%s/reset-two-factor/{id}", urlExtension), controller.ResetTwoFactor)
+		mux.Get(fmt.Sprintf("/admin/%s/reset-two-factor/success", urlExtension), controller.ResetTwoFactorSuccess)
+	})
+	return router
+}
+
+// Adds routes for inspecting and managing background jobs in the admin panel
+func AddAdminJobRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminJobController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Read All
+		mux.Get(fmt.Sprintf("/admin/%s", urlExtension), controller.FindAll)
+		// Retry (GET confirmation / POST retry)
+		mux.Get(fmt.Sprintf("/admin/%s/retry/{id}", urlExtension), controller.Retry)
+		mux.Post(fmt.Sprintf("/admin/%s/retry/{id}", urlExtension), controller.Retry)
+		mux.Get(fmt.Sprintf("/admin/%s/retry/success", urlExtension), controller.RetrySuccess)
+		// Cancel (GET confirmation / POST cancel)
+		mux.Get(fmt.Sprintf("/admin/%s/cancel/{id}", urlExtension), controller.Cancel)
+		mux.Post(fmt.Sprintf("/admin/%s/cancel/{id}", urlExtension), controller.Cancel)
+		mux.Get(fmt.Sprintf("/admin/%s/cancel/success", urlExtension), controller.CancelSuccess)
+		// Delete
+		mux.Get(fmt.Sprintf("/admin/%s/delete/{id}", urlExtension), controller.Delete)
+		mux.Post(fmt.Sprintf("/admin/%s/delete/{id}", urlExtension), controller.Delete)
+		mux.Get(fmt.Sprintf("/admin/%s/delete/success", urlExtension), controller.DeleteSuccess)
+		// Bulk actions (from table)
+		mux.Post(fmt.Sprintf("/admin/%s/bulk-retry", urlExtension), controller.BulkRetry)
+		mux.Post(fmt.Sprintf("/admin/%s/bulk-cancel", urlExtension), controller.BulkCancel)
+		mux.Delete(fmt.Sprintf("/admin/%s/bulk-delete", urlExtension), controller.BulkDelete)
+
+		// View One
+		mux.Get(fmt.Sprintf("/admin/%s/{id}", urlExtension), controller.View)
+	})
+	return router
+}
+
+// Adds routes for previewing the emails captured by the file email driver in the admin panel
+func AddAdminOutboxRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminOutboxController) *chi.Mux {
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Read All
+		mux.Get(fmt.Sprintf("/admin/%s", urlExtension), controller.FindAll)
+		// Bulk delete (from table)
+		mux.Delete(fmt.Sprintf("/admin/%s/bulk-delete", urlExtension), controller.BulkDelete)
+
+		// View One
+		mux.Get(fmt.Sprintf("/admin/%s/{id}", urlExtension), controller.View)
+		// HTML body preview
+		mux.Get(fmt.Sprintf("/admin/%s/{id}/html", urlExtension), controller.HTML)
+	})
+	return router
+}
+
+// Adds routes for viewing the email log in the admin panel and resending logged emails
+func AddAdminEmailLogRouteSet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminEmailLogController) *chi.Mux {
+	// List, view and delete
+	router = AddAdminRouteSet(router, protected, urlExtension, controller)
+	// Reassign for consistency
+	r := router
+	r.Group(func(mux chi.Router) {
+		// Set to use JWT authentication if protected
+		if protected {
+			mux.Use(auth.AuthenticateJWT)
+		}
+		// Resend
+		mux.Get(fmt.Sprintf("/admin/%s/resend/{id}", urlExtension), controller.Resend)
+		mux.Post(fmt.Sprintf("/admin/%s/resend/{id}", urlExtension), controller.Resend)
+		mux.Get(fmt.Sprintf("/admin/%s/resend/success", urlExtension), controller.ResendSuccess)
+	})
+	return router
+}
+
 // Adds routess for editing and creating admin auth policies for the admin panel
 func AddAdminPolicySet(router *chi.Mux, protected bool, urlExtension string, controller adminpanel.AdminAuthPolicyController) *chi.Mux {
 	// Reassign for consistency
@@ -103,10 +197,17 @@ func AddBasicAdminRoutes(router *chi.Mux, controller adminpanel.AdminCoreControl
 		mux.Get("/admin", controller.AdminRedirectBasedOnLoginStatus)
 		mux.Get("/admin/login", controller.Login)
 		mux.Post("/admin/login", controller.Login)
+		// Second login step (two-factor authentication)
+		mux.Get("/admin/login/two-factor", controller.LoginTwoFactor)
+		mux.Post("/admin/login/two-factor", controller.LoginTwoFactor)
 
 		// admin logout
 		mux.Get("/admin/logout", controller.Logout)
 
+		// Reset password (link from password reset emails)
+		mux.Get("/admin/reset-password", controller.ResetPassword)
+		mux.Post("/admin/reset-password", controller.ResetPassword)
+
 		// Private routes
 		mux.Group(func(mux chi.Router) {
 			mux.Use(auth.AuthenticateJWT)
@@ -120,6 +221,9 @@ func AddBasicAdminRoutes(router *chi.Mux, controller adminpanel.AdminCoreControl
 			mux.Post("/admin/change-password", controller.ChangePassword)
 
 			mux.Get("/admin/change-password-success", controller.ChangePasswordSuccess)
+			// Two-factor authentication enrolment
+			mux.Get("/admin/two-factor", controller.TwoFactor)
+			mux.Post("/admin/two-factor", controller.TwoFactor)
 
 		})
 
@@ -24,6 +24,8 @@ type api struct {
 	// Basic Controllers
 	User   core.UserController
 	Policy core.AuthPolicyController
+	Email  core.EmailController
+	ApiKey core.ApiKeyController
 	// Admin Controller
 	Admin adminpanel.AdminPanelController
 	// Module Controllers
@@ -36,6 +38,8 @@ func NewApi(
 	admin adminpanel.AdminPanelController,
 	user core.UserController,
 	policy core.AuthPolicyController,
+	emailController core.EmailController,
+	apiKeyController core.ApiKeyController,
 	moduleMap models.ModuleMap) Api {
-	return &api{Admin: admin, User: user, Policy: policy, ModuleMap: moduleMap}
+	return &api{Admin: admin, User: user, Policy: policy, Email: emailController, ApiKey: apiKeyController, ModuleMap: moduleMap}
 }
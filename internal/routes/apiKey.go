@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	chi "github.com/go-chi/chi/v5"
+)
+
+// Adds API key routes to a Chi mux router (users managing their own keys)
+func AddApiKeyApiRoutes(router *chi.Mux, apiKeyController core.ApiKeyController) *chi.Mux {
+	// Private routes
+	router.Group(func(mux chi.Router) {
+		mux.Use(auth.AuthenticateJWT)
+
+		// My API keys
+		mux.Get("/api/me/tokens", apiKeyController.GetMyApiKeys)
+		mux.Post("/api/me/tokens", apiKeyController.CreateMyApiKey)
+		mux.Delete("/api/me/tokens/{id}", apiKeyController.DeleteMyApiKey)
+	})
+	return router
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/controller/core"
+	"github.com/dmawardi/Go-Template/internal/email"
+	chi "github.com/go-chi/chi/v5"
+)
+
+// Adds email routes to a Chi mux router (unsubscribe links and email preferences)
+func AddEmailApiRoutes(router *chi.Mux, emailController core.EmailController) *chi.Mux {
+	// Public routes
+	router.Group(func(mux chi.Router) {
+		// Unsubscribe links (signed)
+		mux.Get(email.UnsubscribePath, emailController.Unsubscribe)
+		mux.Post(email.UnsubscribePath, emailController.Unsubscribe)
+
+		// Private routes
+		mux.Group(func(mux chi.Router) {
+			mux.Use(auth.AuthenticateJWT)
+
+			// My email preferences
+			mux.Get("/api/me/email-preferences", emailController.GetMyEmailPreferences)
+			mux.Put("/api/me/email-preferences", emailController.UpdateMyEmailPreferences)
+		})
+	})
+	return router
+}
@@ -26,15 +26,29 @@ func (a api) Routes() http.Handler {
 	// Add user and group API routes
 	mux = AddUserApiRoutes(mux, a.User)
 	mux = AddAuthRBACApiRoutes(mux, a.Policy)
+	// Add email routes (unsubscribe links and preferences)
+	mux = AddEmailApiRoutes(mux, a.Email)
+	// Add API key routes (users managing their own keys)
+	mux = AddApiKeyApiRoutes(mux, a.ApiKey)
 
 	// Add basic admin panel routes (home, login, etc)
 	mux = AddBasicAdminRoutes(mux, a.Admin.Base)
 	// Add admin user routes
-	mux = AddAdminRouteSet(mux, true, "users", a.Admin.User)
+	mux = AddAdminUserRouteSet(mux, true, "users", a.Admin.User)
 	// Add admin policy routes
 	mux = AddAdminPolicySet(mux, true, "policy", a.Admin.Auth)
 	// Add admin action routes
 	mux = AddAdminActionRouteSet(mux, true, "actions", a.Admin.Action)
+	// Add admin background job routes
+	mux = AddAdminJobRouteSet(mux, true, "jobs", a.Admin.Job)
+	// Add admin email outbox routes
+	mux = AddAdminOutboxRouteSet(mux, true, "outbox", a.Admin.Outbox)
+	// Add admin email log routes
+	mux = AddAdminEmailLogRouteSet(mux, true, "email-logs", a.Admin.EmailLog)
+	// Add admin email suppression list routes
+	mux = AddAdminRouteSet(mux, true, "email-suppressions", a.Admin.EmailSuppression)
+	// Add admin API key routes
+	mux = AddAdminRouteSet(mux, true, "api-keys", a.Admin.ApiKey)
 
 	// Other schemas
 	for _, module := range a.ModuleMap {
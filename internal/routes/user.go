@@ -16,8 +16,18 @@ func AddUserApiRoutes(router *chi.Mux, user core.UserController) *chi.Mux {
 		mux.Get("/", controller.GetJobs)
 		// Login
 		mux.Post("/api/users/login", user.Login)
+		// Second login step of users with two-factor authentication
+		mux.Post("/api/users/login/2fa", user.LoginTwoFactor)
+		// Exchange a refresh token for a new token pair
+		mux.Post("/api/users/refresh", user.Refresh)
+		// Logout (using a refresh token, or the session of the access token)
+		mux.Post("/api/users/logout", user.Logout)
+		// Public keys verifying access tokens
+		mux.Get("/.well-known/jwks.json", core.JWKS)
 		// Forgot password
 		mux.Post("/api/users/forgot-password", user.ResetPassword)
+		// Set a new password using the token from a password reset email
+		mux.Post("/api/users/reset-password", user.CompletePasswordReset)
 		// Verify Email
 		mux.Get("/api/users/verify-email/{token}", user.EmailVerification)
 
@@ -40,6 +50,10 @@ func AddUserApiRoutes(router *chi.Mux, user core.UserController) *chi.Mux {
 			mux.Get("/api/me", user.GetMyUserDetails)
 			mux.Post("/api/me", controller.HealthCheck)
 			mux.Put("/api/me", user.UpdateMyProfile)
+			// My two-factor authentication (status, enrolment and confirmation)
+			mux.Get("/api/me/2fa", user.GetMyTwoFactor)
+			mux.Post("/api/me/2fa", user.EnrolTwoFactor)
+			mux.Post("/api/me/2fa/confirm", user.ConfirmTwoFactor)
 
 			// Email verification
 			mux.Post("/api/users/send-verification-email", user.ResendVerificationEmail)
@@ -0,0 +1,159 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+func TestApiKeyService_Create(t *testing.T) {
+	owner, cleanup := createApiKeyOwner(t, "creator@ymail.com")
+	defer cleanup()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(24 * time.Hour)
+	var tests = []struct {
+		name        string
+		scopes      []db.ApiKeyScope
+		expiresAt   *time.Time
+		expectedErr error
+	}{
+		{"Scope owner has", []db.ApiKeyScope{{Object: "/api/posts", Action: "read"}}, nil, nil},
+		{"Scopes are normalized", []db.ApiKeyScope{{Object: " /api/posts ", Action: "Read"}}, &future, nil},
+		{"Fail: Scope owner doesn't have", []db.ApiKeyScope{{Object: "/api/posts", Action: "read"}, {Object: "/api/posts", Action: "delete"}}, nil, coreservices.ErrInvalidApiKeyScope},
+		{"Fail: Invalid action", []db.ApiKeyScope{{Object: "/api/posts", Action: "write"}}, nil, coreservices.ErrInvalidApiKeyScope},
+		{"Fail: Invalid object", []db.ApiKeyScope{{Object: "api/posts", Action: "read"}}, nil, coreservices.ErrInvalidApiKeyScope},
+		{"Fail: No scopes", []db.ApiKeyScope{}, nil, coreservices.ErrInvalidApiKeyScope},
+		{"Fail: Expiry passed", []db.ApiKeyScope{{Object: "/api/posts", Action: "read"}}, &past, coreservices.ErrInvalidApiKeyExpiry},
+	}
+	for _, v := range tests {
+		created, err := testModule.apiKeys.serv.Create(&models.CreateApiKey{UserID: owner.ID, Name: v.name, Scopes: v.scopes, ExpiresAt: v.expiresAt})
+		if !errors.Is(err, v.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.expectedErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// The key is only returned on creation, and only its hash is stored
+		if created.Key == "" || created.Prefix != created.Key[:len(created.Prefix)] || created.KeyHash != auth.HashToken(created.Key) {
+			t.Errorf("%s: unexpected key %+v", v.name, created)
+		}
+		found, err := testModule.apiKeys.serv.FindById(int(created.ID))
+		if err != nil {
+			t.Fatalf("%s: failed to find key: %v", v.name, err)
+		}
+		if found.Key != "" || len(found.Scopes) != 1 || found.Scopes[0] != (db.ApiKeyScope{Object: "/api/posts", Action: "read"}) {
+			t.Errorf("%s: unexpected stored key %+v", v.name, found)
+		}
+	}
+
+	keys, err := testModule.apiKeys.serv.FindByUser(int(owner.ID))
+	if err != nil || len(keys) != 2 {
+		t.Errorf("Expected 2 keys for the owner, got %d (%v)", len(keys), err)
+	}
+}
+
+func TestApiKeyService_Authentication(t *testing.T) {
+	owner, cleanup := createApiKeyOwner(t, "integration@ymail.com")
+	defer cleanup()
+
+	created, err := testModule.apiKeys.serv.Create(&models.CreateApiKey{UserID: owner.ID, Name: "Integration", Scopes: []db.ApiKeyScope{{Object: "/api/posts", Action: "read"}}})
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	// Requests made with the key act on behalf of the owner
+	tokenData, err := validateApiKey(created.Key)
+	if err != nil {
+		t.Fatalf("Expected key to be accepted, got %v", err)
+	}
+	if tokenData.UserID != fmt.Sprint(owner.ID) || tokenData.Email != owner.Email || tokenData.Role != "user" || tokenData.ApiKeyID != created.ID || len(tokenData.ApiKeyScopes) != 1 {
+		t.Errorf("Unexpected token data %+v", tokenData)
+	}
+	found, err := testModule.apiKeys.serv.FindById(int(created.ID))
+	if err != nil || found.LastUsedAt == nil {
+		t.Errorf("Expected the last use of the key to be recorded, got %+v (%v)", found, err)
+	}
+
+	var tests = []struct {
+		name  string
+		key   string
+		setup func()
+	}{
+		{"Fail: Unknown key", created.Key + "x", func() {}},
+		{"Fail: Expired key", created.Key, func() {
+			testModule.dbClient.Model(&db.ApiKey{}).Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute))
+		}},
+		{"Fail: Deleted key", created.Key, func() {
+			if err := testModule.apiKeys.serv.DeleteForUser(int(owner.ID), int(created.ID)); err != nil {
+				t.Fatalf("Failed to delete key: %v", err)
+			}
+		}},
+	}
+	for _, v := range tests {
+		v.setup()
+		if _, err := validateApiKey(v.key); err == nil {
+			t.Errorf("%s: expected key to be rejected", v.name)
+		}
+	}
+}
+
+func TestApiKeyService_DeleteForUser(t *testing.T) {
+	owner, cleanup := createApiKeyOwner(t, "keyowner@ymail.com")
+	defer cleanup()
+	other, cleanupOther := createApiKeyOwner(t, "otherowner@ymail.com")
+	defer cleanupOther()
+
+	created, err := testModule.apiKeys.serv.Create(&models.CreateApiKey{UserID: owner.ID, Name: "Owned", Scopes: []db.ApiKeyScope{{Object: "/api/posts", Action: "read"}}})
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+
+	// Keys of other users aren't found
+	if err := testModule.apiKeys.serv.DeleteForUser(int(other.ID), int(created.ID)); err == nil {
+		t.Errorf("Expected key of another user not to be deleted")
+	}
+	if err := testModule.apiKeys.serv.DeleteForUser(int(owner.ID), int(created.ID)); err != nil {
+		t.Errorf("Expected owner to delete key, got %v", err)
+	}
+	if _, err := testModule.apiKeys.serv.FindById(int(created.ID)); err == nil {
+		t.Errorf("Expected key to be deleted")
+	}
+}
+
+// Creates a user allowed to read posts, and returns a function removing the user, their policies and their keys
+func createApiKeyOwner(t *testing.T, email string) (*db.User, func()) {
+	owner, err := testModule.users.repo.Create(&db.User{Username: "Integrator", Email: email, Password: "password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	app.Auth.Enforcer.AddRoleForUser(fmt.Sprint(owner.ID), "role:user")
+	added, _ := app.Auth.Enforcer.AddPolicy("role:user", "/api/posts", "read")
+	return owner, func() {
+		testModule.dbClient.Where("user_id = ?", owner.ID).Delete(&db.ApiKey{})
+		app.Auth.Enforcer.DeleteRolesForUser(fmt.Sprint(owner.ID))
+		if added {
+			app.Auth.Enforcer.RemovePolicy("role:user", "/api/posts", "read")
+		}
+		testModule.dbClient.Unscoped().Delete(owner)
+	}
+}
+
+// Validates an API key as sent by integrations
+func validateApiKey(key string) (*auth.AuthToken, error) {
+	req, err := http.NewRequest("GET", "/api/posts", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "ApiKey "+key)
+	return auth.ValidateAndParseToken(req)
+}
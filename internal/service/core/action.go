@@ -6,21 +6,30 @@ import (
 	"strconv"
 
 	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
 	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+	"gorm.io/gorm"
 )
 
 
 
 type actionService struct {
 	repo corerepositories.ActionRepository
+	// Actions cached by ID
+	cache *cache.Typed[*db.Action]
 }
 
 func NewActionService(repo corerepositories.ActionRepository) webapi.ActionService {
-	return &actionService{repo: repo}
+	return &actionService{repo: repo,
+		cache: cache.NewTyped[*db.Action](app.Cache, "action", cache.TypedOptions[*db.Action]{
+			NotFound:    gorm.ErrRecordNotFound,
+			NegativeTTL: cache.DefaultNegativeTTL,
+		}),
+	}
 }
 // Record action in database
 func (s *actionService) RecordAction(r *http.Request, schemaName string, schemaID uint, recordAction *models.RecordedAction, changeObjects helpers.ChangeLogInput) error {
@@ -68,6 +77,11 @@ func (s *actionService) RecordAction(r *http.Request, schemaName string, schemaI
 	return nil
 }
 func (s *actionService) RecordBulkDelete(r *http.Request, schemaName, pluralSchemaName string,  schemaIDs []int, recordAction *models.RecordedAction) error {
+	description := fmt.Sprintf("Bulk Deleted %d %s: %s", len(schemaIDs), pluralSchemaName, fmt.Sprint(schemaIDs))
+	return s.RecordBulkAction(r, schemaName, schemaIDs, recordAction, description)
+}
+// Record an action applied to multiple records (eg. bulk retry) using the given description
+func (s *actionService) RecordBulkAction(r *http.Request, schemaName string, schemaIDs []int, recordAction *models.RecordedAction, description string) error {
 	// Validate and parse token to obtain adminID
 	admin, err := auth.ValidateAndParseToken(r)
 	if err != nil {
@@ -87,7 +101,7 @@ func (s *actionService) RecordBulkDelete(r *http.Request, schemaName, pluralSche
 		EntityType:  schemaName,
 		EntityID:    fmt.Sprint(schemaIDs),
 		Changes:     "{}",
-		Description: fmt.Sprintf("Bulk Deleted %d %s: %s", len(schemaIDs), pluralSchemaName, fmt.Sprint(schemaIDs)),
+		Description: description,
 		IPAddress:   r.RemoteAddr,
 		AdminID:     uint(intAdminID),
 	}
@@ -117,6 +131,8 @@ func (s *actionService) Create(action *models.CreateAction) (*db.Action, error)
 	if err != nil {
 		return nil, fmt.Errorf("failed creating action: %w", err)
 	}
+	// Clear a cached "not found" result for the new ID
+	s.cache.Delete(created.ID)
 
 	return created, nil
 }
@@ -130,27 +146,10 @@ func (s *actionService) FindAll(limit int, offset int, order string, conditions
 }
 // Find action in database by ID
 func (s *actionService) FindById(id int) (*db.Action, error) {
-	// Search cache
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("action:%d", id)
-	// Check if action is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached action
-		return cachedPost.(*db.Action), nil
-	}
-
-	// Find action by id
-	action, err := s.repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store action in cache
-	app.Cache.Store(cacheKey, action)
-
-	return action, nil
+	// Load the action from the cache, or from the database if not cached
+	return s.cache.GetOrLoad(id, 0, func() (*db.Action, error) {
+		return s.repo.FindById(id)
+	})
 }
 // Delete action in database
 func (s *actionService) Delete(id int) error {
@@ -161,8 +160,7 @@ func (s *actionService) Delete(id int) error {
 		return err
 	}
 	// else
-	cacheKey := fmt.Sprintf("action:%d", id)
-	app.Cache.Delete(cacheKey)
+	s.cache.Delete(id)
 	return nil
 }
 // Deletes multiple actions in database
@@ -175,8 +173,7 @@ func (s *actionService) BulkDelete(ids []int) error {
 	}
 	// else
 	for _, id := range ids {
-		cacheKey := fmt.Sprintf("action:%d", id)
-		app.Cache.Delete(cacheKey)
+		s.cache.Delete(id)
 	}
 	return nil
 }
@@ -198,8 +195,7 @@ func (s *actionService) Update(id int, action *models.UpdateAction) (*db.Action,
 	}
 
 	// Store updated action in cache
-	cacheKey := fmt.Sprintf("action:%d", id)
-	app.Cache.Store(cacheKey, updated)
+	s.cache.Set(id, updated, 0)
 
 	return updated, nil
 }
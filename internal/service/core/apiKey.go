@@ -0,0 +1,172 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+	"github.com/dmawardi/Go-Template/internal/models"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+	"gorm.io/gorm"
+)
+
+// Returned for invalid scopes, or scopes that aren't one of the owner's permissions
+var ErrInvalidApiKeyScope = errors.New("invalid API key scope")
+
+// Returned when the expiry given for a key has already passed
+var ErrInvalidApiKeyExpiry = errors.New("API key expiry must be in the future")
+
+// Number of characters at the start of a key stored to tell keys apart
+const apiKeyPrefixLength = 8
+
+type ApiKeyService interface {
+	// API keys of every user (admin)
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.ApiKey], error)
+	FindById(int) (*db.ApiKey, error)
+	// Creates a key for its owner. The key itself is only returned here
+	Create(key *models.CreateApiKey) (*db.ApiKey, error)
+	Update(int, *models.UpdateApiKey) (*db.ApiKey, error)
+	Delete(int) error
+	BulkDelete([]int) error
+	// API keys of a user
+	FindByUser(userID int) ([]db.ApiKey, error)
+	// Deletes a key of a user. Keys of other users aren't found
+	DeleteForUser(userID int, id int) error
+}
+
+type apiKeyService struct {
+	repo corerepositories.ApiKeyRepository
+}
+
+func NewApiKeyService(repo corerepositories.ApiKeyRepository) ApiKeyService {
+	return &apiKeyService{repo}
+}
+
+// Generates a key for its owner, restricted to the given scopes. Only the hash of the key is stored,
+// so it's set in the returned key but can't be found again
+func (s *apiKeyService) Create(key *models.CreateApiKey) (*db.ApiKey, error) {
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidApiKeyExpiry
+	}
+	scopes, err := validateApiKeyScopes(key.UserID, key.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.repo.Create(&db.ApiKey{
+		UserID:    key.UserID,
+		Name:      strings.TrimSpace(key.Name),
+		Prefix:    token[:apiKeyPrefixLength],
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: key.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	created.Key = token
+	return created, nil
+}
+
+// Find a list of API keys in the database
+func (s *apiKeyService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.ApiKey], error) {
+	keys, err := s.repo.FindAll(limit, offset, order, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Find API key in database by ID
+func (s *apiKeyService) FindById(id int) (*db.ApiKey, error) {
+	key, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Find the API keys of a user
+func (s *apiKeyService) FindByUser(userID int) ([]db.ApiKey, error) {
+	keys, err := s.repo.FindByUserID(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Renames an API key or changes its expiry
+func (s *apiKeyService) Update(id int, key *models.UpdateApiKey) (*db.ApiKey, error) {
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidApiKeyExpiry
+	}
+	updated, err := s.repo.Update(id, &db.ApiKey{
+		Name:      strings.TrimSpace(key.Name),
+		ExpiresAt: key.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Deletes an API key (revoking it)
+func (s *apiKeyService) Delete(id int) error {
+	err := s.repo.Delete(id)
+	if err != nil {
+		fmt.Println("error in deleting API key: ", err)
+		return err
+	}
+	return nil
+}
+
+// Deletes multiple API keys
+func (s *apiKeyService) BulkDelete(ids []int) error {
+	err := s.repo.BulkDelete(ids)
+	if err != nil {
+		fmt.Println("error in bulk deleting API keys: ", err)
+		return err
+	}
+	return nil
+}
+
+// Deletes an API key of a user
+func (s *apiKeyService) DeleteForUser(userID int, id int) error {
+	found, err := s.repo.FindById(id)
+	if err != nil {
+		return err
+	}
+	if found.UserID != uint(userID) {
+		return gorm.ErrRecordNotFound
+	}
+	return s.Delete(id)
+}
+
+// Normalizes the scopes of a new key and checks that each one is a permission of the owner
+// (keys can't be given access their owner doesn't have)
+func validateApiKeyScopes(userID uint, scopes []db.ApiKeyScope) ([]db.ApiKeyScope, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidApiKeyScope)
+	}
+	validated := []db.ApiKeyScope{}
+	for _, scope := range scopes {
+		scope.Object = strings.TrimSpace(scope.Object)
+		scope.Action = strings.ToLower(strings.TrimSpace(scope.Action))
+		if !strings.HasPrefix(scope.Object, "/") || !utility.ArrayContainsString(auth.ApiKeyActions, scope.Action) {
+			return nil, fmt.Errorf("%w: %q (expected an action of %s and a path)", ErrInvalidApiKeyScope, scope.String(), strings.Join(auth.ApiKeyActions, ", "))
+		}
+		if !auth.Authorize(fmt.Sprint(userID), scope.Object, scope.Action) {
+			return nil, fmt.Errorf("%w: %q isn't one of your permissions", ErrInvalidApiKeyScope, scope.String())
+		}
+		validated = append(validated, scope)
+	}
+	return validated, nil
+}
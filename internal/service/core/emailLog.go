@@ -0,0 +1,272 @@
+package coreservices
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+	"gorm.io/gorm"
+)
+
+// Returned when an email log entry doesn't hold the message needed to resend the email
+var ErrEmailNotResendable = errors.New("email log entry doesn't contain the message sent")
+
+// How long email log entries are kept when EMAIL_LOG_RETENTION isn't set
+const DefaultEmailLogRetention = 90 * 24 * time.Hour
+
+// Job type for purging email log entries whose retention has passed
+const PurgeEmailLogsJobType = "purge-email-logs"
+
+// Recurring job that purges old email log entries every night at 3:45am
+var PurgeEmailLogsSchedule = queue.Schedule{
+	Name:    "nightly-purge-email-logs",
+	Spec:    "45 3 * * *",
+	JobType: PurgeEmailLogsJobType,
+	Payload: "{}",
+}
+
+// Builds the job handlers for jobs processed by the email log service.
+// Entries are kept for the given retention (DefaultEmailLogRetention if not set)
+func NewEmailLogJobHandlers(service EmailLogService, retention time.Duration) []queue.JobHandler {
+	if retention <= 0 {
+		retention = DefaultEmailLogRetention
+	}
+	return []queue.JobHandler{
+		queue.NewJobHandler(PurgeEmailLogsJobType, func(payload struct{}) error {
+			return service.PurgeEmailLogs(time.Now().Add(-retention))
+		}),
+	}
+}
+
+// Recorded as the response of emails accepted by email services that don't report a response (eg. the log driver)
+const emailAcceptedResponse = "accepted"
+
+type EmailLogService interface {
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error)
+	FindById(int) (*db.EmailLog, error)
+	Create(emailLog *models.CreateEmailLog) (*db.EmailLog, error)
+	Update(int, *models.UpdateEmailLog) (*db.EmailLog, error)
+	Delete(int) error
+	BulkDelete([]int) error
+	// Records an attempt to send the email of an email job (used by the job queue)
+	LogEmailDelivery(delivery queue.EmailDelivery) error
+	// Queues the email recorded in an email log entry to be sent again
+	Resend(int) error
+	// Permanently deletes the entries created before the given time
+	PurgeEmailLogs(before time.Time) error
+}
+
+type emailLogService struct {
+	repo  corerepositories.EmailLogRepository
+	queue queue.JobQueue
+}
+
+func NewEmailLogService(repo corerepositories.EmailLogRepository, jobQueue queue.JobQueue) EmailLogService {
+	return &emailLogService{repo: repo, queue: jobQueue}
+}
+
+// Creates an email log entry in the database
+func (s *emailLogService) Create(emailLog *models.CreateEmailLog) (*db.EmailLog, error) {
+	toCreate := db.EmailLog{
+		JobID:      emailLog.JobID,
+		Recipients: emailLog.Recipients,
+		Subject:    emailLog.Subject,
+		Template:   emailLog.Template,
+		Category:   emailLog.Category,
+		Status:     emailLog.Status,
+		Attempts:   1,
+		Response:   emailLog.Response,
+		Message:    emailLog.Message,
+	}
+	if toCreate.Status == db.EmailStatusSent {
+		sentAt := time.Now()
+		toCreate.SentAt = &sentAt
+	}
+
+	created, err := s.repo.Create(&toCreate)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating email log: %w", err)
+	}
+	return created, nil
+}
+
+// Find a list of email log entries in the database
+func (s *emailLogService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailLog], error) {
+	emailLogs, err := s.repo.FindAll(limit, offset, order, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return emailLogs, nil
+}
+
+// Find email log entry in database by ID
+func (s *emailLogService) FindById(id int) (*db.EmailLog, error) {
+	emailLog, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	return emailLog, nil
+}
+
+// Updates email log entry in database
+func (s *emailLogService) Update(id int, emailLog *models.UpdateEmailLog) (*db.EmailLog, error) {
+	toUpdate := &db.EmailLog{
+		Status:   emailLog.Status,
+		Attempts: emailLog.Attempts,
+		Response: emailLog.Response,
+		SentAt:   emailLog.SentAt,
+	}
+
+	updated, err := s.repo.Update(id, toUpdate)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Delete email log entry in database
+func (s *emailLogService) Delete(id int) error {
+	err := s.repo.Delete(id)
+	if err != nil {
+		fmt.Println("error in deleting email log: ", err)
+		return err
+	}
+	return nil
+}
+
+// Deletes multiple email log entries in database
+func (s *emailLogService) BulkDelete(ids []int) error {
+	err := s.repo.BulkDelete(ids)
+	if err != nil {
+		fmt.Println("error in bulk deleting email logs: ", err)
+		return err
+	}
+	return nil
+}
+
+// Records an attempt to send the email of an email job. The first attempt of a job creates an entry,
+// later attempts (retries) update it with the outcome of the latest attempt
+func (s *emailLogService) LogEmailDelivery(delivery queue.EmailDelivery) error {
+	// Determine the outcome of the attempt
+	status := db.EmailStatusSent
+	response := delivery.Response
+	if delivery.Err != nil {
+		status = db.EmailStatusFailed
+		// Record the error if the mail server didn't reply (eg. it couldn't be reached)
+		if response == "" {
+			response = delivery.Err.Error()
+		}
+	} else if len(delivery.Message.Recipients()) == 0 && len(delivery.Suppressed) > 0 {
+		// Every recipient was suppressed, so the email wasn't sent
+		status = db.EmailStatusSuppressed
+	} else if response == "" {
+		response = emailAcceptedResponse
+	}
+	// Note the recipients left out of the email
+	if len(delivery.Suppressed) > 0 {
+		suppressedNote := "suppressed: " + strings.Join(delivery.Suppressed, ", ")
+		if response == "" {
+			response = suppressedNote
+		} else {
+			response = suppressedNote + "\n" + response
+		}
+	}
+
+	// Update the entry of a job that has already been attempted
+	if delivery.JobID != 0 {
+		found, err := s.repo.FindByJobID(delivery.JobID)
+		if err == nil {
+			toUpdate := &models.UpdateEmailLog{
+				Status:   status,
+				Attempts: found.Attempts + 1,
+				Response: response,
+			}
+			if status == db.EmailStatusSent {
+				sentAt := time.Now()
+				toUpdate.SentAt = &sentAt
+			}
+			_, err = s.Update(int(found.ID), toUpdate)
+			return err
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	// Store the message so the email can be resent. The bodies of emails that can contain secrets
+	// (eg. password reset links and verification codes) aren't stored, so they can't be resent
+	stored := delivery.Message
+	if !emailBodyStorable(stored.Category) {
+		stored.HTMLBody = ""
+		stored.TextBody = ""
+		stored.Attachments = nil
+	}
+	message, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	_, err = s.Create(&models.CreateEmailLog{
+		JobID:      delivery.JobID,
+		Recipients: strings.Join(append(delivery.Message.Recipients(), delivery.Suppressed...), ", "),
+		Subject:    delivery.Message.Subject,
+		Template:   delivery.Template,
+		Category:   delivery.Message.Category,
+		Status:     status,
+		Response:   response,
+		Message:    string(message),
+	})
+	return err
+}
+
+// Queues a new email job sending the message recorded in an email log entry.
+// The delivery of the new job is recorded in a new entry
+func (s *emailLogService) Resend(id int) error {
+	found, err := s.repo.FindById(id)
+	if err != nil {
+		return err
+	}
+	if found.Message == "" {
+		return ErrEmailNotResendable
+	}
+	var message email.EmailMessage
+	if err := json.Unmarshal([]byte(found.Message), &message); err != nil {
+		return fmt.Errorf("%w: %v", ErrEmailNotResendable, err)
+	}
+	// Emails that weren't sent to anyone (every recipient was suppressed) or whose body wasn't stored
+	if len(message.Recipients()) == 0 || (message.HTMLBody == "" && message.TextBody == "") {
+		return ErrEmailNotResendable
+	}
+
+	// Build the payload of the email job
+	payload := queue.NewEmailJobPayload(message)
+	payload.Template = found.Template
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return s.queue.AddJob(queue.EmailJobType, string(payloadBytes))
+}
+
+// Deletes the email log entries created before the given time
+func (s *emailLogService) PurgeEmailLogs(before time.Time) error {
+	purged, err := s.repo.DeleteCreatedBefore(before)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d email log entries\n", purged)
+	return nil
+}
+
+// Checks if the body of an email can be stored in the email log: only emails users can opt out of
+// (eg. newsletters). Account emails and emails without a category can contain passwords, links and codes
+func emailBodyStorable(category string) bool {
+	found, ok := email.FindCategory(category)
+	return ok && !found.Transactional
+}
@@ -0,0 +1,221 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/models"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+	"gorm.io/gorm"
+)
+
+// Returned when a category users can't opt out of is given (unregistered or transactional)
+var ErrInvalidEmailCategory = errors.New("users can't opt out of this email category")
+
+type EmailSuppressionService interface {
+	// Suppression list (admin)
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailSuppression], error)
+	FindById(int) (*db.EmailSuppression, error)
+	Create(suppression *models.CreateEmailSuppression) (*db.EmailSuppression, error)
+	Update(int, *models.UpdateEmailSuppression) (*db.EmailSuppression, error)
+	Delete(int) error
+	BulkDelete([]int) error
+	// Returns the recipients that mustn't receive emails of the category (used by the job queue)
+	SuppressedRecipients(recipients []string, category string) ([]string, error)
+	// Adds an address the mail server permanently rejected to the suppression list (used by the job queue)
+	SuppressBounce(address, response string) error
+	// Unsubscribes an address from an email category (used by unsubscribe links)
+	Unsubscribe(address, category string) error
+	// Email categories users can opt out of and whether the user receives them
+	FindPreferences(userID int) ([]models.EmailPreference, error)
+	UpdatePreferences(userID int, preferences *models.UpdateEmailPreferences) ([]models.EmailPreference, error)
+}
+
+type emailSuppressionService struct {
+	repo        corerepositories.EmailSuppressionRepository
+	preferences corerepositories.EmailPreferenceRepository
+}
+
+func NewEmailSuppressionService(repo corerepositories.EmailSuppressionRepository, preferences corerepositories.EmailPreferenceRepository) EmailSuppressionService {
+	return &emailSuppressionService{repo: repo, preferences: preferences}
+}
+
+// Adds an address to the suppression list
+func (s *emailSuppressionService) Create(suppression *models.CreateEmailSuppression) (*db.EmailSuppression, error) {
+	created, err := s.repo.Create(&db.EmailSuppression{
+		Email:  suppression.Email,
+		Reason: suppression.Reason,
+		Detail: suppression.Detail,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed creating email suppression: %w", err)
+	}
+	return created, nil
+}
+
+// Find a list of suppressed addresses in the database
+func (s *emailSuppressionService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.EmailSuppression], error) {
+	suppressions, err := s.repo.FindAll(limit, offset, order, conditions)
+	if err != nil {
+		return nil, err
+	}
+	return suppressions, nil
+}
+
+// Find suppressed address in database by ID
+func (s *emailSuppressionService) FindById(id int) (*db.EmailSuppression, error) {
+	suppression, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	return suppression, nil
+}
+
+// Updates the reason an address is suppressed
+func (s *emailSuppressionService) Update(id int, suppression *models.UpdateEmailSuppression) (*db.EmailSuppression, error) {
+	updated, err := s.repo.Update(id, &db.EmailSuppression{
+		Reason: suppression.Reason,
+		Detail: suppression.Detail,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Removes an address from the suppression list
+func (s *emailSuppressionService) Delete(id int) error {
+	err := s.repo.Delete(id)
+	if err != nil {
+		fmt.Println("error in deleting email suppression: ", err)
+		return err
+	}
+	return nil
+}
+
+// Removes multiple addresses from the suppression list
+func (s *emailSuppressionService) BulkDelete(ids []int) error {
+	err := s.repo.BulkDelete(ids)
+	if err != nil {
+		fmt.Println("error in bulk deleting email suppressions: ", err)
+		return err
+	}
+	return nil
+}
+
+// Returns the recipients that are on the suppression list or belong to users who opted out of the category.
+// Transactional emails (eg. password resets) are sent to everyone, emails without a category are checked against the list
+func (s *emailSuppressionService) SuppressedRecipients(recipients []string, category string) ([]string, error) {
+	if email.IsTransactional(category) || len(recipients) == 0 {
+		return nil, nil
+	}
+
+	// Addresses that mustn't receive any non-transactional emails
+	excluded := map[string]bool{}
+	suppressions, err := s.repo.FindByEmails(recipients)
+	if err != nil {
+		return nil, err
+	}
+	for _, suppression := range suppressions {
+		excluded[suppression.Email] = true
+	}
+	// Users that opted out of the category
+	unsubscribed, err := s.preferences.FindUnsubscribedEmails(recipients, category)
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range unsubscribed {
+		excluded[address] = true
+	}
+
+	var suppressed []string
+	for _, recipient := range recipients {
+		if excluded[strings.ToLower(strings.TrimSpace(recipient))] {
+			suppressed = append(suppressed, recipient)
+		}
+	}
+	return suppressed, nil
+}
+
+// Adds a hard bounced address to the suppression list (addresses already on the list keep their reason)
+func (s *emailSuppressionService) SuppressBounce(address, response string) error {
+	return s.suppress(address, db.SuppressionReasonHardBounce, response)
+}
+
+// Unsubscribes an address from a category. Users opt out of the category (see UpdatePreferences),
+// other addresses (eg. newsletter subscribers without an account) are added to the suppression list
+func (s *emailSuppressionService) Unsubscribe(address, category string) error {
+	if strings.TrimSpace(category) == "" || email.IsTransactional(category) {
+		return ErrInvalidEmailCategory
+	}
+
+	userID, err := s.preferences.FindUserIDByEmail(address)
+	if err == nil {
+		return s.preferences.Upsert(&db.EmailPreference{UserID: userID, Category: category, Subscribed: false})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return s.suppress(address, db.SuppressionReasonUnsubscribed, fmt.Sprintf("Unsubscribed from %s emails", category))
+}
+
+// Finds whether the user receives each email category they can opt out of
+func (s *emailSuppressionService) FindPreferences(userID int) ([]models.EmailPreference, error) {
+	found, err := s.preferences.FindByUserID(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	subscribed := map[string]bool{}
+	for _, preference := range found {
+		subscribed[preference.Category] = preference.Subscribed
+	}
+
+	preferences := []models.EmailPreference{}
+	for _, category := range email.Categories() {
+		if category.Transactional {
+			continue
+		}
+		// Users receive categories they haven't opted out of
+		isSubscribed, ok := subscribed[category.Name]
+		preferences = append(preferences, models.EmailPreference{
+			Category:    category.Name,
+			Description: category.Description,
+			Subscribed:  !ok || isSubscribed,
+		})
+	}
+	return preferences, nil
+}
+
+// Updates the email categories a user receives. Categories not included are left unchanged
+func (s *emailSuppressionService) UpdatePreferences(userID int, preferences *models.UpdateEmailPreferences) ([]models.EmailPreference, error) {
+	// Validate every category before saving
+	for name := range preferences.Categories {
+		category, ok := email.FindCategory(name)
+		if !ok || category.Transactional {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidEmailCategory, name)
+		}
+	}
+	for name, subscribed := range preferences.Categories {
+		err := s.preferences.Upsert(&db.EmailPreference{UserID: uint(userID), Category: name, Subscribed: subscribed})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.FindPreferences(userID)
+}
+
+// Adds an address to the suppression list unless it's already on it
+func (s *emailSuppressionService) suppress(address, reason, detail string) error {
+	found, err := s.repo.FindByEmails([]string{address})
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		return nil
+	}
+	_, err = s.repo.Create(&db.EmailSuppression{Email: address, Reason: reason, Detail: detail})
+	return err
+}
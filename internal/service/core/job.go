@@ -0,0 +1,151 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+)
+
+// Returned when a job's status doesn't allow the requested change
+var (
+	ErrJobNotRetryable   = errors.New("only failed, dead or cancelled jobs can be retried")
+	ErrJobNotCancellable = errors.New("only pending, waiting or failed jobs can be cancelled")
+	ErrJobNotDeletable   = queue.ErrJobRunning
+)
+
+type JobService interface {
+	FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters, filter models.JobFilter) (*models.BasicPaginatedResponse[db.Job], error)
+	FindById(int) (*db.Job, error)
+	// Finds the distinct job types stored (used for filtering)
+	FindJobTypes() ([]string, error)
+	Delete(int) error
+	BulkDelete([]int) error
+	// Requeues a failed, dead or cancelled job to be run again with a fresh set of attempts
+	Retry(int) (*db.Job, error)
+	// Cancels a pending, waiting or failed job so it won't be run
+	Cancel(int) (*db.Job, error)
+	// Retries/cancels jobs in bulk. Jobs with a status that doesn't allow the change are skipped.
+	// Returns the number of jobs updated
+	BulkRetry([]int) (int64, error)
+	BulkCancel([]int) (int64, error)
+}
+
+type jobService struct {
+	repo corerepositories.JobRepository
+	// Retries, cancels and deletes jobs (updating their chains and batches)
+	manager queue.JobManager
+}
+
+func NewJobService(repo corerepositories.JobRepository, manager queue.JobManager) JobService {
+	return &jobService{repo: repo, manager: manager}
+}
+
+// Find a list of jobs in the database
+func (s *jobService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters, filter models.JobFilter) (*models.BasicPaginatedResponse[db.Job], error) {
+	jobs, err := s.repo.FindAll(limit, offset, order, conditions, filter)
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Find job in database by ID
+func (s *jobService) FindById(id int) (*db.Job, error) {
+	job, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Finds the distinct job types stored
+func (s *jobService) FindJobTypes() ([]string, error) {
+	return s.repo.FindJobTypes()
+}
+
+// Delete job in database (cancelling the jobs after it in its chain if it hasn't finished). Running jobs can't be deleted
+func (s *jobService) Delete(id int) error {
+	err := s.manager.DeleteJobs([]uint{uint(id)})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Bulk delete jobs in database. Running jobs are skipped and reported with ErrJobNotDeletable
+func (s *jobService) BulkDelete(ids []int) error {
+	err := s.manager.DeleteJobs(jobIDs(ids))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Requeues a failed, dead or cancelled job
+func (s *jobService) Retry(id int) (*db.Job, error) {
+	return s.updateOne(id, s.manager.RetryJobs, ErrJobNotRetryable)
+}
+
+// Cancels a pending, waiting or failed job
+func (s *jobService) Cancel(id int) (*db.Job, error) {
+	return s.updateOne(id, s.manager.CancelJobs, ErrJobNotCancellable)
+}
+
+// Requeues the failed, dead or cancelled jobs with the given IDs
+func (s *jobService) BulkRetry(ids []int) (int64, error) {
+	return s.manager.RetryJobs(jobIDs(ids))
+}
+
+// Cancels the pending, waiting or failed jobs with the given IDs
+func (s *jobService) BulkCancel(ids []int) (int64, error) {
+	return s.manager.CancelJobs(jobIDs(ids))
+}
+
+// Applies a change to a single job, which skips jobs with a status that doesn't allow it. Returns the updated job
+func (s *jobService) updateOne(id int, change func(ids []uint) (int64, error), statusErr error) (*db.Job, error) {
+	updated, err := change([]uint{uint(id)})
+	if err != nil {
+		return nil, err
+	}
+	// If not updated, determine whether the job is missing or has the wrong status
+	if updated == 0 {
+		if _, err := s.repo.FindById(id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("job %d: %w", id, statusErr)
+	}
+	return s.repo.FindById(id)
+}
+
+// Converts job IDs given as ints
+func jobIDs(ids []int) []uint {
+	converted := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		converted = append(converted, uint(id))
+	}
+	return converted
+}
+
+// Checks if a job's status allows it to be retried
+func JobCanBeRetried(job db.Job) bool {
+	return hasJobStatus(job, queue.RetryableJobStatuses)
+}
+
+// Checks if a job's status allows it to be cancelled
+func JobCanBeCancelled(job db.Job) bool {
+	return hasJobStatus(job, queue.CancellableJobStatuses)
+}
+
+// Checks if a job has one of the given statuses
+func hasJobStatus(job db.Job, statuses []string) bool {
+	for _, status := range statuses {
+		if job.Status == status {
+			return true
+		}
+	}
+	return false
+}
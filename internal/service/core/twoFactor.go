@@ -0,0 +1,263 @@
+package coreservices
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/helpers/utility"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+// How long users have to complete the second login step
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// Invalid codes allowed before the second login step is locked, and how long it stays locked
+const (
+	maxTwoFactorAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// Number of recovery codes given when two-factor authentication is enabled
+const recoveryCodeCount = 10
+
+// Returned for unknown, expired or completed login challenges
+var ErrInvalidTwoFactorChallenge = errors.New("invalid or expired two-factor challenge")
+
+// Returned for codes that don't match the authenticator (or an unused recovery code)
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// Returned while the second login step is locked after too many invalid codes
+var ErrTwoFactorLocked = errors.New("too many invalid two-factor codes, try again later")
+
+// Returned when enrolling a user who already has two-factor authentication
+var ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// Returned when confirming an enrolment that wasn't started
+var ErrTwoFactorNotEnrolled = errors.New("two-factor enrolment not started")
+
+// Completes the login of a user with two-factor authentication, using the challenge token returned by LoginUser
+// and a code from their authenticator (or a recovery code). Starts a new session
+func (s *userService) VerifyTwoFactorLogin(challengeToken string, code string) (*models.LoginResponse, error) {
+	hash := auth.HashToken(challengeToken)
+	found, err := s.twoFactor.FindByChallenge(hash)
+	if err != nil {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	now := time.Now()
+	if found.ConfirmedAt == nil || found.ChallengeExpiresAt == nil || found.ChallengeExpiresAt.Before(now) {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	if found.LockedUntil != nil && found.LockedUntil.After(now) {
+		return nil, ErrTwoFactorLocked
+	}
+
+	valid, err := s.checkTwoFactorCode(found, code)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		locked, err := s.twoFactor.RecordFailedAttempt(found.UserID, maxTwoFactorAttempts, now.Add(twoFactorLockout))
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			fmt.Printf("Too many invalid two-factor codes for user %d. Locking the second login step\n", found.UserID)
+			return nil, ErrTwoFactorLocked
+		}
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	// Challenges can only be completed once
+	completed, err := s.twoFactor.CompleteChallenge(found.UserID, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	user, err := s.FindById(int(found.UserID))
+	if err != nil {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+	fmt.Println("User completed two-factor login: ", user.Email)
+	sessionID, err := auth.GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user, sessionID)
+}
+
+// Returns the two-factor authentication status of a user
+func (s *userService) TwoFactorStatus(userId int) (*models.TwoFactorStatus, error) {
+	user, err := s.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := s.findEnabledTwoFactor(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := &models.TwoFactorStatus{
+		Enabled:  enabled != nil,
+		Required: auth.TwoFactorRequired(fmt.Sprint(user.ID), user.Role),
+	}
+	if status.Enabled {
+		status.RecoveryCodesRemaining, err = s.twoFactor.CountRecoveryCodes(user.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Starts a two-factor enrolment. Returns the secret to add to an authenticator app, which is
+// only used once the enrolment is confirmed. Starting again returns the pending secret
+func (s *userService) BeginTwoFactorEnrolment(userId int) (*models.TwoFactorEnrolment, error) {
+	user, err := s.FindById(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret string
+	existing, err := s.twoFactor.FindByUserID(user.ID)
+	switch {
+	case err == nil && existing.ConfirmedAt != nil:
+		return nil, ErrTwoFactorAlreadyEnabled
+	case err == nil:
+		secret = existing.Secret
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		secret, err = auth.GenerateTOTPSecret()
+		if err != nil {
+			return nil, fmt.Errorf("failed generating two-factor secret: %w", err)
+		}
+		if _, err = s.twoFactor.SaveSecret(user.ID, secret); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// Authenticator apps add the account by scanning the QR code of the URI
+	uri := auth.TOTPURI(auth.TOTPIssuer(), user.Email, secret)
+	qrCode, err := auth.TOTPQRCode(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TwoFactorEnrolment{Secret: secret, URI: uri, QRCode: qrCode}, nil
+}
+
+// Confirms a two-factor enrolment using a code from the authenticator app, enabling two-factor authentication.
+// Returns the recovery codes of the user (only shown once)
+func (s *userService) ConfirmTwoFactorEnrolment(userId int, code string) (*models.TwoFactorRecoveryCodes, error) {
+	existing, err := s.twoFactor.FindByUserID(uint(userId))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, valid := auth.ValidateTOTP(existing.Secret, code, time.Now())
+	if !valid {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	confirmed, err := s.twoFactor.Confirm(uint(userId), step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return &models.TwoFactorRecoveryCodes{RecoveryCodes: codes}, nil
+}
+
+// Removes the two-factor authentication of a user (eg. after losing their authenticator and recovery codes).
+// Every session of the user ends
+func (s *userService) ResetTwoFactor(userId int) error {
+	user, err := s.FindById(userId)
+	if err != nil {
+		return err
+	}
+	if err := s.twoFactor.Delete(user.ID); err != nil {
+		return err
+	}
+	return s.revokeSessions(userId)
+}
+
+// Starts the second login step of a user with two-factor authentication.
+// Returns the challenge token instead of a session
+func (s *userService) startTwoFactorChallenge(twoFactor *db.TwoFactor) (*models.LoginResponse, error) {
+	challengeToken, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.twoFactor.SetChallenge(twoFactor.UserID, hash, time.Now().Add(TwoFactorChallengeTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{TwoFactorRequired: true, ChallengeToken: challengeToken}, nil
+}
+
+// Checks a code from the authenticator app or an unused recovery code. Accepted codes can't be used again
+func (s *userService) checkTwoFactorCode(twoFactor *db.TwoFactor, code string) (bool, error) {
+	if step, valid := auth.ValidateTOTP(twoFactor.Secret, code, time.Now()); valid {
+		// Rejects a code already used (eg. seen by someone else)
+		return s.twoFactor.UseStep(twoFactor.UserID, step)
+	}
+	return s.twoFactor.UseRecoveryCode(twoFactor.UserID, auth.HashToken(normalizeRecoveryCode(code)))
+}
+
+// Returns the confirmed two-factor enrolment of a user, or nil if two-factor authentication isn't enabled
+func (s *userService) findEnabledTwoFactor(userID uint) (*db.TwoFactor, error) {
+	found, err := s.twoFactor.FindByUserID(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if found.ConfirmedAt == nil {
+		return nil, nil
+	}
+	return found, nil
+}
+
+// Checks whether a user must set up two-factor authentication before accessing anything else
+func (s *userService) twoFactorSetupRequired(user *models.UserWithRole) (bool, error) {
+	enabled, err := s.findEnabledTwoFactor(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return enabled == nil && auth.TwoFactorRequired(fmt.Sprint(user.ID), user.Role), nil
+}
+
+// Generates the recovery codes of a user (eg. "k3x9a-m2p7q"). Returns the codes and the hashes stored
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		random, err := utility.GenerateRandomString(10)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed generating recovery codes: %w", err)
+		}
+		code := strings.ToLower(random)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, auth.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// Normalizes a recovery code as typed by the user (case and separators don't matter)
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
@@ -5,18 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dmawardi/Go-Template/internal/auth"
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/helpers/utility"
-	webapi "github.com/dmawardi/Go-Template/internal/helpers/webApi"
 	"github.com/dmawardi/Go-Template/internal/models"
 	"github.com/dmawardi/Go-Template/internal/queue"
 	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type UserService interface {
@@ -28,25 +32,133 @@ type UserService interface {
 	Delete(int) error
 	BulkDelete([]int) error
 	CheckPasswordMatch(id int, password []byte) bool
-	// Login
-	LoginUser(login *models.Login) (string, error)
-	// Takes an email and if the email is found in the database, will reset the password and send an email to the user with the new password
-	ResetPasswordAndSendEmail(email string) error
+	// Login. Starts a session and returns its access and refresh tokens. Users with two-factor
+	// authentication get a challenge token for the second step (VerifyTwoFactorLogin) instead
+	LoginUser(login *models.Login) (*models.LoginResponse, error)
+	// Second login step of users with two-factor authentication. Starts a session
+	VerifyTwoFactorLogin(challengeToken string, code string) (*models.LoginResponse, error)
+	// Exchanges a refresh token for a new token pair. Reusing a refresh token revokes its session
+	RefreshToken(refreshToken string) (*models.LoginResponse, error)
+	// Ends the session of a refresh token
+	Logout(refreshToken string) error
+	// Ends a session using its ID (eg. the session of an access token)
+	RevokeSession(sessionID string) error
+	// Deletes refresh tokens that have expired
+	PurgeExpiredRefreshTokens() error
+	// Two-factor authentication status of a user
+	TwoFactorStatus(userId int) (*models.TwoFactorStatus, error)
+	// Starts a two-factor enrolment, returning the secret to add to an authenticator app
+	BeginTwoFactorEnrolment(userId int) (*models.TwoFactorEnrolment, error)
+	// Enables two-factor authentication using a code from the authenticator app. Returns the recovery codes
+	ConfirmTwoFactorEnrolment(userId int, code string) (*models.TwoFactorRecoveryCodes, error)
+	// Removes the two-factor authentication of a user and ends their sessions
+	ResetTwoFactor(userId int) error
+	// Takes an email and if the email is found in the database, sends the user a link to reset their password
+	SendPasswordResetEmail(email string) error
+	// Sets a new password using a password reset token. Ends every session of the user
+	ResetPassword(token string, newPassword string) error
+	// Clears password reset tokens that have expired
+	PurgeExpiredPasswordResetTokens() error
 	// Verifies user email in database
 	VerifyEmailCode(token string) error
 	// Sends verification email for user
 	ResendVerificationEmail(id int) error
+	// Clears verification codes that have expired
+	PurgeExpiredVerificationCodes() error
 }
 
+// Account emails (verification and password reset) are time sensitive,
+// so they are sent on the high priority queue ahead of other jobs
+var accountEmailJobOptions = queue.JobOptions{
+	Queue:    queue.HighPriorityQueue,
+	Priority: queue.PriorityHigh,
+}
+
+// Window in which repeated requests to resend a verification email don't queue another email
+const VerificationEmailResendWindow = 5 * time.Minute
+
+// Job type for purging expired verification codes
+const PurgeVerificationCodesJobType = "purge-verification-codes"
+
+// Recurring job that purges expired verification codes every night at 3am
+var PurgeVerificationCodesSchedule = queue.Schedule{
+	Name:    "nightly-purge-verification-codes",
+	Spec:    "0 3 * * *",
+	JobType: PurgeVerificationCodesJobType,
+	Payload: "{}",
+}
+
+// How long password reset links are valid
+const PasswordResetTokenTTL = time.Hour
+
+// Job type for purging expired password reset tokens
+const PurgePasswordResetTokensJobType = "purge-password-reset-tokens"
+
+// Recurring job that purges expired password reset tokens every night at 3:15am
+var PurgePasswordResetTokensSchedule = queue.Schedule{
+	Name:    "nightly-purge-password-reset-tokens",
+	Spec:    "15 3 * * *",
+	JobType: PurgePasswordResetTokensJobType,
+	Payload: "{}",
+}
+
+// Job type for purging expired refresh tokens
+const PurgeRefreshTokensJobType = "purge-refresh-tokens"
+
+// Recurring job that purges expired refresh tokens every night at 3:30am
+var PurgeRefreshTokensSchedule = queue.Schedule{
+	Name:    "nightly-purge-refresh-tokens",
+	Spec:    "30 3 * * *",
+	JobType: PurgeRefreshTokensJobType,
+	Payload: "{}",
+}
+
+// Builds the job handlers for jobs processed by the user service
+func NewUserJobHandlers(service UserService) []queue.JobHandler {
+	return []queue.JobHandler{
+		queue.NewJobHandler(PurgeVerificationCodesJobType, func(payload struct{}) error {
+			return service.PurgeExpiredVerificationCodes()
+		}),
+		queue.NewJobHandler(PurgeRefreshTokensJobType, func(payload struct{}) error {
+			return service.PurgeExpiredRefreshTokens()
+		}),
+		queue.NewJobHandler(PurgePasswordResetTokensJobType, func(payload struct{}) error {
+			return service.PurgeExpiredPasswordResetTokens()
+		}),
+	}
+}
+
+// Returned for unknown, expired or used password reset tokens
+var ErrInvalidPasswordResetToken = errors.New("invalid or expired password reset token")
+
+// Returned for unknown, expired or revoked refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Returned when a refresh token that was already exchanged is used again. Its session is revoked,
+// as the token may have been stolen
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// How long users found by ID are cached
+const userCacheTTL = 10 * time.Minute
+
 type userService struct {
-	repo  corerepositories.UserRepository
-	auth  corerepositories.AuthPolicyRepository
-	queue *queue.Queue
+	repo          corerepositories.UserRepository
+	auth          corerepositories.AuthPolicyRepository
+	refreshTokens corerepositories.RefreshTokenRepository
+	twoFactor     corerepositories.TwoFactorRepository
+	queue         queue.JobQueue
+	// Users (with role) cached by ID. Missing users are cached briefly
+	cache *cache.Typed[*models.UserWithRole]
 }
 
 // Builds a new service with injected repository. Includes email service
-func NewUserService(repo corerepositories.UserRepository, auth corerepositories.AuthPolicyRepository, jobQueue *queue.Queue) UserService {
-	return &userService{repo: repo, auth: auth, queue: jobQueue}
+func NewUserService(repo corerepositories.UserRepository, auth corerepositories.AuthPolicyRepository, refreshTokens corerepositories.RefreshTokenRepository, twoFactor corerepositories.TwoFactorRepository, jobQueue queue.JobQueue) UserService {
+	return &userService{repo: repo, auth: auth, refreshTokens: refreshTokens, twoFactor: twoFactor, queue: jobQueue,
+		cache: cache.NewTyped[*models.UserWithRole](app.Cache, "user", cache.TypedOptions[*models.UserWithRole]{
+			NotFound:    gorm.ErrRecordNotFound,
+			NegativeTTL: cache.DefaultNegativeTTL,
+		}),
+	}
 }
 
 // Creates a user in the database
@@ -78,6 +190,7 @@ func (s *userService) Create(user *models.CreateUser) (*models.UserWithRole, err
 		Password: string(hashedPassword),
 		Name:     user.Name,
 		Email:    user.Email,
+		Language: user.Language,
 		Verified: &user.Verified,
 	}
 
@@ -96,6 +209,9 @@ func (s *userService) Create(user *models.CreateUser) (*models.UserWithRole, err
 		return nil, fmt.Errorf("failed creating user: %w", err)
 	}
 
+	// Clear a cached "not found" result for the new ID
+	s.invalidate(int(created.ID))
+
 	// Combine user and role data
 	userToReturn := BuildUserWithRole(created, user.Role)
 
@@ -128,32 +244,18 @@ func (s *userService) FindAll(limit int, offset int, order string, conditions []
 
 // Find user in database by ID
 func (s *userService) FindById(userId int) (*models.UserWithRole, error) {
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("user:%d", userId)
-	// Attempt to load the user from the cache first
-	cachedUser, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found and not expired, return the cached user
-		return cachedUser.(*models.UserWithRole), nil
-	}
-	// Find user by id
-	user, err := s.repo.FindById(userId)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Get user role and attach to user
-	fullUser, err := findRoleAndAttach(user, s.auth)
-	if err != nil {
-		return nil, err
-	}
-
-	// Cache the full user with a TTL before returning
-	// Assuming you have defined a duration for the TTL
-	app.Cache.Store(cacheKey, fullUser)
-
-	return fullUser, nil
+	// Load the user from the cache, or from the database if not cached.
+	// Concurrent lookups of the same user share a single query
+	return s.cache.GetOrLoad(userId, userCacheTTL, func() (*models.UserWithRole, error) {
+		// Find user by id
+		user, err := s.repo.FindById(userId)
+		// If error detected
+		if err != nil {
+			return nil, err
+		}
+		// Get user role and attach to user
+		return findRoleAndAttach(user, s.auth)
+	})
 }
 
 // Find user in database by email
@@ -194,10 +296,7 @@ func (s *userService) Delete(id int) error {
 	}
 
 	// If all successful, delete user from cache
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("user:%d", id)
-	// Delete record in cache
-	app.Cache.Delete(cacheKey)
+	s.invalidate(id)
 
 	// else
 	return nil
@@ -213,10 +312,8 @@ func (s *userService) BulkDelete(ids []int) error {
 	}
 	// Iterate through ids and delete all user roles and cache records
 	for _, id := range ids {
-		// Define a key with a naming convention
-		cacheKey := fmt.Sprintf("user:%d", id)
 		// Delete record in cache
-		app.Cache.Delete(cacheKey)
+		s.invalidate(id)
 
 		// Delete all user roles
 		success, err := s.auth.DeleteRolesForUser(fmt.Sprint(id))
@@ -238,7 +335,7 @@ func (s *userService) BulkDelete(ids []int) error {
 func (s *userService) Update(id int, user *models.UpdateUser) (*models.UserWithRole, error) {
 
 	// Create db User type from incoming DTO
-	toUpdate := &db.User{Name: user.Name, Username: user.Username, Email: user.Email, Verified: &user.Verified}
+	toUpdate := &db.User{Name: user.Name, Username: user.Username, Email: user.Email, Language: user.Language, Verified: &user.Verified}
 
 	// If the user password is not empty
 	if user.Password != "" {
@@ -274,94 +371,280 @@ func (s *userService) Update(id int, user *models.UpdateUser) (*models.UserWithR
 		return nil, err
 	}
 
-	// Cache the full user with a TTL before returning
-	cacheKey := fmt.Sprintf("user:%d", id)
-	app.Cache.Store(cacheKey, fullUser, 10*time.Minute)
+	// End every session of the user if their password changed
+	if user.Password != "" {
+		if err := s.revokeSessions(id); err != nil {
+			return nil, err
+		}
+	}
+
+	// Invalidate the user (and entries embedding it), then cache the full user with a TTL before returning
+	s.invalidate(id)
+	s.cache.Set(id, fullUser, userCacheTTL)
 
 	return fullUser, nil
 }
 
-// Takes an email and if the email is found in the database, will reset the password and send an email to the user with the new password
-func (s *userService) ResetPasswordAndSendEmail(userEmail string) error {
+// Invalidates the cached users and every cached entry embedding them (eg. posts tagged with their user)
+func (s *userService) invalidate(ids ...int) {
+	tags := make([]string, len(ids))
+	for i, id := range ids {
+		tags[i] = cache.EntityTag("user", id)
+	}
+	app.Cache.InvalidateTags(tags...)
+}
+
+// Takes an email and if the email is found in the database, sends the user a link to reset their password.
+// The link contains a single use token (only its hash is stored) that expires after PasswordResetTokenTTL.
+// The password only changes once the token is used (see ResetPassword)
+func (s *userService) SendPasswordResetEmail(userEmail string) error {
 	// Check if user exists in db
 	foundUser, err := s.repo.FindByEmail(userEmail)
 	if err != nil {
-		fmt.Println("error in resetting password. User not found: ", userEmail)
+		fmt.Println("error in sending password reset email. User not found: ", userEmail)
 		return err
 	}
 	// Else
-	// Generate random password
-	randomPassword, err := utility.GenerateRandomString(10)
+	// Generate a reset token
+	token, hash, err := auth.GenerateToken()
 	if err != nil {
 		return err
 	}
-	// Update found user's password
-	s.repo.Update(int(foundUser.ID), &db.User{Password: randomPassword})
 
 	// Build data for template
 	data := struct {
-		Name        string
-		NewPassword string
+		Name      string
+		ResetUrl  template.URL
+		ExpiresIn int
 	}{
-		Name:        foundUser.Name,
-		NewPassword: randomPassword,
+		Name:      foundUser.Name,
+		ResetUrl:  template.URL(passwordResetURL(token)),
+		ExpiresIn: int(PasswordResetTokenTTL.Minutes()),
 	}
 
-	// Build HTML email template from file using injected data
-	emailString, err := webapi.LoadTemplate(webapi.BuildPathFromWorkingDirectory("internal/email/templates/password-reset.tmpl"), data)
+	// Render email template in the user's language using injected data
+	rendered, err := email.RenderTemplate(email.PasswordResetTemplate, foundUser.Language, data)
 	if err != nil {
-		fmt.Printf("error in loading template: %v", err)
+		fmt.Printf("error in rendering template: %v", err)
 		return err
 	}
 
 	// Create payload containing details for email job
-	payload := queue.EmailJobPayload{
-		Recipient: foundUser.Email,
-		Subject:   "Password Reset Request",
-		Body:      emailString,
-	}
+	payload := queue.NewTemplateEmailJobPayload(*rendered, foundUser.Email)
+	// Account emails are transactional, so they're sent even if the user opted out of other emails
+	payload.Category = email.CategoryAccount
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	// Add job to queue
-	err = s.queue.AddJob("email", string(payloadBytes))
+	// Store the token before queueing its email, so the link works as soon as the email is sent
+	err = s.repo.SetPasswordResetToken(int(foundUser.ID), hash, time.Now().Add(PasswordResetTokenTTL))
 	if err != nil {
+		return err
+	}
+
+	// Add job to queue. Only one reset email is queued per user within the resend window
+	jobOptions := accountEmailJobOptions
+	jobOptions.UniqueKey = fmt.Sprintf("password-reset-email:%d", foundUser.ID)
+	jobOptions.UniqueFor = VerificationEmailResendWindow
+	err = s.queue.AddJobWithOptions(queue.EmailJobType, string(payloadBytes), jobOptions)
+	if err != nil {
+		// The new token isn't emailed. Put back the previous token, so the link of an email already queued keeps working
+		restoreErr := s.repo.RestorePasswordResetToken(int(foundUser.ID), hash, foundUser.PasswordResetTokenHash, foundUser.PasswordResetExpiry)
+		if restoreErr != nil {
+			return restoreErr
+		}
+		if errors.Is(err, queue.ErrDuplicateJob) {
+			return nil
+		}
 		return errors.New("error adding job to queue")
 	}
+	return nil
+}
 
-	// Return no error found
+// Sets a new password using a password reset token. The token can only be used once,
+// and every session of the user ends (including any started by someone who knew the old password)
+func (s *userService) ResetPassword(token string, newPassword string) error {
+	// Build hashed password from user password input
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	user, err := s.repo.ResetPassword(auth.HashToken(token), string(hashedPassword))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidPasswordResetToken
+		}
+		return err
+	}
+
+	s.invalidate(int(user.ID))
+	return s.revokeSessions(int(user.ID))
+}
+
+// Clears password reset tokens that have expired
+func (s *userService) PurgeExpiredPasswordResetTokens() error {
+	purged, err := s.repo.ClearExpiredPasswordResetTokens()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d expired password reset token(s)\n", purged)
 	return nil
 }
 
-func (s *userService) LoginUser(login *models.Login) (token string, err error) {
-	// Init token string
-	tokenString := ""
+// Builds the link sent in password reset emails. Points to PASSWORD_RESET_URL (eg. a page of the frontend
+// that posts the token and new password to /api/users/reset-password) or the admin panel's reset page
+func passwordResetURL(token string) string {
+	resetUrl := os.Getenv("PASSWORD_RESET_URL")
+	if resetUrl == "" {
+		// SERVER_PORT prefixed with :
+		resetUrl = "http://" + os.Getenv("SERVER_BASE_URL") + os.Getenv("SERVER_PORT") + "/admin/reset-password"
+	}
+	separator := "?"
+	if strings.Contains(resetUrl, "?") {
+		separator = "&"
+	}
+	return resetUrl + separator + "token=" + url.QueryEscape(token)
+}
 
+// Logs in a user and starts a session. Returns the access and refresh tokens of the session
+func (s *userService) LoginUser(login *models.Login) (*models.LoginResponse, error) {
 	// Find user by email
 	found, err := s.FindByEmail(login.Email)
 	if err != nil {
-		return "", errors.New("invalid credentials")
+		return nil, errors.New("invalid credentials")
 	}
 
 	// If user is found
 	// Compare stored (hashed) password with input password
 	err = bcrypt.CompareHashAndPassword([]byte(found.Password), []byte(login.Password))
 	if err != nil {
-		return "", errors.New("incorrect username/password")
+		return nil, errors.New("incorrect username/password")
 	}
 
-	// If match found provide the token string for the user
-	if err == nil {
-		fmt.Println("User logging in: ", found.Email)
-		// Set login status to true
-		tokenString, err = auth.GenerateJWT(int(found.ID), found.Email, found.Role)
+	// Users with two-factor authentication get a challenge for the second login step instead of a session
+	twoFactor, err := s.findEnabledTwoFactor(found.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor != nil {
+		fmt.Println("User logging in (two-factor authentication required): ", found.Email)
+		return s.startTwoFactorChallenge(twoFactor)
+	}
+
+	// If match found, start a new session (refresh token family) for the user
+	fmt.Println("User logging in: ", found.Email)
+	sessionID, err := auth.GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(found, sessionID)
+}
+
+// Exchanges a refresh token for a new token pair of the same session. Each refresh token can only be used once:
+// using it again revokes the session, so a stolen token stops working for both the thief and the user
+func (s *userService) RefreshToken(refreshToken string) (*models.LoginResponse, error) {
+	found, err := s.refreshTokens.FindByHash(auth.HashToken(refreshToken))
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if found.RevokedAt != nil || found.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+	// Mark the token as used. Fails if it was used before (or by a concurrent request)
+	if found.UsedAt == nil {
+		marked, err := s.refreshTokens.MarkUsed(found.ID)
 		if err != nil {
-			fmt.Println("Failed to create JWT")
+			return nil, err
+		}
+		if marked {
+			// Rotate: issue a new token pair for the same session
+			user, err := s.FindById(int(found.UserID))
+			if err != nil {
+				return nil, ErrInvalidRefreshToken
+			}
+			return s.issueTokens(user, found.FamilyID)
 		}
 	}
-	return tokenString, nil
+
+	// Reuse detected: revoke the whole family
+	fmt.Printf("Refresh token reused for user %d. Revoking session\n", found.UserID)
+	if err := s.RevokeSession(found.FamilyID); err != nil {
+		return nil, err
+	}
+	return nil, ErrRefreshTokenReused
+}
+
+// Ends the session of a refresh token
+func (s *userService) Logout(refreshToken string) error {
+	found, err := s.refreshTokens.FindByHash(auth.HashToken(refreshToken))
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+	return s.RevokeSession(found.FamilyID)
+}
+
+// Ends every session of a user
+func (s *userService) revokeSessions(userId int) error {
+	sessionIDs, err := s.refreshTokens.RevokeUser(uint(userId))
+	if err != nil {
+		return err
+	}
+	for _, sessionID := range sessionIDs {
+		auth.SessionRevoked(sessionID)
+	}
+	return nil
+}
+
+// Revokes the refresh tokens of a session. Access tokens of the session are rejected from then on
+func (s *userService) RevokeSession(sessionID string) error {
+	if err := s.refreshTokens.RevokeFamily(sessionID); err != nil {
+		return err
+	}
+	auth.SessionRevoked(sessionID)
+	return nil
+}
+
+// Deletes refresh tokens that have expired
+func (s *userService) PurgeExpiredRefreshTokens() error {
+	purged, err := s.refreshTokens.DeleteExpired(time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d expired refresh token(s)\n", purged)
+	return nil
+}
+
+// Issues an access token and a refresh token for a session of the user. Access tokens of users who must set up
+// two-factor authentication only give access to the enrolment pages (refreshing once enrolled lifts it)
+func (s *userService) issueTokens(user *models.UserWithRole, sessionID string) (*models.LoginResponse, error) {
+	setupRequired, err := s.twoFactorSetupRequired(user)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := auth.GenerateAccessToken(int(user.ID), user.Email, user.Role, sessionID, setupRequired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWT: %w", err)
+	}
+	refreshToken, hash, err := auth.GenerateToken()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.refreshTokens.Create(&db.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
 }
 
 func (s *userService) CheckPasswordMatch(id int, password []byte) bool {
@@ -409,6 +692,7 @@ func (s *userService) VerifyEmailCode(token string) error {
 	if err != nil {
 		return err
 	}
+	s.invalidate(int(user.ID))
 
 	// Return no error found
 	return nil
@@ -421,21 +705,21 @@ func (s *userService) ResendVerificationEmail(id int) error {
 	if err != nil {
 		return err
 	}
-	// Generate verification code and set expiry and store in user update
-	userUpdate, err := helpers.GenerateVerificationCodeAndSetExpiry()
+	// Find the current verification code (not loaded by FindById), restored if the email isn't queued
+	current, err := s.repo.FindByEmail(user.Email)
 	if err != nil {
 		return err
 	}
-
-	// Update user in database
-	_, err = s.repo.Update(int(user.ID), userUpdate)
+	// Generate verification code and set expiry and store in user update
+	userUpdate, err := helpers.GenerateVerificationCodeAndSetExpiry()
 	if err != nil {
 		return err
 	}
+
 	// Build data for email template (SERVER_PORT prefixed with :)
 	baseUrl := fmt.Sprintf("%s%s", os.Getenv("SERVER_BASE_URL"), os.Getenv("SERVER_PORT"))
-	// Build URL for verification
-	tokenUrl := template.URL("http://" + baseUrl + "/api/users/verify-email/" + user.VerificationCode)
+	// Build URL for verification using the new code
+	tokenUrl := template.URL("http://" + baseUrl + "/api/users/verify-email/" + userUpdate.VerificationCode)
 	data := struct {
 		Name     string
 		TokenUrl template.URL
@@ -444,27 +728,42 @@ func (s *userService) ResendVerificationEmail(id int) error {
 		TokenUrl: tokenUrl,
 	}
 
-	// Build HTML email template from file using injected data
-	emailString, err := webapi.LoadTemplate(webapi.BuildPathFromWorkingDirectory("/internal/email/templates/email-verification.tmpl"), data)
+	// Render email template in the user's language using injected data
+	rendered, err := email.RenderTemplate(email.EmailVerificationTemplate, user.Language, data)
 	if err != nil {
-		fmt.Printf("error in loading template: %v", err)
+		fmt.Printf("error in rendering template: %v", err)
 		return err
 	}
 
 	// Create payload containing details for email job
-	payload := queue.EmailJobPayload{
-		Recipient: user.Email,
-		Subject:   "Please Verify your Email",
-		Body:      emailString,
-	}
+	payload := queue.NewTemplateEmailJobPayload(*rendered, user.Email)
+	// Account emails are transactional, so they're sent even if the user opted out of other emails
+	payload.Category = email.CategoryAccount
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
-	// Add job to queue
-	s.queue.AddJob("email", string(payloadBytes))
+	// Store the new code before queueing its email, so the link works as soon as the email is sent
+	_, err = s.repo.Update(int(user.ID), userUpdate)
+	if err != nil {
+		return err
+	}
+
+	// Add job to queue. Only one verification email is queued per user within the resend window
+	jobOptions := accountEmailJobOptions
+	jobOptions.UniqueKey = fmt.Sprintf("verification-email:%d", user.ID)
+	jobOptions.UniqueFor = VerificationEmailResendWindow
+	err = s.queue.AddJobWithOptions(queue.EmailJobType, string(payloadBytes), jobOptions)
 	if err != nil {
+		// The new code isn't emailed. Put back the previous code, so the link of an email already queued keeps working
+		restoreErr := s.repo.RestoreVerificationCode(int(user.ID), userUpdate.VerificationCode, current.VerificationCode, current.VerificationCodeExpiry)
+		if restoreErr != nil {
+			return restoreErr
+		}
+		if errors.Is(err, queue.ErrDuplicateJob) {
+			return nil
+		}
 		return errors.New("error adding job to queue")
 	}
 
@@ -472,6 +771,16 @@ func (s *userService) ResendVerificationEmail(id int) error {
 	return nil
 }
 
+// Clears verification codes that have expired
+func (s *userService) PurgeExpiredVerificationCodes() error {
+	purged, err := s.repo.ClearExpiredVerificationCodes()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d expired verification code(s)\n", purged)
+	return nil
+}
+
 // Helper function to find user role and attach to user
 func findRoleAndAttach(user *db.User, auth corerepositories.AuthPolicyRepository) (*models.UserWithRole, error) {
 	fullUser := &models.UserWithRole{}
@@ -499,6 +808,7 @@ func BuildUserWithRole(user *db.User, role string) *models.UserWithRole {
 		Password: user.Password,
 		Name:     user.Name,
 		Email:    user.Email,
+		Language: user.Language,
 		// Authorization
 		Role: role,
 		// Verification
@@ -0,0 +1,181 @@
+package service_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+func TestEmailLogService_LogEmailDelivery(t *testing.T) {
+	message := email.EmailMessage{
+		To:       []string{"logged@ymail.com"},
+		Bcc:      []string{"audit@ymail.com"},
+		Subject:  "Your receipt",
+		TextBody: "Thanks",
+	}
+	var tests = []struct {
+		name         string
+		delivery     queue.EmailDelivery
+		wantStatus   string
+		wantAttempts int
+		wantResponse string
+		wantSent     bool
+	}{
+		{"Rejected", queue.EmailDelivery{JobID: 424242, Template: "receipt", Message: message, Response: "550 5.1.1 User unknown", Err: errors.New("smtp.SendMail() failed with: 550 5.1.1 User unknown")},
+			db.EmailStatusFailed, 1, "550 5.1.1 User unknown", false},
+		{"Unreachable", queue.EmailDelivery{JobID: 424242, Template: "receipt", Message: message, Err: errors.New("connection refused")},
+			db.EmailStatusFailed, 2, "connection refused", false},
+		{"Accepted on retry", queue.EmailDelivery{JobID: 424242, Template: "receipt", Message: message, Response: "250 2.0.0 Ok: queued as 4F2A1"},
+			db.EmailStatusSent, 3, "250 2.0.0 Ok: queued as 4F2A1", true},
+	}
+
+	for _, v := range tests {
+		err := testModule.emailLogs.serv.LogEmailDelivery(v.delivery)
+		if err != nil {
+			t.Fatalf("%s: failed to log delivery: %v", v.name, err)
+		}
+
+		// Each attempt of the job updates the same entry
+		found, err := testModule.emailLogs.repo.FindByJobID(v.delivery.JobID)
+		if err != nil {
+			t.Fatalf("%s: failed to find email log: %v", v.name, err)
+		}
+		if found.Status != v.wantStatus || found.Attempts != v.wantAttempts || found.Response != v.wantResponse || (found.SentAt != nil) != v.wantSent {
+			t.Errorf("%s: expected status %s, %d attempts, response %q and sent %v, got %s, %d, %q and %v",
+				v.name, v.wantStatus, v.wantAttempts, v.wantResponse, v.wantSent, found.Status, found.Attempts, found.Response, found.SentAt)
+		}
+		if found.Recipients != "logged@ymail.com, audit@ymail.com" || found.Subject != "Your receipt" || found.Template != "receipt" {
+			t.Errorf("%s: expected email details to be recorded, got %+v", v.name, found)
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Where("job_id = ?", 424242).Delete(&db.EmailLog{})
+}
+
+func TestEmailLogService_Resend(t *testing.T) {
+	message := email.EmailMessage{To: []string{"resend@ymail.com"}, Subject: "Welcome", HTMLBody: "<p>Welcome</p>", Category: email.CategoryMarketing}
+	err := testModule.emailLogs.serv.LogEmailDelivery(queue.EmailDelivery{JobID: 434343, Template: "welcome", Message: message})
+	if err != nil {
+		t.Fatalf("failed to log delivery: %v", err)
+	}
+	found, err := testModule.emailLogs.repo.FindByJobID(434343)
+	if err != nil {
+		t.Fatalf("failed to find email log: %v", err)
+	}
+	if found.Response != "accepted" {
+		t.Errorf("expected email accepted without a response to be recorded as accepted, got %q", found.Response)
+	}
+
+	// Test function
+	err = testModule.emailLogs.serv.Resend(int(found.ID))
+	if err != nil {
+		t.Fatalf("failed to resend email: %v", err)
+	}
+
+	// A new email job should be queued with the same message and template
+	emailJobs := findEmailJobs("resend@ymail.com")
+	if len(emailJobs) != 1 {
+		t.Fatalf("expected 1 email job, got %d", len(emailJobs))
+	}
+	var payload queue.EmailJobPayload
+	if err := json.Unmarshal([]byte(emailJobs[0].Payload), &payload); err != nil {
+		t.Fatalf("failed to decode email payload: %v", err)
+	}
+	sent := testModule.mail.SentTo("resend@ymail.com")
+	if payload.Template != "welcome" || payload.Message().Subject != "Welcome" || len(sent) != 1 || sent[0].HTMLBody != "<p>Welcome</p>" {
+		t.Errorf("expected logged email to be sent again, got %+v", payload)
+	}
+
+	// Entries without a message can't be resent
+	testModule.dbClient.Model(found).Update("message", "")
+	if err := testModule.emailLogs.serv.Resend(int(found.ID)); !errors.Is(err, coreservices.ErrEmailNotResendable) {
+		t.Errorf("expected ErrEmailNotResendable, got %v", err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(found)
+}
+
+func TestEmailLogService_LogEmailDeliveryWithoutSecrets(t *testing.T) {
+	var tests = []struct {
+		name      string
+		category  string
+		wantBody  bool
+		resendErr error
+	}{
+		{"Marketing email", email.CategoryMarketing, true, nil},
+		{"Account email", email.CategoryAccount, false, coreservices.ErrEmailNotResendable},
+		{"Email without a category", "", false, coreservices.ErrEmailNotResendable},
+	}
+
+	for i, v := range tests {
+		jobID := uint(454500 + i)
+		message := email.EmailMessage{
+			To:          []string{"secrets@ymail.com"},
+			Subject:     "Reset your password",
+			HTMLBody:    "<a href=\"https://example.com/reset-password?token=s3cr3t\">Reset</a>",
+			TextBody:    "https://example.com/reset-password?token=s3cr3t",
+			Attachments: []email.Attachment{{Filename: "token.txt", Data: []byte("s3cr3t")}},
+			Category:    v.category,
+		}
+		err := testModule.emailLogs.serv.LogEmailDelivery(queue.EmailDelivery{JobID: jobID, Message: message})
+		if err != nil {
+			t.Fatalf("%s: failed to log delivery: %v", v.name, err)
+		}
+		found, err := testModule.emailLogs.repo.FindByJobID(jobID)
+		if err != nil {
+			t.Fatalf("%s: failed to find email log: %v", v.name, err)
+		}
+
+		// Bodies are only stored for emails that can't contain secrets
+		if stored := strings.Contains(found.Message, "s3cr3t") || strings.Contains(found.Message, "czNjcjN0"); stored != v.wantBody {
+			t.Errorf("%s: expected body stored to be %v, got message %s", v.name, v.wantBody, found.Message)
+		}
+		if !strings.Contains(found.Message, "secrets@ymail.com") {
+			t.Errorf("%s: expected recipients to be stored, got message %s", v.name, found.Message)
+		}
+		if err := testModule.emailLogs.serv.Resend(int(found.ID)); !errors.Is(err, v.resendErr) {
+			t.Errorf("%s: expected resend error %v, got %v", v.name, v.resendErr, err)
+		}
+
+		// Clean up
+		testModule.dbClient.Unscoped().Delete(found)
+	}
+}
+
+func TestEmailLogService_PurgeEmailLogs(t *testing.T) {
+	old, err := testModule.emailLogs.repo.Create(&db.EmailLog{JobID: 464646, Recipients: "old@ymail.com", Status: db.EmailStatusSent})
+	if err != nil {
+		t.Fatalf("failed to create email log: %v", err)
+	}
+	testModule.dbClient.Model(old).UpdateColumn("created_at", time.Now().Add(-100*24*time.Hour))
+	recent, err := testModule.emailLogs.repo.Create(&db.EmailLog{JobID: 474747, Recipients: "recent@ymail.com", Status: db.EmailStatusSent})
+	if err != nil {
+		t.Fatalf("failed to create email log: %v", err)
+	}
+
+	// Test function
+	err = testModule.emailLogs.serv.PurgeEmailLogs(time.Now().Add(-coreservices.DefaultEmailLogRetention))
+	if err != nil {
+		t.Fatalf("failed to purge email logs: %v", err)
+	}
+
+	// Only entries older than the retention are purged
+	if _, err := testModule.emailLogs.repo.FindById(int(old.ID)); err == nil {
+		t.Errorf("expected old entry to be purged")
+	}
+	if _, err := testModule.emailLogs.repo.FindById(int(recent.ID)); err != nil {
+		t.Errorf("expected recent entry to be kept, got %v", err)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(recent)
+}
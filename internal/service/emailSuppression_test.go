@@ -0,0 +1,110 @@
+package service_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
+	"github.com/dmawardi/Go-Template/internal/models"
+)
+
+func TestEmailSuppressionService_SuppressedRecipients(t *testing.T) {
+	// User that opted out of marketing emails
+	user, err := testModule.users.repo.Create(&db.User{Username: "Quietly", Email: "Quiet.User@ymail.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	_, err = testModule.emailSuppressions.serv.UpdatePreferences(int(user.ID), &models.UpdateEmailPreferences{Categories: map[string]bool{email.CategoryMarketing: false}})
+	if err != nil {
+		t.Fatalf("Failed to update preferences: %v", err)
+	}
+	// Address that hard bounced
+	if err := testModule.emailSuppressions.serv.SuppressBounce("Bounced@ymail.com", "550 5.1.1 User unknown"); err != nil {
+		t.Fatalf("Failed to suppress bounce: %v", err)
+	}
+
+	recipients := []string{"quiet.user@ymail.com", "bounced@ymail.com", "welcome@ymail.com"}
+	var tests = []struct {
+		name     string
+		category string
+		expected []string
+	}{
+		{"Opted out and bounced", email.CategoryMarketing, []string{"quiet.user@ymail.com", "bounced@ymail.com"}},
+		{"Bounced only", email.CategoryNotifications, []string{"bounced@ymail.com"}},
+		{"Without a category", "", []string{"bounced@ymail.com"}},
+		{"Unregistered category", "receipts", []string{"bounced@ymail.com"}},
+		{"Transactional", email.CategoryAccount, nil},
+	}
+	for _, v := range tests {
+		suppressed, err := testModule.emailSuppressions.serv.SuppressedRecipients(recipients, v.category)
+		if err != nil {
+			t.Fatalf("%s: failed to find suppressed recipients: %v", v.name, err)
+		}
+		if !reflect.DeepEqual(suppressed, v.expected) {
+			t.Errorf("%s: expected %v to be suppressed, got %v", v.name, v.expected, suppressed)
+		}
+	}
+
+	// Bounces keep the response of the mail server
+	found, err := testModule.emailSuppressions.repo.FindByEmails([]string{"bounced@ymail.com"})
+	if err != nil || len(found) != 1 || found[0].Reason != db.SuppressionReasonHardBounce || found[0].Detail != "550 5.1.1 User unknown" {
+		t.Errorf("Expected hard bounce to be recorded, got %+v (%v)", found, err)
+	}
+
+	// Clean up
+	testModule.dbClient.Where("user_id = ?", user.ID).Delete(&db.EmailPreference{})
+	testModule.dbClient.Where("email = ?", "bounced@ymail.com").Delete(&db.EmailSuppression{})
+	testModule.dbClient.Unscoped().Delete(user)
+}
+
+func TestEmailSuppressionService_Unsubscribe(t *testing.T) {
+	user, err := testModule.users.repo.Create(&db.User{Username: "Unsubscriber", Email: "unsubscriber@ymail.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	var tests = []struct {
+		name            string
+		address         string
+		category        string
+		valid           bool
+		wantPreference  bool
+		wantSuppression bool
+	}{
+		{"User opts out of the category", "Unsubscriber@ymail.com", email.CategoryNotifications, true, true, false},
+		{"Address without an account is suppressed", "reader@ymail.com", email.CategoryMarketing, true, false, true},
+		{"Transactional category", "unsubscriber@ymail.com", email.CategoryAccount, false, false, false},
+		{"Missing category", "unsubscriber@ymail.com", "", false, false, false},
+	}
+	for _, v := range tests {
+		err := testModule.emailSuppressions.serv.Unsubscribe(v.address, v.category)
+		if (err == nil) != v.valid {
+			t.Errorf("%s: expected valid to be %v, got %v", v.name, v.valid, err)
+			continue
+		}
+		if !v.valid {
+			continue
+		}
+
+		preferences, _ := testModule.emailSuppressions.serv.FindPreferences(int(user.ID))
+		optedOut := false
+		for _, preference := range preferences {
+			if preference.Category == v.category && !preference.Subscribed {
+				optedOut = true
+			}
+		}
+		if optedOut != v.wantPreference {
+			t.Errorf("%s: expected user opted out to be %v, got %v", v.name, v.wantPreference, preferences)
+		}
+		found, _ := testModule.emailSuppressions.repo.FindByEmails([]string{v.address})
+		if (len(found) == 1 && found[0].Reason == db.SuppressionReasonUnsubscribed) != v.wantSuppression {
+			t.Errorf("%s: expected suppressed to be %v, got %+v", v.name, v.wantSuppression, found)
+		}
+	}
+
+	// Clean up
+	testModule.dbClient.Where("user_id = ?", user.ID).Delete(&db.EmailPreference{})
+	testModule.dbClient.Where("email = ?", "reader@ymail.com").Delete(&db.EmailSuppression{})
+	testModule.dbClient.Unscoped().Delete(user)
+}
@@ -0,0 +1,212 @@
+package service_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
+)
+
+// Job type used for jobs created in these tests (avoids clashing with jobs enqueued by other tests)
+const testJobType = "service-test-job"
+
+func TestJobService_Retry(t *testing.T) {
+	var tests = []struct {
+		name       string
+		status     string
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "Dead job", status: db.JobStatusDead, wantErr: nil, wantStatus: db.JobStatusPending},
+		{name: "Failed job", status: db.JobStatusFailed, wantErr: nil, wantStatus: db.JobStatusPending},
+		{name: "Cancelled job", status: db.JobStatusCancelled, wantErr: nil, wantStatus: db.JobStatusPending},
+		{name: "Running job", status: db.JobStatusRunning, wantErr: coreservices.ErrJobNotRetryable, wantStatus: db.JobStatusRunning},
+		{name: "Processed job", status: db.JobStatusProcessed, wantErr: coreservices.ErrJobNotRetryable, wantStatus: db.JobStatusProcessed},
+	}
+
+	for _, v := range tests {
+		job := createTestJob(t, v.status)
+
+		// Test function
+		updated, err := testModule.jobs.serv.Retry(int(job.ID))
+		if !errors.Is(err, v.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.wantErr, err)
+		}
+		if err == nil && (updated.Attempts != 0 || updated.LastError != "job failed") {
+			t.Errorf("%s: expected attempts to reset and last error to be kept, got %d attempts and %q", v.name, updated.Attempts, updated.LastError)
+		}
+
+		// Check stored status
+		found, err := testModule.jobs.serv.FindById(int(job.ID))
+		if err != nil {
+			t.Fatalf("%s: error finding job: %v", v.name, err)
+		}
+		if found.Status != v.wantStatus {
+			t.Errorf("%s: expected status %s, got %s", v.name, v.wantStatus, found.Status)
+		}
+
+		// Clean up
+		testModule.dbClient.Unscoped().Delete(job)
+	}
+
+	// Test missing job
+	_, err := testModule.jobs.serv.Retry(999999)
+	if err == nil || errors.Is(err, coreservices.ErrJobNotRetryable) {
+		t.Errorf("Expected not found error when retrying missing job, got %v", err)
+	}
+}
+
+func TestJobService_Cancel(t *testing.T) {
+	var tests = []struct {
+		name       string
+		status     string
+		wantErr    error
+		wantStatus string
+	}{
+		{name: "Pending job", status: db.JobStatusPending, wantErr: nil, wantStatus: db.JobStatusCancelled},
+		{name: "Failed job", status: db.JobStatusFailed, wantErr: nil, wantStatus: db.JobStatusCancelled},
+		{name: "Running job", status: db.JobStatusRunning, wantErr: coreservices.ErrJobNotCancellable, wantStatus: db.JobStatusRunning},
+		{name: "Dead job", status: db.JobStatusDead, wantErr: coreservices.ErrJobNotCancellable, wantStatus: db.JobStatusDead},
+	}
+
+	for _, v := range tests {
+		job := createTestJob(t, v.status)
+
+		// Test function
+		_, err := testModule.jobs.serv.Cancel(int(job.ID))
+		if !errors.Is(err, v.wantErr) {
+			t.Errorf("%s: expected error %v, got %v", v.name, v.wantErr, err)
+		}
+
+		// Check stored status
+		found, err := testModule.jobs.serv.FindById(int(job.ID))
+		if err != nil {
+			t.Fatalf("%s: error finding job: %v", v.name, err)
+		}
+		if found.Status != v.wantStatus {
+			t.Errorf("%s: expected status %s, got %s", v.name, v.wantStatus, found.Status)
+		}
+
+		// Clean up
+		testModule.dbClient.Unscoped().Delete(job)
+	}
+}
+
+func TestJobService_BulkRetryAndCancel(t *testing.T) {
+	dead := createTestJob(t, db.JobStatusDead)
+	running := createTestJob(t, db.JobStatusRunning)
+	pending := createTestJob(t, db.JobStatusPending)
+	ids := []int{int(dead.ID), int(running.ID), int(pending.ID)}
+
+	// Only the dead job can be retried
+	updated, err := testModule.jobs.serv.BulkRetry(ids)
+	if err != nil {
+		t.Fatalf("Error retrying jobs: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 job to be retried, got %d", updated)
+	}
+
+	// The retried and pending jobs can be cancelled, the running job is skipped
+	updated, err = testModule.jobs.serv.BulkCancel(ids)
+	if err != nil {
+		t.Fatalf("Error cancelling jobs: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 jobs to be cancelled, got %d", updated)
+	}
+
+	// Check the running job was left alone
+	found, err := testModule.jobs.serv.FindById(int(running.ID))
+	if err != nil {
+		t.Fatalf("Error finding job: %v", err)
+	}
+	if found.Status != db.JobStatusRunning {
+		t.Errorf("Expected running job to keep its status, got %s", found.Status)
+	}
+
+	// Test bulk delete (the running job is skipped and reported)
+	err = testModule.jobs.serv.BulkDelete(ids)
+	if !errors.Is(err, coreservices.ErrJobNotDeletable) {
+		t.Fatalf("Expected running job not to be deleted, got %v", err)
+	}
+	if _, err := testModule.jobs.serv.FindById(int(dead.ID)); err == nil {
+		t.Errorf("Expected job to be deleted")
+	}
+	if _, err := testModule.jobs.serv.FindById(int(running.ID)); err != nil {
+		t.Errorf("Expected running job to be kept, got %v", err)
+	}
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&db.Job{}, ids)
+}
+
+func TestJobService_FindAll(t *testing.T) {
+	dead := createTestJob(t, db.JobStatusDead)
+	pending := createTestJob(t, db.JobStatusPending)
+	processed := createTestJob(t, db.JobStatusProcessed)
+
+	var tests = []struct {
+		name       string
+		conditions []models.QueryConditionParameters
+		filter     models.JobFilter
+		wantCount  int
+	}{
+		{name: "Job type", filter: models.JobFilter{JobType: testJobType}, wantCount: 3},
+		{name: "Job type and status", filter: models.JobFilter{JobType: testJobType, Status: db.JobStatusDead}, wantCount: 1},
+		{name: "Job type and queue", filter: models.JobFilter{JobType: testJobType, Queue: "missing-queue"}, wantCount: 0},
+		// Search conditions mustn't bypass the filters
+		{name: "Job type, status and search", filter: models.JobFilter{JobType: testJobType, Status: db.JobStatusPending}, conditions: []models.QueryConditionParameters{
+			{Condition: "LOWER(last_error) LIKE ?", Value: "%failed%"},
+			{Condition: "LOWER(payload) LIKE ?", Value: "%test%"},
+		}, wantCount: 1},
+	}
+
+	for _, v := range tests {
+		found, err := testModule.jobs.serv.FindAll(10, 0, "", v.conditions, v.filter)
+		if err != nil {
+			t.Fatalf("%s: error finding jobs: %v", v.name, err)
+		}
+		if len(*found.Data) != v.wantCount {
+			t.Errorf("%s: expected %d jobs, got %d", v.name, v.wantCount, len(*found.Data))
+		}
+		if found.Meta.GetMetaData().Total_Records != int64(v.wantCount) {
+			t.Errorf("%s: expected %d total records, got %d", v.name, v.wantCount, found.Meta.GetMetaData().Total_Records)
+		}
+	}
+
+	// Check job types include the test job type
+	jobTypes, err := testModule.jobs.serv.FindJobTypes()
+	if err != nil {
+		t.Fatalf("Error finding job types: %v", err)
+	}
+	foundType := false
+	for _, jobType := range jobTypes {
+		if jobType == testJobType {
+			foundType = true
+		}
+	}
+	if !foundType {
+		t.Errorf("Expected job types %v to include %s", jobTypes, testJobType)
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&db.Job{}, []uint{dead.ID, pending.ID, processed.ID})
+}
+
+// Creates a job with the given status that has run out of attempts
+func createTestJob(t *testing.T, status string) *db.Job {
+	job := &db.Job{
+		JobType:     testJobType,
+		Payload:     `{"test":true}`,
+		Status:      status,
+		Attempts:    3,
+		MaxAttempts: 3,
+		LastError:   "job failed",
+	}
+	if err := testModule.dbClient.Create(job).Error; err != nil {
+		t.Fatalf("Error creating job: %v", err)
+	}
+	return job
+}
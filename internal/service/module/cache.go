@@ -0,0 +1,71 @@
+package moduleservices
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/models"
+	"gorm.io/gorm"
+)
+
+// How long entities and lists are cached
+const entityCacheTTL = 10 * time.Minute
+
+// Caches the entities (by ID) and lists (by query) of a module. Entries are tagged so a write
+// invalidates the entity and every list of the module, and entries embedding other entities
+// (eg. the user of a post) are invalidated when those entities change
+type moduleCache[dbSchema any] struct {
+	schemaName string
+	store      cache.Cache
+	entities   *cache.Typed[*dbSchema]
+	lists      *cache.Typed[*models.BasicPaginatedResponse[dbSchema]]
+}
+
+// Builds the cache of a module. relatedTags (optional) returns the tags of the entities embedded in an entity
+// Example usage: newModuleCache("post", func(post *db.Post) []string { return []string{cache.EntityTag("user", post.UserID)} })
+func newModuleCache[dbSchema any](schemaName string, relatedTags func(*dbSchema) []string) *moduleCache[dbSchema] {
+	return &moduleCache[dbSchema]{
+		schemaName: schemaName,
+		store:      app.Cache,
+		entities: cache.NewTyped[*dbSchema](app.Cache, schemaName, cache.TypedOptions[*dbSchema]{
+			Tags:        relatedTags,
+			NotFound:    gorm.ErrRecordNotFound,
+			NegativeTTL: cache.DefaultNegativeTTL,
+		}),
+		lists: cache.NewTyped[*models.BasicPaginatedResponse[dbSchema]](app.Cache, cache.ListTag(schemaName), cache.TypedOptions[*models.BasicPaginatedResponse[dbSchema]]{
+			// Lists are tagged with the list tag and the related entities of every entity in them
+			Tags: func(list *models.BasicPaginatedResponse[dbSchema]) []string {
+				tags := []string{cache.ListTag(schemaName)}
+				if relatedTags != nil && list.Data != nil {
+					for i := range *list.Data {
+						tags = append(tags, relatedTags(&(*list.Data)[i])...)
+					}
+				}
+				return tags
+			},
+		}),
+	}
+}
+
+// Returns the cached entity or loads it. Concurrent lookups of the same entity share a single query
+func (c *moduleCache[dbSchema]) findById(id int, loader func() (*dbSchema, error)) (*dbSchema, error) {
+	return c.entities.GetOrLoad(id, entityCacheTTL, loader)
+}
+
+// Returns the cached list of a query or loads it
+func (c *moduleCache[dbSchema]) findAll(limit int, offset int, order string, conditions []models.QueryConditionParameters, loader func() (*models.BasicPaginatedResponse[dbSchema], error)) (*models.BasicPaginatedResponse[dbSchema], error) {
+	// Key lists by their query parameters
+	key := fmt.Sprintf("%d|%d|%s|%v", limit, offset, order, conditions)
+	return c.lists.GetOrLoad(key, entityCacheTTL, loader)
+}
+
+// Invalidates the cached entities with the IDs (and the entries embedding them) and every list of the module.
+// Called after every create, update and delete
+func (c *moduleCache[dbSchema]) invalidate(ids ...int) {
+	tags := []string{cache.ListTag(c.schemaName)}
+	for _, id := range ids {
+		tags = append(tags, cache.EntityTag(c.schemaName, id))
+	}
+	c.store.InvalidateTags(tags...)
+}
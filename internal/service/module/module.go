@@ -2,6 +2,7 @@ package moduleservices
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/dmawardi/Go-Template/internal/config"
 	"github.com/dmawardi/Go-Template/internal/models"
@@ -28,14 +29,18 @@ type BasicModuleService[dbSchema, create, update any] interface {
 type BasicServiceStruct[dbSchema, createDTO, updateDTO any] struct {
 	Repo repository.BasicModuleRepository[dbSchema]
 	schemaName string
+	// Entities cached by ID and lists cached by query. Missing entities are cached briefly
+	cache *moduleCache[dbSchema]
 	// Mapping functions
 	mapCreateToDbSchema func(*createDTO) *dbSchema
 	mapUpdateToDbSchema func(*updateDTO) *dbSchema
 }
-// Returns a new basic service
-func newBasicModuleService[dbSchema, createDTO, updateDTO any](repo repository.BasicModuleRepository[dbSchema]) BasicModuleService[dbSchema, createDTO, updateDTO] {
+// Returns a new basic service. The schema name is used in errors and as the cache key prefix (eg. "post")
+func newBasicModuleService[dbSchema, createDTO, updateDTO any](repo repository.BasicModuleRepository[dbSchema], schemaName string) BasicModuleService[dbSchema, createDTO, updateDTO] {
 	return &BasicServiceStruct[dbSchema, createDTO, updateDTO]{
-		Repo: repo,
+		Repo:       repo,
+		schemaName: schemaName,
+		cache:      newModuleCache[dbSchema](schemaName, nil),
 	}
 }
 
@@ -52,40 +57,28 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Create(create *crea
 	if err != nil {
 		return nil, fmt.Errorf("failed creation of %s: %w", s.schemaName, err)
 	}
+	// Invalidate cached lists (and a cached "not found" result for the new ID)
+	if id, found := entityID(created); found {
+		s.cache.invalidate(id)
+	} else {
+		s.cache.invalidate()
+	}
 
 	return created, nil
 }
 // Find all entities in database
 func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[dbSchema], error) {
-	entities, err := s.Repo.FindAll(limit, offset, order, conditions)
-	if err != nil {
-		return nil, err
-	}
-	return entities, nil
+	return s.cache.findAll(limit, offset, order, conditions, func() (*models.BasicPaginatedResponse[dbSchema], error) {
+		return s.Repo.FindAll(limit, offset, order, conditions)
+	})
 }
 // Find entity by id
 func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) FindById(id int) (*dbSchema, error) {
-	// Search cache
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	// Check if entity is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached post
-		return cachedPost.(*dbSchema), nil
-	}
-
-	// Find entity by id
-	entity, err := s.Repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store entity in cache
-	app.Cache.Store(cacheKey, entity)
-
-	return entity, nil
+	// Load the entity from the cache, or from the database if not cached.
+	// Concurrent lookups of the same entity share a single query
+	return s.cache.findById(id, func() (*dbSchema, error) {
+		return s.Repo.FindById(id)
+	})
 }
 // Delete entity in database
 func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Delete(id int) error {
@@ -96,8 +89,7 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Delete(id int) erro
 		return err
 	}
 	// else
-	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	app.Cache.Delete(cacheKey)
+	s.cache.invalidate(id)
 	return nil
 }
 // Deletes multiple entities in database
@@ -109,10 +101,7 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) BulkDelete(ids []in
 		return err
 	}
 	// else
-	for _, id := range ids {
-		cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-		app.Cache.Delete(cacheKey)
-	}
+	s.cache.invalidate(ids...)
 	return nil
 }
 // Updates entity in database
@@ -126,10 +115,25 @@ func (s *BasicServiceStruct[dbSchema, createDTO, updateDTO]) Update(id int, upda
 		return nil, err
 	}
 
-	// Store updated entity in cache
-	cacheKey := fmt.Sprintf("%s:%d", s.schemaName, id)
-	app.Cache.Store(cacheKey, updated)
+	// Invalidate the entity and lists, then store updated entity in cache
+	s.cache.invalidate(id)
+	s.cache.entities.Set(id, updated, entityCacheTTL)
 
 	return updated, nil
 }
 
+// Returns the ID field of a db schema entity (eg. db.Post.ID)
+func entityID(entity interface{}) (int, bool) {
+	value := reflect.Indirect(reflect.ValueOf(entity))
+	if value.Kind() != reflect.Struct {
+		return 0, false
+	}
+	id := value.FieldByName("ID")
+	switch {
+	case id.CanUint():
+		return int(id.Uint()), true
+	case id.CanInt():
+		return int(id.Int()), true
+	}
+	return 0, false
+}
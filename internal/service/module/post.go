@@ -3,6 +3,7 @@ package moduleservices
 import (
 	"fmt"
 
+	"github.com/dmawardi/Go-Template/internal/cache"
 	"github.com/dmawardi/Go-Template/internal/db"
 	"github.com/dmawardi/Go-Template/internal/models"
 	schemamodels "github.com/dmawardi/Go-Template/internal/models/schemaModels"
@@ -20,10 +21,15 @@ type PostService interface {
 
 type postService struct {
 	repo modulerepositories.PostRepository
+	// Posts cached by ID and lists cached by query. Tagged with their user so user updates invalidate them
+	cache *moduleCache[db.Post]
 }
 
 func NewPostService(repo modulerepositories.PostRepository) PostService {
-	return &postService{repo: repo}
+	return &postService{repo: repo, cache: newModuleCache("post", func(post *db.Post) []string {
+		// Same tag as the users cached by the user service
+		return []string{cache.EntityTag("user", post.UserID)}
+	})}
 }
 
 // Creates a post in the database
@@ -40,42 +46,26 @@ func (s *postService) Create(post *schemamodels.CreatePost) (*db.Post, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed creating post: %w", err)
 	}
+	// Invalidate cached lists (and a cached "not found" result for the new ID)
+	s.cache.invalidate(int(created.ID))
 
 	return created, nil
 }
 
 // Find a list of posts in the database
 func (s *postService) FindAll(limit int, offset int, order string, conditions []models.QueryConditionParameters) (*models.BasicPaginatedResponse[db.Post], error) {
-	posts, err := s.repo.FindAll(limit, offset, order, conditions)
-	if err != nil {
-		return nil, err
-	}
-	return posts, nil
+	return s.cache.findAll(limit, offset, order, conditions, func() (*models.BasicPaginatedResponse[db.Post], error) {
+		return s.repo.FindAll(limit, offset, order, conditions)
+	})
 }
 
 // Find post in database by ID
 func (s *postService) FindById(id int) (*db.Post, error) {
-	// Search cache
-	// Define a key with a naming convention
-	cacheKey := fmt.Sprintf("post:%d", id)
-	// Check if post is in cache
-	cachedPost, found := app.Cache.Load(cacheKey)
-	if found {
-		// If found, return cached post
-		return cachedPost.(*db.Post), nil
-	}
-
-	// Find post by id
-	post, err := s.repo.FindById(id)
-	// If error detected
-	if err != nil {
-		return nil, err
-	}
-
-	// Store post in cache
-	app.Cache.Store(cacheKey, post)
-
-	return post, nil
+	// Load the post from the cache, or from the database if not cached.
+	// Concurrent lookups of the same post share a single query
+	return s.cache.findById(id, func() (*db.Post, error) {
+		return s.repo.FindById(id)
+	})
 }
 
 // Delete post in database
@@ -87,8 +77,7 @@ func (s *postService) Delete(id int) error {
 		return err
 	}
 	// else
-	cacheKey := fmt.Sprintf("post:%d", id)
-	app.Cache.Delete(cacheKey)
+	s.cache.invalidate(id)
 	return nil
 }
 
@@ -101,10 +90,7 @@ func (s *postService) BulkDelete(ids []int) error {
 		return err
 	}
 	// else
-	for _, id := range ids {
-		cacheKey := fmt.Sprintf("post:%d", id)
-		app.Cache.Delete(cacheKey)
-	}
+	s.cache.invalidate(ids...)
 	return nil
 }
 
@@ -123,9 +109,9 @@ func (s *postService) Update(id int, post *schemamodels.UpdatePost) (*db.Post, e
 		return nil, err
 	}
 
-	// Store updated post in cache
-	cacheKey := fmt.Sprintf("post:%d", id)
-	app.Cache.Store(cacheKey, updated)
+	// Invalidate the post and lists, then store updated post in cache
+	s.cache.invalidate(id)
+	s.cache.entities.Set(id, updated, entityCacheTTL)
 
 	return updated, nil
 }
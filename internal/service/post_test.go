@@ -0,0 +1,120 @@
+package service_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/dmawardi/Go-Template/internal/cache"
+	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/models"
+	schemamodels "github.com/dmawardi/Go-Template/internal/models/schemaModels"
+	moduleservices "github.com/dmawardi/Go-Template/internal/service/module"
+)
+
+func TestPostService_FindByIdConcurrent(t *testing.T) {
+	// Use a cache smaller than the number of posts so entries are evicted while being read
+	previousCache := app.Cache
+	app.Cache = cache.New(cache.Options{MaxEntries: 3})
+	defer func() { app.Cache = previousCache }()
+	// Build the service after swapping the cache so it uses the bounded cache
+	service := moduleservices.NewPostService(testModule.posts.repo)
+
+	user, err := testModule.users.repo.Create(&db.User{Username: "Poster", Email: "concurrent-poster@ymail.com", Password: "password"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	var posts []*db.Post
+	for i := 0; i < 6; i++ {
+		post, err := testModule.posts.repo.Create(&db.Post{Title: fmt.Sprintf("Post %d", i), Body: "Body", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+		posts = append(posts, post)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*50)
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				expected := posts[(worker+i)%len(posts)]
+				found, err := service.FindById(int(expected.ID))
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if found.Title != expected.Title {
+					errs <- fmt.Errorf("expected %q, got %q", expected.Title, found.Title)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Failed to find post: %v", err)
+	}
+
+	// Lookups are counted and the cache stays within its bounds
+	stats := app.Cache.Stats()
+	if stats.Entries > 3 || stats.Hits+stats.Misses != 8*50 || stats.Evictions == 0 {
+		t.Errorf("Expected at most 3 entries, 400 lookups and evictions, got %+v", stats)
+	}
+
+	// Clean up
+	for _, post := range posts {
+		testModule.dbClient.Unscoped().Delete(post)
+	}
+	testModule.dbClient.Unscoped().Delete(user)
+}
+
+func TestPostService_CacheInvalidation(t *testing.T) {
+	user, err := testModule.users.serv.Create(&models.CreateUser{Username: "Tagged", Email: "tagged-poster@ymail.com", Password: "password", Name: "Before"})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	conditions := []models.QueryConditionParameters{{Condition: "user_id = ?", Value: user.ID}}
+	findAll := func() []db.Post {
+		found, err := testModule.posts.serv.FindAll(10, 0, "", conditions)
+		if err != nil {
+			t.Fatalf("Failed to find posts: %v", err)
+		}
+		return *found.Data
+	}
+
+	// Lists are cached until a post is written
+	if posts := findAll(); len(posts) != 0 {
+		t.Fatalf("Expected no posts, got %d", len(posts))
+	}
+	post, err := testModule.posts.serv.Create(&schemamodels.CreatePost{Title: "Tagged", Body: "Body", User: db.User{ID: user.ID}})
+	if err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+	if posts := findAll(); len(posts) != 1 || posts[0].User.Name != "Before" {
+		t.Fatalf("Expected created post in list, got %+v", posts)
+	}
+	// Updating the user invalidates the lists embedding it
+	if _, err := testModule.users.serv.Update(int(user.ID), &models.UpdateUser{Name: "After"}); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if posts := findAll(); len(posts) != 1 || posts[0].User.Name != "After" {
+		t.Errorf("Expected list with updated user, got %+v", posts)
+	}
+	// Deleting the post invalidates the post and the lists
+	if err := testModule.posts.serv.Delete(int(post.ID)); err != nil {
+		t.Fatalf("Failed to delete post: %v", err)
+	}
+	if posts := findAll(); len(posts) != 0 {
+		t.Errorf("Expected deleted post to be removed from list, got %+v", posts)
+	}
+	if _, err := testModule.posts.serv.FindById(int(post.ID)); err == nil {
+		t.Errorf("Expected deleted post not to be found")
+	}
+
+	// Clean up
+	testModule.dbClient.Unscoped().Delete(&db.Post{}, post.ID)
+	testModule.users.serv.Delete(int(user.ID))
+}
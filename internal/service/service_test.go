@@ -26,9 +26,17 @@ var app config.AppConfig
 
 type repositoryTestModule struct {
 	dbClient *gorm.DB
-	users    userModule
-	auth     authModule
-	posts    postModule
+	// Jobs added by the services are kept in memory and run as they are added
+	jobQueue *queue.MemoryQueue
+	// Records the emails sent by the jobs
+	mail              *helpers.EmailMock
+	users             userModule
+	auth              authModule
+	posts             postModule
+	jobs              jobModule
+	emailLogs         emailLogModule
+	emailSuppressions emailSuppressionModule
+	apiKeys           apiKeyModule
 }
 
 // Module structures
@@ -41,6 +49,27 @@ type authModule struct {
 	serv coreservices.AuthPolicyService
 }
 
+type jobModule struct {
+	repo corerepositories.JobRepository
+	serv coreservices.JobService
+}
+
+type emailLogModule struct {
+	repo corerepositories.EmailLogRepository
+	serv coreservices.EmailLogService
+}
+
+type emailSuppressionModule struct {
+	repo        corerepositories.EmailSuppressionRepository
+	preferences corerepositories.EmailPreferenceRepository
+	serv        coreservices.EmailSuppressionService
+}
+
+type apiKeyModule struct {
+	repo corerepositories.ApiKeyRepository
+	serv coreservices.ApiKeyService
+}
+
 type postModule struct {
 	repo modulerepositories.PostRepository
 	serv moduleservices.PostService
@@ -95,16 +124,30 @@ func TestMain(m *testing.M) {
 // Builds new API using routes package
 func (t *repositoryTestModule) TestServSetup(client *gorm.DB) {
 	mail := &helpers.EmailMock{}
+	t.mail = mail
 
 	// Create job queue
-	jobQueue := queue.NewQueue(client, mail)
+	t.jobQueue = queue.NewSyncMemoryQueue(mail)
 	// Setup module stack
 	// Auth
 	t.auth.repo = corerepositories.NewAuthPolicyRepository(client)
 	t.auth.serv = coreservices.NewAuthPolicyService(t.auth.repo)
 	// Users
 	t.users.repo = corerepositories.NewUserRepository(client)
-	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, jobQueue)
+	t.users.serv = coreservices.NewUserService(t.users.repo, t.auth.repo, corerepositories.NewRefreshTokenRepository(client), corerepositories.NewTwoFactorRepository(client), t.jobQueue)
+	// Jobs
+	t.jobs.repo = corerepositories.NewJobRepository(client)
+	t.jobs.serv = coreservices.NewJobService(t.jobs.repo, queue.NewQueue(client, mail))
+	// Email logs
+	t.emailLogs.repo = corerepositories.NewEmailLogRepository(client)
+	t.emailLogs.serv = coreservices.NewEmailLogService(t.emailLogs.repo, t.jobQueue)
+	// Email suppression list and preferences
+	t.emailSuppressions.repo = corerepositories.NewEmailSuppressionRepository(client)
+	t.emailSuppressions.preferences = corerepositories.NewEmailPreferenceRepository(client)
+	t.emailSuppressions.serv = coreservices.NewEmailSuppressionService(t.emailSuppressions.repo, t.emailSuppressions.preferences)
+	// API keys
+	t.apiKeys.repo = corerepositories.NewApiKeyRepository(client)
+	t.apiKeys.serv = coreservices.NewApiKeyService(t.apiKeys.repo)
 	// Posts
 	t.posts.repo = modulerepositories.NewPostRepository(client)
 	t.posts.serv = moduleservices.NewPostService(t.posts.repo)
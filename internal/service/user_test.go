@@ -1,12 +1,26 @@
 package service_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dmawardi/Go-Template/internal/auth"
 	"github.com/dmawardi/Go-Template/internal/db"
+	"github.com/dmawardi/Go-Template/internal/email"
 	"github.com/dmawardi/Go-Template/internal/helpers"
 	"github.com/dmawardi/Go-Template/internal/models"
+	"github.com/dmawardi/Go-Template/internal/queue"
+	corerepositories "github.com/dmawardi/Go-Template/internal/repository/core"
+	coreservices "github.com/dmawardi/Go-Template/internal/service/core"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 func TestUserService_Create(t *testing.T) {
@@ -109,6 +123,39 @@ func TestUserService_FindById(t *testing.T) {
 	}
 }
 
+func TestUserService_FindByIdNotFound(t *testing.T) {
+	missingId := 987654
+	// Test function
+	// Missing users are cached as not found
+	if _, err := testModule.users.serv.FindById(missingId); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected record not found, got: %v", err)
+	}
+	// Insert the user without going through the service
+	userToCreate := &db.User{Username: "Missing", Email: "missing@ymail.com", Password: "password"}
+	userToCreate.ID = uint(missingId)
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(userToCreate, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user for find by id not found user service test: %v", err)
+	}
+	if _, err := testModule.users.serv.FindById(missingId); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expected cached record not found, got: %v", err)
+	}
+	// Updating the user through the service replaces the cached result
+	if _, err := testModule.users.serv.Update(missingId, &models.UpdateUser{Name: "Found"}); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	foundUser, err := testModule.users.serv.FindById(missingId)
+	if err != nil || foundUser.Name != "Found" {
+		t.Errorf("expected updated user to be found, got: %v (%v)", foundUser, err)
+	}
+
+	// Clean up: Delete created user
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
 func TestUserService_FindByEmail(t *testing.T) {
 	// Build test user
 	userToCreate := &db.User{
@@ -295,7 +342,7 @@ func TestUserService_FindAll(t *testing.T) {
 	}
 }
 
-func TestUserService_ResetPasswordAndSendEmail(t *testing.T) {
+func TestUserService_SendPasswordResetEmail(t *testing.T) {
 	// Create test user
 	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
 		Username: "Jabar",
@@ -308,10 +355,57 @@ func TestUserService_ResetPasswordAndSendEmail(t *testing.T) {
 	}
 
 	// Test function
-	// Reset password and send email
-	err = testModule.users.serv.ResetPasswordAndSendEmail(createdUser.Email)
+	// Send password reset email
+	err = testModule.users.serv.SendPasswordResetEmail(createdUser.Email)
+	if err != nil {
+		t.Fatalf("failed to send password reset email: %v", err)
+	}
+
+	// The password doesn't change until the link is used
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("password")) {
+		t.Errorf("expected password to be unchanged")
+	}
+	// The email contains a link with the token, and only the hash of the token is stored
+	token := findPasswordResetToken(t, createdUser.Email)
+	storedUser := db.User{}
+	testModule.dbClient.First(&storedUser, createdUser.ID)
+	if storedUser.PasswordResetTokenHash != auth.HashToken(token) || storedUser.PasswordResetExpiry == nil {
+		t.Errorf("expected hash of the emailed token to be stored, got %q", storedUser.PasswordResetTokenHash)
+	}
+
+	// Requesting again within the window doesn't queue another email or change the token
+	err = testModule.users.serv.SendPasswordResetEmail(createdUser.Email)
 	if err != nil {
-		t.Fatalf("failed to reset password and send email: %v", err)
+		t.Fatalf("failed to send password reset email: %v", err)
+	}
+	if count := len(findEmailJobs(createdUser.Email)); count != 1 {
+		t.Errorf("expected 1 password reset email job, got %d", count)
+	}
+	resentUser := db.User{}
+	testModule.dbClient.First(&resentUser, createdUser.ID)
+	if resentUser.PasswordResetTokenHash != storedUser.PasswordResetTokenHash {
+		t.Errorf("expected password reset token to be unchanged")
+	}
+
+	// If the email can't be queued, the previous token is kept and the new one isn't stored
+	failingService := coreservices.NewUserService(testModule.users.repo, testModule.auth.repo, corerepositories.NewRefreshTokenRepository(testModule.dbClient), corerepositories.NewTwoFactorRepository(testModule.dbClient), &failingJobQueue{JobQueue: testModule.jobQueue})
+	if err := failingService.SendPasswordResetEmail(createdUser.Email); err == nil {
+		t.Errorf("expected an error when the email can't be queued")
+	}
+	failedUser := db.User{}
+	testModule.dbClient.First(&failedUser, createdUser.ID)
+	if failedUser.PasswordResetTokenHash != storedUser.PasswordResetTokenHash {
+		t.Errorf("expected previous password reset token to be kept")
+	}
+	// Users without a previous token are left without one
+	testModule.dbClient.Model(&db.User{}).Where("id = ?", createdUser.ID).Updates(map[string]interface{}{"password_reset_token_hash": nil, "password_reset_expiry": nil})
+	if err := failingService.SendPasswordResetEmail(createdUser.Email); err == nil {
+		t.Errorf("expected an error when the email can't be queued")
+	}
+	failedUser = db.User{}
+	testModule.dbClient.First(&failedUser, createdUser.ID)
+	if failedUser.PasswordResetTokenHash != "" || failedUser.PasswordResetExpiry != nil {
+		t.Errorf("expected no password reset token to be stored, got %q", failedUser.PasswordResetTokenHash)
 	}
 
 	// Clean up: Delete created user
@@ -321,6 +415,98 @@ func TestUserService_ResetPasswordAndSendEmail(t *testing.T) {
 	}
 }
 
+// Job queue that fails to add jobs with options (eg. when the database is unavailable)
+type failingJobQueue struct {
+	queue.JobQueue
+}
+
+func (q *failingJobQueue) AddJobWithOptions(jobType, payload string, opts queue.JobOptions) error {
+	return errors.New("queue unavailable")
+}
+
+func TestUserService_ResetPassword(t *testing.T) {
+	password := "password"
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Forgetful",
+		Email:    "reset-password@ymail.com",
+		Password: password,
+		Name:     "Forgot Password",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	// Session started before the reset (eg. by someone who knew the old password)
+	session, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	err = testModule.users.serv.SendPasswordResetEmail(createdUser.Email)
+	if err != nil {
+		t.Fatalf("failed to send password reset email: %v", err)
+	}
+	token := findPasswordResetToken(t, createdUser.Email)
+
+	// Test function
+	err = testModule.users.serv.ResetPassword(token, "newPassword")
+	if err != nil {
+		t.Fatalf("failed to reset password: %v", err)
+	}
+
+	// The new password is used to log in
+	if !testModule.users.serv.CheckPasswordMatch(int(createdUser.ID), []byte("newPassword")) {
+		t.Errorf("expected new password to be set")
+	}
+	// Every existing session ends
+	if _, err := validateToken(session.Token); err == nil {
+		t.Errorf("expected access token of existing session to be rejected")
+	}
+	if _, err := testModule.users.serv.RefreshToken(session.RefreshToken); !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected refresh token of existing session to be rejected, got %v", err)
+	}
+	// The token can only be used once
+	if err := testModule.users.serv.ResetPassword(token, "otherPassword"); !errors.Is(err, coreservices.ErrInvalidPasswordResetToken) {
+		t.Errorf("expected used token to be rejected, got %v", err)
+	}
+
+	// Expired tokens are rejected
+	expiredToken, hash, _ := auth.GenerateToken()
+	expiry := time.Now().Add(-time.Minute)
+	testModule.dbClient.Model(&db.User{}).Where("id = ?", createdUser.ID).Updates(map[string]interface{}{"password_reset_token_hash": hash, "password_reset_expiry": expiry})
+	if err := testModule.users.serv.ResetPassword(expiredToken, "otherPassword"); !errors.Is(err, coreservices.ErrInvalidPasswordResetToken) {
+		t.Errorf("expected expired token to be rejected, got %v", err)
+	}
+	// and purged
+	err = testModule.users.serv.PurgeExpiredPasswordResetTokens()
+	if err != nil {
+		t.Fatalf("failed to purge expired tokens: %v", err)
+	}
+	purgedUser := db.User{}
+	testModule.dbClient.First(&purgedUser, createdUser.ID)
+	if purgedUser.PasswordResetTokenHash != "" || purgedUser.PasswordResetExpiry != nil {
+		t.Errorf("expected expired token to be cleared")
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+// Returns the token in the link of the password reset email sent to an address
+func findPasswordResetToken(t *testing.T, address string) string {
+	sent := testModule.mail.SentTo(address)
+	if len(sent) == 0 {
+		t.Fatalf("expected a password reset email for %s", address)
+	}
+	match := regexp.MustCompile(`reset-password\?token=([A-Za-z0-9]+)`).FindStringSubmatch(sent[len(sent)-1].HTMLBody)
+	if match == nil {
+		t.Fatalf("expected password reset link in email")
+	}
+	return match[1]
+}
+
 func TestUserService_LoginUser(t *testing.T) {
 	// create password
 	password := "password"
@@ -336,23 +522,359 @@ func TestUserService_LoginUser(t *testing.T) {
 	}
 
 	// Test function
-	token, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	tokens, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
 	if err != nil {
 		t.Fatalf("failed to login user: %v", err)
 	}
 
-	// Verify that the token is not empty
-	if token == "" {
-		t.Error("token should not be empty")
+	// Verify that the tokens are not empty
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Error("tokens should not be empty")
+	}
+	// Verify that only the hash of the refresh token is stored
+	var stored db.RefreshToken
+	result := testModule.dbClient.Where("user_id = ?", createdUser.ID).First(&stored)
+	if result.Error != nil {
+		t.Fatalf("failed to find refresh token: %v", result.Error)
+	}
+	if stored.TokenHash != auth.HashToken(tokens.RefreshToken) {
+		t.Errorf("expected stored hash of refresh token, got %q", stored.TokenHash)
 	}
 
 	// Clean up: Delete created user
+	result = testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_RefreshToken(t *testing.T) {
+	password := "password"
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Rotator",
+		Email:    "refresh-rotation@ymail.com",
+		Password: password,
+		Name:     "Rotating Tokens",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	login, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+
+	// Using the refresh token rotates it
+	rotated, err := testModule.users.serv.RefreshToken(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh tokens: %v", err)
+	}
+	if rotated.RefreshToken == login.RefreshToken {
+		t.Errorf("expected a new refresh token")
+	}
+	if _, err := validateToken(rotated.Token); err != nil {
+		t.Errorf("expected rotated access token to be valid, got %v", err)
+	}
+
+	// Reusing the first refresh token revokes the whole family
+	_, err = testModule.users.serv.RefreshToken(login.RefreshToken)
+	if !errors.Is(err, coreservices.ErrRefreshTokenReused) {
+		t.Errorf("expected reuse to be detected, got %v", err)
+	}
+	if _, err := testModule.users.serv.RefreshToken(rotated.RefreshToken); !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected rotated refresh token to be revoked, got %v", err)
+	}
+	for _, accessToken := range []string{login.Token, rotated.Token} {
+		if _, err := validateToken(accessToken); err == nil {
+			t.Errorf("expected access token of revoked session to be rejected")
+		}
+	}
+
+	// Unknown tokens are rejected
+	if _, err := testModule.users.serv.RefreshToken("unknown"); !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected unknown refresh token to be rejected, got %v", err)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_Logout(t *testing.T) {
+	password := "password"
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Leaving",
+		Email:    "logout-session@ymail.com",
+		Password: password,
+		Name:     "Logging Out",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	// Two sessions (eg. two devices)
+	first, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	second, err := testModule.users.serv.LoginUser(&models.Login{Email: createdUser.Email, Password: password})
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	// Check the first session's access token, so its status is cached before logging out
+	if _, err := validateToken(first.Token); err != nil {
+		t.Fatalf("expected access token to be valid, got %v", err)
+	}
+
+	// Test function
+	err = testModule.users.serv.Logout(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to logout: %v", err)
+	}
+
+	// Only the first session is ended
+	if _, err := validateToken(first.Token); err == nil {
+		t.Errorf("expected access token of logged out session to be rejected")
+	}
+	if _, err := testModule.users.serv.RefreshToken(first.RefreshToken); !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected refresh token of logged out session to be rejected, got %v", err)
+	}
+	if _, err := validateToken(second.Token); err != nil {
+		t.Errorf("expected access token of other session to be valid, got %v", err)
+	}
+	if _, err := testModule.users.serv.RefreshToken(second.RefreshToken); err != nil {
+		t.Errorf("expected refresh token of other session to be valid, got %v", err)
+	}
+	if err := testModule.users.serv.Logout("unknown"); !errors.Is(err, coreservices.ErrInvalidRefreshToken) {
+		t.Errorf("expected unknown refresh token to be rejected, got %v", err)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
 	result := testModule.dbClient.Delete(createdUser)
 	if result.Error != nil {
 		t.Fatalf("failed to delete created user: %v", result.Error)
 	}
 }
 
+func TestUserService_TwoFactor(t *testing.T) {
+	password := "password"
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Second",
+		Email:    "two-factor@ymail.com",
+		Password: password,
+		Name:     "Second Factor",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	userId := int(createdUser.ID)
+	credentials := &models.Login{Email: createdUser.Email, Password: password}
+
+	// Confirming requires an enrolment
+	if _, err := testModule.users.serv.ConfirmTwoFactorEnrolment(userId, "123456"); !errors.Is(err, coreservices.ErrTwoFactorNotEnrolled) {
+		t.Errorf("expected error confirming without enrolment, got %v", err)
+	}
+
+	// Enrol
+	enrolment, err := testModule.users.serv.BeginTwoFactorEnrolment(userId)
+	if err != nil {
+		t.Fatalf("failed to start two-factor enrolment: %v", err)
+	}
+	if !strings.HasPrefix(enrolment.URI, "otpauth://totp/") || !strings.Contains(enrolment.URI, enrolment.Secret) || !strings.HasPrefix(enrolment.QRCode, "data:image/png;base64,") {
+		t.Errorf("unexpected enrolment %+v", enrolment)
+	}
+	// Starting again shows the pending secret
+	again, err := testModule.users.serv.BeginTwoFactorEnrolment(userId)
+	if err != nil || again.Secret != enrolment.Secret {
+		t.Errorf("expected pending secret to be returned again, got %v (%v)", again, err)
+	}
+	// Not enabled until confirmed
+	login, err := testModule.users.serv.LoginUser(credentials)
+	if err != nil || login.TwoFactorRequired || login.Token == "" {
+		t.Errorf("expected login without second step before confirmation, got %+v (%v)", login, err)
+	}
+
+	// Confirm
+	if _, err := testModule.users.serv.ConfirmTwoFactorEnrolment(userId, totpCode(t, enrolment.Secret, -5)); !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected invalid code to be rejected, got %v", err)
+	}
+	confirmationCode := totpCode(t, enrolment.Secret, 0)
+	recovery, err := testModule.users.serv.ConfirmTwoFactorEnrolment(userId, confirmationCode)
+	if err != nil {
+		t.Fatalf("failed to confirm two-factor enrolment: %v", err)
+	}
+	if len(recovery.RecoveryCodes) != 10 {
+		t.Errorf("expected 10 recovery codes, got %v", recovery.RecoveryCodes)
+	}
+	if _, err := testModule.users.serv.BeginTwoFactorEnrolment(userId); !errors.Is(err, coreservices.ErrTwoFactorAlreadyEnabled) {
+		t.Errorf("expected enrolment to be refused once enabled, got %v", err)
+	}
+
+	// Login requires the second step
+	login, err = testModule.users.serv.LoginUser(credentials)
+	if err != nil {
+		t.Fatalf("failed to login user: %v", err)
+	}
+	if !login.TwoFactorRequired || login.ChallengeToken == "" || login.Token != "" || login.RefreshToken != "" {
+		t.Fatalf("expected a challenge instead of tokens, got %+v", login)
+	}
+	// The confirmation code can't be used again
+	if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, confirmationCode); !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected used code to be rejected, got %v", err)
+	}
+	tokens, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, totpCode(t, enrolment.Secret, 1))
+	if err != nil {
+		t.Fatalf("failed to complete two-factor login: %v", err)
+	}
+	if _, err := validateToken(tokens.Token); err != nil || tokens.RefreshToken == "" {
+		t.Errorf("expected a valid session, got %+v (%v)", tokens, err)
+	}
+	// Challenges can only be completed once
+	if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, recovery.RecoveryCodes[1]); !errors.Is(err, coreservices.ErrInvalidTwoFactorChallenge) {
+		t.Errorf("expected completed challenge to be rejected, got %v", err)
+	}
+
+	// Recovery codes can be used once (case and separators don't matter)
+	login, _ = testModule.users.serv.LoginUser(credentials)
+	if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))); err != nil {
+		t.Errorf("expected recovery code to be accepted, got %v", err)
+	}
+	login, _ = testModule.users.serv.LoginUser(credentials)
+	if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, recovery.RecoveryCodes[0]); !errors.Is(err, coreservices.ErrInvalidTwoFactorCode) {
+		t.Errorf("expected used recovery code to be rejected, got %v", err)
+	}
+	status, err := testModule.users.serv.TwoFactorStatus(userId)
+	if err != nil || !status.Enabled || status.RecoveryCodesRemaining != 9 {
+		t.Errorf("expected two-factor authentication enabled with 9 recovery codes, got %+v (%v)", status, err)
+	}
+
+	// Too many invalid codes lock the second step (one invalid code was used above)
+	for attempt := 2; attempt <= 5; attempt++ {
+		expectedErr := coreservices.ErrInvalidTwoFactorCode
+		if attempt == 5 {
+			expectedErr = coreservices.ErrTwoFactorLocked
+		}
+		if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, "not-a-code"); !errors.Is(err, expectedErr) {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, expectedErr, err)
+		}
+	}
+	login, _ = testModule.users.serv.LoginUser(credentials)
+	if _, err := testModule.users.serv.VerifyTwoFactorLogin(login.ChallengeToken, recovery.RecoveryCodes[2]); !errors.Is(err, coreservices.ErrTwoFactorLocked) {
+		t.Errorf("expected second step to be locked, got %v", err)
+	}
+
+	// Reset removes two-factor authentication and ends the user's sessions
+	err = testModule.users.serv.ResetTwoFactor(userId)
+	if err != nil {
+		t.Fatalf("failed to reset two-factor authentication: %v", err)
+	}
+	if _, err := validateToken(tokens.Token); err == nil {
+		t.Errorf("expected session to end when two-factor authentication is reset")
+	}
+	login, err = testModule.users.serv.LoginUser(credentials)
+	if err != nil || login.TwoFactorRequired || login.Token == "" {
+		t.Errorf("expected login without second step after reset, got %+v (%v)", login, err)
+	}
+
+	// Clean up: Delete created user and tokens
+	testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_TwoFactorRequired(t *testing.T) {
+	password := "password"
+	var tests = []struct {
+		testName string
+		email    string
+		// Required using TWO_FACTOR_REQUIRED_ROLES, or else a Casbin policy
+		requiredRoles string
+	}{
+		{"Required by config", "required-by-config@ymail.com", "moderator, user"},
+		{"Required by policy", "required-by-policy@ymail.com", ""},
+	}
+	for _, v := range tests {
+		createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+			Username: "Required",
+			Email:    v.email,
+			Password: password,
+			Name:     "Two-Factor Required",
+		}, testModule.dbClient, t)
+		if err != nil {
+			t.Fatalf("failed to create test user: %v", err)
+		}
+		userId := int(createdUser.ID)
+		t.Setenv("TWO_FACTOR_REQUIRED_ROLES", v.requiredRoles)
+		if v.requiredRoles != "" {
+			app.Auth.Enforcer.AddRoleForUser(fmt.Sprint(userId), "role:user")
+		} else {
+			app.Auth.Enforcer.AddPolicy(fmt.Sprint(userId), auth.TwoFactorPolicyObject, auth.TwoFactorPolicyAction)
+		}
+
+		// Sessions only give access to the enrolment pages until two-factor authentication is set up
+		login, err := testModule.users.serv.LoginUser(&models.Login{Email: v.email, Password: password})
+		if err != nil {
+			t.Fatalf("%s: failed to login user: %v", v.testName, err)
+		}
+		claims, err := validateToken(login.Token)
+		if err != nil || !claims.TwoFactorSetupRequired {
+			t.Errorf("%s: expected access token to require two-factor setup, got %+v (%v)", v.testName, claims, err)
+		}
+		status, err := testModule.users.serv.TwoFactorStatus(userId)
+		if err != nil || !status.Required || status.Enabled {
+			t.Errorf("%s: expected two-factor authentication to be required, got %+v (%v)", v.testName, status, err)
+		}
+
+		// Once enrolled, refreshing lifts the restriction
+		enrolment, err := testModule.users.serv.BeginTwoFactorEnrolment(userId)
+		if err != nil {
+			t.Fatalf("%s: failed to start two-factor enrolment: %v", v.testName, err)
+		}
+		if _, err := testModule.users.serv.ConfirmTwoFactorEnrolment(userId, totpCode(t, enrolment.Secret, 0)); err != nil {
+			t.Fatalf("%s: failed to confirm two-factor enrolment: %v", v.testName, err)
+		}
+		refreshed, err := testModule.users.serv.RefreshToken(login.RefreshToken)
+		if err != nil {
+			t.Fatalf("%s: failed to refresh tokens: %v", v.testName, err)
+		}
+		claims, err = validateToken(refreshed.Token)
+		if err != nil || claims.TwoFactorSetupRequired {
+			t.Errorf("%s: expected access token without two-factor restriction, got %+v (%v)", v.testName, claims, err)
+		}
+
+		// Clean up: Delete policies, created user and tokens
+		app.Auth.Enforcer.DeleteRolesForUser(fmt.Sprint(userId))
+		app.Auth.Enforcer.RemovePolicy(fmt.Sprint(userId), auth.TwoFactorPolicyObject, auth.TwoFactorPolicyAction)
+		testModule.users.serv.ResetTwoFactor(userId)
+		testModule.dbClient.Where("user_id = ?", createdUser.ID).Delete(&db.RefreshToken{})
+		result := testModule.dbClient.Delete(createdUser)
+		if result.Error != nil {
+			t.Fatalf("failed to delete created user: %v", result.Error)
+		}
+	}
+}
+
+// Returns the code of a TOTP secret, a number of time steps from now
+func totpCode(t *testing.T, secret string, steps int64) string {
+	code, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now())+steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// Validates an access token as sent in the Authorization header
+func validateToken(accessToken string) (*auth.AuthToken, error) {
+	request := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	request.Header.Set("Authorization", "Bearer "+accessToken)
+	return auth.ValidateAndParseToken(request)
+}
+
 func TestUserService_CheckPasswordMatch(t *testing.T) {
 	// Create test user
 	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
@@ -439,9 +961,132 @@ func TestUserService_ResendVerificationEmail(t *testing.T) {
 		t.Fatalf("failed to resend email verification: %v", err)
 	}
 
+	// Verification emails should be sent on the high priority queue
+	emailJobs := findEmailJobs(createdUser.Email)
+	if len(emailJobs) != 1 {
+		t.Fatalf("expected 1 verification email job, got %d", len(emailJobs))
+	}
+	job := emailJobs[0]
+	if job.Queue != queue.HighPriorityQueue || job.Priority != queue.PriorityHigh {
+		t.Errorf("expected email job on queue %s with priority %d, got %s with priority %d", queue.HighPriorityQueue, queue.PriorityHigh, job.Queue, job.Priority)
+	}
+
+	// The email should have been sent
+	if job.Status != db.JobStatusProcessed {
+		t.Errorf("expected email job to be processed, got status %s", job.Status)
+	}
+
+	// The email should contain the stored verification code
+	storedUser := db.User{}
+	testModule.dbClient.First(&storedUser, createdUser.ID)
+	sent := testModule.mail.SentTo(createdUser.Email)
+	if storedUser.VerificationCode == "" || len(sent) != 1 || !strings.Contains(sent[0].HTMLBody, storedUser.VerificationCode) {
+		t.Errorf("expected email to contain the stored verification code")
+	}
+	// The code shouldn't be kept in the processed job
+	if strings.Contains(job.Payload, storedUser.VerificationCode) || !strings.Contains(job.Payload, queue.RedactedValue) {
+		t.Errorf("expected email body to be redacted from the processed job, got %s", job.Payload)
+	}
+
+	// Resending within the window shouldn't queue another email or change the code
+	err = testModule.users.serv.ResendVerificationEmail(int(createdUser.ID))
+	if err != nil {
+		t.Fatalf("failed to resend email verification: %v", err)
+	}
+	if count := len(findEmailJobs(createdUser.Email)); count != 1 {
+		t.Errorf("expected 1 verification email job, got %d", count)
+	}
+	resentUser := db.User{}
+	testModule.dbClient.First(&resentUser, createdUser.ID)
+	if resentUser.VerificationCode != storedUser.VerificationCode {
+		t.Errorf("expected verification code to be unchanged")
+	}
+
+	// If the email can't be queued, the previous code is kept and the new one isn't stored
+	failingService := coreservices.NewUserService(testModule.users.repo, testModule.auth.repo, corerepositories.NewRefreshTokenRepository(testModule.dbClient), corerepositories.NewTwoFactorRepository(testModule.dbClient), &failingJobQueue{JobQueue: testModule.jobQueue})
+	if err := failingService.ResendVerificationEmail(int(createdUser.ID)); err == nil {
+		t.Errorf("expected an error when the email can't be queued")
+	}
+	failedUser := db.User{}
+	testModule.dbClient.First(&failedUser, createdUser.ID)
+	if failedUser.VerificationCode != storedUser.VerificationCode {
+		t.Errorf("expected previous verification code to be kept")
+	}
+	// Users without a previous code are left without one
+	testModule.dbClient.Model(&db.User{}).Where("id = ?", createdUser.ID).Updates(map[string]interface{}{"verification_code": nil, "verification_code_expiry": nil})
+	if err := failingService.ResendVerificationEmail(int(createdUser.ID)); err == nil {
+		t.Errorf("expected an error when the email can't be queued")
+	}
+	failedUser = db.User{}
+	testModule.dbClient.First(&failedUser, createdUser.ID)
+	if failedUser.VerificationCode != "" {
+		t.Errorf("expected no verification code to be stored, got %q", failedUser.VerificationCode)
+	}
+
+	// Clean up: Delete created user
+	result := testModule.dbClient.Delete(createdUser)
+	if result.Error != nil {
+		t.Fatalf("failed to delete created user: %v", result.Error)
+	}
+}
+
+func TestUserService_ResendVerificationEmailInUserLanguage(t *testing.T) {
+	// Create test user
+	createdUser, err := helpers.HashPassAndGenerateUserInDb(&db.User{
+		Username: "Idioma",
+		Email:    "idioma@ymail.com",
+		Password: "password",
+		Name:     "Ana Lucia",
+		Language: "es-MX",
+	}, testModule.dbClient, t)
+	if err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	// Test function
+	err = testModule.users.serv.ResendVerificationEmail(int(createdUser.ID))
+	if err != nil {
+		t.Fatalf("failed to resend email verification: %v", err)
+	}
+
+	// The email should be rendered in the user's language with a plain text alternative
+	emailJobs := findEmailJobs(createdUser.Email)
+	if len(emailJobs) != 1 {
+		t.Fatalf("expected 1 verification email job, got %d", len(emailJobs))
+	}
+	var payload queue.EmailJobPayload
+	if err := json.Unmarshal([]byte(emailJobs[0].Payload), &payload); err != nil {
+		t.Fatalf("failed to decode email payload: %v", err)
+	}
+	if payload.Template != email.EmailVerificationTemplate {
+		t.Errorf("expected template %q to be recorded, got %q", email.EmailVerificationTemplate, payload.Template)
+	}
+	sent := testModule.mail.SentTo(createdUser.Email)
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 verification email to be sent, got %d", len(sent))
+	}
+	message := sent[0]
+	if message.Subject != "Verifica tu correo electrónico" {
+		t.Errorf("expected Spanish subject, got %q", message.Subject)
+	}
+	if !strings.Contains(message.TextBody, "Hola Ana Lucia") || !strings.Contains(message.HTMLBody, "Hola Ana Lucia") {
+		t.Errorf("expected Spanish HTML and text bodies, got %q and %q", message.HTMLBody, message.TextBody)
+	}
+
 	// Clean up: Delete created user
 	result := testModule.dbClient.Delete(createdUser)
 	if result.Error != nil {
 		t.Fatalf("failed to delete created user: %v", result.Error)
 	}
 }
+
+// Finds the email jobs added to the test job queue for a recipient
+func findEmailJobs(recipient string) []db.Job {
+	jobs := []db.Job{}
+	for _, job := range testModule.jobQueue.JobsOfType(queue.EmailJobType) {
+		if strings.Contains(job.Payload, recipient) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
@@ -94,6 +94,24 @@ async function commitMultiAction(event, schemaHomeUrl) {
     }
   }
 
+  // Otherwise, post the selected items to the bulk action url (eg. /bulk-retry)
+  else if (bulkAction) {
+    response = await bulkActionSelectedItems(
+      selectedItems,
+      schemaHomeUrl + "/bulk-" + bulkAction
+    );
+    if (!response) {
+      alert("Bulk " + bulkAction + " failed.");
+      // Change button status to failed
+      actionSubmitButton.value = "Failed";
+      actionSubmitButton.disabled = true;
+
+      // Uncheck checkboxes
+      uncheckCheckboxes(htmlSelectedCheckboxes);
+      return;
+    }
+  }
+
   // Uncheck checkboxes
   uncheckCheckboxes(htmlSelectedCheckboxes);
   // Once complete, Reload the page
@@ -129,6 +147,37 @@ async function bulkDeleteSelectedItems(selectedItems, schemaDeleteUrl) {
   }
 }
 
+// Apply a bulk action (eg. retry) to the selected items (returns fail)
+async function bulkActionSelectedItems(selectedItems, schemaActionUrl) {
+  try {
+    // Convert the selectedItems array to JSON
+    selectedItemsJson = JSON.stringify({ selected_items: selectedItems });
+    // Send a POST request to the server
+    const response = await fetch(schemaActionUrl, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: selectedItemsJson,
+    });
+
+    // If the response is not ok, then throw an error
+    if (!response.ok) {
+      return false;
+    }
+    // Else convert json response to data
+    const data = await response.json();
+    // Treat unsuccessful responses as failures
+    if (!data.success) {
+      return false;
+    }
+    return data;
+  } catch (error) {
+    console.error("Error:", error);
+    return false;
+  }
+}
+
 // Takes a NodeList of checkboxes and unchecks them all
 function uncheckCheckboxes(checkedBoxes) {
   // Iterate through the NodeList of checked checkboxes